@@ -0,0 +1,83 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// IE: a package of the tree nothing was published for in a while, whichever
+// of its versions the tree has
+type abandonedPackage struct {
+	Name        string    `json:"name"`
+	Versions    []string  `json:"versions"`
+	LastPublish time.Time `json:"lastPublish"`
+	// IE: since the last publish, in whole days
+	Days int `json:"days"`
+}
+
+// IE: the configured threshold unless ?abandonedAfter= (a duration, i.e. 8760h)
+// replaces it
+func requestAbandonedAfter(query url.Values) (time.Duration, error) {
+	value := strings.TrimSpace(query.Get("abandonedAfter"))
+	if value == "" {
+		return opts.abandonedAfter, nil
+	}
+	after, err := time.ParseDuration(value)
+	if err != nil || after <= 0 {
+		return 0, fmt.Errorf("%w: abandonedAfter must be a positive duration, got %q", ErrInvalidQuery, value)
+	}
+	return after, nil
+}
+
+// IE: longest abandoned first. The packuments without publish dates (i.e.
+// from a CDN) have nothing to tell, they are left out
+func abandonedSection(ctx context.Context, tree *NpmPackageVersion, query url.Values, report *treeReport) error {
+	after, err := requestAbandonedAfter(query)
+	if err != nil {
+		return err
+	}
+	versions := make(map[string][]string)
+	for _, pkg := range uniqueVersions(tree) {
+		versions[pkg.Name] = append(versions[pkg.Name], pkg.Version)
+	}
+
+	now := time.Now()
+	var mu sync.Mutex
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(live().concurrency, 1))
+	for name := range versions {
+		g.Go(func() error {
+			meta, err := fetchPackageMeta(gctx, name)
+			if err != nil {
+				return fmt.Errorf("fetching package meta for %s: %w", name, err)
+			}
+			last := meta.lastPublish()
+			if last.IsZero() || now.Sub(last) < after {
+				return nil
+			}
+			abandoned := abandonedPackage{Name: name, Versions: versions[name], LastPublish: last, Days: int(now.Sub(last) / (24 * time.Hour))}
+			sortVersions(abandoned.Versions)
+			mu.Lock()
+			report.Abandoned = append(report.Abandoned, abandoned)
+			mu.Unlock()
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	sort.Slice(report.Abandoned, func(i, j int) bool {
+		if !report.Abandoned[i].LastPublish.Equal(report.Abandoned[j].LastPublish) {
+			return report.Abandoned[i].LastPublish.Before(report.Abandoned[j].LastPublish)
+		}
+		return report.Abandoned[i].Name < report.Abandoned[j].Name
+	})
+	return nil
+}
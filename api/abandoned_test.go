@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/snyk/snyk-code-review-exercise/internal/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAbandonedPackages(t *testing.T) {
+	packages := fixtures.Registry{
+		"app":   {"1.0.0": {"old": "^1.0.0", "older": "^1.0.0", "fresh": "^1.0.0"}},
+		"old":   {"1.0.0": {"older": "^2.0.0"}},
+		"older": {"1.0.0": nil, "2.0.0": nil},
+		"fresh": {"1.0.0": nil, "2.0.0": nil},
+	}
+	registry := maintainedRegistry(t, packages, map[string]map[string]int{
+		"app":   {"1.0.0": 10},
+		"old":   {"1.0.0": 4 * 365},
+		"older": {"1.0.0": 8 * 365, "2.0.0": 6 * 365},
+		// IE: the version of the tree is old, the package isn't
+		"fresh": {"1.0.0": 6 * 365, "2.0.0": 30},
+	}, nil)
+	handler := New(WithRegistryURL(registry.URL))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0/report?sections=abandoned", nil))
+	report := decodeReport(t, rec)
+	require.Len(t, report.Abandoned, 2)
+	assert.Equal(t, "older", report.Abandoned[0].Name)
+	assert.Equal(t, []string{"1.0.0", "2.0.0"}, report.Abandoned[0].Versions)
+	assert.InDelta(t, 6*365, report.Abandoned[0].Days, 1)
+	assert.Equal(t, "old", report.Abandoned[1].Name)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0/report?sections=abandoned&abandonedAfter=48h", nil))
+	assert.Len(t, decodeReport(t, rec).Abandoned, 4)
+
+	handler = New(WithRegistryURL(registry.URL), WithAbandonedAfter(5*365*24*time.Hour))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0/report?sections=abandoned", nil))
+	assert.Len(t, decodeReport(t, rec).Abandoned, 1)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0/report?sections=abandoned&abandonedAfter=3y", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
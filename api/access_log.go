@@ -0,0 +1,167 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Access log formats accepted by WithAccessLog.
+const (
+	// AccessLogCombined is the Apache/nginx combined log format, followed by the latency in seconds.
+	AccessLogCombined = "combined"
+	// AccessLogJSON writes one JSON object per request.
+	AccessLogJSON = "json"
+)
+
+// IE: the combined format wants the Apache timestamp layout
+const combinedTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+type accessLogEntry struct {
+	Time      time.Time `json:"time"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Query     string    `json:"query,omitempty"`
+	Protocol  string    `json:"protocol"`
+	Status    int       `json:"status"`
+	Bytes     int64     `json:"bytes"`
+	LatencyMs float64   `json:"latencyMs"`
+	ClientIP  string    `json:"clientIp"`
+	UserAgent string    `json:"userAgent,omitempty"`
+	Referer   string    `json:"referer,omitempty"`
+	RequestID string    `json:"requestId,omitempty"`
+}
+
+// IE: one line per request, apart from the logs of the resolver, so it can go
+// to its own file or pipeline. Lines are written whole under the lock, the
+// requests are served concurrently
+type accessLogger struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format string
+}
+
+func newAccessLogger(w io.Writer, format string) (*accessLogger, error) {
+	if w == nil {
+		return nil, nil
+	}
+	if format != AccessLogCombined && format != AccessLogJSON {
+		return nil, fmt.Errorf("unknown access log format %q, expected %s or %s", format, AccessLogCombined, AccessLogJSON)
+	}
+	return &accessLogger{w: w, format: format}, nil
+}
+
+func logAccess(next http.Handler, l *accessLogger) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		l.write(accessLogEntry{
+			Time:      start,
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Query:     r.URL.RawQuery,
+			Protocol:  r.Proto,
+			Status:    rec.status,
+			Bytes:     rec.bytes,
+			LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+			ClientIP:  clientIP(r),
+			UserAgent: r.UserAgent(),
+			Referer:   r.Referer(),
+			RequestID: requestIDFrom(r.Context()),
+		})
+	})
+}
+
+func (l *accessLogger) write(entry accessLogEntry) {
+	var line []byte
+	if l.format == AccessLogJSON {
+		line, _ = json.Marshal(entry)
+		line = append(line, '\n')
+	} else {
+		line = []byte(combinedLine(entry))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.w.Write(line); err != nil {
+		logger.Error("Could not write access log", "error", err)
+	}
+}
+
+// IE: %h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-agent}i", then the
+// latency like nginx's $request_time
+func combinedLine(entry accessLogEntry) string {
+	target := entry.Path
+	if entry.Query != "" {
+		target += "?" + entry.Query
+	}
+	size := "-"
+	if entry.Bytes > 0 {
+		size = strconv.FormatInt(entry.Bytes, 10)
+	}
+	return fmt.Sprintf("%s - - [%s] %s %d %s %s %s %.3f\n",
+		entry.ClientIP, entry.Time.Format(combinedTimeLayout),
+		strconv.Quote(entry.Method+" "+target+" "+entry.Protocol), entry.Status, size,
+		quoteOrDash(entry.Referer), quoteOrDash(entry.UserAgent), entry.LatencyMs/1000)
+}
+
+// IE: quoted so a client can't forge log lines through its headers
+func quoteOrDash(value string) string {
+	if value == "" {
+		return `"-"`
+	}
+	return strconv.Quote(value)
+}
+
+// IE: the peer address, proxies in front aren't trusted for X-Forwarded-For
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// IE: keeps the status and size of the response for the access log and the
+// request span, flushes still go through for the NDJSON streams
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status, w.wroteHeader = status, true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *statusRecorder) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.wroteHeader = true
+		flusher.Flush()
+	}
+}
+
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessLogCombined(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{
+		"a": {"1.0.0": nil},
+	})
+	var buf bytes.Buffer
+	handler := New(WithRegistryURL(registry.URL), WithAccessLog(&buf, AccessLogCombined))
+
+	req := httptest.NewRequest("GET", "/package/a/1.0.0?format=json", nil)
+	req.RemoteAddr = "192.0.2.10:51234"
+	req.Header.Set("User-Agent", `curl/8.0 "forged"`)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/missing/1.0.0", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 2)
+	combined := regexp.MustCompile(`^192\.0\.2\.10 - - \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /package/a/1\.0\.0\?format=json HTTP/1\.1" 200 \d+ "-" "curl/8\.0 \\"forged\\"" \d+\.\d{3}$`)
+	assert.Regexp(t, combined, lines[0])
+	assert.Contains(t, lines[1], `"GET /package/missing/1.0.0 HTTP/1.1" 404 `)
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{
+		"a": {"1.0.0": nil},
+	})
+	var buf bytes.Buffer
+	handler := New(WithRegistryURL(registry.URL), WithAccessLog(&buf, AccessLogJSON))
+
+	req := httptest.NewRequest("GET", "/package/a/1.0.0?format=ndjson", nil)
+	req.Header.Set(requestIDHeader, "trace-me")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var entry accessLogEntry
+	require.Nil(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "GET", entry.Method)
+	assert.Equal(t, "/package/a/1.0.0", entry.Path)
+	assert.Equal(t, "format=ndjson", entry.Query)
+	assert.Equal(t, http.StatusOK, entry.Status)
+	assert.Equal(t, int64(rec.Body.Len()), entry.Bytes)
+	assert.Equal(t, "192.0.2.1", entry.ClientIP)
+	assert.Equal(t, "trace-me", entry.RequestID)
+	assert.WithinDuration(t, time.Now(), entry.Time, time.Minute)
+}
+
+func TestAccessLogIsOffByDefault(t *testing.T) {
+	access, err := newAccessLogger(nil, AccessLogCombined)
+	assert.Nil(t, err)
+	assert.Nil(t, access)
+
+	_, err = newAccessLogger(&bytes.Buffer{}, "common")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"net/http"
+	"net/http/pprof"
+)
+
+// AdminHandler serves the operator endpoints that must not be reachable by
+// API clients, i.e. the pprof profiles under /debug/pprof/, the schedule of
+// the precomputed trees under /debug/precompute, the progress of the
+// resolutions in flight under /debug/resolutions, the runtime state of the
+// process under /debug/status and the feature flags under /debug/features.
+// POST /debug/reload reloads the settings, see WithReloader, and
+// /debug/drain drains the replica, see Drain, i.e. from a preStop hook. Serve
+// it on a separate, non public, address.
+func AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	// IE: registered by hand, importing net/http/pprof for its side effects would expose them on http.DefaultServeMux
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/precompute", precomputeHandler)
+	mux.HandleFunc("/debug/resolutions", resolutionsHandler)
+	mux.HandleFunc("/debug/status", debugStatusHandler)
+	mux.HandleFunc("/debug/features", featuresHandler)
+	mux.HandleFunc("/debug/reload", reloadHandler)
+	mux.HandleFunc("/debug/drain", drainHandler)
+	return mux
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// VulnerabilitySourceNPM looks the advisories of the resolved versions up in
+// the bulk advisory endpoint of the registry, see WithVulnerabilitySource.
+const VulnerabilitySourceNPM = "npm"
+
+// Advisory is a security advisory affecting a resolved version.
+type Advisory struct {
+	ID int64 `json:"id"`
+	// IE: low, moderate, high or critical
+	Severity string `json:"severity"`
+	Title    string `json:"title,omitempty"`
+	URL      string `json:"url,omitempty"`
+}
+
+type npmAdvisory struct {
+	Advisory
+	VulnerableVersions string `json:"vulnerable_versions"`
+}
+
+// IE: the registry answers every advisory of the package for any of the
+// versions asked, the ones of each version are told apart here, like npm audit
+// does
+func fetchAdvisories(ctx context.Context, versions map[string][]string) (map[string][]Advisory, error) {
+	body, err := json.Marshal(versions)
+	if err != nil {
+		return nil, err
+	}
+	url := live().registryURL + "/-/npm/v1/security/advisories/bulk"
+	resp, err := httpPost(ctx, url, body)
+	if err != nil {
+		return nil, upstreamError(ctx, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: unexpected status %d for %s", ErrRegistryUnavailable, resp.StatusCode, url)
+	}
+
+	var listing map[string][]npmAdvisory
+	if err := json.NewDecoder(resp.Body).Decode(&listing); err != nil {
+		return nil, err
+	}
+	affected := make(map[string][]Advisory)
+	for name, advisories := range listing {
+		for _, advisory := range advisories {
+			constraint, err := semver.NewConstraint(advisory.VulnerableVersions)
+			if err != nil {
+				loggerFrom(ctx).Debug("Skipping advisory", "id", advisory.ID, "vulnerable_versions", advisory.VulnerableVersions, "error", err)
+				continue
+			}
+			for _, version := range versions[name] {
+				if parsed, err := semver.NewVersion(version); err == nil && constraint.Check(parsed) {
+					affected[name+"@"+version] = append(affected[name+"@"+version], advisory.Advisory)
+				}
+			}
+		}
+	}
+	for _, advisories := range affected {
+		sort.Slice(advisories, func(i, j int) bool { return advisories[i].ID < advisories[j].ID })
+	}
+	return affected, nil
+}
+
+// IE: a single call for the whole tree once it's resolved, the cached subtrees
+// it reuses included. A failing lookup only gets logged, the tree is still right
+func annotateAdvisories(ctx context.Context, root *NpmPackageVersion) {
+	if opts.vulnerabilitySource == "" {
+		return
+	}
+
+	var nodes []*NpmPackageVersion
+	versions := make(map[string][]string)
+	listed := make(map[string]bool)
+	visited := map[*NpmPackageVersion]bool{root: true}
+	stack := []*NpmPackageVersion{root}
+	for len(stack) > 0 {
+		pkg := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		nodes = append(nodes, pkg)
+		if key := pkg.Name + "@" + pkg.Version; !listed[key] {
+			listed[key] = true
+			versions[pkg.Name] = append(versions[pkg.Name], pkg.Version)
+		}
+		for _, dep := range pkg.Dependencies {
+			if dep != nil && !visited[dep] {
+				visited[dep] = true
+				stack = append(stack, dep)
+			}
+		}
+	}
+
+	affected, err := fetchAdvisories(ctx, versions)
+	if err != nil {
+		loggerFrom(ctx).Error("Could not look the advisories up", "source", opts.vulnerabilitySource, "error", err)
+		return
+	}
+	for _, pkg := range nodes {
+		pkg.Advisories = affected[pkg.Name+"@"+pkg.Version]
+	}
+}
+
+// IE: the ids of the nodes written for a version
+type streamedVersion struct {
+	name    string
+	version string
+	ids     []uint64
+}
+
+// IE: called with the stream locked
+func (s *nodeStream) record(pkg *NpmPackageVersion, id uint64) {
+	key := pkg.Name + "@" + pkg.Version
+	node, found := s.versions[key]
+	if !found {
+		if s.versions == nil {
+			s.versions = make(map[string]*streamedVersion)
+		}
+		node = &streamedVersion{name: pkg.Name, version: pkg.Version}
+		s.versions[key] = node
+		s.nodes = append(s.nodes, node)
+	}
+	node.ids = append(node.ids, id)
+}
+
+// IE: the nodes are long written by then, the advisories come as lines of
+// their own referring to them by id
+func (s *nodeStream) writeAdvisories(ctx context.Context) error {
+	s.mu.Lock()
+	nodes := s.nodes
+	s.mu.Unlock()
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	versions := make(map[string][]string)
+	for _, node := range nodes {
+		versions[node.name] = append(versions[node.name], node.version)
+	}
+	affected, err := fetchAdvisories(ctx, versions)
+	if err != nil {
+		loggerFrom(ctx).Error("Could not look the advisories up", "source", opts.vulnerabilitySource, "error", err)
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, node := range nodes {
+		advisories := affected[node.name+"@"+node.version]
+		if len(advisories) == 0 {
+			continue
+		}
+		for _, id := range node.ids {
+			line := struct {
+				Node       uint64     `json:"node"`
+				Advisories []Advisory `json:"advisories"`
+			}{id, advisories}
+			if err := s.enc.Encode(line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/snyk/snyk-code-review-exercise/internal/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// IE: the advisories of the bulk endpoint for every package, whatever the
+// versions asked, like the registry answers
+func advisoryRegistry(t *testing.T, packages fixtures.Registry, advisories string) (*httptest.Server, *map[string][]string) {
+	var asked map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/-/npm/v1/security/advisories/bulk" {
+			packages.ServeHTTP(w, r)
+			return
+		}
+		if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&asked) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, advisories)
+	}))
+	t.Cleanup(server.Close)
+	return server, &asked
+}
+
+func TestAdvisories(t *testing.T) {
+	registry, asked := advisoryRegistry(t, fixtures.Registry{
+		"app":      {"1.0.0": {"minimist": "^1.2.0", "mkdirp": "^0.5.0"}},
+		"mkdirp":   {"0.5.1": {"minimist": "0.0.8"}},
+		"minimist": {"0.0.8": nil, "1.2.5": nil},
+	}, `{"minimist": [
+		{"id": 1179, "severity": "moderate", "title": "Prototype Pollution in minimist", "vulnerable_versions": "<0.2.1 || >=1.0.0 <1.2.3"},
+		{"id": 1097678, "severity": "critical", "title": "Prototype Pollution in minimist", "url": "https://github.com/advisories/GHSA-xvch-5gv4-984h", "vulnerable_versions": "<0.2.4 || >=1.0.0 <1.2.6"},
+		{"id": 1, "severity": "low", "vulnerable_versions": "not a range"}
+	]}`)
+	handler := New(WithRegistryURL(registry.URL), WithVulnerabilitySource(VulnerabilitySourceNPM))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	sort.Strings((*asked)["minimist"])
+	assert.Equal(t, map[string][]string{"app": {"1.0.0"}, "mkdirp": {"0.5.1"}, "minimist": {"0.0.8", "1.2.5"}}, *asked)
+
+	var tree NpmPackageVersion
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &tree))
+	assert.Empty(t, tree.Advisories)
+	assert.Empty(t, tree.Dependencies["mkdirp"].Advisories)
+	assert.Equal(t, []Advisory{
+		{ID: 1097678, Severity: "critical", Title: "Prototype Pollution in minimist", URL: "https://github.com/advisories/GHSA-xvch-5gv4-984h"},
+	}, tree.Dependencies["minimist"].Advisories)
+	old := tree.Dependencies["mkdirp"].Dependencies["minimist"].Advisories
+	require.Len(t, old, 2)
+	assert.Equal(t, []int64{1179, 1097678}, []int64{old[0].ID, old[1].ID})
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/mkdirp/0.5.1?format=ndjson", nil))
+	lines := readNDJSON(t, rec.Body.String())
+	require.Len(t, lines, 3)
+	assert.Equal(t, "minimist", lines[1]["name"])
+	assert.Equal(t, lines[1]["id"], lines[2]["node"])
+	assert.Len(t, lines[2]["advisories"], 2)
+}
+
+func TestAdvisoriesUnavailable(t *testing.T) {
+	registry := newFakeRegistry(t, fixtures.Registry{"app": {"1.0.0": nil}})
+	handler := New(WithRegistryURL(registry.URL), WithVulnerabilitySource(VulnerabilitySourceNPM))
+
+	// IE: the fixtures answer 404 to the bulk endpoint
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "advisories")
+}
@@ -4,25 +4,36 @@ package api
 // IE: for example create api_handler.go (New() + packageHandler()) and dependency_resolver.go (rest of funcs)
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
-	"sort"
 	"strings"
-	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Masterminds/semver/v3"
-	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 type npmPackageMetaResponse struct {
 	Versions map[string]npmPackageResponse `json:"versions"`
+	DistTags map[string]string             `json:"dist-tags,omitempty"`
+	Time     publishTimes                  `json:"time,omitempty"`
+	// IE: see maintainerName
+	Maintainers []json.RawMessage `json:"maintainers,omitempty"`
 }
 
 // IE: why expose NpmPackageVersion outside the api package if we are only using api.New() ???
@@ -48,338 +59,757 @@ type npmPackageResponse struct {
 	Name         string            `json:"name"`
 	Version      string            `json:"version"`
 	Dependencies map[string]string `json:"dependencies"`
+	// IE: not resolved, see upgradeSection
+	PeerDependencies map[string]string `json:"peerDependencies,omitempty"`
+	Dist             npmDist           `json:"dist"`
+	License          spdxLicense       `json:"license,omitempty"`
+	// IE: the license of old packages, see license()
+	Licenses []spdxLicense `json:"licenses,omitempty"`
+	// IE: the message npm prints, see deprecationNotice
+	Deprecated deprecationNotice `json:"deprecated,omitempty"`
+	Scripts    map[string]string `json:"scripts,omitempty"`
+	// IE: see nativeAddon
+	GypFile bool `json:"gypfile,omitempty"`
+	// IE: see moduleFormat
+	Type    string          `json:"type,omitempty"`
+	Main    string          `json:"main,omitempty"`
+	Exports json.RawMessage `json:"exports,omitempty"`
+	Engines engineRanges    `json:"engines,omitempty"`
 }
 
 type NpmPackageVersion struct {
 	Name         string                        `json:"name" deepcopier:"field:Name"`
 	Version      string                        `json:"version"  deepcopier:"field:Version"`
 	Dependencies map[string]*NpmPackageVersion `json:"dependencies" deepcopier:"field:Dependencies"`
-	sync.RWMutex `deepcopier:"skip"`
+	Tarball      *TarballInfo                  `json:"tarball,omitempty" deepcopier:"skip"`
+	// IE: only ever set on the root, see WithMaxNodes
+	Partial bool `json:"partial,omitempty" deepcopier:"skip"`
+	// IE: why the package policy doesn't let the node in, see WithPackagePolicy
+	Policy string `json:"policy,omitempty" deepcopier:"skip"`
+	// IE: one of the Provenance constants, see WithProvenanceVerification
+	Provenance string `json:"provenance,omitempty" deepcopier:"skip"`
+	// IE: the popular package the name is suspiciously close to, see WithTyposquatCheck
+	Typosquat string `json:"typosquat,omitempty" deepcopier:"skip"`
+	// IE: the install hooks the version declares, see installScripts
+	InstallScripts []string `json:"installScripts,omitempty" deepcopier:"skip"`
+	// IE: what gives the native addon away, see nativeAddon
+	Native string `json:"native,omitempty" deepcopier:"skip"`
+	// IE: see WithVulnerabilitySource
+	Advisories []Advisory `json:"advisories,omitempty" deepcopier:"skip"`
+	// IE: with ?maintenance=true
+	Maintenance *MaintenanceScore `json:"maintenance,omitempty" deepcopier:"skip"`
+	// IE: only ever set on the root, with ?stats=true
+	Stats *TreeStats `json:"stats,omitempty" deepcopier:"skip"`
 }
 
-// IE: use log for logging instead of simple Println for extra features (i.e. timestamp)
-var errorLogger *log.Logger
-var debugLogger *log.Logger
+// IE: cache serialized responses for instant response on repeated identical requests
+var responseCache Cache
 
-// IE: use a WaitGroup to process each recursive resolveDependencies() request asynchronously
-var wg sync.WaitGroup
+// IE: the resolved subtrees reused across requests, bounded on their own so
+// the many nodes of a large tree can't evict the full responses
+var subtreeCache Cache
 
-// IE: cache the last request for instant response on repeated identical requests
-var lastRequest map[string][]byte
+var metricsRegistry *prometheus.Registry
 
-// IE: debug counter for start/end resolveDependencies()
-var goroutineCount WaitGroupCount
+// Configure sets the resolver up with optFns, caches and upstream limits
+// included, without any route. The settings are those of the whole process:
+// New configures it again, and so does the resolver package.
+func Configure(optFns ...Option) {
+	opts = defaultOptions()
+	for _, o := range optFns {
+		o(&opts)
+	}
 
-var rootPkg *NpmPackageVersion
+	// IE: structured so log pipelines can parse it, the levels below the configured one are dropped
+	logger = opts.logger
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(os.Stdout, nil))
+	}
+	logSampling = newLogSampler(opts.logSampleFirst, opts.logSampleThereafter, opts.logSampleInterval)
+	logger = sampledLogger(logger, logSampling)
 
-var scannedPkgs map[string]*NpmPackageVersion
-var scannedPkgsMutex = sync.RWMutex{}
+	logger.Debug("Decoding registry documents", "codec", jsonCodec)
 
-var copiedDeps map[string]string
+	tracerProvider := opts.tracerProvider
+	if tracerProvider == nil {
+		tracerProvider = noop.NewTracerProvider()
+	}
+	tracer = tracerProvider.Tracer(tracerName)
+
+	settings.Store(liveSettingsOf(&opts))
+	drainStart.Store(nil)
+	resetRegistryKeys()
+	upstreamLimiter = newAdaptiveLimiter(opts.upstreamLimit)
+
+	authenticator = newJWTAuthenticator(opts.authIssuer, opts.authAudience, opts.authJWKSURL)
+	rateLimits = newRateLimiter(opts.rateLimit, opts.rateBurst, opts.clientRateLimits)
+	addressFilter = newIPFilter(opts.allowCIDRs, opts.denyCIDRs)
+	typosquats = newTyposquatDetector(opts.typosquatList, opts.typosquatDistance)
+	corsRules = newCORSPolicy(opts.corsOrigins, opts.corsMethods, opts.corsHeaders, opts.corsMaxAge)
+
+	// IE: own registry instead of the global one, New() may be called more than once (i.e. tests)
+	metricsRegistry = prometheus.NewRegistry()
+	metricsRegistry.MustRegister(cacheCollector{})
+	registerUpstreamMetrics(metricsRegistry)
+	registerLogMetrics(metricsRegistry)
+	registerRateLimitMetrics(metricsRegistry)
+
+	if errorHub != nil {
+		errorHub.Flush(time.Second)
+	}
+	var err error
+	if auditSink != nil {
+		auditSink.Close()
+	}
+	auditSink, err = newAuditWriter(opts.auditLog)
+	if err != nil {
+		logger.Error("Could not open the audit log, resolutions aren't audited", "target", opts.auditLog, "error", err)
+		auditSink = nil
+	}
 
-func New() http.Handler {
-	// IE: use log for logging instead of fmt for extra features (i.e. timestamp)
-	errorLogger = log.New(os.Stdout, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
-	debugLogger = log.New(os.Stdout, "DEBUG: ", log.Ldate|log.Ltime|log.Lshortfile)
+	if history != nil {
+		history.Close()
+		history = nil
+	}
+	if opts.historyPath != "" {
+		store, err := openHistoryStore(opts.historyPath, opts.historyRetention)
+		if err != nil {
+			logger.Error("Could not open the resolution history, resolutions aren't kept", "path", opts.historyPath, "error", err)
+		} else {
+			history = store
+		}
+	}
 
-	// IE: in case we need to limit resource CPU Load
-	// runtime.GOMAXPROCS(runtime.NumCPU() * 0.75)
-	goroutineCount = WaitGroupCount{}
+	errorHub, err = newErrorHub(opts.errorTrackingDSN, opts.errorTrackingEnvironment, opts.errorTrackingTransport)
+	if err != nil {
+		logger.Error("Could not set up error tracking", "error", err)
+	}
 
-	router := mux.NewRouter()
-	router.Handle("/package/{package}/{version}", http.HandlerFunc(packageHandler))
+	if statsdSink != nil {
+		statsdSink.Close()
+		statsdSink = nil
+	}
+	if sink, err := newStatsdEmitter(opts.statsdAddress, opts.statsdFormat, opts.statsdInterval, metricsRegistry); err != nil {
+		logger.Error("Could not set up statsd metrics, only /metrics serves them", "address", opts.statsdAddress, "error", err)
+	} else {
+		statsdSink = sink
+	}
+
+	// IE: cache serialized responses for instant response on repeated identical requests
+	responseCache, packumentCache, err = newCaches(opts)
+	cacheSetupErr = err
+	if err != nil {
+		logger.Error("Could not set up cache, falling back on in-memory caches", "backend", opts.cacheBackend, "error", err)
+		responseCache, packumentCache = newMemoryCaches(opts)
+	}
+
+	parsedVersionsCache = newVersionsCache(parsedVersionsCapacity)
+	selectionCache = newShardedCache(selectionCacheSize, selectionCacheBytes, opts.cacheShards)
+	lastSelections = newShardedCache(selectionCacheSize, selectionCacheBytes, opts.cacheShards)
+	subtreeCache = newShardedCache(opts.subtreeSize, opts.subtreeBytes, opts.cacheShards)
+
+	if opts.snapshotPath != "" {
+		if err := restoreCaches(opts.snapshotPath); err != nil {
+			logger.Error("Could not restore cache snapshot", "path", opts.snapshotPath, "error", err)
+		}
+	}
 
-	// IE: cache the last request for instant response on repeated identical requests
-	lastRequest = make(map[string][]byte)
+	if invalidations != nil {
+		invalidations.Close()
+		invalidations = nil
+	}
+	if opts.invalidationURL != "" {
+		bus, err := newInvalidationBus(opts.invalidationURL)
+		if err != nil {
+			logger.Error("Could not subscribe to cache invalidations, purges stay local", "error", err)
+		} else {
+			invalidations = bus
+		}
+	}
 
-	scannedPkgs = make(map[string]*NpmPackageVersion)
-	copiedDeps = make(map[string]string)
+	if precomputeJob != nil {
+		precomputeJob.Close()
+	}
+	precomputeJob = newPrecomputer(opts.precomputeTop, opts.precomputeInterval)
 
-	return router
+	if opts.warmupList != "" {
+		entries, err := loadWarmupList(opts.warmupList)
+		if err != nil {
+			logger.Error("Could not load warm-up list", "path", opts.warmupList, "error", err)
+		} else {
+			go warmCache(entries)
+		}
+	}
+}
+
+func New(optFns ...Option) http.Handler {
+	Configure(optFns...)
+
+	router := mux.NewRouter()
+	// IE: one limit shared by the routes, they are the same resource
+	resolve := auditResolutions(authenticate(identifyClient(limitRate(limitInFlight(http.HandlerFunc(resolvingHandler), func() int { return live().maxInFlight })))))
+	router.Handle("/package/{package}/{version}", resolve)
+	// IE: same resource, don't make clients care about trailing slashes
+	router.Handle("/package/{package}/{version}/", resolve)
+	router.Handle("/package/{package}/{version}/report", resolve).Name(reportRoute)
+	router.Handle("/drift", resolve).Methods(http.MethodPost).Name(driftRoute)
+	router.Handle("/trend/{package}", resolve).Methods(http.MethodGet).Name(trendRoute)
+	// IE: the kubelet probes the serving port, the admin one may be off
+	router.Handle("/healthz", http.HandlerFunc(healthzHandler))
+	router.Handle("/readyz", http.HandlerFunc(readyzHandler))
+	router.Handle("/cache/stats", authenticate(http.HandlerFunc(cacheStatsHandler)))
+	router.Handle("/cache/entries", authenticate(http.HandlerFunc(cacheEntriesHandler))).Methods(http.MethodGet)
+	router.Handle("/cache/purge/{package}", authenticate(http.HandlerFunc(purgeHandler))).Methods(http.MethodPost)
+
+	router.Handle("/metrics", promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+	if history != nil {
+		router.Handle("/history/common", authenticate(http.HandlerFunc(commonPackagesHandler))).Methods(http.MethodGet)
+		router.Handle("/history/{package}/{version}", authenticate(http.HandlerFunc(historyHandler))).Methods(http.MethodGet)
+	}
+
+	access, err := newAccessLogger(opts.accessLog, opts.accessLogFormat)
+	if err != nil {
+		logger.Error("Could not set up the access log", "error", err)
+	}
+	return closeWhileDraining(traceRequests(withRequestID(logAccess(trackErrors(filterAddresses(requireClientCertificate(withCORS(limitInput(requestFeatures(withDeadline(router, opts.requestTimeout))))))), access))))
 }
 
 func packageHandler(w http.ResponseWriter, r *http.Request) {
 	// IE: start timestamp for debugging purposes
 	start := time.Now()
 
-	var toWrite []byte
-	if cached, found := lastRequest[r.RequestURI]; found {
-		// IE: request is identical to previous one, return from cached response
-		toWrite = cached
-	} else {
-		vars := mux.Vars(r)
-
-		// IE: someone might use this func at some point with bad params
-		// IE: check for 'package' and 'version' presence in the 'vars' map
-		pkgName, ok := vars["package"]
-		if !ok {
-			errorLogger.Println("Package name not found:", r.RequestURI)
-			return
-		}
-		pkgVersion, ok := vars["version"]
-		if !ok {
-			errorLogger.Println("Package version not found:", r.RequestURI)
-			return
-		}
-
-		// IE: NpmPackageVersion also has a 'version' attribute, should pass 'pkgVersion' into rootPkg
-		newEmptyDeps := make(map[string]*NpmPackageVersion)
-		newEmptyDeps[uuid.NewString()] = nil
-		rootPkg = &NpmPackageVersion{Name: pkgName, Version: pkgVersion, Dependencies: newEmptyDeps}
+	vars := mux.Vars(r)
 
-		// IE: send task to WaitGroup to perform it asynchronously, new goroutine for each dependency found
-		wg.Add(1)
-		go resolveDependencies(rootPkg, pkgVersion)
-		wg.Wait()
+	// IE: someone might use this func at some point with bad params
+	// IE: check for 'package' and 'version' presence in the 'vars' map
+	pkgName, ok := vars["package"]
+	if !ok {
+		logger.Error("Package name not found", "uri", r.RequestURI)
+		return
+	}
+	pkgVersion, ok := vars["version"]
+	if !ok {
+		logger.Error("Package version not found", "uri", r.RequestURI)
+		return
+	}
 
-		debugLogger.Println("Changing node names...")
+	log := requestLogger(r, pkgName, pkgVersion)
+	r = r.WithContext(withLogger(r.Context(), log))
+	if err := checkPackageInput(pkgName, pkgVersion); err != nil {
+		httpError(w, r, err)
+		return
+	}
+	tracePackageRequest(r.Context(), pkgName, pkgVersion)
+	tagErrors(r.Context(), r, pkgName, pkgVersion)
 
-		for k := range copiedDeps {
-			delete(copiedDeps, k)
-		}
-		changeNodeNames(rootPkg)
+	format, err := requestFormat(r.URL.Query())
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	if format == formatNDJSON {
+		ndjsonHandler(w, r, pkgName, pkgVersion, start)
+		return
+	}
+	if _, found := treeExports[format]; found {
+		exportHandler(w, r, pkgName, pkgVersion, format, start)
+		return
+	}
+	if format == formatJSON && featuresFrom(r.Context()).enabled(FeatureDAGOutput) {
+		dagHandler(w, r, pkgName, pkgVersion, start)
+		return
+	}
 
-		stringified, err := json.MarshalIndent(rootPkg, "", "  ")
-		if err != nil {
-			// IE: use log for logging instead of fmt for extra features (i.e. timestamp)
-			errorLogger.Println(err.Error())
-			w.WriteHeader(500)
-			return
-		}
-		toWrite = stringified
-		lastRequest[r.RequestURI] = stringified
+	ctx, stats := requestResolutionStats(r.Context())
+	tree, err := cachedTree(ctx, pkgName, pkgVersion, r.URL.Query())
+	if err != nil {
+		writeResolveError(w, r, err)
+		return
+	}
+	if tree.root == nil {
+		recordCachedResolution(pkgVersion, r.URL.Query(), nil, tree.cached)
+	}
+	if treeVariant(r.URL.Query()) == "" {
+		precomputeJob.record(pkgName, pkgVersion)
 	}
 
+	trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("cache.status", tree.status))
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache-Status", tree.status)
+	w.Header().Set("Trailer", resolutionStatsHeader)
+	if tree.root != nil && tree.root.Partial {
+		w.Header().Set("X-Partial-Tree", "true")
+	}
 	w.WriteHeader(200)
 
-	debugLogger.Println("Writing json...")
-	// Ignoring ResponseWriter errors
-	_, _ = w.Write(toWrite)
+	log.Debug("Writing json")
+	if _, err := tree.WriteTo(w); err != nil {
+		log.Debug("Could not write response", "error", err)
+	}
+	w.Header().Set(resolutionStatsHeader, stats.snapshot().String())
 
 	// IE: log time spent retrieving full dependency tree for each request
-	debugLogger.Println("Request for", r.RequestURI, "completed in", (time.Since(start)))
-
-	goroutineCount.Done()
+	log.Info("Request completed", "duration", time.Since(start), "cache", tree.status, "partial", tree.root != nil && tree.root.Partial)
 }
 
-// IE: need to send each package retrieval on a separate thread
-func resolveDependencies(pkg *NpmPackageVersion, versionConstraint string) {
-	// IE: signal that the goroutine is done to WaitGroup before each goroutine ends
-	defer wg.Done()
-
-	// IE: debug counter
-	goroutineCount.Add(1)
-	debugLogger.Println("Starting goroutine", goroutineCount.GetCount())
-
-	pkgMeta, err := fetchPackageMeta(pkg.Name)
-	if err != nil {
-		// IE: log the error
-		errorLogger.Println("Could not fetch package meta for", pkg.Name)
+func writeResolveError(w http.ResponseWriter, r *http.Request, err error) {
+	// IE: client went away, nobody left to answer
+	if errors.Is(r.Context().Err(), context.Canceled) {
 		return
 	}
-	concreteVersion, err := highestCompatibleVersion(versionConstraint, pkgMeta)
-	if err != nil {
-		// IE: log the error
-		errorLogger.Println("Could not find highest compatible version for", pkg.Name)
+	if errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+		loggerFrom(r.Context()).Error("Request timed out", "error", err)
+		reportResolveError(r.Context(), err, errTimeout.Status)
+		auditError(r.Context(), err)
+		httpError(w, r, errTimeout)
 		return
 	}
-	pkg.Version = concreteVersion
+	loggerFrom(r.Context()).Error("Could not resolve tree", "error", err)
+	reportResolveError(r.Context(), err, classifyError(err).Status)
+	auditError(r.Context(), err)
+	httpError(w, r, err)
+}
 
-	npmPkg, err := fetchPackage(pkg.Name, pkg.Version)
-	if err != nil {
-		// IE: log the error
-		errorLogger.Println("Could not fetch package dependency", pkg.Name, "version", pkg.Version)
-		return
+// IE: the first package failing to resolve fails the whole tree, a partial tree
+// would be served (and cached) as if it was complete otherwise
+func resolveTree(ctx context.Context, pkgName, pkgVersion string, maxDepth int) (*NpmPackageVersion, error) {
+	// IE: NpmPackageVersion also has a 'version' attribute, should pass 'pkgVersion' into rootPkg
+	rootPkg := newNode(pkgName, pkgVersion)
+
+	// IE: returns once the whole tree is resolved by the bounded pool of workers
+	r := newResolver(maxDepth)
+	if err := r.run(ctx, &resolveTask{pkg: rootPkg, constraint: pkgVersion}, live().concurrency); err != nil {
+		releaseTree(rootPkg)
+		return nil, err
 	}
+	rootPkg.Partial = r.exhausted()
+	annotateAdvisories(ctx, rootPkg)
 
-	// IE: need some sort of protection against circular dependencies
-	// i.e. trucolor 4.0.4 cannot be retrieved, npmjs eventually closes the connection and sends GOAWAY
-	for dependencyName, dependencyVersionConstraint := range npmPkg.Dependencies {
+	return rootPkg, nil
+}
 
-		// IE: get dependencies for nodes already scanned, NOT WORKING ATM
-		var cachedDeps, emptyNpmPackageVersion NpmPackageVersion
-		getCachedDeps(dependencyName, dependencyVersionConstraint, rootPkg, &cachedDeps)
-		if cachedDeps.Name != emptyNpmPackageVersion.Name && cachedDeps.Version != emptyNpmPackageVersion.Version {
-			pkg.Dependencies = cachedDeps.Dependencies
-		} else {
-			newEmptyDeps := make(map[string]*NpmPackageVersion)
-			dep := &NpmPackageVersion{Name: dependencyName, Version: dependencyVersionConstraint, Dependencies: newEmptyDeps}
-
-			pkg.Dependencies[uuid.NewString()] = dep
-			if len(pkg.Dependencies) > 0 {
-				// IE: send each each package dependency retrieval on a new goroutine
-				wg.Add(1)
-				go resolveDependencies(dep, dependencyVersionConstraint)
-			}
+// Resolve answers the tree of name at the highest version constraint accepts,
+// the way the package route would (cache, depth limit and policies included),
+// for the programs embedding the resolver, see Configure. The tree belongs to
+// the caller, the nodes of a name@version appearing more than once may be
+// shared. Failures are the same as the route's, i.e. ErrNoCompatibleVersion.
+func Resolve(ctx context.Context, name, constraint string) (*NpmPackageVersion, error) {
+	if err := checkPackageInput(name, constraint); err != nil {
+		return nil, err
+	}
+	tree, release, _, err := loadTree(ctx, name, constraint, url.Values{})
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return detachTree(tree, make(map[*NpmPackageVersion]*NpmPackageVersion)), nil
+}
 
+// IE: a copy out of the node pool, shared nodes staying shared
+func detachTree(pkg *NpmPackageVersion, copies map[*NpmPackageVersion]*NpmPackageVersion) *NpmPackageVersion {
+	if copied, found := copies[pkg]; found {
+		return copied
+	}
+	copied := &NpmPackageVersion{}
+	*copied = *pkg
+	copies[pkg] = copied
+	if pkg.Dependencies != nil {
+		copied.Dependencies = make(map[string]*NpmPackageVersion, len(pkg.Dependencies))
+		for name, dep := range pkg.Dependencies {
+			if dep != nil {
+				copied.Dependencies[name] = detachTree(dep, copies)
+			} else {
+				copied.Dependencies[name] = nil
+			}
 		}
 	}
+	return copied
+}
 
-	// IE: debug counter
-	debugLogger.Println("Ending goroutine", goroutineCount.GetCount())
-	goroutineCount.Add(-1)
+// IE: resolves a single node and returns its dependencies as new tasks
+// IE: ancestors holds the name@version of every node above pkg, a dependency
+// already in there is a cycle and is left unresolved, and the subtree is then
+// reported as truncated so it doesn't get reused where the cycle doesn't apply.
+// Nodes at maxDepth are cut the same way
+func (r *resolver) resolveDependencies(ctx context.Context, task *resolveTask) ([]*resolveTask, error) {
+	pkg := task.pkg
 
-	scannedPkgsMutex.Lock()
-	scannedPkgs[fmt.Sprintf("%s%s", pkg.Name, pkg.Version)] = pkg
-	scannedPkgsMutex.Unlock()
+	// IE: debug counter
+	log := loggerFrom(ctx)
+	log.Debug("Starting task", "in-flight", atomic.AddInt64(&r.stats.inFlight, 1))
+	defer func() {
+		// IE: debug counter
+		log.Debug("Ending task", "in-flight", atomic.LoadInt64(&r.stats.inFlight))
+		atomic.AddInt64(&r.stats.inFlight, -1)
+	}()
+
+	if negativelyCached(negativeVersionKey(pkg.Name, task.constraint)) {
+		return nil, fmt.Errorf("%w: %s@%s (cached)", ErrNoCompatibleVersion, pkg.Name, task.constraint)
+	}
 
-	debugLogger.Println("Scanned package", fmt.Sprintf("%s%s", pkg.Name, pkg.Version))
-}
+	pkgMeta, err := fetchPackageMeta(ctx, pkg.Name)
+	if err != nil {
+		return nil, fmt.Errorf("fetching package meta for %s: %w", pkg.Name, err)
+	}
+	concreteVersion, err := r.selectVersion(pkg.Name, task.constraint, pkgMeta)
+	if err != nil {
+		if errors.Is(err, ErrNoCompatibleVersion) {
+			cacheNegative(negativeVersionKey(pkg.Name, task.constraint))
+		}
+		if task.parent == nil && errors.Is(err, errInvalidRange) {
+			return nil, fmt.Errorf("%w: version %q of %s: %w", errInvalidPackage, task.constraint, pkg.Name, err)
+		}
+		return nil, fmt.Errorf("%s@%s: %w", pkg.Name, task.constraint, err)
+	}
+	pkg.Version = concreteVersion
+	if err := r.enforcePolicy(pkg); err != nil {
+		return nil, err
+	}
+	r.flagTyposquat(pkg)
 
-// IE: this func should be checking asynchronously if a certain package
-// has already been scanned for dependency during current request and would return that node
-// so that its dependencies could be simply copied to another tree level where that dependency resides
-func getCachedDeps(name string, version string, curNode *NpmPackageVersion, cachedDeps *NpmPackageVersion) {
-	scannedPkgsMutex.RLock()
-	cachedPkg, exist := scannedPkgs[fmt.Sprintf("%s%s", name, strings.Trim(version, "^"))]
-	scannedPkgsMutex.RUnlock()
+	key := pkg.Name + "@" + pkg.Version
+	if task.ancestors[key] {
+		log.Debug("Circular dependency", "node", key, "code", ErrCycleDetected.Code)
+		atomic.StoreInt32(&task.truncated, 1)
+		return nil, r.emit(task, true)
+	}
+	if r.maxDepth > 0 && task.depth >= r.maxDepth {
+		atomic.StoreInt32(&task.truncated, 1)
+		return nil, r.emit(task, true)
+	}
 
-	if exist {
-		*cachedDeps = *cachedPkg
+	// IE: same name@version already resolved, during this request or a previous one
+	// IE: full subtrees would go past the depth limit, don't reuse them under one
+	if r.maxDepth == 0 {
+		if cached, found := r.getCachedDeps(key); found {
+			if r.stream != nil {
+				var parent uint64
+				if task.parent != nil {
+					parent = task.parent.id
+				}
+				return nil, r.stream.writeSubtree(parent, cached)
+			}
+			// IE: copied rather than shared, every node owns its map so it can go back to the pool
+			for name, dep := range cached.Dependencies {
+				pkg.Dependencies[name] = dep
+			}
+			pkg.Tarball = cached.Tarball
+			pkg.Provenance = cached.Provenance
+			pkg.InstallScripts = cached.InstallScripts
+			pkg.Native = cached.Native
+			return nil, nil
+		}
+	}
 
-		debugLogger.Println("Found duplicate: ", cachedPkg.Name, cachedPkg.Version)
+	npmPkg, err := fetchPackage(ctx, pkg.Name, pkg.Version)
+	if err != nil {
+		return nil, fmt.Errorf("fetching package %s: %w", key, err)
+	}
+	task.key = key
+	pkg.InstallScripts = installScripts(npmPkg)
+	pkg.Native = nativeAddon(npmPkg)
 
-		return
+	// IE: verification failures only get logged, the tree itself is still right
+	if opts.verifyTarballs {
+		tarball, err := verifyTarball(ctx, npmPkg.Dist)
+		if err != nil {
+			log.Error("Could not verify tarball", "node", key, "error", err)
+		} else {
+			if !tarball.Verified {
+				log.Error("Integrity mismatch", "node", key, "tarball", tarball.URL)
+			}
+			pkg.Tarball = tarball
+		}
+	}
+	if opts.verifyProvenance {
+		provenance, err := verifyProvenance(ctx, pkg.Name, pkg.Version, npmPkg.Dist)
+		switch {
+		case errors.Is(err, errProvenanceMismatch):
+			log.Error("Provenance mismatch", "node", key, "error", err)
+			pkg.Provenance = provenance
+		case err != nil:
+			log.Error("Could not verify provenance", "node", key, "error", err)
+		default:
+			pkg.Provenance = provenance
+		}
 	}
-}
 
-func copyDeps(src *NpmPackageVersion, dest *NpmPackageVersion) {
-	if src.Dependencies == nil || len(src.Dependencies) == 0 {
-		return
+	if !r.reserveNodes(len(npmPkg.Dependencies)) {
+		log.Debug("Node budget exhausted, not expanding", "node", key)
+		atomic.StoreInt32(&task.truncated, 1)
+		return nil, r.emit(task, true)
+	}
+	if err := r.emit(task, false); err != nil {
+		return nil, err
 	}
 
-	newEmptyDeps := make(map[string]*NpmPackageVersion)
-	dest = &NpmPackageVersion{Name: src.Name, Version: src.Version, Dependencies: newEmptyDeps}
+	childAncestors := make(map[string]bool, len(task.ancestors)+1)
+	for ancestor := range task.ancestors {
+		childAncestors[ancestor] = true
+	}
+	childAncestors[key] = true
 
-	for k, dep := range src.Dependencies {
-		if dep != nil {
-			newEmptyDeps := make(map[string]*NpmPackageVersion)
-			curNode := &NpmPackageVersion{Name: dep.Name, Version: dep.Version, Dependencies: newEmptyDeps}
-			copyDeps(dep, curNode)
-			dest.Dependencies[k] = curNode
+	// IE: the dependencies map is complete before any child is queued, so no locking needed
+	defer r.prefetch(ctx, task.depth+1, npmPkg.Dependencies)
+	children := make([]*resolveTask, 0, len(npmPkg.Dependencies))
+	for dependencyName, dependencyVersionConstraint := range npmPkg.Dependencies {
+		dep := newNode(dependencyName, dependencyVersionConstraint)
+		if r.stream == nil {
+			pkg.Dependencies[dependencyName] = dep
 		}
+		children = append(children, &resolveTask{pkg: dep, constraint: dependencyVersionConstraint, ancestors: childAncestors, parent: task, depth: task.depth + 1})
 	}
+	return children, nil
 }
 
-func changeNodeNames(node *NpmPackageVersion) {
-	if node.Dependencies == nil || len(node.Dependencies) == 0 {
-		debugLogger.Println("no more deps")
-		return
+// IE: looks up an already resolved name@version, first among the nodes of the
+// current request (shared as is) then in the subtree cache (across requests)
+func (r *resolver) getCachedDeps(key string) (*NpmPackageVersion, bool) {
+	if cachedPkg, exist := r.scanned.Load(key); exist {
+		r.log.Debug("Found duplicate", "node", key)
+		return cachedPkg.(*NpmPackageVersion), true
 	}
 
-	debugLogger.Println("retrieving deps for", node.Name, node.Version)
-	for nodeName, dep := range node.Dependencies {
-		node.set(uuid.NewString(), dep)
-		node.delete(nodeName)
+	if !r.features.enabled(FeatureSubtreeCache) {
+		return nil, false
+	}
+	var subtree NpmPackageVersion
+	if cachedJSON(subtreeCache, subtreeKeyPrefix+key+opts.packagePolicy.cacheSuffix(), &subtree) {
+		r.log.Debug("Found cached subtree", "node", key)
 
-		if dep != nil {
-			if _, ok := copiedDeps[dep.Name+dep.Version]; !ok {
-				copiedDeps[dep.Name+dep.Version] = dep.Version
-				changeNodeNames(dep)
-			} else {
-				dep.Dependencies = map[string]*NpmPackageVersion{}
-			}
-		}
+		r.scanned.Store(key, &subtree)
+		return &subtree, true
 	}
-}
 
-func (r *NpmPackageVersion) get(key string) *NpmPackageVersion {
-	r.RLock()
-	defer r.RUnlock()
-	return r.Dependencies[key]
+	return nil, false
 }
 
-func (r *NpmPackageVersion) set(key string, value *NpmPackageVersion) {
-	r.Lock()
-	defer r.Unlock()
-	r.Dependencies[key] = value
-}
+// IE: only fully resolved subtrees end up here, keyed by their concrete version
+func (r *resolver) cacheDeps(key string, pkg *NpmPackageVersion) {
+	r.scanned.Store(key, pkg)
 
-func (r *NpmPackageVersion) delete(key string) {
-	r.Lock()
-	defer r.Unlock()
-	delete(r.Dependencies, key)
+	if r.features.enabled(FeatureSubtreeCache) {
+		cacheJSON(subtreeCache, subtreeKeyPrefix+key+opts.packagePolicy.cacheSuffix(), pkg)
+	}
 }
 
-func highestCompatibleVersion(constraintStr string, versions *npmPackageMetaResponse) (string, error) {
+// IE: the versions are already sorted, the first one matching from the top is the highest
+// IE: a constraint that doesn't parse. The client's fault when it asked for it,
+// the registry's when a published document has it, see resolveDependencies
+var errInvalidRange = errors.New("invalid range")
+
+// IE: a dist-tag (i.e. latest, next) is the version it points at, as long as
+// it's published. Tags can't parse as ranges, so they never shadow one
+func highestCompatibleVersion(name, constraintStr string, versions *npmPackageMetaResponse) (string, error) {
+	if versions != nil {
+		if tagged, found := versions.DistTags[strings.TrimSpace(constraintStr)]; found {
+			if _, published := versions.Versions[tagged]; published {
+				return tagged, nil
+			}
+			return "", fmt.Errorf("%w: dist-tag %s points at unpublished %s", ErrNoCompatibleVersion, constraintStr, tagged)
+		}
+	}
 	constraint, err := semver.NewConstraint(constraintStr)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("%w: %w", errInvalidRange, err)
 	}
 	if versions == nil {
-		errorLogger.Println("nil versions for ")
+		logger.Error("No versions in packument", "name", name)
+		return "", ErrNoCompatibleVersion
 	}
-	filtered := filterCompatibleVersions(constraint, versions)
 
-	// IE: why sort then compare len to 0 instead of the other way around?
-	if len(filtered) == 0 {
-		return "", errors.New("no compatible versions found")
+	sorted := parsedVersionsCache.sortedVersions(name, versions)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		if constraint.Check(sorted[i]) {
+			return sorted[i].String(), nil
+		}
 	}
+	return "", ErrNoCompatibleVersion
+}
 
-	sort.Sort(filtered)
+// IE: version is always concrete here, so the document is immutable and cached for long
+func fetchPackage(ctx context.Context, name, version string) (_ *npmPackageResponse, err error) {
+	ctx, span := tracer.Start(ctx, "fetch version document", trace.WithAttributes(
+		attribute.String("package.name", name), attribute.String("package.version", version)))
+	defer func() { endSpan(span, err) }()
 
-	return filtered[len(filtered)-1].String(), nil
-}
+	if cached, found := cachedPackage(name, version); found {
+		span.SetAttributes(attribute.Bool("cache.hit", true))
+		return cached, nil
+	}
+	span.SetAttributes(attribute.Bool("cache.hit", false))
 
-func filterCompatibleVersions(constraint *semver.Constraints, pkgMeta *npmPackageMetaResponse) semver.Collection {
-	var compatible semver.Collection
-	for version := range pkgMeta.Versions {
-		semVer, err := semver.NewVersion(version)
-		if err != nil {
-			continue
-		}
-		if constraint.Check(semVer) {
-			compatible = append(compatible, semVer)
-		}
+	shared, err := sharedFetch(ctx, &packageFlights, name+"@"+version, func() (interface{}, error) {
+		return loadPackage(ctx, name, version)
+	})
+	if err != nil {
+		return nil, err
 	}
-	return compatible
+	return shared.(*npmPackageResponse), nil
 }
 
-func fetchPackage(name, version string) (*npmPackageResponse, error) {
-	resp, err := http.Get(fmt.Sprintf("https://registry.npmjs.org/%s/%s", name, version))
+func loadPackage(ctx context.Context, name, version string) (*npmPackageResponse, error) {
+	parsed, err := fetchRegistryPackage(ctx, name, version)
+	if err != nil && ctx.Err() == nil && opts.cdnFallback {
+		loggerFrom(ctx).Warn("Registry failed, falling back on unpkg", "name", name, "version", version, "error", err)
+		parsed, err = fetchUnpkgPackage(ctx, name, version)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	// IE: I would honestly close the stream right after io.ReadAll
-	defer resp.Body.Close()
+	cachePackage(name, version, parsed)
+	return parsed, nil
+}
 
-	body, err := io.ReadAll(resp.Body)
+func fetchRegistryPackage(ctx context.Context, name, version string) (*npmPackageResponse, error) {
+	body, err := registry().Version(ctx, name, version)
 	if err != nil {
-		// IE: log the error
-		errorLogger.Println("Could not read response body for package", name, "version", version)
 		return nil, err
 	}
 
 	var parsed npmPackageResponse
-	_ = json.Unmarshal(body, &parsed)
+	_ = decodeJSON(body, &parsed)
 	return &parsed, nil
 }
 
-func fetchPackageMeta(p string) (*npmPackageMetaResponse, error) {
-	resp, err := http.Get(fmt.Sprintf("https://registry.npmjs.org/%s", p))
+func fetchPackageMeta(ctx context.Context, p string) (_ *npmPackageMetaResponse, err error) {
+	ctx, span := tracer.Start(ctx, "fetch packument", trace.WithAttributes(attribute.String("package.name", p)))
+	defer func() { endSpan(span, err) }()
+
+	if cached, found := cachedPackageMeta(p); found {
+		span.SetAttributes(attribute.Bool("cache.hit", true))
+		return cached, nil
+	}
+	if negativelyCached(negativePackumentKey(p)) {
+		span.SetAttributes(attribute.Bool("cache.hit", true))
+		return nil, ErrPackageNotFound
+	}
+	span.SetAttributes(attribute.Bool("cache.hit", false))
+
+	shared, err := sharedFetch(ctx, &packumentFlights, p, func() (interface{}, error) {
+		return loadPackageMeta(ctx, p)
+	})
 	if err != nil {
-		// IE: log the error
-		errorLogger.Println("Failed call on https://registry.npmjs.org/", p, err)
 		return nil, err
 	}
+	return shared.(*npmPackageMetaResponse), nil
+}
 
-	// IE: I would honestly close the stream right after io.ReadAll
-	defer resp.Body.Close()
+func loadPackageMeta(ctx context.Context, p string) (*npmPackageMetaResponse, error) {
+	parsed, err := fetchRegistryPackageMeta(ctx, p)
+	if err != nil && ctx.Err() == nil && opts.cdnFallback {
+		loggerFrom(ctx).Warn("Registry failed, falling back on jsDelivr", "name", p, "error", err)
+		parsed, err = fetchJsdelivrPackageMeta(ctx, p)
+	}
+	if err != nil {
+		if errors.Is(err, ErrPackageNotFound) {
+			cacheNegative(negativePackumentKey(p))
+		}
+		return nil, err
+	}
+
+	cachePackageMeta(p, parsed)
+	return parsed, nil
+}
 
-	body, err := io.ReadAll(resp.Body)
+func fetchRegistryPackageMeta(ctx context.Context, p string) (*npmPackageMetaResponse, error) {
+	body, err := registry().Packument(ctx, p)
 	if err != nil {
-		// IE: log the error
-		errorLogger.Println("Could not read package meta for package", p, resp.Body, err)
 		return nil, err
 	}
 
 	var parsed npmPackageMetaResponse
 	// IE: no need to convert to byte slice since 'body' is already returned as []byte from io.ReadAll
-	if err := json.Unmarshal([]byte(body), &parsed); err != nil {
+	if err := decodeJSON(body, &parsed); err != nil {
 		return nil, err
 	}
 
 	return &parsed, nil
 }
+
+// IE: every upstream call goes through here so a failed tree cancels the calls
+// still in flight, and the upstream limits (of the tree and the shared adaptive one) apply.
+// Throttled calls are retried after backing off, without holding their slots meanwhile
+func httpGet(ctx context.Context, url string) (*http.Response, error) {
+	return httpCall(ctx, http.MethodGet, url, nil)
+}
+
+// IE: the body is sent again on a retry, hence the bytes rather than a reader
+func httpPost(ctx context.Context, url string, body []byte) (*http.Response, error) {
+	return httpCall(ctx, http.MethodPost, url, body)
+}
+
+func httpCall(ctx context.Context, method, url string, body []byte) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := httpCallOnce(ctx, method, url, body)
+		if attempt == throttleRetries || !isThrottled(resp, err) {
+			return resp, err
+		}
+
+		wait := throttleWait(resp, attempt)
+		if resp != nil {
+			resp.Body.Close()
+		}
+		loggerFrom(ctx).Debug("Throttled, retrying", "url", url, "wait", wait)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// IE: the span starts before the upstream slots are acquired, waiting for them is part of what makes a resolution slow
+func httpCallOnce(ctx context.Context, method, url string, body []byte) (_ *http.Response, err error) {
+	ctx, span := tracer.Start(ctx, method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("http.request.method", method), attribute.String("url.full", url)))
+	defer func() { endSpan(span, err) }()
+
+	releaseTree, err := acquireUpstream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	releaseShared, err := upstreamLimiter.acquire(ctx)
+	if err != nil {
+		releaseTree()
+		return nil, err
+	}
+	release := func() {
+		releaseShared()
+		releaseTree()
+	}
+	span.AddEvent("upstream slot acquired")
+
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err == nil {
+		err = checkUpstreamURL(req.URL)
+	}
+	if err == nil && body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if err == nil {
+		err = authorizeRegistryCall(ctx, req)
+	}
+	if err != nil {
+		release()
+		return nil, err
+	}
+	propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	countUpstreamCall(ctx)
+	resp, err := upstreamClient.Do(req)
+	throttled := isThrottled(resp, err)
+	upstreamLimiter.observe(throttled)
+	span.SetAttributes(attribute.Bool("upstream.throttled", throttled))
+	if err != nil {
+		release()
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
@@ -0,0 +1,302 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// IE: values of the outcome of an audit record
+const (
+	auditOutcomeOK        = "ok"
+	auditOutcomePartial   = "partial"
+	auditOutcomeRejected  = "rejected"
+	auditOutcomeError     = "error"
+	auditOutcomeCancelled = "cancelled"
+)
+
+// IE: the HTTP sink posts what it has every interval, or as soon as a batch is full
+const (
+	auditBatchSize     = 100
+	auditFlushInterval = time.Second
+	// IE: past it, while the endpoint is down, records are dropped rather than
+	// piling up in memory, and counted
+	auditQueueSize = 10000
+)
+
+// IE: nil unless WithAuditLog is set, replaced by every New()
+var auditSink auditWriter
+
+// IE: one per resolution request, whatever its outcome, i.e. rejected ones too
+type auditRecord struct {
+	Time          time.Time `json:"time"`
+	RequestID     string    `json:"requestId,omitempty"`
+	Client        string    `json:"client"`
+	Subject       string    `json:"subject,omitempty"`
+	Package       string    `json:"package"`
+	Version       string    `json:"version"`
+	Query         string    `json:"query,omitempty"`
+	Status        int       `json:"status"`
+	Outcome       string    `json:"outcome"`
+	Error         string    `json:"error,omitempty"`
+	Cache         string    `json:"cache,omitempty"`
+	DurationMs    float64   `json:"durationMs"`
+	Nodes         int64     `json:"nodes"`
+	UpstreamCalls int64     `json:"upstreamCalls"`
+}
+
+type auditWriter interface {
+	write(record auditRecord)
+	// IE: sends whatever is still pending
+	flush() error
+	Close() error
+}
+
+// IE: a path, or an http(s) url the records are posted to as NDJSON
+func newAuditWriter(target string) (auditWriter, error) {
+	if target == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		return newHTTPAuditWriter(target, auditFlushInterval), nil
+	}
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &fileAuditWriter{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+// IE: a record per line, written whole under the lock
+type fileAuditWriter struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+func (w *fileAuditWriter) write(record auditRecord) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.enc.Encode(record); err != nil {
+		logger.Error("Could not write audit record", "error", err)
+	}
+}
+
+func (w *fileAuditWriter) flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.f.Sync()
+}
+
+func (w *fileAuditWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.f.Close()
+}
+
+// IE: the requests don't wait on the audit endpoint, records are queued and
+// posted in batches from a goroutine of its own
+type httpAuditWriter struct {
+	url    string
+	client *http.Client
+
+	mu      sync.Mutex
+	pending []auditRecord
+	dropped atomic.Uint64
+	// IE: wakes the loop up once a batch is full
+	full chan struct{}
+
+	// IE: flushes come from the loop and from FlushAuditLog, one at a time so
+	// the records are posted in order
+	flushMu sync.Mutex
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newHTTPAuditWriter(url string, interval time.Duration) *httpAuditWriter {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &httpAuditWriter{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+		full:   make(chan struct{}, 1),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go w.loop(ctx, interval)
+	return w
+}
+
+func (w *httpAuditWriter) write(record auditRecord) {
+	w.mu.Lock()
+	if len(w.pending) >= auditQueueSize {
+		w.mu.Unlock()
+		w.dropped.Add(1)
+		logger.Error("Audit queue full, dropping record", "endpoint", w.url, "dropped", w.dropped.Load())
+		return
+	}
+	w.pending = append(w.pending, record)
+	full := len(w.pending) >= auditBatchSize
+	w.mu.Unlock()
+
+	if full {
+		select {
+		case w.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (w *httpAuditWriter) loop(ctx context.Context, interval time.Duration) {
+	defer close(w.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.full:
+		case <-ticker.C:
+		}
+		if err := w.flush(); err != nil {
+			logger.Error("Could not send audit records", "endpoint", w.url, "error", err)
+		}
+	}
+}
+
+// IE: posted without the lock, the requests keep queueing meanwhile. A failed
+// batch goes back in front of the queue for the next flush
+func (w *httpAuditWriter) flush() error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	w.mu.Lock()
+	batch := w.pending
+	w.pending = nil
+	w.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+
+	err := w.post(batch)
+	if err != nil {
+		w.mu.Lock()
+		w.pending = append(batch, w.pending...)
+		if len(w.pending) > auditQueueSize {
+			w.dropped.Add(uint64(len(w.pending) - auditQueueSize))
+			w.pending = w.pending[len(w.pending)-auditQueueSize:]
+		}
+		w.mu.Unlock()
+	}
+	return err
+}
+
+func (w *httpAuditWriter) post(batch []auditRecord) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, record := range batch {
+		if err := enc.Encode(record); err != nil {
+			return err
+		}
+	}
+	resp, err := w.client.Post(w.url, "application/x-ndjson", &body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("audit endpoint answered %s", resp.Status)
+	}
+	return nil
+}
+
+func (w *httpAuditWriter) Close() error {
+	w.cancel()
+	<-w.done
+	return w.flush()
+}
+
+type auditKey struct{}
+
+// IE: filled along the way by the handlers, the failure is only known there
+func auditRecordFrom(ctx context.Context) *auditRecord {
+	record, _ := ctx.Value(auditKey{}).(*auditRecord)
+	return record
+}
+
+func auditError(ctx context.Context, err error) {
+	if record := auditRecordFrom(ctx); record != nil {
+		record.Error = err.Error()
+	}
+}
+
+// IE: around the package routes, outside authenticate and limitInFlight for the
+// rejected requests. authenticate swaps the client for the subject of the token
+func auditResolutions(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sink := auditSink
+		if sink == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		vars := mux.Vars(r)
+		record := &auditRecord{
+			Time:      start,
+			RequestID: requestIDFrom(r.Context()),
+			Client:    requestClient(r),
+			Package:   vars["package"],
+			Version:   vars["version"],
+			Query:     r.URL.RawQuery,
+		}
+		stats := &resolutionStats{}
+		ctx := withResolutionStats(context.WithValue(r.Context(), auditKey{}, record), stats)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		snapshot := stats.snapshot()
+		record.Status = rec.status
+		record.Cache = rec.Header().Get("X-Cache-Status")
+		record.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+		record.Nodes = snapshot.Resolved
+		record.UpstreamCalls = snapshot.UpstreamCalls
+		switch {
+		case errors.Is(r.Context().Err(), context.Canceled):
+			record.Outcome = auditOutcomeCancelled
+		case rec.status >= http.StatusInternalServerError:
+			record.Outcome = auditOutcomeError
+		case rec.status >= http.StatusBadRequest:
+			record.Outcome = auditOutcomeRejected
+		// IE: a stream failing past its first line, the status was long sent
+		case record.Error != "":
+			record.Outcome = auditOutcomeError
+		case rec.Header().Get("X-Partial-Tree") != "":
+			record.Outcome = auditOutcomePartial
+		default:
+			record.Outcome = auditOutcomeOK
+		}
+		sink.write(*record)
+	})
+}
+
+// FlushAuditLog sends the audit records still queued for the audit endpoint,
+// or syncs the audit file, on shutdown they could be lost otherwise. A no-op
+// without WithAuditLog.
+func FlushAuditLog() error {
+	if auditSink == nil {
+		return nil
+	}
+	return auditSink.flush()
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readAuditRecords(t *testing.T, data []byte) []auditRecord {
+	var records []auditRecord
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var record auditRecord
+		require.Nil(t, json.Unmarshal(scanner.Bytes(), &record), scanner.Text())
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestAuditLogRecordsEveryResolution(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{
+		"app": {"1.0.0": {"a": "^1.0.0"}},
+		"a":   {"1.0.0": nil},
+	})
+	path := filepath.Join(t.TempDir(), "audit.log")
+	handler := New(WithRegistryURL(registry.URL), WithAuditLog(path), WithClientHeader("X-Client-ID"), WithTrustedGateways([]string{"gateway"}))
+
+	for _, url := range []string{"/package/app/1.0.0", "/package/app/1.0.0", "/package/missing/1.0.0", "/package/app/1.0.0?format=xml"} {
+		req := withClientCertificate(httptest.NewRequest("GET", url, nil), "gateway")
+		req.Header.Set("X-Client-ID", "ci")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	require.Nil(t, FlushAuditLog())
+
+	data, err := os.ReadFile(path)
+	require.Nil(t, err)
+	records := readAuditRecords(t, data)
+	require.Len(t, records, 4)
+
+	assert.Equal(t, "ci", records[0].Client)
+	assert.Equal(t, "app", records[0].Package)
+	assert.Equal(t, "1.0.0", records[0].Version)
+	assert.Equal(t, http.StatusOK, records[0].Status)
+	assert.Equal(t, auditOutcomeOK, records[0].Outcome)
+	assert.Equal(t, cacheStatusMiss, records[0].Cache)
+	assert.EqualValues(t, 2, records[0].Nodes)
+	assert.NotZero(t, records[0].UpstreamCalls)
+	assert.NotEmpty(t, records[0].RequestID)
+
+	// IE: served from the cache, nothing resolved
+	assert.Equal(t, auditOutcomeOK, records[1].Outcome)
+	assert.EqualValues(t, 0, records[1].Nodes)
+
+	assert.Equal(t, http.StatusNotFound, records[2].Status)
+	assert.Equal(t, auditOutcomeRejected, records[2].Outcome)
+	assert.NotEmpty(t, records[2].Error)
+
+	assert.Equal(t, http.StatusBadRequest, records[3].Status)
+	assert.Equal(t, "format=xml", records[3].Query)
+}
+
+func TestAuditLogPostsBatches(t *testing.T) {
+	var mu sync.Mutex
+	var received []auditRecord
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/x-ndjson", r.Header.Get("Content-Type"))
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, readAuditRecords(t, body)...)
+		mu.Unlock()
+	}))
+	defer endpoint.Close()
+
+	w := newHTTPAuditWriter(endpoint.URL, time.Hour)
+	for i := 0; i < 3; i++ {
+		w.write(auditRecord{Package: "a", Outcome: auditOutcomeOK})
+	}
+	require.Nil(t, w.Close())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Len(t, received, 3)
+}
+
+func TestAuditLogKeepsRecordsWhileEndpointFails(t *testing.T) {
+	fail := true
+	var received int
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		received += len(readAuditRecords(t, body))
+	}))
+	defer endpoint.Close()
+
+	w := newHTTPAuditWriter(endpoint.URL, time.Hour)
+	defer w.Close()
+	w.write(auditRecord{Package: "a"})
+	assert.NotNil(t, w.flush())
+
+	fail = false
+	w.write(auditRecord{Package: "b"})
+	require.Nil(t, w.flush())
+	assert.Equal(t, 2, received)
+}
+
+func TestAuditLogDisabled(t *testing.T) {
+	New()
+	assert.Nil(t, auditSink)
+	assert.Nil(t, FlushAuditLog())
+
+	_, err := newAuditWriter(filepath.Join(t.TempDir(), "missing", "audit.log"))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,308 @@
+package api
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// IE: the keys are fetched again past it, and at most once per
+// jwksMinRefresh for a kid they don't have, the issuer may have rotated
+const (
+	jwksMaxAge     = time.Hour
+	jwksMinRefresh = time.Minute
+	// IE: clocks of the issuer and of the replicas drift apart
+	jwtLeeway = 30 * time.Second
+)
+
+// IE: the asymmetric ones only, a shared secret would have to be configured here
+var jwtMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+var errUnauthorized = &Error{Code: "unauthorized", Status: http.StatusUnauthorized, message: "unauthorized"}
+
+// IE: nil unless WithJWTAuth is set, replaced by every New()
+var authenticator *jwtAuthenticator
+
+type jwtAuthenticator struct {
+	issuer   string
+	audience string
+	keys     *jwksCache
+}
+
+func newJWTAuthenticator(issuer, audience, jwksURL string) *jwtAuthenticator {
+	if issuer == "" {
+		return nil
+	}
+	return &jwtAuthenticator{
+		issuer:   issuer,
+		audience: audience,
+		keys:     &jwksCache{issuer: issuer, url: jwksURL, client: &http.Client{Timeout: 10 * time.Second}},
+	}
+}
+
+func (a *jwtAuthenticator) verify(ctx context.Context, raw string) (jwt.MapClaims, error) {
+	parserOpts := []jwt.ParserOption{
+		jwt.WithValidMethods(jwtMethods),
+		jwt.WithIssuer(a.issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(jwtLeeway),
+	}
+	if a.audience != "" {
+		parserOpts = append(parserOpts, jwt.WithAudience(a.audience))
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return a.keys.key(ctx, kid)
+	}, parserOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// IE: the keys of the issuer by kid, fetched from url or, without one, from the
+// jwks_uri of its OpenID configuration
+type jwksCache struct {
+	issuer string
+	url    string
+	client *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// IE: under the lock, the requests coming in while the keys are fetched wait
+// for them rather than fetching them as well
+func (c *jwksCache) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key, found := c.lookup(kid)
+	stale := time.Since(c.fetchedAt) > jwksMaxAge
+	if found && !stale {
+		return key, nil
+	}
+	if !stale && time.Since(c.fetchedAt) < jwksMinRefresh {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	if err := c.refresh(ctx); err != nil {
+		logger.Error("Could not fetch the signing keys", "issuer", c.issuer, "error", err)
+		// IE: the keys there are keep working while the issuer is unreachable
+		if found {
+			return key, nil
+		}
+		return nil, err
+	}
+	if key, found = c.lookup(kid); !found {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// IE: a token without kid is only accepted from an issuer with a single key
+func (c *jwksCache) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(c.keys) == 1 {
+		for _, key := range c.keys {
+			return key, true
+		}
+	}
+	key, found := c.keys[kid]
+	return key, found
+}
+
+func (c *jwksCache) refresh(ctx context.Context) error {
+	// IE: a failed fetch counts too, or every request would fetch again meanwhile
+	c.fetchedAt = time.Now()
+
+	url := c.url
+	if url == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := c.getJSON(ctx, strings.TrimSuffix(c.issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+			return fmt.Errorf("openid configuration: %w", err)
+		}
+		if discovery.JWKSURI == "" {
+			return errors.New("openid configuration without jwks_uri")
+		}
+		url = discovery.JWKSURI
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := c.getJSON(ctx, url, &set); err != nil {
+		return err
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		// IE: encryption keys and unknown key types are skipped, not fatal
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			logger.Warn("Skipping signing key", "issuer", c.issuer, "kid", k.Kid, "error", err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no usable signing key at %s", url)
+	}
+	c.keys = keys
+	return nil
+}
+
+// IE: not through httpGet, the issuer isn't the registry and doesn't share its limits
+func (c *jwksCache) getJSON(ctx context.Context, url string, v interface{}) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.client.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d for %s", resp.StatusCode, url)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// IE: the fields of RFC 7517 the RSA, EC and Ed25519 keys need
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("rsa exponent out of range")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		// IE: the coordinates are left padded to the size of the curve
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) != size || len(y) != size {
+			return nil, errors.New("ec coordinates of the wrong size")
+		}
+		return ecdsa.ParseUncompressedPublicKey(curve, append(append([]byte{4}, x...), y...))
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("ed25519 key of the wrong size")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+type claimsKey struct{}
+
+// IE: nil for requests that didn't need a token, auth being off
+func claimsFrom(ctx context.Context) jwt.MapClaims {
+	claims, _ := ctx.Value(claimsKey{}).(jwt.MapClaims)
+	return claims
+}
+
+// IE: the token is the client, its sub goes before the client header and the address
+func claimsSubject(ctx context.Context) string {
+	subject, _ := claimsFrom(ctx)["sub"].(string)
+	return subject
+}
+
+// IE: RFC 6750, the challenge tells the client the token is the problem rather
+// than its request
+func authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := authenticator
+		if auth == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		scheme, raw, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(raw) == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="deps"`)
+			httpError(w, r, fmt.Errorf("%w: bearer token required", errUnauthorized))
+			return
+		}
+		claims, err := auth.verify(r.Context(), strings.TrimSpace(raw))
+		if err != nil {
+			loggerFrom(r.Context()).Debug("Rejected bearer token", "error", err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="deps", error="invalid_token"`)
+			httpError(w, r, fmt.Errorf("%w: invalid token: %v", errUnauthorized, err))
+			return
+		}
+		r = r.WithContext(context.WithValue(r.Context(), claimsKey{}, claims))
+		if record := auditRecordFrom(r.Context()); record != nil {
+			record.Client, record.Subject = requestClient(r), claimsSubject(r.Context())
+		}
+		next.ServeHTTP(w, r)
+	})
+}
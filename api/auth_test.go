@@ -0,0 +1,176 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// IE: an OIDC issuer serving its discovery document and the JWKS of keys,
+// which the test may rotate
+type fakeIssuer struct {
+	*httptest.Server
+	keys       atomic.Pointer[[]jwk]
+	jwksCalls  atomic.Int64
+	rsaKey     *rsa.PrivateKey
+	ecKey      *ecdsa.PrivateKey
+	rotatedKey *rsa.PrivateKey
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func rsaJWK(kid string, key *rsa.PrivateKey) jwk {
+	return jwk{Kty: "RSA", Kid: kid, Use: "sig", N: b64(key.N.Bytes()), E: b64(big.NewInt(int64(key.E)).Bytes())}
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	issuer := &fakeIssuer{}
+	var err error
+	issuer.rsaKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+	issuer.rotatedKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+	issuer.ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+
+	point, err := issuer.ecKey.PublicKey.Bytes()
+	require.Nil(t, err)
+	keys := []jwk{
+		rsaJWK("rsa-1", issuer.rsaKey),
+		{Kty: "EC", Kid: "ec-1", Crv: "P-256", X: b64(point[1:33]), Y: b64(point[33:])},
+		// IE: skipped, not a signing key
+		{Kty: "RSA", Kid: "enc-1", Use: "enc"},
+	}
+	issuer.keys.Store(&keys)
+
+	issuer.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			_ = json.NewEncoder(w).Encode(map[string]string{"issuer": issuer.URL, "jwks_uri": issuer.URL + "/keys"})
+		case "/keys":
+			issuer.jwksCalls.Add(1)
+			_ = json.NewEncoder(w).Encode(map[string][]jwk{"keys": *issuer.keys.Load()})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(issuer.Close)
+	return issuer
+}
+
+func (i *fakeIssuer) claims(subject string) jwt.MapClaims {
+	return jwt.MapClaims{"iss": i.URL, "sub": subject, "aud": "deps", "exp": time.Now().Add(time.Hour).Unix()}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	require.Nil(t, err)
+	return signed
+}
+
+func authorized(handler http.Handler, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestJWTAuth(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{"app": {"1.0.0": nil}})
+	issuer := newFakeIssuer(t)
+	path := filepath.Join(t.TempDir(), "audit.log")
+	handler := New(WithRegistryURL(registry.URL), WithJWTAuth(issuer.URL, "deps", ""), WithAuditLog(path))
+
+	rec := authorized(handler, "/package/app/1.0.0", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, `Bearer realm="deps"`, rec.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, "unauthorized", decodeErrorPayload(t, rec).Code)
+
+	rec = authorized(handler, "/package/app/1.0.0", sign(t, jwt.SigningMethodRS256, "rsa-1", issuer.rsaKey, issuer.claims("ci")))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	rec = authorized(handler, "/cache/stats", sign(t, jwt.SigningMethodES256, "ec-1", issuer.ecKey, issuer.claims("dashboard")))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	// IE: the probes stay open, the kubelet has no token
+	assert.Equal(t, http.StatusOK, authorized(handler, "/healthz", "").Code)
+	assert.Equal(t, int64(1), issuer.jwksCalls.Load())
+
+	require.Nil(t, FlushAuditLog())
+	data, err := os.ReadFile(path)
+	require.Nil(t, err)
+	records := readAuditRecords(t, data)
+	require.Len(t, records, 2)
+	assert.Equal(t, auditOutcomeRejected, records[0].Outcome)
+	assert.Equal(t, "ci", records[1].Client)
+	assert.Equal(t, "ci", records[1].Subject)
+}
+
+func TestJWTAuthRejectsInvalidTokens(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	handler := New(WithJWTAuth(issuer.URL, "deps", issuer.URL+"/keys"))
+
+	expired := issuer.claims("ci")
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	otherAudience := issuer.claims("ci")
+	otherAudience["aud"] = "billing"
+	otherIssuer := issuer.claims("ci")
+	otherIssuer["iss"] = "https://evil.example.com"
+	noExpiry := issuer.claims("ci")
+	delete(noExpiry, "exp")
+	forged, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+
+	for name, token := range map[string]string{
+		"expired":        sign(t, jwt.SigningMethodRS256, "rsa-1", issuer.rsaKey, expired),
+		"audience":       sign(t, jwt.SigningMethodRS256, "rsa-1", issuer.rsaKey, otherAudience),
+		"issuer":         sign(t, jwt.SigningMethodRS256, "rsa-1", issuer.rsaKey, otherIssuer),
+		"no expiry":      sign(t, jwt.SigningMethodRS256, "rsa-1", issuer.rsaKey, noExpiry),
+		"forged":         sign(t, jwt.SigningMethodRS256, "rsa-1", forged, issuer.claims("ci")),
+		"hmac":           sign(t, jwt.SigningMethodHS256, "rsa-1", []byte("secret"), issuer.claims("ci")),
+		"unknown key":    sign(t, jwt.SigningMethodRS256, "rsa-9", issuer.rsaKey, issuer.claims("ci")),
+		"not even a jwt": "garbage",
+	} {
+		rec := authorized(handler, "/cache/stats", token)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, name)
+		assert.Contains(t, rec.Header().Get("WWW-Authenticate"), `error="invalid_token"`, name)
+	}
+	// IE: the unknown kid refreshed the keys once, the next ones wait jwksMinRefresh
+	assert.Equal(t, int64(1), issuer.jwksCalls.Load())
+}
+
+func TestJWKSRotation(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	handler := New(WithJWTAuth(issuer.URL, "", issuer.URL+"/keys"))
+	require.Equal(t, http.StatusOK, authorized(handler, "/cache/stats", sign(t, jwt.SigningMethodRS256, "rsa-1", issuer.rsaKey, issuer.claims("ci"))).Code)
+
+	keys := []jwk{rsaJWK("rsa-2", issuer.rotatedKey)}
+	issuer.keys.Store(&keys)
+	// IE: as if the keys were fetched long enough ago
+	authenticator.keys.fetchedAt = time.Now().Add(-jwksMinRefresh)
+
+	rotated := sign(t, jwt.SigningMethodRS256, "rsa-2", issuer.rotatedKey, issuer.claims("ci"))
+	assert.Equal(t, http.StatusOK, authorized(handler, "/cache/stats", rotated).Code)
+	assert.Equal(t, http.StatusUnauthorized, authorized(handler, "/cache/stats", sign(t, jwt.SigningMethodRS256, "rsa-1", issuer.rsaKey, issuer.claims("ci"))).Code)
+	assert.Equal(t, int64(2), issuer.jwksCalls.Load())
+}
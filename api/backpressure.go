@@ -0,0 +1,34 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// IE: retrying right away would be rejected again, resolutions take seconds
+const retryAfter = 2 * time.Second
+
+// IE: non-blocking semaphore, beyond max() requests in flight the client is asked
+// to come back later instead of queueing up memory and upstream connections
+// here. Read on every request, the limit may be reloaded, 0 doesn't limit them
+func limitInFlight(next http.Handler, max func() int) http.Handler {
+	var inFlight atomic.Int64
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := max()
+		if n <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if inFlight.Add(1) <= int64(n) {
+			defer inFlight.Add(-1)
+			next.ServeHTTP(w, r)
+		} else {
+			inFlight.Add(-1)
+			loggerFrom(r.Context()).Debug("Rejecting request", "uri", r.RequestURI, "in-flight", n)
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter/time.Second)))
+			httpError(w, r, errTooManyRequests)
+		}
+	})
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var boltBucket = []byte("cache")
+
+// IE: single file store, persistence without running any extra infrastructure
+type boltCache struct {
+	db *bolt.DB
+
+	// IE: overridable for tests
+	now func() time.Time
+	cacheCounters
+}
+
+func newBoltCache(path string) (*boltCache, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return &boltCache{db: db, now: time.Now}, nil
+}
+
+// IE: values are stored as <8 bytes unix nano expiry><payload>, a zero expiry never expires
+func (c *boltCache) Get(key string) ([]byte, bool) {
+	value, _, found := c.getWithExpiry(key)
+	return value, found
+}
+
+func (c *boltCache) getWithExpiry(key string) ([]byte, time.Time, bool) {
+	var value []byte
+	var expiresAt time.Time
+	expired := false
+
+	err := c.db.View(func(tx *bolt.Tx) error {
+		stored := tx.Bucket(boltBucket).Get([]byte(key))
+		if len(stored) < 8 {
+			return nil
+		}
+
+		expires := int64(binary.BigEndian.Uint64(stored[:8]))
+		if expires != 0 && c.now().UnixNano() > expires {
+			expired = true
+			return nil
+		}
+		if expires != 0 {
+			expiresAt = time.Unix(0, expires)
+		}
+
+		// IE: bolt only guarantees the slice for the lifetime of the transaction
+		value = append([]byte(nil), stored[8:]...)
+		return nil
+	})
+	if err != nil {
+		logger.Error("Bolt get failed", "key", key, "error", err)
+		c.record(false)
+		return nil, time.Time{}, false
+	}
+
+	if expired {
+		c.Delete(key)
+		c.recordEviction()
+	}
+
+	c.record(value != nil)
+	return value, expiresAt, value != nil
+}
+
+func (c *boltCache) Set(key string, value []byte, ttl time.Duration) {
+	stored := make([]byte, 8+len(value))
+	if ttl > 0 {
+		binary.BigEndian.PutUint64(stored[:8], uint64(c.now().Add(ttl).UnixNano()))
+	}
+	copy(stored[8:], value)
+
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Put([]byte(key), stored)
+	})
+	if err != nil {
+		logger.Error("Bolt set failed", "key", key, "error", err)
+	}
+}
+
+func (c *boltCache) Delete(key string) {
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Delete([]byte(key))
+	})
+	if err != nil {
+		logger.Error("Bolt delete failed", "key", key, "error", err)
+	}
+}
+
+// IE: the store time isn't recorded on disk, so no age for these
+func (c *boltCache) Entries(prefix string) []CacheEntryInfo {
+	now := c.now()
+	var entries []CacheEntryInfo
+	err := c.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(boltBucket).Cursor()
+		for k, v := cursor.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, v = cursor.Next() {
+			if len(v) < 8 {
+				continue
+			}
+			var expires time.Time
+			if nanos := int64(binary.BigEndian.Uint64(v[:8])); nanos != 0 {
+				expires = time.Unix(0, nanos)
+				if now.After(expires) {
+					continue
+				}
+			}
+			entries = append(entries, newCacheEntryInfo(string(k), len(v)-8, now, time.Time{}, expires))
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("Bolt listing failed", "prefix", prefix, "error", err)
+	}
+	return entries
+}
+
+// IE: keys are sorted in bolt, so a prefix is a contiguous range
+func (c *boltCache) DeletePrefix(prefix string) int {
+	deleted := 0
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(boltBucket).Cursor()
+		for k, _ := cursor.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, _ = cursor.Next() {
+			if err := cursor.Delete(); err != nil {
+				return err
+			}
+			deleted++
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("Bolt prefix delete failed", "prefix", prefix, "error", err)
+	}
+	return deleted
+}
+
+func (c *boltCache) Stats() CacheStats {
+	entries := -1
+	_ = c.db.View(func(tx *bolt.Tx) error {
+		entries = tx.Bucket(boltBucket).Stats().KeyN
+		return nil
+	})
+	return c.stats(CacheBackendBolt, entries)
+}
+
+func (c *boltCache) Close() error {
+	return c.db.Close()
+}
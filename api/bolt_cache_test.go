@@ -0,0 +1,49 @@
+package api
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoltCachePersists(t *testing.T) {
+	New()
+	path := filepath.Join(t.TempDir(), "cache.db")
+
+	cache, err := newBoltCache(path)
+	require.Nil(t, err)
+	cache.Set("tree:react@16.13.0", []byte(`{"name":"react"}`), 0)
+	require.Nil(t, cache.Close())
+
+	// IE: reopen, the entry must have survived
+	cache, err = newBoltCache(path)
+	require.Nil(t, err)
+	defer cache.Close()
+
+	value, found := cache.Get("tree:react@16.13.0")
+	assert.True(t, found)
+	assert.Equal(t, []byte(`{"name":"react"}`), value)
+}
+
+func TestBoltCacheExpiresEntries(t *testing.T) {
+	New()
+
+	cache, err := newBoltCache(filepath.Join(t.TempDir(), "cache.db"))
+	require.Nil(t, err)
+	defer cache.Close()
+
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	cache.Set("packument:left-pad", []byte("{}"), time.Minute)
+
+	_, found := cache.Get("packument:left-pad")
+	assert.True(t, found)
+
+	now = now.Add(2 * time.Minute)
+	_, found = cache.Get("packument:left-pad")
+	assert.False(t, found)
+}
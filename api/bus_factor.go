@@ -0,0 +1,145 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// IE: who can publish the packages of a tree, the ones a single account can
+// publish are one compromised account away from a malicious release
+type busFactorReport struct {
+	Packages int `json:"packages"`
+	// IE: distinct accounts across the packages
+	Maintainers      int `json:"maintainers"`
+	SingleMaintainer int `json:"singleMaintainer"`
+	// IE: the packuments without maintainers (i.e. from a CDN)
+	Unknown int `json:"unknown"`
+	// IE: ?limit= of the accounts maintaining the most packages of the tree,
+	// the ones a compromise would reach the furthest from
+	TopMaintainers []maintainerPackages `json:"topMaintainers"`
+	// IE: every single maintainer package, by name
+	Single []singleMaintained `json:"single"`
+}
+
+type maintainerPackages struct {
+	Name     string `json:"name"`
+	Packages int    `json:"packages"`
+}
+
+type singleMaintained struct {
+	Name       string `json:"name"`
+	Maintainer string `json:"maintainer"`
+}
+
+// IE: {"name": ..., "email": ...} in packuments, a "name <email> (url)" string
+// in some old ones
+func maintainerName(raw json.RawMessage) string {
+	var person struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	}
+	if err := json.Unmarshal(raw, &person); err == nil {
+		if person.Name != "" {
+			return person.Name
+		}
+		return person.Email
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		if at := strings.IndexAny(text, "<("); at >= 0 {
+			text = text[:at]
+		}
+		return strings.TrimSpace(text)
+	}
+	return ""
+}
+
+// IE: the accounts of a packument, once each
+func maintainerNames(meta *npmPackageMetaResponse) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, raw := range meta.Maintainers {
+		if name := maintainerName(raw); name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// IE: by package, the versions of a package share its maintainers. The root
+// counts like its dependencies
+func busFactorSection(ctx context.Context, tree *NpmPackageVersion, query url.Values, report *treeReport) error {
+	limit, err := requestLimit(query)
+	if err != nil {
+		return err
+	}
+	// IE: the names listed up front, the goroutines only write to maintainers
+	seen := make(map[string]bool)
+	var packages []string
+	for _, pkg := range uniqueVersions(tree) {
+		if !seen[pkg.Name] {
+			seen[pkg.Name] = true
+			packages = append(packages, pkg.Name)
+		}
+	}
+
+	maintainers := make(map[string][]string, len(packages))
+	var mu sync.Mutex
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(live().concurrency, 1))
+	for _, name := range packages {
+		g.Go(func() error {
+			meta, err := fetchPackageMeta(gctx, name)
+			if err != nil {
+				return fmt.Errorf("fetching package meta for %s: %w", name, err)
+			}
+			names := maintainerNames(meta)
+			mu.Lock()
+			maintainers[name] = names
+			mu.Unlock()
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	bus := &busFactorReport{Packages: len(packages), TopMaintainers: []maintainerPackages{}, Single: []singleMaintained{}}
+	byAccount := make(map[string]int)
+	for name, names := range maintainers {
+		switch len(names) {
+		case 0:
+			bus.Unknown++
+		case 1:
+			bus.SingleMaintainer++
+			bus.Single = append(bus.Single, singleMaintained{Name: name, Maintainer: names[0]})
+		}
+		for _, account := range names {
+			byAccount[account]++
+		}
+	}
+	bus.Maintainers = len(byAccount)
+	for account, n := range byAccount {
+		bus.TopMaintainers = append(bus.TopMaintainers, maintainerPackages{Name: account, Packages: n})
+	}
+	sort.Slice(bus.TopMaintainers, func(i, j int) bool {
+		if bus.TopMaintainers[i].Packages != bus.TopMaintainers[j].Packages {
+			return bus.TopMaintainers[i].Packages > bus.TopMaintainers[j].Packages
+		}
+		return bus.TopMaintainers[i].Name < bus.TopMaintainers[j].Name
+	})
+	if len(bus.TopMaintainers) > limit {
+		bus.TopMaintainers = bus.TopMaintainers[:limit]
+	}
+	sort.Slice(bus.Single, func(i, j int) bool { return bus.Single[i].Name < bus.Single[j].Name })
+	report.BusFactor = bus
+	return nil
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/snyk/snyk-code-review-exercise/internal/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBusFactor(t *testing.T) {
+	packages := fixtures.Registry{
+		"app":  {"1.0.0": {"solo": "^1.0.0", "team": "^1.0.0", "cdn": "^1.0.0"}},
+		"solo": {"1.0.0": {"team": "^1.0.0"}},
+		"team": {"1.0.0": nil},
+		"cdn":  {"1.0.0": nil},
+	}
+	maintainers := map[string]string{
+		"app":  `[{"name": "alice", "email": "alice@example.com"}, {"name": "bob"}]`,
+		"solo": `["alice <alice@example.com> (https://example.com)"]`,
+		"team": `[{"name": "bob"}, {"email": "carol@example.com"}, {"name": "bob"}]`,
+	}
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/")
+		if versions, found := packages[name]; found {
+			doc := map[string]any{"versions": map[string]any{}}
+			for version, deps := range versions {
+				doc["versions"].(map[string]any)[version] = npmPackageResponse{Name: name, Version: version, Dependencies: deps}
+			}
+			if list, found := maintainers[name]; found {
+				doc["maintainers"] = json.RawMessage(list)
+			}
+			_ = json.NewEncoder(w).Encode(doc)
+			return
+		}
+		packages.ServeHTTP(w, r)
+	}))
+	t.Cleanup(registry.Close)
+	handler := New(WithRegistryURL(registry.URL))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0/report?sections=bus-factor&limit=2", nil))
+	report := decodeReport(t, rec)
+	require.NotNil(t, report.BusFactor)
+	assert.Equal(t, &busFactorReport{
+		Packages: 4, Maintainers: 3, SingleMaintainer: 1, Unknown: 1,
+		TopMaintainers: []maintainerPackages{{"alice", 2}, {"bob", 2}},
+		Single:         []singleMaintained{{"solo", "alice"}},
+	}, report.BusFactor)
+}
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Cache stores serialized values for at most a TTL. Both the response cache
+// and the packument cache go through it, so backends are pluggable.
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	// Set stores value under key, a zero ttl never expires it.
+	Set(key string, value []byte, ttl time.Duration)
+	Delete(key string)
+	Stats() CacheStats
+}
+
+// CacheStats reports lookups served by a Cache. Entries is -1 whenever the
+// backend cannot count them cheaply.
+type CacheStats struct {
+	Backend   string `json:"backend"`
+	Entries   int    `json:"entries"`
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	// Bytes is only reported by the in-memory backend.
+	Bytes int64 `json:"bytes,omitempty"`
+}
+
+// IE: embedded by every backend so hit/miss accounting is the same everywhere
+type cacheCounters struct {
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+func (c *cacheCounters) record(found bool) {
+	if found {
+		atomic.AddUint64(&c.hits, 1)
+	} else {
+		atomic.AddUint64(&c.misses, 1)
+	}
+}
+
+// IE: only counts entries dropped by the cache itself (capacity or expiry), not explicit deletes
+func (c *cacheCounters) recordEviction() {
+	atomic.AddUint64(&c.evictions, 1)
+}
+
+func (c *cacheCounters) stats(backend string, entries int) CacheStats {
+	return CacheStats{
+		Backend:   backend,
+		Entries:   entries,
+		Hits:      atomic.LoadUint64(&c.hits),
+		Misses:    atomic.LoadUint64(&c.misses),
+		Evictions: atomic.LoadUint64(&c.evictions),
+	}
+}
+
+// IE: supported values for the cache backend option
+const (
+	CacheBackendMemory    = "memory"
+	CacheBackendRedis     = "redis"
+	CacheBackendMemcached = "memcached"
+	CacheBackendBolt      = "bolt"
+	CacheBackendTiered    = "tiered"
+)
+
+func newMemoryCaches(o options) (responses *shardedCache, packuments *shardedCache) {
+	return newShardedCache(o.cacheSize, o.cacheBytes, o.cacheShards), newShardedCache(o.packumentSize, o.packumentBytes, o.cacheShards)
+}
+
+// IE: one shared backend serves both caches, only the in-memory one is split
+// so packuments can't evict resolved trees and the other way around
+func newCaches(o options) (responses Cache, packuments Cache, err error) {
+	if o.cache != nil {
+		return o.cache, o.cache, nil
+	}
+
+	switch o.cacheBackend {
+	case "", CacheBackendMemory:
+		responses, packuments := newMemoryCaches(o)
+		return responses, packuments, nil
+	case CacheBackendRedis:
+		redisCache, err := newRedisCache(o.cacheAddress)
+		if err != nil {
+			return nil, nil, err
+		}
+		return redisCache, redisCache, nil
+	case CacheBackendMemcached:
+		memcachedCache := newMemcachedCache(o.cacheAddress)
+		return memcachedCache, memcachedCache, nil
+	case CacheBackendBolt:
+		boltCache, err := newBoltCache(o.cacheAddress)
+		if err != nil {
+			return nil, nil, err
+		}
+		return boltCache, boltCache, nil
+	case CacheBackendTiered:
+		// IE: one disk file for both layers, keys are prefixed per layer anyway
+		boltCache, err := newBoltCache(o.cacheAddress)
+		if err != nil {
+			return nil, nil, err
+		}
+		responses, packuments := newMemoryCaches(o)
+		return newTieredCache(responses, boltCache), newTieredCache(packuments, boltCache), nil
+	}
+
+	return nil, nil, fmt.Errorf("unknown cache backend %q", o.cacheBackend)
+}
+
+// IE: bump whenever the shape of the cached data changes (i.e. new per-node fields),
+// entries written by other versions then simply stop being found, on every backend
+const (
+	treeSchemaVersion     = "2"
+	registrySchemaVersion = "1"
+)
+
+const (
+	treeKeyPrefix      = "tree:v" + treeSchemaVersion + ":"
+	packumentKeyPrefix = "packument:v" + registrySchemaVersion + ":"
+	versionKeyPrefix   = "version:v" + registrySchemaVersion + ":"
+	subtreeKeyPrefix   = "subtree:v" + treeSchemaVersion + ":"
+)
+
+// IE: resolved trees and packuments are cached in separate stores (they may be the same backend)
+var packumentCache Cache
+
+// IE: TTL by volatility: a published version document never changes (npm forbids
+// republishing a version) while packuments change with every publish, and
+// resolved trees follow their dependencies' packuments
+func ttlFor(key string) time.Duration {
+	switch {
+	case strings.HasPrefix(key, negativeKeyPrefix):
+		return live().negativeTTL
+	case strings.HasPrefix(key, versionKeyPrefix):
+		return live().versionTTL
+	case strings.HasPrefix(key, packumentKeyPrefix):
+		return live().packumentTTL
+	}
+	return live().cacheTTL
+}
+
+func cachedJSON(cache Cache, key string, v interface{}) bool {
+	cached, found := cache.Get(key)
+	if !found {
+		return false
+	}
+
+	if err := decodeJSON(cached, v); err != nil {
+		logger.Error("Dropping corrupted cache entry", "key", key, "error", err)
+		cache.Delete(key)
+		return false
+	}
+	return true
+}
+
+// IE: only the fields we unmarshalled are stored, which keeps the entries way smaller than the raw registry documents
+func cacheJSON(cache Cache, key string, v interface{}) {
+	encoded, err := encodeJSON(v)
+	if err != nil {
+		logger.Error("Could not cache", "key", key, "error", err)
+		return
+	}
+	cache.Set(key, encoded, ttlFor(key))
+}
+
+func cachedPackageMeta(name string) (*npmPackageMetaResponse, bool) {
+	var parsed npmPackageMetaResponse
+	if !cachedJSON(packumentCache, packumentKeyPrefix+name, &parsed) {
+		return nil, false
+	}
+	return &parsed, true
+}
+
+func cachePackageMeta(name string, meta *npmPackageMetaResponse) {
+	cacheJSON(packumentCache, packumentKeyPrefix+name, meta)
+}
+
+func cachedPackage(name, version string) (*npmPackageResponse, bool) {
+	var parsed npmPackageResponse
+	if !cachedJSON(packumentCache, versionKeyPrefix+name+"@"+version, &parsed) {
+		return nil, false
+	}
+	return &parsed, true
+}
+
+func cachePackage(name, version string, pkg *npmPackageResponse) {
+	cacheJSON(packumentCache, versionKeyPrefix+name+"@"+version, pkg)
+}
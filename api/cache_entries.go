@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// CacheEntryInfo describes a cached entry for operators. AgeSeconds is -1
+// when the backend doesn't record when the entry was stored, TTLSeconds is
+// -1 for entries that never expire.
+type CacheEntryInfo struct {
+	Layer      string  `json:"layer"`
+	Key        string  `json:"key"`
+	Size       int     `json:"size"`
+	AgeSeconds float64 `json:"ageSeconds"`
+	TTLSeconds float64 `json:"ttlSeconds"`
+}
+
+// IE: optional, like prefixDeleter only the backends able to enumerate their keys implement it
+type entryLister interface {
+	Entries(prefix string) []CacheEntryInfo
+}
+
+func newCacheEntryInfo(key string, size int, now, stored, expires time.Time) CacheEntryInfo {
+	info := CacheEntryInfo{Key: key, Size: size, AgeSeconds: -1, TTLSeconds: -1}
+	if !stored.IsZero() {
+		info.AgeSeconds = now.Sub(stored).Seconds()
+	}
+	if !expires.IsZero() {
+		info.TTLSeconds = expires.Sub(now).Seconds()
+	}
+	return info
+}
+
+// IE: the prefix is matched against package names, whatever the kind of entry
+var entryKindPrefixes = map[string][]string{
+	"responses":  {treeKeyPrefix},
+	"packuments": {packumentKeyPrefix, versionKeyPrefix, negativeKeyPrefix + "packument:", negativeKeyPrefix + "version:"},
+	"selections": {selectionKeyPrefix},
+	"subtrees":   {subtreeKeyPrefix},
+}
+
+func cacheEntries(prefix string) []CacheEntryInfo {
+	entries := []CacheEntryInfo{}
+	for layer, cache := range cacheLayers() {
+		lister, ok := cache.(entryLister)
+		if !ok {
+			continue
+		}
+		for _, kindPrefix := range entryKindPrefixes[layer] {
+			for _, entry := range lister.Entries(kindPrefix + prefix) {
+				entry.Layer = layer
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Layer != entries[j].Layer {
+			return entries[i].Layer < entries[j].Layer
+		}
+		return entries[i].Key < entries[j].Key
+	})
+	return entries
+}
+
+func cacheEntriesHandler(w http.ResponseWriter, r *http.Request) {
+	entries := cacheEntries(normalizePackageName(r.URL.Query().Get("prefix")))
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(entries); err != nil {
+		logger.Error("Could not write cache entries", "error", err)
+	}
+}
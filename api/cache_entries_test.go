@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRUCacheEntries(t *testing.T) {
+	cache := newLRUCache(8, 0)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	cache.Set("tree:react@16.13.0", []byte("abcd"), time.Minute)
+	cache.Set("tree:express@4.18.1", []byte("ab"), 0)
+	cache.Set("tree:react-dom@16.13.0", []byte("ab"), time.Second)
+	now = now.Add(30 * time.Second)
+
+	entries := cache.Entries("tree:react")
+	require.Len(t, entries, 1)
+	assert.Equal(t, "tree:react@16.13.0", entries[0].Key)
+	assert.Equal(t, 4, entries[0].Size)
+	assert.Equal(t, 30.0, entries[0].AgeSeconds)
+	assert.Equal(t, 30.0, entries[0].TTLSeconds)
+
+	entries = cache.Entries("tree:express")
+	require.Len(t, entries, 1)
+	assert.Equal(t, -1.0, entries[0].TTLSeconds)
+}
+
+func TestBoltCacheEntries(t *testing.T) {
+	cache, err := newBoltCache(filepath.Join(t.TempDir(), "cache.db"))
+	require.Nil(t, err)
+	defer cache.Close()
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	cache.Set("tree:react@16.13.0", []byte("abcd"), time.Minute)
+	cache.Set("tree:redux@4.0.0", []byte("ab"), 0)
+
+	entries := cache.Entries("tree:react")
+	require.Len(t, entries, 1)
+	assert.Equal(t, 4, entries[0].Size)
+	assert.Equal(t, -1.0, entries[0].AgeSeconds)
+	assert.Equal(t, 60.0, entries[0].TTLSeconds)
+}
+
+func TestCacheEntriesEndpoint(t *testing.T) {
+	server := httptest.NewServer(New())
+	defer server.Close()
+
+	responseCache.Set(treeKeyPrefix+"react@16.13.0", []byte("{}"), 0)
+	responseCache.Set(treeKeyPrefix+"express@4.18.1", []byte("{}"), 0)
+	packumentCache.Set(packumentKeyPrefix+"react", []byte("{}"), 0)
+
+	resp, err := server.Client().Get(server.URL + "/cache/entries?prefix=react")
+	require.Nil(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var entries []CacheEntryInfo
+	require.Nil(t, json.NewDecoder(resp.Body).Decode(&entries))
+	require.Len(t, entries, 2)
+	assert.Equal(t, "packuments", entries[0].Layer)
+	assert.Equal(t, packumentKeyPrefix+"react", entries[0].Key)
+	assert.Equal(t, "responses", entries[1].Layer)
+	assert.Equal(t, treeKeyPrefix+"react@16.13.0", entries[1].Key)
+}
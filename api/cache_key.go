@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// IE: the registry is case sensitive (legacy packages like JSONStream have
+// capitals, React is a 404), so is the key: lowercased, a cached react would
+// answer for React when the registry wouldn't
+func normalizePackageName(name string) string {
+	return strings.TrimSpace(name)
+}
+
+// IE: semantically identical requests must share a cache entry:
+//   - exact versions are canonicalized (i.e. "v1.2.0" or "1.2.0 " is "1.2.0")
+//   - ranges are keyed by the version they currently resolve to, so "^1.2.0" and
+//     ">=1.2.0 <2.0.0" hit the same entry, and the key moves on by itself once a
+//     newer version gets published and the packument cache expires
+//   - ranges keep the last version they resolved to while the registry fails,
+//     so their cached trees are still served (stale ones included)
+//   - unresolvable ranges fallback on their whitespace-collapsed form
+func normalizeVersion(ctx context.Context, name, version string) string {
+	version = strings.Join(strings.Fields(version), " ")
+
+	if exact, err := semver.StrictNewVersion(strings.TrimPrefix(version, "v")); err == nil {
+		return exact.String()
+	}
+
+	key := selectionKey(name, version)
+	meta, err := fetchPackageMeta(ctx, name)
+	if err != nil {
+		if last, found := lastSelections.Get(key); found && !errors.Is(err, ErrPackageNotFound) {
+			return string(last)
+		}
+		return version
+	}
+	concrete, err := selectVersion(name, version, meta)
+	if err != nil {
+		return version
+	}
+	lastSelections.Set(key, []byte(concrete), 0)
+	return concrete
+}
+
+// IE: every query parameter changing the response must be listed here, and only
+// those, so cache busters (i.e. ?_=1665700000) don't fragment the cache
+var varyQueryParams = map[string]func(string) string{
+	"format":      strings.ToLower,
+	"maxDepth":    strings.TrimSpace,
+	"stats":       normalizeBool,
+	"maintenance": normalizeBool,
+}
+
+// IE: values meaning the same as leaving the parameter out
+var queryParamDefaults = map[string]string{
+	"format":      "json",
+	"stats":       "false",
+	"maintenance": "false",
+}
+
+func normalizeBool(value string) string {
+	parsed, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		return value
+	}
+	return strconv.FormatBool(parsed)
+}
+
+// IE: canonical, sorted form of the behaviour affecting parameters, empty for the default behaviour
+func treeVariant(query url.Values) string {
+	variant := url.Values{}
+	for param, normalize := range varyQueryParams {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+		value = normalize(strings.TrimSpace(value))
+		if value == queryParamDefaults[param] {
+			continue
+		}
+		variant.Set(param, value)
+	}
+	return variant.Encode()
+}
+
+func treeCacheKey(ctx context.Context, name, version string, query url.Values) string {
+	key := treeKeyPrefix + normalizePackageName(name) + "@" + normalizeVersion(ctx, name, version)
+	if variant := treeVariant(query); variant != "" {
+		key += "?" + variant
+	}
+	return key + opts.packagePolicy.cacheSuffix()
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/snyk/snyk-code-review-exercise/internal/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTreeCacheKeyNormalization(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{
+		"left-pad": {"1.2.0": nil, "1.3.0": nil, "2.0.0": nil},
+	})
+	New(WithRegistryURL(registry.URL))
+
+	key := treeCacheKey(context.Background(), "left-pad", "1.3.0", nil)
+	assert.Equal(t, treeKeyPrefix+"left-pad@1.3.0", key)
+
+	assert.NotEqual(t, key, treeCacheKey(context.Background(), "Left-Pad", "1.3.0", nil))
+	assert.Equal(t, key, treeCacheKey(context.Background(), "left-pad", "v1.3.0", nil))
+	assert.Equal(t, key, treeCacheKey(context.Background(), "left-pad", "^1.2.0", nil))
+	assert.Equal(t, key, treeCacheKey(context.Background(), "left-pad", ">=1.2.0 <2.0.0", nil))
+	assert.Equal(t, key, treeCacheKey(context.Background(), "left-pad", ">=1.2.0   <2.0.0", nil))
+
+	// IE: no compatible version, keep the constraint instead of guessing
+	assert.Equal(t, treeKeyPrefix+"left-pad@^9.0.0", treeCacheKey(context.Background(), "left-pad", "^9.0.0", nil))
+}
+
+func TestPackageHandlerTrailingSlashHitsCache(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{
+		"left-pad": {"1.3.0": nil},
+	})
+	handler := New(WithRegistryURL(registry.URL))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/left-pad/1.3.0", nil))
+	require.Equal(t, 200, rec.Code)
+
+	calls := registry.Calls()
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/left-pad/^1.0.0/", nil))
+	require.Equal(t, 200, rec.Code)
+
+	assert.Equal(t, calls, registry.Calls())
+	assert.Equal(t, uint64(1), responseCache.Stats().Hits)
+
+	// IE: the registry has no Left-Pad, the cached left-pad mustn't answer for it
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/Left-Pad/1.3.0", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestTreeCacheKeyVariesOnBehaviourParams(t *testing.T) {
+	New()
+
+	key := treeCacheKey(context.Background(), "left-pad", "1.3.0", nil)
+
+	// IE: defaults and unrelated parameters don't change the key
+	assert.Equal(t, key, treeCacheKey(context.Background(), "left-pad", "1.3.0", url.Values{"format": {"JSON"}}))
+	assert.Equal(t, key, treeCacheKey(context.Background(), "left-pad", "1.3.0", url.Values{"stats": {"0"}, "_": {"1665700000"}}))
+	// IE: the package route has no such parameters
+	assert.Equal(t, key, treeCacheKey(context.Background(), "left-pad", "1.3.0", url.Values{"includeDev": {"1"}, "strategy": {"dedupe"}}))
+
+	withStats := treeCacheKey(context.Background(), "left-pad", "1.3.0", url.Values{"stats": {"1"}})
+	assert.NotEqual(t, key, withStats)
+	assert.Equal(t, withStats, treeCacheKey(context.Background(), "left-pad", "1.3.0", url.Values{"stats": {"true"}}))
+
+	// IE: parameter order doesn't matter
+	assert.Equal(t,
+		treeCacheKey(context.Background(), "left-pad", "1.3.0", url.Values{"maxDepth": {"2"}, "maintenance": {"true"}}),
+		treeCacheKey(context.Background(), "left-pad", "1.3.0", url.Values{"maintenance": {"1"}, "maxDepth": {" 2"}}),
+	)
+}
+
+func TestTreeCacheKeyOfRangeWhileRegistryFails(t *testing.T) {
+	var down atomic.Bool
+	packages := fixtures.Registry{"left-pad": {"1.2.0": nil, "1.3.0": nil}}
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		packages.ServeHTTP(w, r)
+	}))
+	defer registry.Close()
+	handler := New(WithRegistryURL(registry.URL))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/left-pad/^1.2.0", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	// IE: the packument and the selection expired, the tree didn't
+	down.Store(true)
+	packumentCache.Delete(packumentKeyPrefix + "left-pad")
+	selectionCache.Delete(selectionKey("left-pad", "^1.2.0"))
+
+	assert.Equal(t, treeCacheKey(context.Background(), "left-pad", "1.3.0", nil), treeCacheKey(context.Background(), "left-pad", "^1.2.0", nil))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/left-pad/^1.2.0", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, cacheStatusHit, rec.Header().Get("X-Cache-Status"))
+
+	// IE: never resolved before, nothing to fall back on
+	assert.Equal(t, treeKeyPrefix+"left-pad@~1.2.0", treeCacheKey(context.Background(), "left-pad", "~1.2.0", nil))
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// IE: stats are keyed by cache layer, both layers may report the same shared backend
+func cacheLayers() map[string]Cache {
+	return map[string]Cache{
+		"responses":  responseCache,
+		"packuments": packumentCache,
+		"selections": selectionCache,
+		"subtrees":   subtreeCache,
+	}
+}
+
+func cacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	stats := make(map[string]CacheStats)
+	for layer, cache := range cacheLayers() {
+		stats[layer] = cache.Stats()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		logger.Error("Could not write cache stats", "error", err)
+	}
+}
+
+var (
+	cacheHitsDesc      = prometheus.NewDesc("deps_cache_hits_total", "Cache lookups served from the cache.", []string{"layer", "backend"}, nil)
+	cacheMissesDesc    = prometheus.NewDesc("deps_cache_misses_total", "Cache lookups not found in the cache.", []string{"layer", "backend"}, nil)
+	cacheEvictionsDesc = prometheus.NewDesc("deps_cache_evictions_total", "Entries dropped by the cache because of capacity or expiry.", []string{"layer", "backend"}, nil)
+	cacheEntriesDesc   = prometheus.NewDesc("deps_cache_entries", "Entries currently held by the cache, -1 when unknown.", []string{"layer", "backend"}, nil)
+	cacheBytesDesc     = prometheus.NewDesc("deps_cache_bytes", "Bytes currently held by the in-memory cache.", []string{"layer", "backend"}, nil)
+)
+
+// IE: reads the counters on scrape, so the caches don't need to know about prometheus
+type cacheCollector struct{}
+
+func (cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheHitsDesc
+	ch <- cacheMissesDesc
+	ch <- cacheEvictionsDesc
+	ch <- cacheEntriesDesc
+	ch <- cacheBytesDesc
+}
+
+func (cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	for layer, cache := range cacheLayers() {
+		stats := cache.Stats()
+		ch <- prometheus.MustNewConstMetric(cacheHitsDesc, prometheus.CounterValue, float64(stats.Hits), layer, stats.Backend)
+		ch <- prometheus.MustNewConstMetric(cacheMissesDesc, prometheus.CounterValue, float64(stats.Misses), layer, stats.Backend)
+		ch <- prometheus.MustNewConstMetric(cacheEvictionsDesc, prometheus.CounterValue, float64(stats.Evictions), layer, stats.Backend)
+		ch <- prometheus.MustNewConstMetric(cacheEntriesDesc, prometheus.GaugeValue, float64(stats.Entries), layer, stats.Backend)
+		ch <- prometheus.MustNewConstMetric(cacheBytesDesc, prometheus.GaugeValue, float64(stats.Bytes), layer, stats.Backend)
+	}
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheStatsEndpoint(t *testing.T) {
+	server := httptest.NewServer(New())
+	defer server.Close()
+
+	responseCache.Get(treeKeyPrefix + "react@16.13.0")
+	packumentCache.Set(packumentKeyPrefix+"react", []byte("{}"), 0)
+	packumentCache.Get(packumentKeyPrefix + "react")
+
+	resp, err := server.Client().Get(server.URL + "/cache/stats")
+	require.Nil(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var stats map[string]CacheStats
+	require.Nil(t, json.NewDecoder(resp.Body).Decode(&stats))
+
+	assert.Equal(t, uint64(1), stats["responses"].Misses)
+	assert.Equal(t, uint64(1), stats["packuments"].Hits)
+	assert.Equal(t, 1, stats["packuments"].Entries)
+}
+
+func TestCacheMetricsEndpoint(t *testing.T) {
+	server := httptest.NewServer(New())
+	defer server.Close()
+
+	responseCache.Get(treeKeyPrefix + "react@16.13.0")
+
+	resp, err := server.Client().Get(server.URL + "/metrics")
+	require.Nil(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.Nil(t, err)
+
+	assert.Contains(t, string(body), `deps_cache_misses_total{backend="memory",layer="responses"} 1`)
+	assert.Contains(t, string(body), `deps_cache_entries{backend="memory",layer="packuments"} 0`)
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCachesSelectsBackend(t *testing.T) {
+	New()
+
+	o := defaultOptions()
+	responses, packuments, err := newCaches(o)
+	require.Nil(t, err)
+	assert.Equal(t, CacheBackendMemory, responses.Stats().Backend)
+	assert.NotSame(t, responses, packuments)
+
+	o.cacheBackend, o.cacheAddress = CacheBackendBolt, filepath.Join(t.TempDir(), "cache.db")
+	responses, packuments, err = newCaches(o)
+	require.Nil(t, err)
+	defer responses.(*boltCache).Close()
+	assert.Equal(t, CacheBackendBolt, responses.Stats().Backend)
+	assert.Same(t, responses, packuments)
+
+	o.cacheBackend = "floppy"
+	_, _, err = newCaches(o)
+	assert.NotNil(t, err)
+}
+
+func TestWithCacheOverridesBackend(t *testing.T) {
+	custom := newShardedCache(1, 0, 1)
+	New(WithCache(custom), WithCacheBackend(CacheBackendRedis, "not a url"))
+
+	assert.Same(t, custom, responseCache)
+	assert.Same(t, custom, packumentCache)
+}
+
+func TestCacheStatsCountsLookups(t *testing.T) {
+	cache := newLRUCache(10, 0)
+	cache.Set("a", []byte("1"), time.Minute)
+
+	cache.Get("a")
+	cache.Get("a")
+	cache.Get("b")
+
+	cache.Delete("a")
+	cache.Get("a")
+
+	assert.Equal(t, CacheStats{Backend: CacheBackendMemory, Entries: 0, Hits: 2, Misses: 2}, cache.Stats())
+
+	cache = newLRUCache(1, 0)
+	cache.Set("a", []byte("1"), 0)
+	cache.Set("b", []byte("2"), 0)
+	assert.Equal(t, uint64(1), cache.Stats().Evictions)
+}
+
+func TestTTLPolicyByVolatility(t *testing.T) {
+	New(WithResponseCache(10, time.Minute), WithPackumentCache(10, 5*time.Minute), WithVersionDocumentTTL(24*time.Hour), WithNegativeCache(30*time.Second))
+
+	assert.Equal(t, time.Minute, ttlFor(treeKeyPrefix+"react@16.13.0"))
+	assert.Equal(t, 5*time.Minute, ttlFor(packumentKeyPrefix+"react"))
+	assert.Equal(t, 24*time.Hour, ttlFor(versionKeyPrefix+"react@16.13.0"))
+	assert.Equal(t, 30*time.Second, ttlFor(negativePackumentKey("react")))
+}
+
+func TestFetchPackageCachesVersionDocuments(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{
+		"left-pad": {"1.3.0": {"pad": "^1.0.0"}},
+	})
+	New(WithRegistryURL(registry.URL))
+
+	for i := 0; i < 3; i++ {
+		pkg, err := fetchPackage(context.Background(), "left-pad", "1.3.0")
+		require.Nil(t, err)
+		assert.Equal(t, map[string]string{"pad": "^1.0.0"}, pkg.Dependencies)
+	}
+
+	assert.Equal(t, int64(1), registry.Calls())
+}
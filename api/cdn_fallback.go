@@ -0,0 +1,54 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// IE: jsDelivr only knows the version strings, which is all highestCompatibleVersion() needs
+type jsdelivrPackageResponse struct {
+	Versions []string `json:"versions"`
+}
+
+func fetchJsdelivrPackageMeta(ctx context.Context, name string) (*npmPackageMetaResponse, error) {
+	var parsed jsdelivrPackageResponse
+	if err := getJSON(ctx, fmt.Sprintf("%s/v1/package/npm/%s", opts.jsdelivrURL, name), &parsed); err != nil {
+		loggerFrom(ctx).Error("Could not fetch jsDelivr versions", "name", name, "error", err)
+		return nil, err
+	}
+
+	meta := &npmPackageMetaResponse{Versions: make(map[string]npmPackageResponse, len(parsed.Versions))}
+	for _, version := range parsed.Versions {
+		meta.Versions[version] = npmPackageResponse{Name: name, Version: version}
+	}
+	return meta, nil
+}
+
+// IE: the published package.json carries the dependencies but no dist info, so no tarball verification for these
+func fetchUnpkgPackage(ctx context.Context, name, version string) (*npmPackageResponse, error) {
+	var parsed npmPackageResponse
+	if err := getJSON(ctx, fmt.Sprintf("%s/%s@%s/package.json", opts.unpkgURL, name, version), &parsed); err != nil {
+		loggerFrom(ctx).Error("Could not fetch unpkg package.json", "name", name, "version", version, "error", err)
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+func getJSON(ctx context.Context, url string, v interface{}) error {
+	resp, err := httpGet(ctx, url)
+	if err != nil {
+		return upstreamError(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", ErrPackageNotFound, url)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: unexpected status %d for %s", ErrRegistryUnavailable, resp.StatusCode, url)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func cdnFallbackServers(t *testing.T) {
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(registry.Close)
+
+	jsdelivr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/package/npm/left-pad", r.URL.Path)
+		_, _ = w.Write([]byte(`{"tags":{"latest":"1.3.0"},"versions":["1.3.0","1.2.0","1.1.3"]}`))
+	}))
+	t.Cleanup(jsdelivr.Close)
+
+	unpkg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/left-pad@1.3.0/package.json", r.URL.Path)
+		_, _ = w.Write([]byte(`{"name":"left-pad","version":"1.3.0","dependencies":{"pad":"^1.0.0"}}`))
+	}))
+	t.Cleanup(unpkg.Close)
+
+	New(WithRegistryURL(registry.URL), WithCDNFallback(true))
+	opts.jsdelivrURL = jsdelivr.URL
+	opts.unpkgURL = unpkg.URL
+}
+
+func TestFetchPackageMetaFallsBackOnJsdelivr(t *testing.T) {
+	cdnFallbackServers(t)
+
+	meta, err := fetchPackageMeta(context.Background(), "left-pad")
+	require.Nil(t, err)
+	assert.Len(t, meta.Versions, 3)
+
+	version, err := highestCompatibleVersion("left-pad", "^1.1.0", meta)
+	require.Nil(t, err)
+	assert.Equal(t, "1.3.0", version)
+}
+
+func TestFetchPackageFallsBackOnUnpkg(t *testing.T) {
+	cdnFallbackServers(t)
+
+	pkg, err := fetchPackage(context.Background(), "left-pad", "1.3.0")
+	require.Nil(t, err)
+	assert.Equal(t, "left-pad", pkg.Name)
+	assert.Equal(t, map[string]string{"pad": "^1.0.0"}, pkg.Dependencies)
+}
+
+func TestFetchPackageMetaWithoutFallback(t *testing.T) {
+	cdnFallbackServers(t)
+	opts.cdnFallback = false
+
+	_, err := fetchPackageMeta(context.Background(), "left-pad")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// IE: as the server leaves it once the handshake verified a certificate
+func withClientCertificate(req *http.Request, commonName string) *http.Request {
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: commonName}}}}}
+	return req
+}
+
+func TestRequireClientCertificate(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{"app": {"1.0.0": nil}})
+	path := filepath.Join(t.TempDir(), "audit.log")
+	handler := New(WithRegistryURL(registry.URL), WithClientCertificates(true), WithAuditLog(path))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "unauthorized", decodeErrorPayload(t, rec).Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, withClientCertificate(httptest.NewRequest("GET", "/package/app/1.0.0", nil), "ci"))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	// IE: the kubelet has no certificate
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	require.Nil(t, FlushAuditLog())
+	data, err := os.ReadFile(path)
+	require.Nil(t, err)
+	records := readAuditRecords(t, data)
+	require.Len(t, records, 1)
+	assert.Equal(t, "ci", records[0].Client)
+}
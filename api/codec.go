@@ -0,0 +1,18 @@
+//go:build !jsoniter
+
+package api
+
+import "encoding/json"
+
+// IE: registry documents (packuments run into megabytes) and cached subtrees
+// are decoded and encoded through these, build with -tags jsoniter to swap in
+// a faster codec. The tree responses themselves are written by streamTree
+const jsonCodec = "encoding/json"
+
+func decodeJSON(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func encodeJSON(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
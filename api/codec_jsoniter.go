@@ -0,0 +1,18 @@
+//go:build jsoniter
+
+package api
+
+import jsoniter "github.com/json-iterator/go"
+
+// IE: same behaviour as encoding/json (field tags, map key order, html escaping), only faster
+var jsoniterCodec = jsoniter.ConfigCompatibleWithStandardLibrary
+
+const jsonCodec = "jsoniter"
+
+func decodeJSON(data []byte, v interface{}) error {
+	return jsoniterCodec.Unmarshal(data, v)
+}
+
+func encodeJSON(v interface{}) ([]byte, error) {
+	return jsoniterCodec.Marshal(v)
+}
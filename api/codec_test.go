@@ -0,0 +1,31 @@
+package api
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// IE: runs against whichever codec the build tags select, both must agree with encoding/json
+func TestCodecMatchesEncodingJSON(t *testing.T) {
+	fixture, err := os.ReadFile(filepath.Join("testdata", "react-16.13.0.json"))
+	require.Nil(t, err)
+
+	var decoded, expected NpmPackageVersion
+	require.Nil(t, decodeJSON(fixture, &decoded))
+	require.Nil(t, json.Unmarshal(fixture, &expected))
+
+	encoded, err := encodeJSON(&decoded)
+	require.Nil(t, err)
+	expectedEncoded, err := json.Marshal(&expected)
+	require.Nil(t, err)
+	assert.Equal(t, string(expectedEncoded), string(encoded))
+
+	var meta npmPackageMetaResponse
+	require.Nil(t, decodeJSON([]byte(`{"versions": {"1.0.0": {"name": "a", "version": "1.0.0", "dependencies": {"b": "^1.0.0"}}}}`), &meta))
+	assert.Equal(t, map[string]string{"b": "^1.0.0"}, meta.Versions["1.0.0"].Dependencies)
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// IE: a package showing up in the stored resolutions, each counted once (its
+// last record) however often it was resolved again
+type commonPackage struct {
+	Name string `json:"name"`
+	// IE: the resolutions with any of its versions
+	Resolutions int             `json:"resolutions"`
+	Versions    []commonVersion `json:"versions"`
+}
+
+type commonVersion struct {
+	Version     string `json:"version"`
+	Resolutions int    `json:"resolutions"`
+}
+
+// IE: most resolutions first, then by name (and version). The roots of the
+// resolutions only count when another tree depends on them
+func commonPackages(store *historyStore, limit int) (int, []commonPackage, error) {
+	resolutions := 0
+	byName := make(map[string]map[string]int)
+	withName := make(map[string]int)
+	err := store.latest(func(record *historyRecord) error {
+		resolutions++
+		names := make(map[string]bool)
+		for _, key := range record.Packages {
+			at := strings.LastIndex(key, "@")
+			if at <= 0 {
+				continue
+			}
+			name, version := key[:at], key[at+1:]
+			if byName[name] == nil {
+				byName[name] = make(map[string]int)
+			}
+			byName[name][version]++
+			if !names[name] {
+				names[name] = true
+				withName[name]++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	packages := make([]commonPackage, 0, len(byName))
+	for name, versions := range byName {
+		pkg := commonPackage{Name: name, Resolutions: withName[name], Versions: make([]commonVersion, 0, len(versions))}
+		for version, n := range versions {
+			pkg.Versions = append(pkg.Versions, commonVersion{Version: version, Resolutions: n})
+		}
+		sort.Slice(pkg.Versions, func(i, j int) bool {
+			if pkg.Versions[i].Resolutions != pkg.Versions[j].Resolutions {
+				return pkg.Versions[i].Resolutions > pkg.Versions[j].Resolutions
+			}
+			return pkg.Versions[i].Version < pkg.Versions[j].Version
+		})
+		packages = append(packages, pkg)
+	}
+	sort.Slice(packages, func(i, j int) bool {
+		if packages[i].Resolutions != packages[j].Resolutions {
+			return packages[i].Resolutions > packages[j].Resolutions
+		}
+		return packages[i].Name < packages[j].Name
+	})
+	if len(packages) > limit {
+		packages = packages[:limit]
+	}
+	return resolutions, packages, nil
+}
+
+// IE: GET /history/common?limit=, what to pre-approve or warm the cache with
+func commonPackagesHandler(w http.ResponseWriter, r *http.Request) {
+	limit, err := requestLimit(r.URL.Query())
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	resolutions, packages, err := commonPackages(history, limit)
+	if err != nil {
+		loggerFrom(r.Context()).Error("Could not read the history", "error", err)
+		httpError(w, r, fmt.Errorf("%w: %w", errInternal, err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(struct {
+		Resolutions int             `json:"resolutions"`
+		Packages    []commonPackage `json:"packages"`
+	}{resolutions, packages})
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/snyk/snyk-code-review-exercise/internal/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommonPackages(t *testing.T) {
+	registry := newFakeRegistry(t, fixtures.Registry{
+		"app":    {"1.0.0": {"a": "^1.0.0", "b": "^1.0.0"}},
+		"tool":   {"1.0.0": {"b": "^2.0.0", "@s/c": "^1.0.0"}, "2.0.0": {"b": "^2.0.0"}},
+		"a":      {"1.0.0": {"b": "^1.0.0"}},
+		"b":      {"1.0.0": nil, "2.0.0": nil},
+		"@s/c":   {"1.0.0": nil},
+		"unused": {"1.0.0": nil},
+	})
+	handler := New(WithRegistryURL(registry.URL), WithResponseCache(0, 0), WithResolutionHistory(filepath.Join(t.TempDir(), "history.db"), 0))
+	t.Cleanup(func() { New() })
+
+	// IE: app twice, it still counts once
+	for _, path := range []string{"/package/app/1.0.0", "/package/tool/1.0.0", "/package/tool/2.0.0", "/package/app/^1.0.0", "/package/unused/1.0.0"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		require.Equal(t, http.StatusOK, rec.Code, path)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/history/common?limit=2", nil))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var common struct {
+		Resolutions int             `json:"resolutions"`
+		Packages    []commonPackage `json:"packages"`
+	}
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &common))
+	assert.Equal(t, 4, common.Resolutions)
+	assert.Equal(t, []commonPackage{
+		{Name: "b", Resolutions: 3, Versions: []commonVersion{{"2.0.0", 2}, {"1.0.0", 1}}},
+		{Name: "@s/c", Resolutions: 1, Versions: []commonVersion{{"1.0.0", 1}}},
+	}, common.Packages)
+}
+
+func TestCommonPackagesWithoutHistory(t *testing.T) {
+	handler := New()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/history/common", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
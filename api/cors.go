@@ -0,0 +1,175 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IE: what a dashboard most likely sends, the client header is added to them
+var defaultCORSHeaders = []string{"Authorization", "Content-Type", requestIDHeader, featureFlagsHeader}
+
+// IE: the response headers a page may read besides the safelisted ones
+var corsExposedHeaders = strings.Join([]string{
+	requestIDHeader, featureFlagsHeader, resolutionStatsHeader, "X-Cache-Status", "X-Partial-Tree",
+	"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After", "WWW-Authenticate",
+}, ", ")
+
+// IE: nil unless WithCORS is set, replaced by every New()
+var corsRules *corsPolicy
+
+type corsPolicy struct {
+	anyOrigin bool
+	origins   map[string]bool
+	// IE: "https://*.example.com" as the scheme and the suffix of the host
+	wildcards [][2]string
+
+	methods      map[string]bool
+	headers      map[string]bool
+	allowMethods string
+	allowHeaders string
+	maxAge       string
+}
+
+func newCORSPolicy(origins, methods, headers []string, maxAge time.Duration) *corsPolicy {
+	if len(origins) == 0 {
+		return nil
+	}
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodPost}
+	}
+	if len(headers) == 0 {
+		headers = defaultCORSHeaders
+	}
+	if opts.clientHeader != "" {
+		headers = append(append([]string(nil), headers...), opts.clientHeader)
+	}
+
+	p := &corsPolicy{origins: make(map[string]bool), methods: make(map[string]bool), headers: make(map[string]bool)}
+	for _, origin := range origins {
+		scheme, host, _ := strings.Cut(origin, "://*")
+		switch {
+		case origin == "*":
+			p.anyOrigin = true
+		case strings.HasPrefix(host, "."):
+			p.wildcards = append(p.wildcards, [2]string{strings.ToLower(scheme) + "://", strings.ToLower(host)})
+		default:
+			p.origins[strings.ToLower(origin)] = true
+		}
+	}
+	for _, method := range methods {
+		p.methods[strings.ToUpper(method)] = true
+	}
+	for _, header := range headers {
+		p.headers[http.CanonicalHeaderKey(header)] = true
+	}
+	p.allowMethods, p.allowHeaders = strings.ToUpper(strings.Join(methods, ", ")), strings.Join(headers, ", ")
+	if maxAge > 0 {
+		p.maxAge = strconv.Itoa(int(maxAge / time.Second))
+	}
+	return p
+}
+
+func (p *corsPolicy) allowsOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	if p.anyOrigin || p.origins[origin] {
+		return true
+	}
+	for _, wildcard := range p.wildcards {
+		host, found := strings.CutPrefix(origin, wildcard[0])
+		// IE: a subdomain, not the domain itself nor a path smuggled in
+		if found && len(host) > len(wildcard[1]) && strings.HasSuffix(host, wildcard[1]) && !strings.ContainsAny(host, "/@") {
+			return true
+		}
+	}
+	return false
+}
+
+// IE: the browser sends them lowercased and comma separated
+func (p *corsPolicy) allowsHeaders(requested string) bool {
+	for _, header := range strings.Split(requested, ",") {
+		if header = strings.TrimSpace(header); header != "" && !p.headers[http.CanonicalHeaderKey(header)] {
+			return false
+		}
+	}
+	return true
+}
+
+// IE: outside the router, a preflight is an OPTIONS request no route matches
+// and it carries no token, authenticate would reject it. Requests of an origin
+// that isn't allowed are still served, without the headers the browser won't
+// hand the response to the page
+func withCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy := corsRules
+		origin := r.Header.Get("Origin")
+		if policy == nil || origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		method := r.Header.Get("Access-Control-Request-Method")
+		preflight := r.Method == http.MethodOptions && method != ""
+		w.Header().Add("Vary", "Origin")
+		if preflight {
+			w.Header().Add("Vary", "Access-Control-Request-Method, Access-Control-Request-Headers")
+		}
+		if !policy.allowsOrigin(origin) {
+			if preflight {
+				loggerFrom(r.Context()).Debug("Rejected CORS preflight", "origin", origin)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowOrigin := origin
+		if policy.anyOrigin {
+			allowOrigin = "*"
+		}
+		w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+		if !preflight {
+			w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !policy.methods[method] || !policy.allowsHeaders(r.Header.Get("Access-Control-Request-Headers")) {
+			loggerFrom(r.Context()).Debug("Rejected CORS preflight", "origin", origin, "method", method, "headers", r.Header.Get("Access-Control-Request-Headers"))
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Methods", policy.allowMethods)
+		w.Header().Set("Access-Control-Allow-Headers", policy.allowHeaders)
+		if policy.maxAge != "" {
+			w.Header().Set("Access-Control-Max-Age", policy.maxAge)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// ParseCORSOrigins parses a comma separated list of origins allowed to call
+// the API from a browser, for WithCORS: "*" for any of them, an origin
+// (scheme://host[:port]) or the subdomains of a host, i.e.
+// "https://*.example.com".
+func ParseCORSOrigins(value string) ([]string, error) {
+	var origins []string
+	for _, origin := range strings.Split(value, ",") {
+		origin = strings.TrimSuffix(strings.TrimSpace(origin), "/")
+		if origin == "" {
+			continue
+		}
+		if origin != "*" {
+			parsed, err := url.Parse(strings.Replace(origin, "://*.", "://wildcard.", 1))
+			if err != nil || parsed.Scheme == "" || parsed.Host == "" || parsed.Path != "" || parsed.RawQuery != "" || parsed.User != nil {
+				return nil, fmt.Errorf("expected *, scheme://host[:port] or scheme://*.host, got %q", origin)
+			}
+		}
+		origins = append(origins, origin)
+	}
+	return origins, nil
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fromOrigin(handler http.Handler, method, path, origin string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Origin", origin)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCORS(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{"app": {"1.0.0": nil}})
+	issuer := newFakeIssuer(t)
+	handler := New(
+		WithRegistryURL(registry.URL),
+		WithJWTAuth(issuer.URL, "", issuer.URL+"/keys"),
+		WithClientHeader("X-Client-ID"),
+		WithCORS([]string{"https://dashboard.example.com", "https://*.internal.example.com"}, nil, nil, 10*time.Minute),
+	)
+
+	// IE: no token on a preflight, it's answered before authenticate
+	rec := fromOrigin(handler, http.MethodOptions, "/cache/purge/app", "https://dashboard.example.com", map[string]string{
+		"Access-Control-Request-Method":  "POST",
+		"Access-Control-Request-Headers": "authorization,x-client-id",
+	})
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "https://dashboard.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, POST", rec.Header().Get("Access-Control-Allow-Methods"))
+	assert.Contains(t, rec.Header().Get("Access-Control-Allow-Headers"), "X-Client-ID")
+	assert.Equal(t, "600", rec.Header().Get("Access-Control-Max-Age"))
+	assert.Contains(t, rec.Header().Values("Vary"), "Origin")
+
+	token := sign(t, jwt.SigningMethodRS256, "rsa-1", issuer.rsaKey, issuer.claims("dashboard"))
+	rec = fromOrigin(handler, http.MethodGet, "/package/app/1.0.0", "https://ci.internal.example.com", map[string]string{"Authorization": "Bearer " + token})
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "https://ci.internal.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, rec.Header().Get("Access-Control-Expose-Headers"), "X-Cache-Status")
+	// IE: the errors too, or the page couldn't read why
+	rec = fromOrigin(handler, http.MethodGet, "/package/app/1.0.0", "https://dashboard.example.com", nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "https://dashboard.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+
+	for name, tc := range map[string]struct {
+		origin, method, headers string
+	}{
+		"origin":        {"https://evil.example.com", "GET", ""},
+		"domain itself": {"https://internal.example.com", "GET", ""},
+		"scheme":        {"http://dashboard.example.com", "GET", ""},
+		"method":        {"https://dashboard.example.com", "DELETE", ""},
+		"header":        {"https://dashboard.example.com", "GET", "x-debug"},
+	} {
+		rec = fromOrigin(handler, http.MethodOptions, "/package/app/1.0.0", tc.origin, map[string]string{
+			"Access-Control-Request-Method":  tc.method,
+			"Access-Control-Request-Headers": tc.headers,
+		})
+		assert.Equal(t, http.StatusForbidden, rec.Code, name)
+		assert.Empty(t, rec.Header().Get("Access-Control-Allow-Methods"), name)
+	}
+
+	// IE: served, but the browser keeps the response from the page
+	rec = fromOrigin(handler, http.MethodGet, "/healthz", "https://evil.example.com", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSAnyOrigin(t *testing.T) {
+	handler := New(WithCORS([]string{"*"}, nil, nil, 0))
+	rec := fromOrigin(handler, http.MethodOptions, "/cache/stats", "https://anywhere.example.org", map[string]string{"Access-Control-Request-Method": "GET"})
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "*", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, rec.Header().Get("Access-Control-Max-Age"))
+
+	// IE: off without origins, OPTIONS reaches the router
+	handler = New()
+	rec = fromOrigin(handler, http.MethodOptions, "/cache/stats", "https://anywhere.example.org", map[string]string{"Access-Control-Request-Method": "GET"})
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestParseCORSOrigins(t *testing.T) {
+	origins, err := ParseCORSOrigins(" https://dashboard.example.com/, https://*.example.com, http://localhost:8080 ")
+	require.Nil(t, err)
+	assert.Equal(t, []string{"https://dashboard.example.com", "https://*.example.com", "http://localhost:8080"}, origins)
+
+	for _, invalid := range []string{"dashboard.example.com", "https://example.com/app", "https://user@example.com", "https://example.com?a=b"} {
+		_, err = ParseCORSOrigins(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+)
+
+var csvHeader = []string{"name", "version", "license", "deprecated", "directParent"}
+
+// IE: the deprecated field of a version document is the message npm prints,
+// a few old packages have a boolean there
+type deprecationNotice string
+
+func (d *deprecationNotice) UnmarshalJSON(data []byte) error {
+	var message string
+	if err := json.Unmarshal(data, &message); err == nil {
+		*d = deprecationNotice(message)
+		return nil
+	}
+	var deprecated bool
+	if err := json.Unmarshal(data, &deprecated); err == nil && deprecated {
+		*d = "deprecated"
+		return nil
+	}
+	*d = ""
+	return nil
+}
+
+// IE: the free text cells a spreadsheet would take for a formula
+func csvText(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// IE: one row per name@version but the root's, sorted. The packages requiring
+// a version are its direct parents, space separated in one cell
+func dependencyRows(root *NpmPackageVersion, docs map[string]*npmPackageResponse) [][]string {
+	unique := uniqueVersions(root)
+	rootKey := root.Name + "@" + root.Version
+	parents := make(map[string]map[string]bool)
+	for parentKey, parent := range unique {
+		for _, dep := range parent.Dependencies {
+			if dep == nil {
+				continue
+			}
+			key := dep.Name + "@" + dep.Version
+			if parents[key] == nil {
+				parents[key] = make(map[string]bool)
+			}
+			parents[key][parentKey] = true
+		}
+	}
+
+	keys := make([]string, 0, len(unique))
+	for key := range unique {
+		if key != rootKey {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if unique[keys[i]].Name != unique[keys[j]].Name {
+			return unique[keys[i]].Name < unique[keys[j]].Name
+		}
+		return keys[i] < keys[j]
+	})
+
+	rows := make([][]string, 0, len(keys))
+	for _, key := range keys {
+		pkg := unique[key]
+		license, deprecated := "", ""
+		if doc := docs[key]; doc != nil {
+			license, deprecated = doc.license(), string(doc.Deprecated)
+		}
+		by := make([]string, 0, len(parents[key]))
+		for parent := range parents[key] {
+			by = append(by, parent)
+		}
+		sort.Strings(by)
+		rows = append(rows, []string{pkg.Name, pkg.Version, csvText(license), csvText(deprecated), strings.Join(by, " ")})
+	}
+	return rows
+}
+
+func writeCSV(w io.Writer, tree *NpmPackageVersion, docs map[string]*npmPackageResponse) error {
+	out := csv.NewWriter(w)
+	_ = out.Write(csvHeader)
+	_ = out.WriteAll(dependencyRows(tree, docs))
+	return out.Error()
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/snyk/snyk-code-review-exercise/internal/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSVFormat(t *testing.T) {
+	packages := fixtures.Registry{
+		"app":    {"1.0.0": {"a": "^1.0.0", "@s/b": "^1.0.0"}},
+		"a":      {"1.0.0": {"shared": "^1.0.0"}},
+		"@s/b":   {"1.0.0": {"shared": "^1.0.0", "a": "^1.0.0"}},
+		"shared": {"1.0.0": nil},
+	}
+	fields := map[string]string{
+		"a@1.0.0":      `"license": "MIT", "deprecated": "=HYPERLINK(\"x\") use c"`,
+		"@s/b@1.0.0":   `"licenses": [{"type": "MIT"}, {"type": "ISC"}], "deprecated": true`,
+		"shared@1.0.0": `"license": "ISC", "deprecated": false`,
+	}
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(strings.ReplaceAll(r.URL.Path, "%2f", "/"), "/")
+		at := strings.LastIndex(path, "/")
+		if at > 0 {
+			name, version := path[:at], path[at+1:]
+			if deps, found := packages[name][version]; found {
+				encoded, _ := json.Marshal(deps)
+				doc := `{"name": "` + name + `", "version": "` + version + `", "dependencies": ` + string(encoded)
+				if extra := fields[name+"@"+version]; extra != "" {
+					doc += ", " + extra
+				}
+				_, _ = w.Write([]byte(doc + "}"))
+				return
+			}
+		}
+		packages.ServeHTTP(w, r)
+	}))
+	t.Cleanup(registry.Close)
+	handler := New(WithRegistryURL(registry.URL))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0?format=csv", nil))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "text/csv; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="app@1.0.0.csv"`, rec.Header().Get("Content-Disposition"))
+
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	require.Nil(t, err)
+	assert.Equal(t, [][]string{
+		csvHeader,
+		{"@s/b", "1.0.0", "(MIT OR ISC)", "deprecated", "app@1.0.0"},
+		{"a", "1.0.0", "MIT", `'=HYPERLINK("x") use c`, "@s/b@1.0.0 app@1.0.0"},
+		{"shared", "1.0.0", "ISC", "", "@s/b@1.0.0 a@1.0.0"},
+	}, rows)
+}
+
+func TestUnknownFormat(t *testing.T) {
+	_, err := requestFormat(map[string][]string{"format": {"xml"}})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+	format, err := requestFormat(map[string][]string{"format": {"CSV"}})
+	require.Nil(t, err)
+	assert.Equal(t, formatCSV, format)
+}
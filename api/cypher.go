@@ -0,0 +1,67 @@
+package api
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strings"
+)
+
+// IE: ?format=cypher, statements to run against Neo4j (i.e. with cypher-shell).
+// Everything is merged on name and version, the exports of many resolutions
+// add up to one graph
+var cypherPrelude = "CREATE CONSTRAINT package_version IF NOT EXISTS FOR (p:Package) REQUIRE (p.name, p.version) IS UNIQUE;\n"
+
+var cypherEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`, "\r", `\r`)
+
+func cypherString(value string) string {
+	return "'" + cypherEscaper.Replace(value) + "'"
+}
+
+func cypherPackage(variable string, pkg *NpmPackageVersion) string {
+	return "(" + variable + ":Package {name: " + cypherString(pkg.Name) + ", version: " + cypherString(pkg.Version) + "})"
+}
+
+// IE: one node per name@version, one DEPENDS_ON relationship per range a
+// version asks for, sorted so that two exports of the same tree are the same
+func writeCypher(w io.Writer, tree *NpmPackageVersion, docs map[string]*npmPackageResponse) error {
+	unique := uniqueVersions(tree)
+	keys := make([]string, 0, len(unique))
+	for key := range unique {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	out := bufio.NewWriter(w)
+	_, _ = out.WriteString(cypherPrelude)
+	for _, key := range keys {
+		pkg := unique[key]
+		_, _ = out.WriteString("MERGE " + cypherPackage("p", pkg))
+		if doc := docs[key]; doc != nil {
+			_, _ = out.WriteString(" SET p.license = " + cypherString(doc.license()))
+			if doc.Deprecated != "" {
+				_, _ = out.WriteString(", p.deprecated = " + cypherString(string(doc.Deprecated)))
+			}
+		}
+		_, _ = out.WriteString(";\n")
+	}
+	for _, key := range keys {
+		pkg := unique[key]
+		names := make([]string, 0, len(pkg.Dependencies))
+		for name, dep := range pkg.Dependencies {
+			if dep != nil {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			constraint := ""
+			if doc := docs[key]; doc != nil {
+				constraint = doc.Dependencies[name]
+			}
+			_, _ = out.WriteString("MATCH " + cypherPackage("a", pkg) + ", " + cypherPackage("b", pkg.Dependencies[name]) +
+				" MERGE (a)-[:DEPENDS_ON {range: " + cypherString(constraint) + "}]->(b);\n")
+		}
+	}
+	return out.Flush()
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/snyk/snyk-code-review-exercise/internal/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCypherFormat(t *testing.T) {
+	registry := licensedRegistry(t, fixtures.Registry{
+		"app":    {"1.0.0": {"a": "^1.0.0", "shared": "1.x"}},
+		"a":      {"1.0.0": {"shared": "^1.0.0"}},
+		"shared": {"1.0.0": nil},
+	}, map[string]string{"app@1.0.0": `"MIT"`, "a@1.0.0": `"Bob's license"`})
+	handler := New(WithRegistryURL(registry.URL))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0?format=cypher", nil))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, `attachment; filename="app@1.0.0.cypher"`, rec.Header().Get("Content-Disposition"))
+	assert.Equal(t, strings.Join([]string{
+		strings.TrimSuffix(cypherPrelude, "\n"),
+		`MERGE (p:Package {name: 'a', version: '1.0.0'}) SET p.license = 'Bob\'s license';`,
+		`MERGE (p:Package {name: 'app', version: '1.0.0'}) SET p.license = 'MIT';`,
+		`MERGE (p:Package {name: 'shared', version: '1.0.0'}) SET p.license = '';`,
+		`MATCH (a:Package {name: 'a', version: '1.0.0'}), (b:Package {name: 'shared', version: '1.0.0'}) MERGE (a)-[:DEPENDS_ON {range: '^1.0.0'}]->(b);`,
+		`MATCH (a:Package {name: 'app', version: '1.0.0'}), (b:Package {name: 'a', version: '1.0.0'}) MERGE (a)-[:DEPENDS_ON {range: '^1.0.0'}]->(b);`,
+		`MATCH (a:Package {name: 'app', version: '1.0.0'}), (b:Package {name: 'shared', version: '1.0.0'}) MERGE (a)-[:DEPENDS_ON {range: '1.x'}]->(b);`,
+		``,
+	}, "\n"), rec.Body.String())
+}
+
+func TestCypherString(t *testing.T) {
+	assert.Equal(t, `'a\\b \'c\' \nd'`, cypherString("a\\b 'c' \nd"))
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// IE: a node of the dag-output document, its dependencies by name@version
+type dagNode struct {
+	Name         string            `json:"name"`
+	Version      string            `json:"version"`
+	Dependencies map[string]string `json:"dependencies,omitempty"`
+}
+
+// IE: the document of the resolver package graph, the route and the resolve
+// command answer alike
+type dagDocument struct {
+	Root    string    `json:"root"`
+	Partial bool      `json:"partial,omitempty"`
+	Nodes   []dagNode `json:"nodes"`
+}
+
+// IE: every name@version once, the subtrees shared by several parents are not
+// written again under each of them. Nodes by name then version
+func newDAGDocument(tree *NpmPackageVersion) dagDocument {
+	unique := uniqueVersions(tree)
+	nodes := make([]dagNode, 0, len(unique))
+	for _, pkg := range unique {
+		node := dagNode{Name: pkg.Name, Version: pkg.Version}
+		for name, dep := range pkg.Dependencies {
+			if dep == nil {
+				continue
+			}
+			if node.Dependencies == nil {
+				node.Dependencies = make(map[string]string, len(pkg.Dependencies))
+			}
+			node.Dependencies[name] = dep.Name + "@" + dep.Version
+		}
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Name != nodes[j].Name {
+			return nodes[i].Name < nodes[j].Name
+		}
+		return nodes[i].Version < nodes[j].Version
+	})
+	return dagDocument{Root: tree.Name + "@" + tree.Version, Partial: tree.Partial, Nodes: nodes}
+}
+
+func writeDAG(w io.Writer, tree *NpmPackageVersion) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(newDAGDocument(tree))
+}
+
+// IE: the JSON answer with the dag-output feature, off the same cached tree
+// as the nested one
+func dagHandler(w http.ResponseWriter, r *http.Request, pkgName, pkgVersion string, start time.Time) {
+	ctx, stats := requestResolutionStats(r.Context())
+	tree, release, status, err := loadTree(ctx, pkgName, pkgVersion, r.URL.Query())
+	if err != nil {
+		writeResolveError(w, r, err)
+		return
+	}
+	defer release()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache-Status", status)
+	w.Header().Set(resolutionStatsHeader, stats.snapshot().String())
+	if tree.Partial {
+		w.Header().Set("X-Partial-Tree", "true")
+	}
+	if err := writeDAG(w, tree); err != nil {
+		loggerFrom(r.Context()).Debug("Could not write response", "error", err)
+	}
+	loggerFrom(r.Context()).Info("Request completed", "duration", time.Since(start), "format", FeatureDAGOutput, "cache", status)
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPackageHandlerDAGOutput(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{
+		"app":    {"1.0.0": {"a": "^1.0.0", "b": "^1.0.0"}},
+		"a":      {"1.0.0": {"shared": "^1.0.0"}},
+		"b":      {"1.0.0": {"shared": "^1.0.0"}},
+		"shared": {"1.0.0": nil},
+	})
+	handler := New(WithRegistryURL(registry.URL))
+
+	req := httptest.NewRequest("GET", "/package/app/1.0.0", nil)
+	req.Header.Set(featureFlagsHeader, "dag-output=on")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{
+		"root": "app@1.0.0",
+		"nodes": [
+			{"name": "a", "version": "1.0.0", "dependencies": {"shared": "shared@1.0.0"}},
+			{"name": "app", "version": "1.0.0", "dependencies": {"a": "a@1.0.0", "b": "b@1.0.0"}},
+			{"name": "b", "version": "1.0.0", "dependencies": {"shared": "shared@1.0.0"}},
+			{"name": "shared", "version": "1.0.0"}
+		]
+	}`, rec.Body.String())
+
+	// IE: the nested tree still by default, off the tree the DAG cached
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, cacheStatusHit, rec.Header().Get("X-Cache-Status"))
+	assert.Contains(t, rec.Body.String(), `"shared": {`)
+}
@@ -0,0 +1,21 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// IE: bounds the whole request, resolution included, the upstream calls use the
+// request context so they are cancelled with it
+func withDeadline(next http.Handler, timeout time.Duration) http.Handler {
+	if timeout <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
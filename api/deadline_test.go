@@ -0,0 +1,23 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPackageHandlerTimesOutSlowResolutions(t *testing.T) {
+	registry := newFakeRegistry(t, loadRegistryFixture(t, "react-16.13.0"))
+	registry.delay = time.Second
+	handler := New(WithRegistryURL(registry.URL), WithRequestTimeout(50*time.Millisecond))
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/react/16.13.0", nil))
+
+	assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+	assert.Less(t, time.Since(start), time.Second)
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"time"
+)
+
+// IE: the uptime is the one of the process, New() may be called again
+var processStart = time.Now()
+
+// IE: one look at the health of the process: is it leaking goroutines, growing
+// its heap, are the caches full, how much work is in flight
+type debugStatus struct {
+	StartedAt     time.Time `json:"startedAt"`
+	UptimeSeconds float64   `json:"uptimeSeconds"`
+	GoVersion     string    `json:"goVersion"`
+	GOMAXPROCS    int       `json:"gomaxprocs"`
+	Goroutines    int       `json:"goroutines"`
+
+	Memory              memoryStatus          `json:"memory"`
+	Caches              map[string]CacheStats `json:"caches"`
+	ResolutionsInFlight int                   `json:"resolutionsInFlight"`
+	Upstream            upstreamStatus        `json:"upstream"`
+}
+
+type memoryStatus struct {
+	HeapAllocBytes uint64  `json:"heapAllocBytes"`
+	HeapInuseBytes uint64  `json:"heapInuseBytes"`
+	HeapObjects    uint64  `json:"heapObjects"`
+	SysBytes       uint64  `json:"sysBytes"`
+	NumGC          uint32  `json:"numGC"`
+	GCPauseTotalMs float64 `json:"gcPauseTotalMs"`
+	LastGC         string  `json:"lastGC,omitempty"`
+}
+
+type upstreamStatus struct {
+	Limit     int    `json:"limit"`
+	Queued    int    `json:"queued"`
+	Throttled uint64 `json:"throttled"`
+}
+
+func currentDebugStatus() debugStatus {
+	var mem runtime.MemStats
+	// IE: stops the world for a few microseconds, fine at the rate operators look
+	runtime.ReadMemStats(&mem)
+
+	status := debugStatus{
+		StartedAt:     processStart,
+		UptimeSeconds: time.Since(processStart).Seconds(),
+		GoVersion:     runtime.Version(),
+		GOMAXPROCS:    runtime.GOMAXPROCS(0),
+		Goroutines:    runtime.NumGoroutine(),
+		Memory: memoryStatus{
+			HeapAllocBytes: mem.HeapAlloc,
+			HeapInuseBytes: mem.HeapInuse,
+			HeapObjects:    mem.HeapObjects,
+			SysBytes:       mem.Sys,
+			NumGC:          mem.NumGC,
+			GCPauseTotalMs: float64(mem.PauseTotalNs) / float64(time.Millisecond),
+		},
+		Caches: make(map[string]CacheStats),
+		Upstream: upstreamStatus{
+			Limit:     upstreamLimiter.Limit(),
+			Queued:    upstreamLimiter.Queued(),
+			Throttled: upstreamLimiter.Throttled(),
+		},
+	}
+	if mem.LastGC > 0 {
+		status.Memory.LastGC = time.Unix(0, int64(mem.LastGC)).UTC().Format(time.RFC3339)
+	}
+	for layer, cache := range cacheLayers() {
+		status.Caches[layer] = cache.Stats()
+	}
+	activeResolutions.Range(func(_, _ interface{}) bool {
+		status.ResolutionsInFlight++
+		return true
+	})
+	return status
+}
+
+func debugStatusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(currentDebugStatus()); err != nil {
+		logger.Error("Could not write debug status", "error", err)
+	}
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDebugStatus(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{
+		"a": {"1.0.0": nil},
+	})
+	handler := New(WithRegistryURL(registry.URL))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/a/1.0.0", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	AdminHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/status", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var status debugStatus
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	assert.Greater(t, status.UptimeSeconds, 0.0)
+	assert.Greater(t, status.Goroutines, 0)
+	assert.Greater(t, status.GOMAXPROCS, 0)
+	assert.NotEmpty(t, status.GoVersion)
+	assert.NotZero(t, status.Memory.HeapAllocBytes)
+	assert.Equal(t, 0, status.ResolutionsInFlight)
+	assert.Equal(t, 128, status.Upstream.Limit)
+	require.Contains(t, status.Caches, "responses")
+	assert.NotZero(t, status.Caches["responses"].Entries)
+}
+
+func TestPublicHandlerDoesNotServeDebugStatus(t *testing.T) {
+	rec := httptest.NewRecorder()
+	New().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/status", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"net/url"
+	"sort"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// IE: a package resolved at more than one version, and the single version
+// every package depending on it would accept, like npm dedupe --dry-run
+type dedupeSuggestion struct {
+	Name string `json:"name"`
+	// IE: ascending
+	Versions []string `json:"versions"`
+	// IE: constraint -> the name@version of the packages asking for it
+	Constraints map[string][]string `json:"constraints"`
+	// IE: the highest published version satisfying every constraint, empty
+	// when none does
+	Suggested string `json:"suggested,omitempty"`
+}
+
+// IE: the root is left out, its version is the one asked for
+func dedupeSection(ctx context.Context, tree *NpmPackageVersion, query url.Values, report *treeReport) error {
+	docs, err := versionDocuments(ctx, tree)
+	if err != nil {
+		return err
+	}
+
+	versions := make(map[string]map[string]bool)
+	for _, pkg := range uniqueVersions(tree) {
+		if pkg == tree {
+			continue
+		}
+		if versions[pkg.Name] == nil {
+			versions[pkg.Name] = make(map[string]bool)
+		}
+		versions[pkg.Name][pkg.Version] = true
+	}
+
+	suggestions := []dedupeSuggestion{}
+	for name, resolved := range versions {
+		if len(resolved) < 2 {
+			continue
+		}
+		suggestion := dedupeSuggestion{Name: name, Constraints: make(map[string][]string)}
+		for version := range resolved {
+			suggestion.Versions = append(suggestion.Versions, version)
+		}
+		sortVersions(suggestion.Versions)
+		for parent, doc := range docs {
+			if constraint, found := doc.Dependencies[name]; found {
+				suggestion.Constraints[constraint] = append(suggestion.Constraints[constraint], parent)
+			}
+		}
+		for _, parents := range suggestion.Constraints {
+			sort.Strings(parents)
+		}
+
+		suggested, err := satisfyingAll(ctx, name, suggestion.Constraints)
+		if err != nil {
+			return err
+		}
+		suggestion.Suggested = suggested
+		suggestions = append(suggestions, suggestion)
+	}
+	sort.Slice(suggestions, func(i, j int) bool { return suggestions[i].Name < suggestions[j].Name })
+	report.Dedupe = suggestions
+	return nil
+}
+
+// IE: a constraint that isn't a semver range (i.e. a tag or a git url) can't
+// be reasoned about, nothing is suggested then
+func satisfyingAll(ctx context.Context, name string, constraints map[string][]string) (string, error) {
+	parsed := make([]*semver.Constraints, 0, len(constraints))
+	for constraint := range constraints {
+		c, err := semver.NewConstraint(constraint)
+		if err != nil {
+			return "", nil
+		}
+		parsed = append(parsed, c)
+	}
+	meta, err := fetchPackageMeta(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	published := parsedVersionsCache.sortedVersions(name, meta)
+	for i := len(published) - 1; i >= 0; i-- {
+		satisfied := true
+		for _, c := range parsed {
+			if !c.Check(published[i]) {
+				satisfied = false
+				break
+			}
+		}
+		if satisfied {
+			return published[i].Original(), nil
+		}
+	}
+	return "", nil
+}
+
+// IE: semver order, the versions that don't parse last in string order
+func sortVersions(versions []string) {
+	sort.Slice(versions, func(i, j int) bool {
+		a, errA := semver.NewVersion(versions[i])
+		b, errB := semver.NewVersion(versions[j])
+		switch {
+		case errA == nil && errB == nil:
+			return a.LessThan(b)
+		case errA != nil && errB != nil:
+			return versions[i] < versions[j]
+		}
+		return errA == nil
+	})
+}
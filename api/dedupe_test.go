@@ -0,0 +1,59 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDedupeSuggestions(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{
+		"app":     {"1.0.0": {"debug": "~4.1.0", "express": "^4.0.0", "pinned": "^1.0.0", "ms": "^2.0.0"}},
+		"express": {"4.18.1": {"debug": ">=4.0.0"}},
+		"pinned":  {"1.0.0": {"ms": "2.0.0", "debug": "4.3.4"}},
+		"debug":   {"4.1.1": {"ms": "^2.1.0"}, "4.3.4": {"ms": "^2.1.0"}, "4.4.0": nil},
+		"ms":      {"2.0.0": nil, "2.1.3": nil},
+	})
+	handler := New(WithRegistryURL(registry.URL))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0/report?sections=dedupe", nil))
+	report := decodeReport(t, rec)
+	assert.Empty(t, report.HeaviestPaths)
+	require.Len(t, report.Dedupe, 2)
+
+	// IE: ~4.1.0 and 4.3.4 can't both be satisfied
+	assert.Equal(t, dedupeSuggestion{
+		Name:     "debug",
+		Versions: []string{"4.1.1", "4.3.4", "4.4.0"},
+		Constraints: map[string][]string{
+			"~4.1.0":  {"app@1.0.0"},
+			">=4.0.0": {"express@4.18.1"},
+			"4.3.4":   {"pinned@1.0.0"},
+		},
+	}, report.Dedupe[0])
+
+	assert.Equal(t, "ms", report.Dedupe[1].Name)
+	assert.Equal(t, []string{"2.0.0", "2.1.3"}, report.Dedupe[1].Versions)
+	assert.Empty(t, report.Dedupe[1].Suggested)
+}
+
+func TestDedupeSuggestsHighestSatisfying(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{
+		"app": {"1.0.0": {"a": "^1.0.0", "b": "^1.0.0"}},
+		"a":   {"1.0.0": {"lib": "~1.2.0"}},
+		"b":   {"1.0.0": {"lib": "^1.2.3"}},
+		"lib": {"1.2.0": nil, "1.2.5": nil, "1.3.0": nil},
+	})
+	handler := New(WithRegistryURL(registry.URL))
+
+	// IE: 1.3.0 is out of ~1.2.0, 1.2.0 out of ^1.2.3
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0/report?sections=dedupe", nil))
+	report := decodeReport(t, rec)
+	require.Len(t, report.Dedupe, 1)
+	assert.Equal(t, []string{"1.2.5", "1.3.0"}, report.Dedupe[0].Versions)
+	assert.Equal(t, "1.2.5", report.Dedupe[0].Suggested)
+}
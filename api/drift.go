@@ -0,0 +1,359 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"golang.org/x/sync/errgroup"
+)
+
+const driftRoute = "drift"
+
+// IE: why a fresh resolution differs from the lockfile for a package
+const (
+	driftAdded            = "added"
+	driftRemoved          = "removed"
+	driftNewPublish       = "new publish"
+	driftConstraintChange = "constraint change"
+)
+
+var errInvalidBody = &Error{Code: "invalid_body", Status: http.StatusBadRequest, message: "invalid request body"}
+
+// IE: the body of POST /drift, a package.json and the package-lock.json next
+// to it
+type driftRequest struct {
+	Manifest struct {
+		Name            string            `json:"name"`
+		Version         string            `json:"version"`
+		Dependencies    map[string]string `json:"dependencies"`
+		DevDependencies map[string]string `json:"devDependencies"`
+	} `json:"manifest"`
+	Lockfile npmLockfile `json:"lockfile"`
+}
+
+// IE: lockfileVersion 2 and 3 list every package by its folder under
+// "packages", version 1 nests them under "dependencies"
+type npmLockfile struct {
+	LockfileVersion int                         `json:"lockfileVersion"`
+	Packages        map[string]lockedPackage    `json:"packages"`
+	Dependencies    map[string]lockedDependency `json:"dependencies"`
+}
+
+type lockedPackage struct {
+	// IE: set for the aliases only (i.e. "node_modules/b": {"name": "a"})
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Dev     bool   `json:"dev"`
+	Link    bool   `json:"link"`
+}
+
+type lockedDependency struct {
+	Version      string                      `json:"version"`
+	Dev          bool                        `json:"dev"`
+	Dependencies map[string]lockedDependency `json:"dependencies"`
+}
+
+// IE: name -> the versions the lockfile installs, the links (workspaces) left out
+func (l *npmLockfile) versions(includeDev bool) map[string]map[string]bool {
+	locked := make(map[string]map[string]bool)
+	add := func(name, version string) {
+		if locked[name] == nil {
+			locked[name] = make(map[string]bool)
+		}
+		locked[name][version] = true
+	}
+
+	if len(l.Packages) > 0 {
+		for folder, pkg := range l.Packages {
+			at := strings.LastIndex(folder, "node_modules/")
+			if at < 0 || pkg.Link || pkg.Version == "" || (pkg.Dev && !includeDev) {
+				continue
+			}
+			name := folder[at+len("node_modules/"):]
+			if pkg.Name != "" {
+				name = pkg.Name
+			}
+			add(name, pkg.Version)
+		}
+		return locked
+	}
+
+	var walk func(deps map[string]lockedDependency)
+	walk = func(deps map[string]lockedDependency) {
+		for name, dep := range deps {
+			if dep.Version != "" && (!dep.Dev || includeDev) {
+				add(name, dep.Version)
+			}
+			walk(dep.Dependencies)
+		}
+	}
+	walk(l.Dependencies)
+	return locked
+}
+
+// IE: a package a fresh resolution installs at other versions than the lockfile
+type driftChange struct {
+	Name     string   `json:"name"`
+	Locked   []string `json:"locked,omitempty"`
+	Resolved []string `json:"resolved,omitempty"`
+	// IE: one of the drift constants
+	Reason string `json:"reason"`
+	// IE: the ranges asking for the versions only the fresh resolution has ->
+	// the name@version of the packages with them, "" for the manifest
+	Constraints map[string][]string `json:"constraints,omitempty"`
+}
+
+type driftReport struct {
+	Name    string        `json:"name,omitempty"`
+	Version string        `json:"version,omitempty"`
+	Changes []driftChange `json:"changes"`
+	// IE: the dependencies of the manifest that aren't registry ranges (i.e.
+	// git urls, file: or workspace: ones), not resolved
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+// IE: the specs the registry can't answer, npm installs them from elsewhere
+func registrySpec(spec string) bool {
+	return !strings.Contains(spec, ":") && !strings.Contains(spec, "/")
+}
+
+func decodeDriftRequest(r *http.Request) (*driftRequest, error) {
+	body := &driftRequest{}
+	if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, fmt.Errorf("%w: at most %d bytes", errRequestTooLarge, tooLarge.Limit)
+		}
+		return nil, fmt.Errorf("%w: %w", errInvalidBody, err)
+	}
+	if body.Lockfile.Packages == nil && body.Lockfile.Dependencies == nil {
+		return nil, fmt.Errorf("%w: lockfile without packages nor dependencies", errInvalidBody)
+	}
+	return body, nil
+}
+
+func driftHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	log := requestLogger(r, "", "")
+	r = r.WithContext(withLogger(r.Context(), log))
+
+	body, err := decodeDriftRequest(r)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	includeDev, err := requestIncludeDev(r.URL.Query())
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+
+	ctx, _ := requestResolutionStats(r.Context())
+	report, err := compareLockfile(ctx, body, includeDev)
+	if err != nil {
+		writeResolveError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Debug("Could not write response", "error", err)
+	}
+	log.Info("Drift completed", "duration", time.Since(start), "changes", len(report.Changes))
+}
+
+// IE: the devDependencies of the manifest, and the dev packages of the lockfile
+func requestIncludeDev(query url.Values) (bool, error) {
+	value := strings.TrimSpace(query.Get("includeDev"))
+	if value == "" {
+		return false, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%w: includeDev must be a boolean, got %q", ErrInvalidQuery, value)
+	}
+	return enabled, nil
+}
+
+// IE: every direct dependency is resolved (and cached) like the package route
+// would, under a root standing for the manifest
+func compareLockfile(ctx context.Context, body *driftRequest, includeDev bool) (*driftReport, error) {
+	manifest := body.Manifest
+	report := &driftReport{Name: manifest.Name, Version: manifest.Version, Changes: []driftChange{}}
+	direct := make(map[string]string)
+	for name, spec := range manifest.Dependencies {
+		direct[name] = spec
+	}
+	if includeDev {
+		for name, spec := range manifest.DevDependencies {
+			direct[name] = spec
+		}
+	}
+	skipped := make(map[string]bool)
+	for name, spec := range direct {
+		if !registrySpec(spec) {
+			report.Skipped = append(report.Skipped, name+"@"+spec)
+			skipped[name] = true
+			delete(direct, name)
+		}
+	}
+	sort.Strings(report.Skipped)
+
+	root := &NpmPackageVersion{Name: manifest.Name, Version: manifest.Version, Dependencies: make(map[string]*NpmPackageVersion, len(direct))}
+	docs := make(map[string]*npmPackageResponse)
+	var mu sync.Mutex
+	var releases []func()
+	defer func() {
+		for _, release := range releases {
+			release()
+		}
+	}()
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(live().concurrency, 1))
+	for name, spec := range direct {
+		g.Go(func() error {
+			if err := checkPackageInput(name, spec); err != nil {
+				return err
+			}
+			tree, release, _, err := loadTree(gctx, name, spec, url.Values{})
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			releases = append(releases, release)
+			root.Dependencies[name] = tree
+			mu.Unlock()
+			treeDocs, err := versionDocuments(gctx, tree)
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			for key, doc := range treeDocs {
+				docs[key] = doc
+			}
+			mu.Unlock()
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	resolved := make(map[string]map[string]bool)
+	// IE: name@version -> range -> who asks for it
+	askedBy := make(map[string]map[string]map[string]bool)
+	for parentKey, parent := range uniqueVersions(root) {
+		if parent == root {
+			parentKey = ""
+		}
+		for name, dep := range parent.Dependencies {
+			if dep == nil {
+				continue
+			}
+			key := dep.Name + "@" + dep.Version
+			constraint := direct[name]
+			if parent != root {
+				constraint = docs[parentKey].Dependencies[name]
+			}
+			if askedBy[key] == nil {
+				askedBy[key] = make(map[string]map[string]bool)
+			}
+			if askedBy[key][constraint] == nil {
+				askedBy[key][constraint] = make(map[string]bool)
+			}
+			askedBy[key][constraint][parentKey] = true
+			if resolved[dep.Name] == nil {
+				resolved[dep.Name] = make(map[string]bool)
+			}
+			resolved[dep.Name][dep.Version] = true
+		}
+	}
+
+	locked := body.Lockfile.versions(includeDev)
+	names := make(map[string]bool)
+	// IE: nothing to compare the skipped ones with
+	for name := range locked {
+		names[name] = !skipped[name]
+	}
+	for name := range resolved {
+		names[name] = true
+	}
+	for name, compared := range names {
+		if !compared {
+			continue
+		}
+		change := driftChange{Name: name, Locked: versionList(locked[name]), Resolved: versionList(resolved[name])}
+		if strings.Join(change.Locked, " ") == strings.Join(change.Resolved, " ") {
+			continue
+		}
+		switch {
+		case len(change.Locked) == 0:
+			change.Reason = driftAdded
+		case len(change.Resolved) == 0:
+			change.Reason = driftRemoved
+		default:
+			change.Reason = driftNewPublish
+		}
+		for _, version := range change.Resolved {
+			if locked[name][version] {
+				continue
+			}
+			for constraint, parents := range askedBy[name+"@"+version] {
+				if change.Constraints == nil {
+					change.Constraints = make(map[string][]string)
+				}
+				for parent := range parents {
+					change.Constraints[constraint] = append(change.Constraints[constraint], parent)
+				}
+				sort.Strings(change.Constraints[constraint])
+				if change.Reason == driftNewPublish && !satisfiedByAny(constraint, change.Locked) {
+					change.Reason = driftConstraintChange
+				}
+			}
+		}
+		// IE: versions only dropped, the packages asking for them changed
+		if change.Reason == driftNewPublish && change.Constraints == nil {
+			change.Reason = driftConstraintChange
+		}
+		report.Changes = append(report.Changes, change)
+	}
+	sort.Slice(report.Changes, func(i, j int) bool { return report.Changes[i].Name < report.Changes[j].Name })
+	return report, nil
+}
+
+func versionList(versions map[string]bool) []string {
+	if len(versions) == 0 {
+		return nil
+	}
+	list := make([]string, 0, len(versions))
+	for version := range versions {
+		list = append(list, version)
+	}
+	sortVersions(list)
+	return list
+}
+
+// IE: a locked version the range accepts, the newer one comes from a publish
+// since. A range that doesn't parse (i.e. a tag) is taken as changed
+func satisfiedByAny(constraint string, versions []string) bool {
+	parsed, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return false
+	}
+	for _, version := range versions {
+		if v, err := semver.NewVersion(version); err == nil && parsed.Check(v) {
+			return true
+		}
+	}
+	return false
+}
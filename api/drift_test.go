@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/snyk/snyk-code-review-exercise/internal/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const driftBody = `{
+	"manifest": {
+		"name": "app",
+		"version": "1.0.0",
+		"dependencies": {"express": "^4.17.0", "debug": "^4.0.0", "gitdep": "github:acme/gitdep"},
+		"devDependencies": {"jest": "^29.0.0"}
+	},
+	"lockfile": {
+		"lockfileVersion": 3,
+		"packages": {
+			"": {"name": "app", "version": "1.0.0"},
+			"node_modules/express": {"version": "4.17.1"},
+			"node_modules/qs": {"version": "6.9.6"},
+			"node_modules/debug": {"version": "3.2.7"},
+			"node_modules/ms": {"version": "2.1.2"},
+			"node_modules/lodash": {"version": "4.17.21"},
+			"node_modules/jest": {"version": "29.0.0", "dev": true},
+			"node_modules/gitdep": {"version": "1.0.0", "resolved": "git+ssh://git@github.com/acme/gitdep.git"}
+		}
+	}
+}`
+
+func TestLockfileDrift(t *testing.T) {
+	registry := newFakeRegistry(t, fixtures.Registry{
+		"express": {"4.17.1": {"qs": "~6.9.0"}, "4.18.1": {"qs": "6.10.3"}},
+		"qs":      {"6.9.6": nil, "6.10.3": nil},
+		"debug":   {"3.2.7": {"ms": "^2.1.1"}, "4.3.4": {"ms": "2.1.2"}},
+		"ms":      {"2.1.2": nil},
+	})
+	handler := New(WithRegistryURL(registry.URL))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/drift", strings.NewReader(driftBody)))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var report driftReport
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.Equal(t, driftReport{
+		Name:    "app",
+		Version: "1.0.0",
+		Changes: []driftChange{
+			{Name: "debug", Locked: []string{"3.2.7"}, Resolved: []string{"4.3.4"}, Reason: driftConstraintChange, Constraints: map[string][]string{"^4.0.0": {""}}},
+			{Name: "express", Locked: []string{"4.17.1"}, Resolved: []string{"4.18.1"}, Reason: driftNewPublish, Constraints: map[string][]string{"^4.17.0": {""}}},
+			{Name: "lodash", Locked: []string{"4.17.21"}, Reason: driftRemoved},
+			{Name: "qs", Locked: []string{"6.9.6"}, Resolved: []string{"6.10.3"}, Reason: driftConstraintChange, Constraints: map[string][]string{"6.10.3": {"express@4.18.1"}}},
+		},
+		Skipped: []string{"gitdep@github:acme/gitdep"},
+	}, report)
+}
+
+func TestLockfileVersionOne(t *testing.T) {
+	var lockfile npmLockfile
+	require.Nil(t, json.Unmarshal([]byte(`{"lockfileVersion": 1, "dependencies": {
+		"debug": {"version": "2.6.9", "dependencies": {"ms": {"version": "2.0.0"}}},
+		"ms": {"version": "2.1.3"},
+		"jest": {"version": "29.0.0", "dev": true}
+	}}`), &lockfile))
+	assert.Equal(t, map[string]map[string]bool{
+		"debug": {"2.6.9": true},
+		"ms":    {"2.0.0": true, "2.1.3": true},
+	}, lockfile.versions(false))
+	assert.Contains(t, lockfile.versions(true), "jest")
+}
+
+func TestLockfileAliasesAndLinks(t *testing.T) {
+	var lockfile npmLockfile
+	require.Nil(t, json.Unmarshal([]byte(`{"lockfileVersion": 3, "packages": {
+		"node_modules/@acme/a/node_modules/@acme/b": {"version": "1.0.0"},
+		"node_modules/old-lodash": {"name": "lodash", "version": "3.10.1"},
+		"node_modules/workspace": {"resolved": "packages/workspace", "link": true},
+		"packages/workspace": {"version": "0.0.1"}
+	}}`), &lockfile))
+	assert.Equal(t, map[string]map[string]bool{
+		"@acme/b": {"1.0.0": true},
+		"lodash":  {"3.10.1": true},
+	}, lockfile.versions(false))
+}
+
+func TestLockfileDriftBadRequests(t *testing.T) {
+	handler := New(WithRegistryURL(newFakeRegistry(t, fixtures.Registry{}).URL))
+	for body, code := range map[string]string{
+		`{"manifest": {}`:                    "invalid_body",
+		`{"manifest": {"name": "app"}}`:      "invalid_body",
+		`{"lockfile": {"packages": {}}, "x"`: "invalid_body",
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("POST", "/drift", strings.NewReader(body)))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+		assert.Contains(t, rec.Body.String(), code, body)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/drift", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// IE: the Node lines maintained at the time of writing, without ?node=
+var defaultNodeVersions = []string{"20.0.0", "22.0.0", "24.0.0"}
+
+// IE: the engines field of a version document, a few old packages have an
+// array of strings (i.e. ["node >= 0.4"]) there, which npm ignores as well
+type engineRanges map[string]string
+
+func (e *engineRanges) UnmarshalJSON(data []byte) error {
+	var ranges map[string]string
+	if err := json.Unmarshal(data, &ranges); err != nil {
+		*e = nil
+		return nil
+	}
+	*e = ranges
+	return nil
+}
+
+// IE: a Node version, and the packages whose engines.node won't have it
+type engineColumn struct {
+	Node         string             `json:"node"`
+	Compatible   int                `json:"compatible"`
+	Incompatible []engineConstraint `json:"incompatible"`
+}
+
+type engineConstraint struct {
+	Package string `json:"package"`
+	Range   string `json:"range"`
+}
+
+type engineMatrix struct {
+	// IE: the versions of the tree declaring an engines.node, the others run anywhere
+	Declared int            `json:"declared"`
+	Columns  []engineColumn `json:"columns"`
+	// IE: the ranges that don't parse, left out of the columns
+	Unparsed []engineConstraint `json:"unparsed,omitempty"`
+}
+
+// IE: comma separated, in the order the columns come in
+func requestNodeVersions(query url.Values) ([]*semver.Version, error) {
+	values := defaultNodeVersions
+	if value := strings.TrimSpace(query.Get("node")); value != "" {
+		values = strings.Split(value, ",")
+	}
+	versions := make([]*semver.Version, 0, len(values))
+	for _, value := range values {
+		version, err := semver.NewVersion(strings.TrimPrefix(strings.TrimSpace(value), "v"))
+		if err != nil {
+			return nil, fmt.Errorf("%w: node version %q: %w", ErrInvalidQuery, value, err)
+		}
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
+
+func enginesSection(ctx context.Context, tree *NpmPackageVersion, query url.Values, report *treeReport) error {
+	nodes, err := requestNodeVersions(query)
+	if err != nil {
+		return err
+	}
+	docs, err := versionDocuments(ctx, tree)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(docs))
+	for key := range docs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	matrix := &engineMatrix{Columns: make([]engineColumn, len(nodes))}
+	for i, node := range nodes {
+		matrix.Columns[i] = engineColumn{Node: node.String(), Incompatible: []engineConstraint{}}
+	}
+	for _, key := range keys {
+		declared := strings.TrimSpace(docs[key].Engines["node"])
+		if declared == "" {
+			continue
+		}
+		matrix.Declared++
+		constraint, err := semver.NewConstraint(declared)
+		if err != nil {
+			matrix.Unparsed = append(matrix.Unparsed, engineConstraint{Package: key, Range: declared})
+			continue
+		}
+		for i, node := range nodes {
+			if constraint.Check(node) {
+				matrix.Columns[i].Compatible++
+			} else {
+				matrix.Columns[i].Incompatible = append(matrix.Columns[i].Incompatible, engineConstraint{Package: key, Range: declared})
+			}
+		}
+	}
+	report.Engines = matrix
+	return nil
+}
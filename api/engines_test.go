@@ -0,0 +1,53 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/snyk/snyk-code-review-exercise/internal/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngineMatrix(t *testing.T) {
+	registry := scriptedRegistry(t, fixtures.Registry{
+		"app":    {"1.0.0": {"modern": "^1.0.0", "legacy": "^1.0.0", "loose": "^1.0.0", "odd": "^1.0.0"}},
+		"modern": {"1.0.0": nil},
+		"legacy": {"1.0.0": nil},
+		"loose":  {"1.0.0": nil},
+		"odd":    {"1.0.0": nil},
+	}, map[string]npmPackageResponse{
+		"app@1.0.0":    {Engines: engineRanges{"node": ">= 14.17.0"}},
+		"modern@1.0.0": {Engines: engineRanges{"node": "^18.17.0 || >=20.5.0", "npm": ">=9"}},
+		"legacy@1.0.0": {Engines: engineRanges{"node": ">=0.10 <17"}},
+		"odd@1.0.0":    {Engines: engineRanges{"node": "not a range"}},
+	})
+	handler := New(WithRegistryURL(registry.URL))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0/report?sections=engines&node=v16.20.2,18.0.0,20.11.1", nil))
+	report := decodeReport(t, rec)
+	require.NotNil(t, report.Engines)
+	assert.Equal(t, &engineMatrix{
+		Declared: 4,
+		Columns: []engineColumn{
+			{Node: "16.20.2", Compatible: 2, Incompatible: []engineConstraint{{"modern@1.0.0", "^18.17.0 || >=20.5.0"}}},
+			{Node: "18.0.0", Compatible: 1, Incompatible: []engineConstraint{{"legacy@1.0.0", ">=0.10 <17"}, {"modern@1.0.0", "^18.17.0 || >=20.5.0"}}},
+			{Node: "20.11.1", Compatible: 2, Incompatible: []engineConstraint{{"legacy@1.0.0", ">=0.10 <17"}}},
+		},
+		Unparsed: []engineConstraint{{"odd@1.0.0", "not a range"}},
+	}, report.Engines)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0/report?sections=engines&node=lts", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestLegacyEngines(t *testing.T) {
+	var doc npmPackageResponse
+	require.Nil(t, json.Unmarshal([]byte(`{"name": "old", "engines": ["node >= 0.4"]}`), &doc))
+	assert.Equal(t, "old", doc.Name)
+	assert.Nil(t, doc.Engines)
+}
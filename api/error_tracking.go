@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// IE: nil unless WithErrorTracking is set, replaced by every New()
+var errorHub *sentry.Hub
+
+func newErrorHub(dsn, environment string, transport sentry.Transport) (*sentry.Hub, error) {
+	if dsn == "" {
+		return nil, nil
+	}
+	client, err := sentry.NewClient(sentry.ClientOptions{
+		Dsn:         dsn,
+		Environment: environment,
+		Transport:   transport,
+		// IE: the request headers may carry credentials
+		SendDefaultPII: false,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sentry.NewHub(client, sentry.NewScope()), nil
+}
+
+// IE: the hub of the request, its scope tagged along the way, the package one
+// for the background jobs
+func errorHubFrom(ctx context.Context) *sentry.Hub {
+	if hub := sentry.GetHubFromContext(ctx); hub != nil {
+		return hub
+	}
+	return errorHub
+}
+
+// IE: every request gets its own scope, and a panic in a handler a 500 instead
+// of a dropped connection. Inside logAccess, so the 500 is what is logged
+func trackErrors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if errorHub != nil {
+			hub := errorHub.Clone()
+			hub.Scope().SetRequest(r)
+			hub.Scope().SetTag("request_id", requestIDFrom(r.Context()))
+			r = r.WithContext(sentry.SetHubOnContext(r.Context(), hub))
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			// IE: the way handlers abort a response on purpose, net/http deals with it
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			reportPanic(r.Context(), p)
+			if !rec.wroteHeader {
+				httpError(rec, r, errInternal)
+			}
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// IE: the fields of requestLogger, for the reports of the request
+func tagErrors(ctx context.Context, r *http.Request, name, version string) {
+	if hub := sentry.GetHubFromContext(ctx); hub != nil {
+		hub.Scope().SetTags(map[string]string{"package": name, "version": version, "client": requestClient(r)})
+	}
+}
+
+// IE: called from the deferred recover, the stack still has the panicking frames
+func reportPanic(ctx context.Context, p interface{}) {
+	loggerFrom(ctx).Error("Recovered from panic", "panic", fmt.Sprint(p), "stack", string(debug.Stack()))
+	if hub := errorHubFrom(ctx); hub != nil {
+		hub.RecoverWithContext(ctx, p)
+	}
+}
+
+// IE: only the failures on our side or upstream's, the 4xx are the client's.
+// Grouped by their innermost error, the capture point is the same for all of them
+func reportResolveError(ctx context.Context, err error, status int) {
+	hub := errorHubFrom(ctx)
+	var panicked *panicError
+	// IE: panics are reported where they are recovered, with their stack
+	if hub == nil || status < http.StatusInternalServerError || errors.As(err, &panicked) {
+		return
+	}
+	cause := err
+	for errors.Unwrap(cause) != nil {
+		cause = errors.Unwrap(cause)
+	}
+	hub.WithScope(func(scope *sentry.Scope) {
+		scope.SetFingerprint([]string{"{{ default }}", cause.Error()})
+		scope.SetTag("status", fmt.Sprint(status))
+		scope.SetTag("code", classifyError(err).Code)
+		hub.CaptureException(err)
+	})
+}
+
+// IE: a panicking worker fails its resolution instead of the whole process
+type panicError struct {
+	value interface{}
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("panic while resolving: %v", e.value)
+}
+
+// FlushErrors waits up to timeout for the pending error reports to be sent, on
+// shutdown they would be lost otherwise. A no-op without WithErrorTracking.
+func FlushErrors(timeout time.Duration) bool {
+	if errorHub == nil {
+		return true
+	}
+	return errorHub.Flush(timeout)
+}
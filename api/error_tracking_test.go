@@ -0,0 +1,102 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDSN = "https://public@sentry.example.com/1"
+
+func withTestErrorTracking(transport sentry.Transport) Option {
+	return func(o *options) {
+		o.errorTrackingDSN = testDSN
+		o.errorTrackingEnvironment = "test"
+		o.errorTrackingTransport = transport
+	}
+}
+
+func TestErrorTrackingReportsUpstreamFailures(t *testing.T) {
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/missing") {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, "down", http.StatusInternalServerError)
+	}))
+	defer registry.Close()
+
+	transport := &sentry.MockTransport{}
+	handler := New(WithRegistryURL(registry.URL), withTestErrorTracking(transport), WithNegativeCache(0))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/missing/1.0.0", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	// IE: the client's problem, nothing to report
+	assert.Empty(t, transport.Events())
+
+	req := httptest.NewRequest("GET", "/package/react/16.13.0", nil)
+	req.Header.Set(requestIDHeader, "req-1")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusBadGateway, rec.Code)
+	require.True(t, FlushErrors(time.Second))
+
+	events := transport.Events()
+	require.Len(t, events, 1)
+	assert.Equal(t, "test", events[0].Environment)
+	assert.Equal(t, "react", events[0].Tags["package"])
+	assert.Equal(t, "16.13.0", events[0].Tags["version"])
+	assert.Equal(t, "req-1", events[0].Tags["request_id"])
+	assert.Equal(t, "502", events[0].Tags["status"])
+	require.Len(t, events[0].Fingerprint, 2)
+}
+
+func TestTrackErrorsRecoversPanics(t *testing.T) {
+	transport := &sentry.MockTransport{}
+	New(withTestErrorTracking(transport))
+
+	handler := withRequestID(trackErrors(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/react/16.13.0", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Contains(t, rec.Body.String(), rec.Header().Get(requestIDHeader))
+	events := transport.Events()
+	require.Len(t, events, 1)
+	assert.Equal(t, "boom", events[0].Message)
+	assert.Equal(t, rec.Header().Get(requestIDHeader), events[0].Tags["request_id"])
+}
+
+func TestTrackErrorsWithoutTracker(t *testing.T) {
+	New()
+	assert.Nil(t, errorHub)
+	assert.True(t, FlushErrors(time.Second))
+
+	// IE: recovered all the same, the response was already started here
+	handler := trackErrors(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		panic("boom")
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	assert.Panics(t, func() {
+		trackErrors(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic(http.ErrAbortHandler)
+		})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	})
+}
+
+func TestResolveErrorStatusOfPanics(t *testing.T) {
+	assert.Equal(t, http.StatusInternalServerError, classifyError(&panicError{"boom"}).Status)
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Error is a failure of the API with a stable code and the HTTP status it is
+// answered with. The resolver wraps them with the package it failed on, match
+// them with errors.Is, i.e. errors.Is(err, ErrPackageNotFound).
+type Error struct {
+	// Code identifies the error in the payloads, i.e. package_not_found.
+	Code string
+	// Status is the HTTP status of the response.
+	Status  int
+	message string
+}
+
+func (e *Error) Error() string {
+	return e.message
+}
+
+// Errors of the resolver.
+var (
+	// ErrPackageNotFound is a package the registry doesn't know.
+	ErrPackageNotFound = &Error{Code: "package_not_found", Status: http.StatusNotFound, message: "package not found"}
+	// ErrNoCompatibleVersion is a constraint no published version satisfies.
+	ErrNoCompatibleVersion = &Error{Code: "no_compatible_version", Status: http.StatusNotFound, message: "no compatible versions found"}
+	// ErrRegistryUnavailable is a registry failing, unreachable or answering
+	// anything but a document or a 404.
+	ErrRegistryUnavailable = &Error{Code: "registry_unavailable", Status: http.StatusBadGateway, message: "registry unavailable"}
+	// ErrCycleDetected is a dependency on a package already above it in the
+	// tree. npm allows them, the resolver cuts them and marks the subtree
+	// truncated instead of failing, it only shows in the debug logs.
+	ErrCycleDetected = &Error{Code: "cycle_detected", Status: http.StatusLoopDetected, message: "dependency cycle detected"}
+	// ErrPolicyViolation is a package the PackagePolicy doesn't let in the
+	// trees, with PolicyActionReject.
+	ErrPolicyViolation = &Error{Code: "policy_violation", Status: http.StatusForbidden, message: "package not allowed by policy"}
+	// ErrLicenseViolation is a package the LicensePolicy doesn't let in the
+	// trees, in strict mode.
+	ErrLicenseViolation = &Error{Code: "license_violation", Status: http.StatusUnprocessableEntity, message: "license not allowed by policy"}
+	// ErrInvalidQuery is a query parameter of the request the API can't use.
+	ErrInvalidQuery = &Error{Code: "invalid_query", Status: http.StatusBadRequest, message: "invalid query parameter"}
+)
+
+// IE: the errors of the API itself, not returned by the resolver
+var (
+	errInvalidHeader   = &Error{Code: "invalid_header", Status: http.StatusBadRequest, message: "invalid header"}
+	errTooManyRequests = &Error{Code: "too_many_requests", Status: http.StatusTooManyRequests, message: "too many requests in flight, retry later"}
+	errTimeout         = &Error{Code: "timeout", Status: http.StatusGatewayTimeout, message: "resolution took too long"}
+	errInternal        = &Error{Code: "internal", Status: http.StatusInternalServerError, message: "internal server error"}
+	// IE: anything unclassified failed on the way to the registry (a broken
+	// document, a tarball not matching its integrity), upstream's fault then
+	errResolution = &Error{Code: "resolution_failed", Status: http.StatusBadGateway, message: "resolution failed"}
+)
+
+// IE: a call to the registry (or the CDNs and tarball hosts standing in for it)
+// that got no answer. Left alone once ctx is done, the request gave up then,
+// and when it was refused before being made (a host not allowed)
+func upstreamError(ctx context.Context, err error) error {
+	var apiErr *Error
+	if ctx.Err() != nil || errors.As(err, &apiErr) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrRegistryUnavailable, err)
+}
+
+// IE: the outermost Error in the chain, a panic is always internal
+func classifyError(err error) *Error {
+	var panicked *panicError
+	if errors.As(err, &panicked) {
+		return errInternal
+	}
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	return errResolution
+}
+
+type errorPayload struct {
+	Error     string `json:"error"`
+	Code      string `json:"code"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// IE: every error of the API answers the same JSON, the NDJSON streams end with
+// it too once their status is sent
+func newErrorPayload(err error, requestID string) errorPayload {
+	return errorPayload{Error: err.Error(), Code: classifyError(err).Code, RequestID: requestID}
+}
+
+// IE: the status and code come from err. The request id is in the body, the one
+// thing a user reporting a failure has to copy along
+func httpError(w http.ResponseWriter, r *http.Request, err error) {
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(classifyError(err).Status)
+	_ = json.NewEncoder(w).Encode(newErrorPayload(err, requestIDFrom(r.Context())))
+}
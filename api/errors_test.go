@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyError(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want *Error
+	}{
+		{fmt.Errorf("fetching package meta for a: %w", ErrPackageNotFound), ErrPackageNotFound},
+		{fmt.Errorf("a@^2.0.0: %w", ErrNoCompatibleVersion), ErrNoCompatibleVersion},
+		{upstreamError(context.Background(), errors.New("connection refused")), ErrRegistryUnavailable},
+		{fmt.Errorf("%w: maxDepth", ErrInvalidQuery), ErrInvalidQuery},
+		{&panicError{"boom"}, errInternal},
+		{errors.New("integrity mismatch"), errResolution},
+	} {
+		assert.Equal(t, tc.want, classifyError(tc.err), tc.err.Error())
+	}
+
+	// IE: the request gave up, the registry isn't to blame
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.NotErrorIs(t, upstreamError(ctx, context.Canceled), ErrRegistryUnavailable)
+}
+
+func decodeErrorPayload(t *testing.T, rec *httptest.ResponseRecorder) errorPayload {
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var payload errorPayload
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &payload), rec.Body.String())
+	return payload
+}
+
+func TestErrorPayloads(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{
+		"app": {"1.0.0": {"a": "^2.0.0"}},
+		"a":   {"1.0.0": nil},
+		"bad": {"1.0.0": {"a": "not a range"}},
+	})
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	for _, tc := range []struct {
+		registry, path string
+		status         int
+		code           string
+	}{
+		{registry.URL, "/package/missing/1.0.0", http.StatusNotFound, "package_not_found"},
+		{registry.URL, "/package/app/1.0.0", http.StatusNotFound, "no_compatible_version"},
+		{registry.URL, "/package/app/1.0.0?maxDepth=none", http.StatusBadRequest, "invalid_query"},
+		{registry.URL, "/package/app/notaversion", http.StatusBadRequest, "invalid_package"},
+		// IE: a range the registry published is no fault of the client
+		{registry.URL, "/package/bad/1.0.0", http.StatusBadGateway, "resolution_failed"},
+		{down.URL, "/package/app/1.0.0", http.StatusBadGateway, "registry_unavailable"},
+	} {
+		handler := New(WithRegistryURL(tc.registry))
+		req := httptest.NewRequest("GET", tc.path, nil)
+		req.Header.Set(requestIDHeader, "req-1")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		assert.Equal(t, tc.status, rec.Code, tc.path)
+		payload := decodeErrorPayload(t, rec)
+		assert.Equal(t, tc.code, payload.Code, tc.path)
+		assert.Equal(t, "req-1", payload.RequestID)
+		assert.NotEmpty(t, payload.Error)
+	}
+
+	// IE: the stream already started, the last line carries the code
+	rec := httptest.NewRecorder()
+	New(WithRegistryURL(registry.URL)).ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0?format=ndjson", nil))
+	lines := readNDJSON(t, rec.Body.String())
+	require.Len(t, lines, 2)
+	assert.Equal(t, "no_compatible_version", lines[1]["code"])
+}
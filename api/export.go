@@ -0,0 +1,51 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// IE: the formats writing the tree the package route would answer along with
+// the version documents of its packages, all at once
+type treeExport struct {
+	contentType string
+	extension   string
+	write       func(w io.Writer, tree *NpmPackageVersion, docs map[string]*npmPackageResponse) error
+}
+
+var treeExports = map[string]treeExport{
+	formatCSV:    {"text/csv; charset=utf-8", "csv", writeCSV},
+	formatCypher: {"text/plain; charset=utf-8", "cypher", writeCypher},
+}
+
+// IE: nothing is written before every version document is fetched, a failure
+// still gets a proper error status
+func exportHandler(w http.ResponseWriter, r *http.Request, pkgName, pkgVersion, format string, start time.Time) {
+	export := treeExports[format]
+	ctx, stats := requestResolutionStats(r.Context())
+	tree, release, status, err := loadTree(ctx, pkgName, pkgVersion, r.URL.Query())
+	if err != nil {
+		writeResolveError(w, r, err)
+		return
+	}
+	defer release()
+	docs, err := versionDocuments(ctx, tree)
+	if err != nil {
+		writeResolveError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", export.contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+strings.ReplaceAll(tree.Name, "/", "_")+"@"+tree.Version+"."+export.extension+`"`)
+	w.Header().Set("X-Cache-Status", status)
+	w.Header().Set(resolutionStatsHeader, stats.snapshot().String())
+	if tree.Partial {
+		w.Header().Set("X-Partial-Tree", "true")
+	}
+	if err := export.write(w, tree, docs); err != nil {
+		loggerFrom(r.Context()).Debug("Could not write response", "error", err)
+	}
+	loggerFrom(r.Context()).Info("Request completed", "duration", time.Since(start), "format", format, "cache", status)
+}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Features that can be turned on or off per deployment with WithFeatures, and
+// per request with the X-Feature-Flags header.
+const (
+	// FeaturePrefetch fetches the packuments of the dependencies of a node
+	// while the node is still being resolved, on by default.
+	FeaturePrefetch = "prefetch"
+	// FeatureSubtreeCache reuses the subtrees resolved by previous requests,
+	// on by default.
+	FeatureSubtreeCache = "subtree-cache"
+	// FeatureWorkerPool resolves the nodes on a bounded pool of workers,
+	// shallowest first, on by default. Off, every node gets its own goroutine.
+	FeatureWorkerPool = "worker-pool"
+	// FeatureDAGOutput answers the package route with the tree as a DAG, a
+	// single node per name@version listing the name@version of its
+	// dependencies, off by default.
+	FeatureDAGOutput = "dag-output"
+)
+
+// IE: name=on|off list, i.e. "prefetch=off,subtree-cache=on"
+const featureFlagsHeader = "X-Feature-Flags"
+
+// IE: new risky behaviours get registered here, off by default until they are
+// trusted. Ones changing the response must vary the tree cache key as well,
+// or a request turning them on gets the cached tree of one that didn't
+type featureFlag struct {
+	description string
+	enabled     bool
+	// IE: whether clients may flip it for their own requests
+	perRequest bool
+}
+
+var knownFeatures = map[string]featureFlag{
+	FeaturePrefetch:     {description: "prefetch the packuments of the dependencies while their parent resolves", enabled: true, perRequest: true},
+	FeatureSubtreeCache: {description: "reuse the subtrees resolved by previous requests", enabled: true, perRequest: true},
+	FeatureWorkerPool:   {description: "resolve on a bounded pool of workers rather than a goroutine per node", enabled: true, perRequest: true},
+	FeatureDAGOutput:    {description: "answer the package route with a node per name@version rather than the nested tree", perRequest: true},
+}
+
+// ParseFeatureFlags parses a comma separated list of feature=on|off pairs,
+// i.e. "prefetch=off", for WithFeatures. A bare name turns it on. Unknown
+// features are an error.
+func ParseFeatureFlags(value string) (map[string]bool, error) {
+	flags, unknown, err := parseFeatureFlags(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown features %s, expected one of %s", strings.Join(unknown, ", "), strings.Join(featureNames(), ", "))
+	}
+	return flags, nil
+}
+
+func parseFeatureFlags(value string) (map[string]bool, []string, error) {
+	flags := make(map[string]bool)
+	var unknown []string
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, state, found := strings.Cut(pair, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		enabled := true
+		if found {
+			switch strings.ToLower(strings.TrimSpace(state)) {
+			case "on", "true", "1":
+			case "off", "false", "0":
+				enabled = false
+			default:
+				return nil, nil, fmt.Errorf("expected feature=on|off, got %q", pair)
+			}
+		}
+		if _, ok := knownFeatures[name]; !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		flags[name] = enabled
+	}
+	return flags, unknown, nil
+}
+
+func featureNames() []string {
+	names := make([]string, 0, len(knownFeatures))
+	for name := range knownFeatures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IE: the overrides of the request on top of the ones of the deployment
+type featureSet map[string]bool
+
+func (s featureSet) enabled(name string) bool {
+	if enabled, ok := s[name]; ok {
+		return enabled
+	}
+	return deploymentFeature(name)
+}
+
+func deploymentFeature(name string) bool {
+	if enabled, ok := opts.features[name]; ok {
+		return enabled
+	}
+	return knownFeatures[name].enabled
+}
+
+type featuresKey struct{}
+
+// IE: no overrides outside of a request, the deployment settings then
+func featuresFrom(ctx context.Context) featureSet {
+	features, _ := ctx.Value(featuresKey{}).(featureSet)
+	return features
+}
+
+// IE: clients rolling a feature out may talk to replicas that don't know it yet,
+// unknown and non overridable features are ignored rather than rejected
+func requestFeatures(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get(featureFlagsHeader)
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		flags, unknown, err := parseFeatureFlags(header)
+		if err != nil {
+			httpError(w, r, fmt.Errorf("%w: %s: %v", errInvalidHeader, featureFlagsHeader, err))
+			return
+		}
+		features := make(featureSet, len(flags))
+		applied := make([]string, 0, len(flags))
+		for name, enabled := range flags {
+			if !knownFeatures[name].perRequest {
+				unknown = append(unknown, name)
+				continue
+			}
+			features[name] = enabled
+			state := "off"
+			if enabled {
+				state = "on"
+			}
+			applied = append(applied, name+"="+state)
+		}
+		if len(unknown) > 0 {
+			loggerFrom(r.Context()).Debug("Ignoring feature flags", "features", unknown)
+		}
+		// IE: tells the client which of its flags were honoured
+		sort.Strings(applied)
+		w.Header().Set(featureFlagsHeader, strings.Join(applied, ","))
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), featuresKey{}, features)))
+	})
+}
+
+type featureStatus struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Enabled     bool   `json:"enabled"`
+	Default     bool   `json:"default"`
+	PerRequest  bool   `json:"perRequest"`
+}
+
+// IE: the state of the deployment, what a request gets without overrides
+func featuresHandler(w http.ResponseWriter, r *http.Request) {
+	features := make([]featureStatus, 0, len(knownFeatures))
+	for _, name := range featureNames() {
+		flag := knownFeatures[name]
+		features = append(features, featureStatus{
+			Name:        name,
+			Description: flag.description,
+			Enabled:     deploymentFeature(name),
+			Default:     flag.enabled,
+			PerRequest:  flag.perRequest,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(features); err != nil {
+		logger.Error("Could not write feature flags", "error", err)
+	}
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFeatureFlags(t *testing.T) {
+	flags, err := ParseFeatureFlags(" prefetch=off, Subtree-Cache ")
+	require.Nil(t, err)
+	assert.Equal(t, map[string]bool{FeaturePrefetch: false, FeatureSubtreeCache: true}, flags)
+
+	flags, err = ParseFeatureFlags("")
+	require.Nil(t, err)
+	assert.Empty(t, flags)
+
+	for _, invalid := range []string{"prefetch=maybe", "unknown-feature=on"} {
+		_, err = ParseFeatureFlags(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+func hasCachedSubtree(key string) bool {
+	var subtree NpmPackageVersion
+	return cachedJSON(subtreeCache, subtreeKeyPrefix+key, &subtree)
+}
+
+func TestDeploymentFeatures(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{
+		"app": {"1.0.0": {"a": "^1.0.0"}},
+		"a":   {"1.0.0": nil},
+	})
+
+	handler := New(WithRegistryURL(registry.URL))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, hasCachedSubtree("a@1.0.0"))
+
+	handler = New(WithRegistryURL(registry.URL), WithFeatures(map[string]bool{FeatureSubtreeCache: false}))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.False(t, hasCachedSubtree("a@1.0.0"))
+}
+
+func TestRequestFeatures(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{
+		"app": {"1.0.0": {"a": "^1.0.0", "b": "^1.0.0"}},
+		"a":   {"1.0.0": nil},
+		"b":   {"1.0.0": nil},
+	})
+	server := httptest.NewServer(New(WithRegistryURL(registry.URL), WithConcurrency(4)))
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", server.URL+"/package/app/1.0.0", nil)
+	require.Nil(t, err)
+	req.Header.Set(featureFlagsHeader, "prefetch=off,subtree-cache=off,unknown-feature=on")
+	resp, err := server.Client().Do(req)
+	require.Nil(t, err)
+	_, err = io.Copy(io.Discard, resp.Body)
+	require.Nil(t, err)
+	resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	// IE: the unknown one is left out
+	assert.Equal(t, "prefetch=off,subtree-cache=off", resp.Header.Get(featureFlagsHeader))
+	// IE: the workers alone, no prefetch next to them
+	assert.Contains(t, resp.Trailer.Get(resolutionStatsHeader), "goroutines=4,")
+	assert.False(t, hasCachedSubtree("a@1.0.0"))
+
+	req.Header.Set(featureFlagsHeader, "prefetch=maybe")
+	resp, err = server.Client().Do(req)
+	require.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestFeaturesHandler(t *testing.T) {
+	New(WithFeatures(map[string]bool{FeaturePrefetch: false}))
+
+	rec := httptest.NewRecorder()
+	AdminHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/features", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var features []featureStatus
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &features))
+	require.Len(t, features, 4)
+	assert.Equal(t, FeatureDAGOutput, features[0].Name)
+	assert.False(t, features[0].Enabled)
+	assert.Equal(t, featureStatus{Name: FeaturePrefetch, Description: knownFeatures[FeaturePrefetch].description, Enabled: false, Default: true, PerRequest: true}, features[1])
+	assert.Equal(t, FeatureSubtreeCache, features[2].Name)
+	assert.True(t, features[2].Enabled)
+	assert.Equal(t, FeatureWorkerPool, features[3].Name)
+	assert.True(t, features[3].Enabled)
+}
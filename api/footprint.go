@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"net/url"
+	"sort"
+)
+
+// IE: what the dependencies of the root take on disk once installed, from the
+// unpacked sizes the registry publishes. The root is the project node_modules
+// belongs to, it isn't counted
+type diskFootprint struct {
+	// IE: one copy of every name@version, the best any layout could do
+	UniquePackages int   `json:"uniquePackages"`
+	UniqueBytes    int64 `json:"uniqueBytes"`
+	// IE: laid out like npm hoists node_modules, the copies nested under a
+	// conflicting version included
+	Installed      int   `json:"installed"`
+	InstalledBytes int64 `json:"installedBytes"`
+	// IE: every node of the tree on its own, without any deduplication
+	Nodes      int   `json:"nodes"`
+	NodesBytes int64 `json:"nodesBytes"`
+	// IE: the versions installed more than once, most bytes first
+	Duplicated []duplicatedInstall `json:"duplicated"`
+}
+
+type duplicatedInstall struct {
+	Package string `json:"package"`
+	Copies  int    `json:"copies"`
+	Bytes   int64  `json:"bytes"`
+}
+
+// IE: a node_modules folder, and the package it belongs to
+type installDir struct {
+	parent   *installDir
+	depth    int
+	version  string
+	children map[string]*installDir
+}
+
+// IE: like npm does since v3, a dependency goes as high as it can be found from
+// the package requiring it: the highest folder up to the first one holding
+// another version of it. One of the same version up there is reused
+func (d *installDir) place(name, version string, maxDepth int) (*installDir, bool) {
+	var target *installDir
+	for dir := d; dir != nil; dir = dir.parent {
+		if installed, found := dir.children[name]; found {
+			if installed.version == version {
+				return installed, false
+			}
+			break
+		}
+		target = dir
+	}
+	// IE: versions conflicting back and forth could nest forever, there is
+	// nothing deeper than every version nested once in the tree anyway
+	if target == nil || target.depth >= maxDepth {
+		return nil, false
+	}
+	installed := &installDir{parent: target, depth: target.depth + 1, version: version, children: make(map[string]*installDir)}
+	target.children[name] = installed
+	return installed, true
+}
+
+// IE: breadth first like npm, the packages closer to the root get the top
+// folders. A version is laid out from its most expanded node, a cycle or the
+// depth limit cuts the others
+func (f *diskFootprint) hoist(root *NpmPackageVersion, unique map[string]*NpmPackageVersion, sizes map[string]int64) {
+	type placement struct {
+		pkg *NpmPackageVersion
+		dir *installDir
+	}
+	copies := make(map[string]int)
+	top := &installDir{children: make(map[string]*installDir)}
+	queue := []placement{{root, top}}
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		for _, dep := range sortedDependencies(next.pkg) {
+			key := dep.Name + "@" + dep.Version
+			dir, installed := next.dir.place(dep.Name, dep.Version, len(unique))
+			if !installed {
+				continue
+			}
+			copies[key]++
+			f.Installed++
+			f.InstalledBytes += sizes[key]
+			queue = append(queue, placement{unique[key], dir})
+		}
+	}
+
+	f.Duplicated = []duplicatedInstall{}
+	for key, n := range copies {
+		if n > 1 {
+			f.Duplicated = append(f.Duplicated, duplicatedInstall{Package: key, Copies: n, Bytes: int64(n) * sizes[key]})
+		}
+	}
+	sort.Slice(f.Duplicated, func(i, j int) bool {
+		if f.Duplicated[i].Bytes != f.Duplicated[j].Bytes {
+			return f.Duplicated[i].Bytes > f.Duplicated[j].Bytes
+		}
+		return f.Duplicated[i].Package < f.Duplicated[j].Package
+	})
+}
+
+// IE: ?limit= of the duplicated versions
+func footprintSection(ctx context.Context, tree *NpmPackageVersion, query url.Values, report *treeReport) error {
+	limit, err := requestLimit(query)
+	if err != nil {
+		return err
+	}
+	docs, err := versionDocuments(ctx, tree)
+	if err != nil {
+		return err
+	}
+	sizes := make(map[string]int64, len(docs))
+	for key, doc := range docs {
+		sizes[key] = doc.Dist.UnpackedSize
+	}
+
+	unique := uniqueVersions(tree)
+	rootKey := tree.Name + "@" + tree.Version
+	footprint := &diskFootprint{}
+	for key := range unique {
+		if key != rootKey {
+			footprint.UniquePackages++
+			footprint.UniqueBytes += sizes[key]
+		}
+	}
+	var count func(pkg *NpmPackageVersion)
+	count = func(pkg *NpmPackageVersion) {
+		for _, dep := range pkg.Dependencies {
+			if dep != nil {
+				footprint.Nodes++
+				footprint.NodesBytes += sizes[dep.Name+"@"+dep.Version]
+				count(dep)
+			}
+		}
+	}
+	count(tree)
+
+	footprint.hoist(tree, unique, sizes)
+	if len(footprint.Duplicated) > limit {
+		footprint.Duplicated = footprint.Duplicated[:limit]
+	}
+	report.Footprint = footprint
+	return nil
+}
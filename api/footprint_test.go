@@ -0,0 +1,55 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/snyk/snyk-code-review-exercise/internal/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskFootprint(t *testing.T) {
+	registry := sizedRegistry(t, fixtures.Registry{
+		"app": {"1.0.0": {"a": "^1.0.0", "b": "^1.0.0"}},
+		"a":   {"1.0.0": {"c": "1.0.0", "e": "^1.0.0"}},
+		"b":   {"1.0.0": {"c": "2.0.0", "d": "^1.0.0", "e": "^1.0.0"}},
+		"c":   {"1.0.0": nil, "2.0.0": nil},
+		"d":   {"1.0.0": {"c": "2.0.0"}},
+		"e":   {"1.0.0": nil},
+	}, map[string]int64{"app@1.0.0": 999, "a@1.0.0": 100, "b@1.0.0": 200, "c@1.0.0": 1000, "c@2.0.0": 3000, "d@1.0.0": 50, "e@1.0.0": 10})
+	handler := New(WithRegistryURL(registry.URL))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0/report?sections=footprint", nil))
+	report := decodeReport(t, rec)
+	require.NotNil(t, report.Footprint)
+	// IE: c@1.0.0 is hoisted first, c@2.0.0 is nested under b and under d
+	assert.Equal(t, &diskFootprint{
+		UniquePackages: 6, UniqueBytes: 4360,
+		Installed: 7, InstalledBytes: 7360,
+		Nodes: 8, NodesBytes: 7370,
+		Duplicated: []duplicatedInstall{{Package: "c@2.0.0", Copies: 2, Bytes: 6000}},
+	}, report.Footprint)
+}
+
+func TestHoistingReusesAncestors(t *testing.T) {
+	top := &installDir{children: make(map[string]*installDir)}
+	a, installed := top.place("a", "1.0.0", 10)
+	require.True(t, installed)
+	b, _ := a.place("b", "1.0.0", 10)
+	assert.Same(t, top, b.parent)
+
+	// IE: a cycle back to a finds it up there
+	again, installed := b.place("a", "1.0.0", 10)
+	assert.False(t, installed)
+	assert.Same(t, a, again)
+
+	nested, installed := b.place("a", "2.0.0", 10)
+	require.True(t, installed)
+	assert.Same(t, b, nested.parent)
+
+	// IE: under b, past the depth allowed
+	_, installed = nested.place("b", "2.0.0", 1)
+	assert.False(t, installed)
+}
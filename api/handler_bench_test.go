@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+)
+
+// IE: the packuments and version documents stay cached, what is measured is the
+// resolution itself and writing out the tree, not the fixture registry
+var benchmarkTrees = []struct {
+	fixture, name, version string
+}{
+	{"react-16.13.0", "react", "16.13.0"},
+	{"express-4.18.1", "express", "4.18.1"},
+	{"npm-8.19.2", "npm", "8.19.2"},
+}
+
+func BenchmarkPackageHandlerMiss(b *testing.B) {
+	for _, tree := range benchmarkTrees {
+		b.Run(tree.name, func(b *testing.B) {
+			benchmarkPackageHandler(b, tree.fixture, "/package/"+tree.name+"/"+tree.version, func() {
+				// IE: drop the trees, subtrees would short-circuit the resolution as well
+				responseCache.(prefixDeleter).DeletePrefix(treeKeyPrefix)
+				subtreeCache.(prefixDeleter).DeletePrefix(subtreeKeyPrefix)
+			})
+		})
+	}
+}
+
+func BenchmarkPackageHandlerHit(b *testing.B) {
+	for _, tree := range benchmarkTrees {
+		b.Run(tree.name, func(b *testing.B) {
+			benchmarkPackageHandler(b, tree.fixture, "/package/"+tree.name+"/"+tree.version, func() {})
+		})
+	}
+}
+
+func benchmarkPackageHandler(b *testing.B, fixture, path string, beforeEach func()) {
+	registry := newFakeRegistry(b, loadRegistryFixture(b, fixture))
+	handler := New(WithRegistryURL(registry.URL), WithMaxInFlight(0), WithLogger(slog.New(slog.DiscardHandler)))
+
+	serve := func() {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusOK {
+			b.Fatalf("%s: status %d: %s", path, rec.Code, rec.Body.String())
+		}
+	}
+	// IE: warm the upstream caches
+	serve()
+
+	latencies := make([]time.Duration, 0, b.N)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		beforeEach()
+		b.StartTimer()
+
+		start := time.Now()
+		serve()
+		latencies = append(latencies, time.Since(start))
+	}
+	b.StopTimer()
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	b.ReportMetric(float64(latencies[len(latencies)*50/100].Nanoseconds()), "p50-ns")
+	b.ReportMetric(float64(latencies[len(latencies)*99/100].Nanoseconds()), "p99-ns")
+}
+
+// IE: many trees resolved at once, with the subtree cache kept cold so every
+// duplicate goes through the scanned nodes of its resolver
+func BenchmarkResolveTreeParallel(b *testing.B) {
+	registry := newFakeRegistry(b, loadRegistryFixture(b, "npm-8.19.2"))
+	New(WithRegistryURL(registry.URL), WithConcurrency(8), WithLogger(slog.New(slog.DiscardHandler)))
+
+	// IE: warm the upstream caches
+	if _, err := resolveTree(context.Background(), "npm", "8.19.2", 0); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			subtreeCache.(prefixDeleter).DeletePrefix(subtreeKeyPrefix)
+			root, err := resolveTree(context.Background(), "npm", "8.19.2", 0)
+			if err != nil {
+				b.Error(err)
+				return
+			}
+			releaseTree(root)
+		}
+	})
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const defaultReportLimit = 10
+
+// IE: what a direct dependency of the root brings into the tree. The exclusive
+// packages are the ones no other direct dependency brings, the ones replacing
+// it would get rid of
+type heavyDependency struct {
+	Dependency        string `json:"dependency"`
+	Nodes             int    `json:"nodes"`
+	UniquePackages    int    `json:"uniquePackages"`
+	Bytes             int64  `json:"bytes"`
+	ExclusivePackages int    `json:"exclusivePackages"`
+	ExclusiveBytes    int64  `json:"exclusiveBytes"`
+	// IE: from the dependency down, through the child with the largest subtree
+	HeaviestChain []string `json:"heaviestChain"`
+}
+
+// IE: ?limit= of the sections listing the worst offenders
+func requestLimit(query url.Values) (int, error) {
+	value := strings.TrimSpace(query.Get("limit"))
+	if value == "" {
+		return defaultReportLimit, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 {
+		return 0, fmt.Errorf("%w: limit must be a positive integer, got %q", ErrInvalidQuery, value)
+	}
+	return limit, nil
+}
+
+// IE: sizes are the unpacked ones the registry publishes, the registries that
+// don't publish them only get the counts compared
+func heaviestPathsSection(ctx context.Context, tree *NpmPackageVersion, query url.Values, report *treeReport) error {
+	limit, err := requestLimit(query)
+	if err != nil {
+		return err
+	}
+	docs, err := versionDocuments(ctx, tree)
+	if err != nil {
+		return err
+	}
+
+	subtreeNodes := make(map[*NpmPackageVersion]int)
+	var countNodes func(pkg *NpmPackageVersion) int
+	countNodes = func(pkg *NpmPackageVersion) int {
+		if n, found := subtreeNodes[pkg]; found {
+			return n
+		}
+		n := 1
+		for _, dep := range pkg.Dependencies {
+			if dep != nil {
+				n += countNodes(dep)
+			}
+		}
+		subtreeNodes[pkg] = n
+		return n
+	}
+
+	names := make([]string, 0, len(tree.Dependencies))
+	for name := range tree.Dependencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	packagesOf := make(map[string]map[string]bool, len(names))
+	// IE: key -> how many direct dependencies bring it
+	reach := make(map[string]int)
+	for _, name := range names {
+		packages := make(map[string]bool)
+		for key := range uniqueVersions(tree.Dependencies[name]) {
+			packages[key] = true
+			reach[key]++
+		}
+		packagesOf[name] = packages
+	}
+
+	heavy := make([]heavyDependency, 0, len(names))
+	for _, name := range names {
+		dep := tree.Dependencies[name]
+		entry := heavyDependency{Dependency: dep.Name + "@" + dep.Version, Nodes: countNodes(dep), UniquePackages: len(packagesOf[name])}
+		for key := range packagesOf[name] {
+			size := docs[key].Dist.UnpackedSize
+			entry.Bytes += size
+			if reach[key] == 1 {
+				entry.ExclusivePackages++
+				entry.ExclusiveBytes += size
+			}
+		}
+		for pkg := dep; pkg != nil; {
+			entry.HeaviestChain = append(entry.HeaviestChain, pkg.Name+"@"+pkg.Version)
+			var heaviest *NpmPackageVersion
+			for _, child := range sortedDependencies(pkg) {
+				if heaviest == nil || countNodes(child) > countNodes(heaviest) {
+					heaviest = child
+				}
+			}
+			pkg = heaviest
+		}
+		heavy = append(heavy, entry)
+	}
+
+	sort.SliceStable(heavy, func(i, j int) bool {
+		if heavy[i].ExclusiveBytes != heavy[j].ExclusiveBytes {
+			return heavy[i].ExclusiveBytes > heavy[j].ExclusiveBytes
+		}
+		if heavy[i].ExclusivePackages != heavy[j].ExclusivePackages {
+			return heavy[i].ExclusivePackages > heavy[j].ExclusivePackages
+		}
+		return heavy[i].Nodes > heavy[j].Nodes
+	})
+	if len(heavy) > limit {
+		heavy = heavy[:limit]
+	}
+	report.HeaviestPaths = heavy
+	return nil
+}
+
+// IE: in name order, so ties always break the same way
+func sortedDependencies(pkg *NpmPackageVersion) []*NpmPackageVersion {
+	names := make([]string, 0, len(pkg.Dependencies))
+	for name, dep := range pkg.Dependencies {
+		if dep != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	deps := make([]*NpmPackageVersion, len(names))
+	for i, name := range names {
+		deps[i] = pkg.Dependencies[name]
+	}
+	return deps
+}
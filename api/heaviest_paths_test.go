@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/snyk/snyk-code-review-exercise/internal/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// IE: fixtures with the unpacked size of every version, in the version documents
+func sizedRegistry(t *testing.T, packages fixtures.Registry, sizes map[string]int64) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		if len(parts) == 2 {
+			if deps, found := packages[parts[0]][parts[1]]; found {
+				_ = json.NewEncoder(w).Encode(npmPackageResponse{Name: parts[0], Version: parts[1], Dependencies: deps,
+					Dist: npmDist{UnpackedSize: sizes[parts[0]+"@"+parts[1]]}})
+				return
+			}
+		}
+		packages.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func decodeReport(t *testing.T, rec *httptest.ResponseRecorder) treeReport {
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var report treeReport
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	return report
+}
+
+func TestHeaviestPaths(t *testing.T) {
+	registry := sizedRegistry(t, fixtures.Registry{
+		"app":        {"1.0.0": {"bundler": "^1.0.0", "small": "^1.0.0", "shared": "^1.0.0"}},
+		"bundler":    {"1.0.0": {"minifier": "^1.0.0", "shared": "^1.0.0"}},
+		"minifier":   {"1.0.0": {"source-map": "^1.0.0"}},
+		"source-map": {"1.0.0": nil},
+		"small":      {"1.0.0": {"shared": "^1.0.0"}},
+		"shared":     {"1.0.0": nil},
+	}, map[string]int64{"bundler@1.0.0": 1000, "minifier@1.0.0": 500, "source-map@1.0.0": 200, "small@1.0.0": 10, "shared@1.0.0": 5000})
+	handler := New(WithRegistryURL(registry.URL))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0/report?sections=heaviest-paths", nil))
+	report := decodeReport(t, rec)
+	assert.Equal(t, "app", report.Name)
+	require.Len(t, report.HeaviestPaths, 3)
+	assert.Equal(t, heavyDependency{
+		Dependency: "bundler@1.0.0", Nodes: 4, UniquePackages: 4, Bytes: 6700, ExclusivePackages: 3, ExclusiveBytes: 1700,
+		HeaviestChain: []string{"bundler@1.0.0", "minifier@1.0.0", "source-map@1.0.0"},
+	}, report.HeaviestPaths[0])
+	// IE: shared is brought by every direct dependency, replacing small gets rid of small only
+	assert.Equal(t, "small@1.0.0", report.HeaviestPaths[1].Dependency)
+	assert.Equal(t, int64(10), report.HeaviestPaths[1].ExclusiveBytes)
+	assert.Equal(t, "shared@1.0.0", report.HeaviestPaths[2].Dependency)
+	assert.Equal(t, 0, report.HeaviestPaths[2].ExclusivePackages)
+
+	// IE: the tree is cached by the report, like by the package route
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0/report?limit=1", nil))
+	assert.Equal(t, cacheStatusHit, rec.Header().Get("X-Cache-Status"))
+	report = decodeReport(t, rec)
+	require.Len(t, report.HeaviestPaths, 1)
+	assert.Equal(t, "bundler@1.0.0", report.HeaviestPaths[0].Dependency)
+
+	for _, query := range []string{"sections=heaviest", "limit=0"} {
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", fmt.Sprintf("/package/app/1.0.0/report?%s", query), nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+}
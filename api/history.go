@@ -0,0 +1,254 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	bolt "go.etcd.io/bbolt"
+)
+
+var historyBucket = []byte("history")
+
+// IE: a resolution as it was at the time, what the tree held rather than the
+// tree itself
+type historyRecord struct {
+	Time      time.Time `json:"time"`
+	Name      string    `json:"name"`
+	Version   string    `json:"version"`
+	Requested string    `json:"requested"`
+	// IE: the depth limit it was resolved under, 0 for none
+	MaxDepth int  `json:"maxDepth,omitempty"`
+	Partial  bool `json:"partial,omitempty"`
+	// IE: served from the cache, resolved by an earlier request
+	Cached bool `json:"cached,omitempty"`
+	// IE: of the package set, two resolutions to the same packages share it
+	Fingerprint string `json:"fingerprint"`
+	// IE: the depth of the deepest node, the root is at 0
+	Depth int `json:"depth"`
+	// IE: every name@version but the root's, sorted
+	Packages []string `json:"packages"`
+}
+
+func newHistoryRecord(requested string, maxDepth int, root *NpmPackageVersion, cached bool, at time.Time) *historyRecord {
+	record := &historyRecord{Time: at, Name: root.Name, Version: root.Version, Requested: requested, MaxDepth: maxDepth, Partial: root.Partial, Cached: cached}
+	rootKey := root.Name + "@" + root.Version
+	for key := range uniqueVersions(root) {
+		if key != rootKey {
+			record.Packages = append(record.Packages, key)
+		}
+	}
+	sort.Strings(record.Packages)
+	sum := sha256.Sum256([]byte(strings.Join(record.Packages, "\n")))
+	record.Fingerprint = hex.EncodeToString(sum[:16])
+
+	type visit struct {
+		pkg   *NpmPackageVersion
+		depth int
+	}
+	stack := []visit{{root, 0}}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		record.Depth = max(record.Depth, node.depth)
+		for _, dep := range node.pkg.Dependencies {
+			if dep != nil {
+				stack = append(stack, visit{dep, node.depth + 1})
+			}
+		}
+	}
+	return record
+}
+
+// IE: a bolt file of its own, the resolutions of a name@version are a
+// contiguous range of keys: <name@version>\x00<8 bytes unix nano>
+type historyStore struct {
+	db        *bolt.DB
+	retention time.Duration
+
+	// IE: overridable for tests
+	now func() time.Time
+}
+
+func openHistoryStore(path string, retention time.Duration) (*historyStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(historyBucket)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &historyStore{db: db, retention: retention, now: time.Now}, nil
+}
+
+func historyPrefix(name, version string) []byte {
+	return []byte(name + "@" + version + "\x00")
+}
+
+// IE: the resolutions of the same name@version past the retention go on the way
+func (h *historyStore) add(record *historyRecord) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	prefix := historyPrefix(record.Name, record.Version)
+	key := binary.BigEndian.AppendUint64(append([]byte(nil), prefix...), uint64(record.Time.UnixNano()))
+	return h.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(historyBucket)
+		if h.retention > 0 {
+			oldest := binary.BigEndian.AppendUint64(append([]byte(nil), prefix...), uint64(h.now().Add(-h.retention).UnixNano()))
+			cursor := bucket.Cursor()
+			for k, _ := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix) && bytes.Compare(k, oldest) < 0; k, _ = cursor.Seek(prefix) {
+				if err := cursor.Delete(); err != nil {
+					return err
+				}
+			}
+		}
+		return bucket.Put(key, value)
+	})
+}
+
+// IE: newest first, limit of them (all for 0)
+func (h *historyStore) list(name, version string, limit int) ([]historyRecord, error) {
+	prefix := historyPrefix(name, version)
+	records := []historyRecord{}
+	err := h.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(historyBucket).Cursor()
+		// IE: past the last key of the range, then backwards
+		k, v := cursor.Seek(append(append([]byte(nil), prefix[:len(prefix)-1]...), 0x01))
+		if k == nil {
+			k, v = cursor.Last()
+		} else {
+			k, v = cursor.Prev()
+		}
+		for ; k != nil && bytes.HasPrefix(k, prefix); k, v = cursor.Prev() {
+			var record historyRecord
+			if err := json.Unmarshal(v, &record); err != nil {
+				return fmt.Errorf("history entry %q: %w", k, err)
+			}
+			records = append(records, record)
+			if limit > 0 && len(records) == limit {
+				break
+			}
+		}
+		return nil
+	})
+	return records, err
+}
+
+// IE: the last record kept of every name@version, the keys of one are
+// contiguous and in time order, only the last of a run is decoded
+func (h *historyStore) latest(each func(record *historyRecord) error) error {
+	return h.db.View(func(tx *bolt.Tx) error {
+		var prefix, last []byte
+		flush := func() error {
+			if last == nil {
+				return nil
+			}
+			var record historyRecord
+			if err := json.Unmarshal(last, &record); err != nil {
+				return fmt.Errorf("history entry %q: %w", prefix, err)
+			}
+			return each(&record)
+		}
+		err := tx.Bucket(historyBucket).ForEach(func(k, v []byte) error {
+			if len(k) < 8 {
+				return nil
+			}
+			if !bytes.Equal(k[:len(k)-8], prefix) {
+				if err := flush(); err != nil {
+					return err
+				}
+				prefix = append(prefix[:0], k[:len(k)-8]...)
+			}
+			// IE: valid until the transaction ends, which is after the last flush
+			last = v
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return flush()
+	})
+}
+
+func (h *historyStore) Close() error {
+	return h.db.Close()
+}
+
+// IE: where resolveAnnotatedTree keeps every tree it resolves, and the
+// handlers every tree they serve from the cache, nil without WithResolutionHistory
+var history *historyStore
+
+// IE: a store failing doesn't fail the resolution, it already succeeded
+func recordResolution(requested string, maxDepth int, root *NpmPackageVersion, cached bool) {
+	store := history
+	if store == nil {
+		return
+	}
+	record := newHistoryRecord(requested, maxDepth, root, cached, store.now())
+	if err := store.add(record); err != nil {
+		logger.Error("Could not record the resolution", "package", root.Name, "version", root.Version, "error", err)
+	}
+}
+
+// IE: the trees served from the cache are recorded like the ones resolved,
+// query is the one cachedTree accepted. With only the cached document at hand
+// (root nil) it is decoded, which only a history pays for
+func recordCachedResolution(requested string, query url.Values, root *NpmPackageVersion, document []byte) {
+	if history == nil {
+		return
+	}
+	if root == nil {
+		root = &NpmPackageVersion{}
+		if err := decodeJSON(document, root); err != nil {
+			logger.Error("Could not record the resolution", "requested", requested, "error", err)
+			return
+		}
+	}
+	maxDepth, _ := requestMaxDepth(query)
+	recordResolution(requested, maxDepth, root, true)
+}
+
+// IE: GET /history/{package}/{version}?limit=, the version resolved to rather
+// than the range asked
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	pkgName, pkgVersion := vars["package"], vars["version"]
+	if err := checkPackageInput(pkgName, pkgVersion); err != nil {
+		httpError(w, r, err)
+		return
+	}
+	limit, err := requestLimit(r.URL.Query())
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+
+	records, err := history.list(pkgName, pkgVersion, limit)
+	if err != nil {
+		loggerFrom(r.Context()).Error("Could not read the history", "package", pkgName, "version", pkgVersion, "error", err)
+		httpError(w, r, fmt.Errorf("%w: %w", errInternal, err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(struct {
+		Name        string          `json:"name"`
+		Version     string          `json:"version"`
+		Resolutions []historyRecord `json:"resolutions"`
+	}{pkgName, pkgVersion, records})
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/snyk/snyk-code-review-exercise/internal/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type historyResponse struct {
+	Name        string          `json:"name"`
+	Version     string          `json:"version"`
+	Resolutions []historyRecord `json:"resolutions"`
+}
+
+func TestResolutionHistory(t *testing.T) {
+	registry := newFakeRegistry(t, fixtures.Registry{
+		"app":   {"1.0.0": {"a": "^1.0.0", "b": "^1.0.0"}},
+		"a":     {"1.0.0": {"b": "^1.0.0"}},
+		"b":     {"1.0.0": nil},
+		"other": {"1.0.0": nil},
+	})
+	handler := New(WithRegistryURL(registry.URL), WithResponseCache(0, 0), WithResolutionHistory(filepath.Join(t.TempDir(), "history.db"), 0))
+	t.Cleanup(func() { New() })
+
+	for _, path := range []string{"/package/app/^1.0.0", "/package/app/1.0.0?maxDepth=1", "/package/other/1.0.0", "/package/app/1.0.0?format=ndjson"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		require.Equal(t, http.StatusOK, rec.Code, path)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/history/app/1.0.0", nil))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var listed historyResponse
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &listed))
+	require.Len(t, listed.Resolutions, 2)
+
+	latest, first := listed.Resolutions[0], listed.Resolutions[1]
+	assert.Equal(t, "1.0.0", latest.Requested)
+	assert.Equal(t, 1, latest.MaxDepth)
+	assert.Equal(t, []string{"a@1.0.0", "b@1.0.0"}, latest.Packages)
+	assert.Equal(t, 1, latest.Depth)
+	assert.Equal(t, "^1.0.0", first.Requested)
+	assert.Equal(t, 2, first.Depth)
+	// IE: the same package set, however deep
+	assert.Equal(t, first.Fingerprint, latest.Fingerprint)
+	assert.False(t, first.Time.After(latest.Time))
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/history/app/1.0.0?limit=1", nil))
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &listed))
+	assert.Len(t, listed.Resolutions, 1)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/history/app/2.0.0", nil))
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &listed))
+	assert.Empty(t, listed.Resolutions)
+}
+
+func TestHistoryRetention(t *testing.T) {
+	store, err := openHistoryStore(filepath.Join(t.TempDir(), "history.db"), 24*time.Hour)
+	require.Nil(t, err)
+	t.Cleanup(func() { store.Close() })
+	now := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	for _, at := range []time.Time{now.Add(-48 * time.Hour), now.Add(-time.Hour)} {
+		require.Nil(t, store.add(&historyRecord{Time: at, Name: "app", Version: "1.0.0"}))
+	}
+	require.Nil(t, store.add(&historyRecord{Time: now.Add(-72 * time.Hour), Name: "app", Version: "1.0.1"}))
+	// IE: pruned on the next resolution of the same version
+	require.Nil(t, store.add(&historyRecord{Time: now, Name: "app", Version: "1.0.0"}))
+
+	records, err := store.list("app", "1.0.0", 0)
+	require.Nil(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, now, records[0].Time.UTC())
+	assert.Equal(t, now.Add(-time.Hour), records[1].Time.UTC())
+
+	records, err = store.list("app", "1.0.1", 0)
+	require.Nil(t, err)
+	assert.Len(t, records, 1)
+}
+
+func TestHistoryDisabled(t *testing.T) {
+	handler := New()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/history/app/1.0.0", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestHistoryRecordsCacheHits(t *testing.T) {
+	registry := newFakeRegistry(t, fixtures.Registry{
+		"app": {"1.0.0": {"a": "^1.0.0"}},
+		"a":   {"1.0.0": nil},
+	})
+	handler := New(WithRegistryURL(registry.URL), WithResolutionHistory(filepath.Join(t.TempDir(), "history.db"), 0))
+	t.Cleanup(func() { New() })
+
+	for _, path := range []string{"/package/app/1.0.0", "/package/app/1.0.0", "/package/app/1.0.0?format=csv"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		require.Equal(t, http.StatusOK, rec.Code, path)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/history/app/1.0.0", nil))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var listed historyResponse
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &listed))
+	require.Len(t, listed.Resolutions, 3)
+
+	resolved := listed.Resolutions[2]
+	assert.False(t, resolved.Cached)
+	for _, served := range listed.Resolutions[:2] {
+		assert.True(t, served.Cached)
+		assert.Equal(t, "1.0.0", served.Requested)
+		assert.Equal(t, []string{"a@1.0.0"}, served.Packages)
+		assert.Equal(t, resolved.Fingerprint, served.Fingerprint)
+	}
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"net/url"
+	"sort"
+)
+
+// IE: the lifecycle scripts npm runs on install, in the order it runs them.
+// Whatever they do happens on the machine installing the package, the
+// primary vector of the malicious ones
+var installHooks = []string{"preinstall", "install", "postinstall"}
+
+// IE: nil without any, so the nodes without them leave the field out
+func installScripts(doc *npmPackageResponse) []string {
+	var hooks []string
+	for _, hook := range installHooks {
+		if installCommand(doc, hook) != "" {
+			hooks = append(hooks, hook)
+		}
+	}
+	return hooks
+}
+
+// IE: the one npm runs for the addons without install scripts, see implicitGypInstall
+func installCommand(doc *npmPackageResponse, hook string) string {
+	if hook == "install" && implicitGypInstall(doc) {
+		return gypInstallCommand
+	}
+	return doc.Scripts[hook]
+}
+
+// IE: one version declaring install scripts, and what they run
+type installScriptPackage struct {
+	Package string            `json:"package"`
+	Scripts map[string]string `json:"scripts"`
+}
+
+// IE: every version of the tree with install scripts, by name@version
+func installScriptsSection(ctx context.Context, tree *NpmPackageVersion, query url.Values, report *treeReport) error {
+	docs, err := versionDocuments(ctx, tree)
+	if err != nil {
+		return err
+	}
+	for key, doc := range docs {
+		hooks := installScripts(doc)
+		if hooks == nil {
+			continue
+		}
+		scripts := make(map[string]string, len(hooks))
+		for _, hook := range hooks {
+			scripts[hook] = installCommand(doc, hook)
+		}
+		report.InstallScripts = append(report.InstallScripts, installScriptPackage{Package: key, Scripts: scripts})
+	}
+	sort.Slice(report.InstallScripts, func(i, j int) bool { return report.InstallScripts[i].Package < report.InstallScripts[j].Package })
+	return nil
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/snyk/snyk-code-review-exercise/internal/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// IE: the version documents (in the packuments too) are the ones of extra,
+// their name, version and dependencies filled in
+func scriptedRegistry(t *testing.T, packages fixtures.Registry, extra map[string]npmPackageResponse) *httptest.Server {
+	document := func(name, version string) npmPackageResponse {
+		doc := extra[name+"@"+version]
+		doc.Name, doc.Version, doc.Dependencies = name, version, packages[name][version]
+		return doc
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		if _, found := packages[parts[0]]; !found {
+			packages.ServeHTTP(w, r)
+			return
+		}
+		if len(parts) == 1 {
+			meta := npmPackageMetaResponse{Versions: make(map[string]npmPackageResponse)}
+			for version := range packages[parts[0]] {
+				meta.Versions[version] = document(parts[0], version)
+			}
+			_ = json.NewEncoder(w).Encode(meta)
+			return
+		}
+		if _, found := packages[parts[0]][parts[1]]; found {
+			_ = json.NewEncoder(w).Encode(document(parts[0], parts[1]))
+			return
+		}
+		packages.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestInstallScripts(t *testing.T) {
+	registry := scriptedRegistry(t, fixtures.Registry{
+		"app":    {"1.0.0": {"hooked": "^1.0.0", "tested": "^1.0.0"}},
+		"hooked": {"1.0.0": nil},
+		"tested": {"1.0.0": {"hooked": "^1.0.0"}},
+	}, map[string]npmPackageResponse{
+		"hooked@1.0.0": {Scripts: map[string]string{"postinstall": "node ./steal.js", "preinstall": "echo hi", "test": "jest"}},
+		"tested@1.0.0": {Scripts: map[string]string{"test": "mocha", "prepare": "tsc"}},
+	})
+	handler := New(WithRegistryURL(registry.URL))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0", nil))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	tree := &NpmPackageVersion{}
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), tree))
+	assert.Equal(t, []string{"preinstall", "postinstall"}, tree.Dependencies["hooked"].InstallScripts)
+	assert.Nil(t, tree.Dependencies["tested"].InstallScripts)
+	// IE: the second hooked comes from the subtree cached for the first one
+	assert.Equal(t, []string{"preinstall", "postinstall"}, tree.Dependencies["tested"].Dependencies["hooked"].InstallScripts)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0?format=ndjson", nil))
+	var flagged []string
+	for _, line := range readNDJSON(t, rec.Body.String()) {
+		if line["installScripts"] != nil {
+			flagged = append(flagged, line["name"].(string))
+		}
+	}
+	assert.Equal(t, []string{"hooked", "hooked"}, flagged)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0/report?sections=install-scripts", nil))
+	assert.Equal(t, []installScriptPackage{
+		{Package: "hooked@1.0.0", Scripts: map[string]string{"preinstall": "echo hi", "postinstall": "node ./steal.js"}},
+	}, decodeReport(t, rec).InstallScripts)
+}
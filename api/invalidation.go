@@ -0,0 +1,79 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const invalidationChannel = "deps:invalidate"
+
+type invalidationMessage struct {
+	Origin  string `json:"origin"`
+	Package string `json:"package"`
+}
+
+// IE: broadcast purges over redis pub/sub so every replica drops its in-memory entries
+type invalidationBus struct {
+	client *redis.Client
+	pubsub *redis.PubSub
+	origin string
+	done   chan struct{}
+}
+
+var invalidations *invalidationBus
+
+func newInvalidationBus(url string) (*invalidationBus, error) {
+	redisOpts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	client := redis.NewClient(redisOpts)
+	pubsub := client.Subscribe(context.Background(), invalidationChannel)
+	// IE: wait for the subscription to be confirmed, otherwise the first messages could be lost
+	if _, err := pubsub.Receive(context.Background()); err != nil {
+		_ = pubsub.Close()
+		_ = client.Close()
+		return nil, err
+	}
+
+	bus := &invalidationBus{client: client, pubsub: pubsub, origin: uuid.NewString(), done: make(chan struct{})}
+	go bus.listen()
+	return bus, nil
+}
+
+// IE: ends once Close() closes the subscription
+func (b *invalidationBus) listen() {
+	defer close(b.done)
+	for msg := range b.pubsub.Channel() {
+		var parsed invalidationMessage
+		if err := json.Unmarshal([]byte(msg.Payload), &parsed); err != nil {
+			logger.Error("Ignoring malformed invalidation message", "payload", msg.Payload, "error", err)
+			continue
+		}
+		// IE: already purged locally before publishing
+		if parsed.Origin == b.origin {
+			continue
+		}
+
+		purged := purgeLocal(parsed.Package)
+		logger.Info("Purged cache entries", "package", parsed.Package, "entries", purged, "origin", parsed.Origin)
+	}
+}
+
+func (b *invalidationBus) Publish(name string) {
+	payload, _ := json.Marshal(invalidationMessage{Origin: b.origin, Package: name})
+	if err := b.client.Publish(context.Background(), invalidationChannel, payload).Err(); err != nil {
+		logger.Error("Could not broadcast invalidation", "package", name, "error", err)
+	}
+}
+
+func (b *invalidationBus) Close() {
+	_ = b.pubsub.Close()
+	// IE: the listener must not log or purge once New() replaced the loggers and caches
+	<-b.done
+	_ = b.client.Close()
+}
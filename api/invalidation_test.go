@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fillCachesFor(name string) {
+	responseCache.Set(treeKeyPrefix+name+"@1.0.0", []byte("{}"), 0)
+	responseCache.Set(treeKeyPrefix+name+"@2.0.0", []byte("{}"), 0)
+	packumentCache.Set(packumentKeyPrefix+name, []byte("{}"), 0)
+	packumentCache.Set(versionKeyPrefix+name+"@1.0.0", []byte("{}"), 0)
+}
+
+func TestPurgeLocal(t *testing.T) {
+	New()
+	fillCachesFor("react")
+	fillCachesFor("react-dom")
+
+	assert.Equal(t, 0, purgeLocal("React"))
+	assert.Equal(t, 3, purgeLocal(" react"))
+
+	_, found := packumentCache.Get(packumentKeyPrefix + "react")
+	assert.False(t, found)
+	_, found = responseCache.Get(treeKeyPrefix + "react-dom@1.0.0")
+	assert.True(t, found)
+}
+
+func TestPurgeHandlerBroadcasts(t *testing.T) {
+	server := miniredis.RunT(t)
+	handler := New(WithInvalidationBus("redis://" + server.Addr()))
+	defer invalidations.Close()
+
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	sub := client.Subscribe(context.Background(), invalidationChannel)
+	defer sub.Close()
+	_, err := sub.Receive(context.Background())
+	require.Nil(t, err)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/cache/purge/react", nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	msg, err := sub.ReceiveMessage(context.Background())
+	require.Nil(t, err)
+
+	var parsed invalidationMessage
+	require.Nil(t, json.Unmarshal([]byte(msg.Payload), &parsed))
+	assert.Equal(t, "react", parsed.Package)
+	assert.Equal(t, invalidations.origin, parsed.Origin)
+}
+
+func TestInvalidationFromOtherReplica(t *testing.T) {
+	server := miniredis.RunT(t)
+	New(WithInvalidationBus("redis://" + server.Addr()))
+	defer invalidations.Close()
+	fillCachesFor("react")
+
+	payload, _ := json.Marshal(invalidationMessage{Origin: "other-replica", Package: "react"})
+	server.Publish(invalidationChannel, string(payload))
+
+	assert.Eventually(t, func() bool {
+		_, found := responseCache.Get(treeKeyPrefix + "react@1.0.0")
+		return !found
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRedisCacheDeletePrefix(t *testing.T) {
+	server := miniredis.RunT(t)
+	New()
+
+	cache, err := newRedisCache("redis://" + server.Addr())
+	require.Nil(t, err)
+
+	cache.Set("tree:react@1.0.0", []byte("{}"), 0)
+	cache.Set("tree:react@2.0.0", []byte("{}"), 0)
+	cache.Set("tree:react-dom@1.0.0", []byte("{}"), 0)
+
+	assert.Equal(t, 2, cache.DeletePrefix("tree:react@"))
+	assert.True(t, server.Exists("deps:tree:react-dom@1.0.0"))
+}
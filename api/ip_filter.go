@@ -0,0 +1,95 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+var errForbidden = &Error{Code: "forbidden", Status: http.StatusForbidden, message: "forbidden"}
+
+// IE: nil unless WithAddressFilter is set, replaced by every New()
+var addressFilter *ipFilter
+
+type ipFilter struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+func newIPFilter(allow, deny []netip.Prefix) *ipFilter {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil
+	}
+	return &ipFilter{allow: allow, deny: deny}
+}
+
+// IE: the deny list wins, an allow list lets nobody else in. An address that
+// doesn't parse (a unix socket peer) is only let in without an allow list
+func (f *ipFilter) permits(address string) bool {
+	addr, err := netip.ParseAddr(address)
+	if err != nil {
+		return len(f.allow) == 0
+	}
+	// IE: "::ffff:10.0.0.1" from a dual stack listener is 10.0.0.1
+	addr = addr.Unmap().WithZone("")
+	for _, prefix := range f.deny {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	if len(f.allow) == 0 {
+		return true
+	}
+	for _, prefix := range f.allow {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// IE: the peer address, as for the access log. The probes stay open, the
+// kubelet calls from the node rather than from the build infrastructure
+func filterAddresses(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filter := addressFilter
+		if filter == nil || r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if address := clientIP(r); !filter.permits(address) {
+			loggerFrom(r.Context()).Info("Rejected client address", "address", address)
+			httpError(w, r, fmt.Errorf("%w: address %s not allowed", errForbidden, address))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ParseCIDRs parses a comma separated list of networks in CIDR notation, i.e.
+// "10.0.0.0/8,2001:db8::/32", or of single addresses, for WithAddressFilter.
+func ParseCIDRs(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, fmt.Errorf("expected a CIDR or an address, got %q", item)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("expected a CIDR or an address, got %q", item)
+		}
+		// IE: "10.1.2.3/8" is taken for 10.0.0.0/8
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fromAddress(handler http.Handler, path, address string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", path, nil)
+	req.RemoteAddr = address
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAddressFilter(t *testing.T) {
+	allow, err := ParseCIDRs("10.0.0.0/8, 2001:db8::/32")
+	require.Nil(t, err)
+	deny, err := ParseCIDRs("10.6.6.6")
+	require.Nil(t, err)
+	handler := New(WithAddressFilter(allow, deny))
+
+	for address, status := range map[string]int{
+		"10.1.2.3:5000":              http.StatusOK,
+		"[2001:db8::1]:5000":         http.StatusOK,
+		"[::ffff:10.1.2.3]:5000":     http.StatusOK,
+		"10.6.6.6:5000":              http.StatusForbidden,
+		"192.168.1.1:5000":           http.StatusForbidden,
+		"[2001:db9::1]:5000":         http.StatusForbidden,
+		"@":                          http.StatusForbidden,
+		"[fe80::1%eth0]:5000":        http.StatusForbidden,
+		"[2001:db8::1%eth0]:5000":    http.StatusOK,
+		"[::ffff:192.168.1.1]:12345": http.StatusForbidden,
+	} {
+		rec := fromAddress(handler, "/cache/stats", address)
+		assert.Equal(t, status, rec.Code, address)
+		if status == http.StatusForbidden {
+			assert.Equal(t, "forbidden", decodeErrorPayload(t, rec).Code)
+		}
+	}
+
+	// IE: the kubelet probes from wherever the node is
+	assert.Equal(t, http.StatusOK, fromAddress(handler, "/healthz", "192.168.1.1:5000").Code)
+	assert.Equal(t, http.StatusOK, fromAddress(handler, "/readyz", "192.168.1.1:5000").Code)
+
+	handler = New(WithAddressFilter(nil, deny))
+	assert.Equal(t, http.StatusOK, fromAddress(handler, "/cache/stats", "192.168.1.1:5000").Code)
+	assert.Equal(t, http.StatusForbidden, fromAddress(handler, "/cache/stats", "10.6.6.6:5000").Code)
+}
+
+func TestParseCIDRs(t *testing.T) {
+	prefixes, err := ParseCIDRs("10.1.2.3/8,::ffff:192.168.0.1, 2001:db8::/32")
+	require.Nil(t, err)
+	require.Len(t, prefixes, 3)
+	assert.Equal(t, "10.0.0.0/8", prefixes[0].String())
+	assert.Equal(t, "192.168.0.1/32", prefixes[1].String())
+	assert.Equal(t, "2001:db8::/32", prefixes[2].String())
+
+	for _, invalid := range []string{"10.0.0.0/33", "example.com", "10.0.0/8"} {
+		_, err = ParseCIDRs(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
@@ -0,0 +1,330 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// IE: the paths listed per violation, a package deep in a large tree can show
+// up under hundreds of parents
+const maxViolationPaths = 5
+
+// LicensePolicy is an organization's rules on the licenses of the packages of
+// a tree, loaded with LoadLicensePolicy and evaluated by the licenses report
+// section. Rules are SPDX identifiers or globs of them (i.e. "GPL-3.0*"),
+// matched case insensitively.
+type LicensePolicy struct {
+	// Allow lists the only licenses let in, every license when empty.
+	Allow []string `yaml:"allow"`
+	// Deny lists the licenses kept out, winning over Allow.
+	Deny []string `yaml:"deny"`
+	// Strict fails the report with ErrLicenseViolation when a package breaks
+	// the policy.
+	Strict bool `yaml:"strict"`
+}
+
+// LoadLicensePolicy reads the YAML (or JSON) policy file at path, i.e.
+//
+//	allow: [MIT, ISC, Apache-2.0, "BSD-*"]
+//	deny: ["GPL-3.0*", "AGPL-*"]
+//	strict: true
+func LoadLicensePolicy(path string) (*LicensePolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	policy := &LicensePolicy{}
+	if err := yaml.Unmarshal(data, policy); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := policy.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return policy, nil
+}
+
+func (p *LicensePolicy) validate() error {
+	for _, rule := range append(append([]string{}, p.Allow...), p.Deny...) {
+		if _, err := path.Match(rule, ""); err != nil {
+			return fmt.Errorf("rule %q: %w", rule, err)
+		}
+	}
+	return nil
+}
+
+// IE: ?allowLicenses= and ?denyLicenses= replace the lists of the configured
+// policy, ?strict= its mode
+func requestLicensePolicy(query url.Values) (*LicensePolicy, error) {
+	policy := &LicensePolicy{}
+	if opts.licensePolicy != nil {
+		*policy = *opts.licensePolicy
+	}
+	for param, list := range map[string]*[]string{"allowLicenses": &policy.Allow, "denyLicenses": &policy.Deny} {
+		if value := strings.TrimSpace(query.Get(param)); value != "" {
+			*list = nil
+			for _, rule := range strings.Split(value, ",") {
+				if rule = strings.TrimSpace(rule); rule != "" {
+					*list = append(*list, rule)
+				}
+			}
+		}
+	}
+	if value := strings.TrimSpace(query.Get("strict")); value != "" {
+		strict, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: strict must be a boolean, got %q", ErrInvalidQuery, value)
+		}
+		policy.Strict = strict
+	}
+	if err := policy.validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidQuery, err)
+	}
+	return policy, nil
+}
+
+func matchesLicense(rules []string, id string) string {
+	for _, rule := range rules {
+		if matched, _ := path.Match(strings.ToLower(rule), strings.ToLower(id)); matched {
+			return rule
+		}
+	}
+	return ""
+}
+
+// IE: why the policy doesn't let id in, empty when it does
+func (p *LicensePolicy) check(id string) string {
+	if rule := matchesLicense(p.Deny, id); rule != "" {
+		return id + " denied by " + rule
+	}
+	if len(p.Allow) > 0 && matchesLicense(p.Allow, id) == "" {
+		if id == "" {
+			return "no license"
+		}
+		return id + " not allowed"
+	}
+	return ""
+}
+
+// IE: why the policy doesn't let the SPDX expression in, empty when it does.
+// Either side of an OR will do, both of an AND are needed. The exception of a
+// WITH doesn't change the license it applies to
+func (p *LicensePolicy) violation(expression string) string {
+	parsed, err := parseLicenseExpression(expression)
+	if err != nil {
+		// IE: i.e. "SEE LICENSE IN LICENSE.md", only an allow list of it lets it in
+		return p.check(strings.TrimSpace(expression))
+	}
+	return strings.Join(p.evaluate(parsed), ", ")
+}
+
+func (p *LicensePolicy) evaluate(expr *licenseExpression) []string {
+	switch expr.op {
+	case "AND":
+		var reasons []string
+		for _, operand := range expr.operands {
+			reasons = append(reasons, p.evaluate(operand)...)
+		}
+		return reasons
+	case "OR":
+		var reasons []string
+		for _, operand := range expr.operands {
+			failed := p.evaluate(operand)
+			if len(failed) == 0 {
+				return nil
+			}
+			reasons = append(reasons, failed...)
+		}
+		return reasons
+	}
+	if reason := p.check(expr.id); reason != "" {
+		return []string{reason}
+	}
+	return nil
+}
+
+// IE: a license id, or an AND / OR of operands
+type licenseExpression struct {
+	id       string
+	op       string
+	operands []*licenseExpression
+}
+
+// IE: AND binds tighter than OR, like the SPDX spec says
+func parseLicenseExpression(expression string) (*licenseExpression, error) {
+	tokens := strings.Fields(strings.NewReplacer("(", " ( ", ")", " ) ").Replace(expression))
+	if len(tokens) == 0 {
+		return &licenseExpression{}, nil
+	}
+	p := &licenseParser{tokens: tokens}
+	expr, err := p.parse("OR")
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in license %q", p.tokens[p.pos], expression)
+	}
+	return expr, nil
+}
+
+type licenseParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *licenseParser) next() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *licenseParser) parse(op string) (*licenseExpression, error) {
+	operand := p.operand
+	if op == "OR" {
+		operand = func() (*licenseExpression, error) { return p.parse("AND") }
+	}
+	first, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	expr := &licenseExpression{op: op, operands: []*licenseExpression{first}}
+	for strings.EqualFold(p.next(), op) {
+		p.pos++
+		next, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		expr.operands = append(expr.operands, next)
+	}
+	if len(expr.operands) == 1 {
+		return first, nil
+	}
+	return expr, nil
+}
+
+func (p *licenseParser) operand() (*licenseExpression, error) {
+	token := p.next()
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("unexpected end of license")
+	case token == "(":
+		p.pos++
+		expr, err := p.parse("OR")
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("unclosed parenthesis in license")
+		}
+		p.pos++
+		return expr, nil
+	case token == ")" || strings.EqualFold(token, "AND") || strings.EqualFold(token, "OR") || strings.EqualFold(token, "WITH"):
+		return nil, fmt.Errorf("unexpected %q in license", token)
+	}
+	p.pos++
+	if strings.EqualFold(p.next(), "WITH") {
+		p.pos++
+		if exception := p.next(); exception == "" || exception == "(" || exception == ")" {
+			return nil, fmt.Errorf("WITH without an exception in license")
+		}
+		p.pos++
+	}
+	return &licenseExpression{id: token}, nil
+}
+
+// IE: the license field of a version document, an SPDX expression. Old
+// packages have it as {"type": "MIT", "url": ...} instead
+type spdxLicense string
+
+func (l *spdxLicense) UnmarshalJSON(data []byte) error {
+	var expression string
+	if err := json.Unmarshal(data, &expression); err == nil {
+		*l = spdxLicense(expression)
+		return nil
+	}
+	var legacy struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		// IE: a license field nobody can make sense of doesn't fail the resolution
+		*l = ""
+		return nil
+	}
+	*l = spdxLicense(legacy.Type)
+	return nil
+}
+
+// IE: the licenses array of old packages were dual licenses
+func (r *npmPackageResponse) license() string {
+	if r.License != "" || len(r.Licenses) == 0 {
+		return string(r.License)
+	}
+	ids := make([]string, len(r.Licenses))
+	for i, license := range r.Licenses {
+		ids[i] = string(license)
+	}
+	if len(ids) == 1 {
+		return ids[0]
+	}
+	return "(" + strings.Join(ids, " OR ") + ")"
+}
+
+// IE: a name@version breaking the license policy, wherever it shows up
+type licenseViolation struct {
+	Package string `json:"package"`
+	License string `json:"license"`
+	Reason  string `json:"reason"`
+	// IE: from the root down to the package, maxViolationPaths of them at most
+	Paths [][]string `json:"paths"`
+}
+
+// IE: nothing to report without a policy, configured or in the query
+func licensesSection(ctx context.Context, tree *NpmPackageVersion, query url.Values, report *treeReport) error {
+	policy, err := requestLicensePolicy(query)
+	if err != nil {
+		return err
+	}
+	docs, err := versionDocuments(ctx, tree)
+	if err != nil {
+		return err
+	}
+
+	violations := make(map[string]*licenseViolation)
+	for key, doc := range docs {
+		license := doc.license()
+		if reason := policy.violation(license); reason != "" {
+			violations[key] = &licenseViolation{Package: key, License: license, Reason: reason}
+		}
+	}
+
+	keys := make(map[string]bool, len(violations))
+	for key := range violations {
+		keys[key] = true
+	}
+	paths := pathsTo(tree, keys, maxViolationPaths)
+
+	report.LicenseViolations = make([]licenseViolation, 0, len(violations))
+	for key, violation := range violations {
+		violation.Paths = paths[key]
+		report.LicenseViolations = append(report.LicenseViolations, *violation)
+	}
+	sort.Slice(report.LicenseViolations, func(i, j int) bool {
+		return report.LicenseViolations[i].Package < report.LicenseViolations[j].Package
+	})
+
+	if policy.Strict && len(report.LicenseViolations) > 0 {
+		first := report.LicenseViolations[0]
+		return fmt.Errorf("%w: %s (%s) via %s, %d violations in all", ErrLicenseViolation,
+			first.Package, first.Reason, strings.Join(first.Paths[0], " > "), len(report.LicenseViolations))
+	}
+	return nil
+}
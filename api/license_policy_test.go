@@ -0,0 +1,131 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/snyk/snyk-code-review-exercise/internal/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// IE: fixtures with the raw license field of some versions, in the version documents
+func licensedRegistry(t *testing.T, packages fixtures.Registry, licenses map[string]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		if len(parts) == 2 {
+			if deps, found := packages[parts[0]][parts[1]]; found {
+				doc := map[string]any{"name": parts[0], "version": parts[1], "dependencies": deps}
+				if license, found := licenses[parts[0]+"@"+parts[1]]; found {
+					doc["license"] = json.RawMessage(license)
+				}
+				_ = json.NewEncoder(w).Encode(doc)
+				return
+			}
+		}
+		packages.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestLicenseExpressions(t *testing.T) {
+	policy := &LicensePolicy{Allow: []string{"MIT", "ISC", "Apache-2.0", "BSD-*"}, Deny: []string{"GPL-3.0*"}}
+	for expression, reason := range map[string]string{
+		"MIT":                                "",
+		"bsd-3-clause":                       "",
+		"(MIT OR GPL-3.0-only)":              "",
+		"GPL-3.0-or-later":                   "GPL-3.0-or-later denied by GPL-3.0*",
+		"MIT AND WTFPL":                      "WTFPL not allowed",
+		"(GPL-3.0 OR WTFPL) AND ISC":         "GPL-3.0 denied by GPL-3.0*, WTFPL not allowed",
+		"Apache-2.0 WITH LLVM-exception":     "",
+		"MIT OR (ISC AND GPL-3.0) AND WTFPL": "",
+		"":                                   "no license",
+		"UNLICENSED":                         "UNLICENSED not allowed",
+		"SEE LICENSE IN LICENSE.md":          "SEE LICENSE IN LICENSE.md not allowed",
+	} {
+		assert.Equal(t, reason, policy.violation(expression), expression)
+	}
+	// IE: without an allow list, anything but the denied ones
+	assert.Equal(t, "", (&LicensePolicy{Deny: []string{"GPL-3.0*"}}).violation(""))
+}
+
+func TestLegacyLicenseFields(t *testing.T) {
+	var doc npmPackageResponse
+	require.Nil(t, json.Unmarshal([]byte(`{"license": {"type": "MIT", "url": "https://opensource.org/licenses/MIT"}}`), &doc))
+	assert.Equal(t, "MIT", doc.license())
+
+	doc = npmPackageResponse{}
+	require.Nil(t, json.Unmarshal([]byte(`{"licenses": [{"type": "MIT"}, {"type": "Apache-2.0"}]}`), &doc))
+	assert.Equal(t, "(MIT OR Apache-2.0)", doc.license())
+
+	// IE: cached version documents keep the same license
+	cached, err := json.Marshal(doc)
+	require.Nil(t, err)
+	doc = npmPackageResponse{}
+	require.Nil(t, json.Unmarshal(cached, &doc))
+	assert.Equal(t, "(MIT OR Apache-2.0)", doc.license())
+}
+
+func TestLicenseViolations(t *testing.T) {
+	registry := licensedRegistry(t, fixtures.Registry{
+		"app":   {"1.0.0": {"a": "^1.0.0", "b": "^1.0.0"}},
+		"a":     {"1.0.0": {"viral": "^1.0.0"}},
+		"b":     {"1.0.0": {"viral": "^1.0.0", "a": "^1.0.0"}},
+		"viral": {"1.0.0": nil},
+	}, map[string]string{"app@1.0.0": `"MIT"`, "a@1.0.0": `"ISC"`, "b@1.0.0": `{"type": "MIT"}`, "viral@1.0.0": `"GPL-3.0-only"`})
+	handler := New(WithRegistryURL(registry.URL), WithLicensePolicy(&LicensePolicy{Deny: []string{"GPL-3.0*"}}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0/report?sections=licenses", nil))
+	report := decodeReport(t, rec)
+	require.Len(t, report.LicenseViolations, 1)
+	assert.Equal(t, licenseViolation{
+		Package: "viral@1.0.0",
+		License: "GPL-3.0-only",
+		Reason:  "GPL-3.0-only denied by GPL-3.0*",
+		Paths: [][]string{
+			{"app@1.0.0", "a@1.0.0", "viral@1.0.0"},
+			{"app@1.0.0", "b@1.0.0", "a@1.0.0", "viral@1.0.0"},
+			{"app@1.0.0", "b@1.0.0", "viral@1.0.0"},
+		},
+	}, report.LicenseViolations[0])
+
+	// IE: the query replaces the lists of the configured policy
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0/report?sections=licenses&denyLicenses=ISC", nil))
+	report = decodeReport(t, rec)
+	require.Len(t, report.LicenseViolations, 1)
+	assert.Equal(t, "a@1.0.0", report.LicenseViolations[0].Package)
+	assert.Len(t, report.LicenseViolations[0].Paths, 2)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0/report?sections=licenses&strict=true", nil))
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	var failure struct{ Error, Code string }
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &failure))
+	assert.Equal(t, "license_violation", failure.Code)
+	assert.Contains(t, failure.Error, "viral@1.0.0 (GPL-3.0-only denied by GPL-3.0*) via app@1.0.0 > a@1.0.0 > viral@1.0.0, 1 violations in all")
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0/report?sections=licenses&strict=maybe", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestLoadLicensePolicy(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "licenses.yaml")
+	require.Nil(t, os.WriteFile(file, []byte("allow: [MIT, \"BSD-*\"]\ndeny: [\"GPL-*\"]\nstrict: true\n"), 0o600))
+	policy, err := LoadLicensePolicy(file)
+	require.Nil(t, err)
+	assert.Equal(t, &LicensePolicy{Allow: []string{"MIT", "BSD-*"}, Deny: []string{"GPL-*"}, Strict: true}, policy)
+
+	require.Nil(t, os.WriteFile(file, []byte("deny: [\"GPL-[\"]\n"), 0o600))
+	_, err = LoadLicensePolicy(file)
+	assert.ErrorContains(t, err, `rule "GPL-["`)
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// IE: when draining started, nil while serving. Reset by every New()
+var drainStart atomic.Pointer[time.Time]
+
+// Drain fails the readiness probe and closes the connections once their
+// response is written, so the load balancer stops sending new requests while
+// the ones in flight complete. It returns once the drain delay of
+// WithDrainDelay has passed since the first call, or ctx is done, and is
+// meant to run before http.Server.Shutdown: the Kubernetes endpoints take a
+// few seconds to drop a terminating pod, requests keep coming meanwhile.
+func Drain(ctx context.Context) error {
+	now := time.Now()
+	if drainStart.CompareAndSwap(nil, &now) {
+		logger.Info("Draining, readiness fails from now on", "delay", opts.drainDelay)
+	}
+
+	// IE: a preStop hook and then SIGTERM both drain, the second call waits
+	// for what is left of the delay only
+	wait := opts.drainDelay - time.Since(*drainStart.Load())
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func draining() bool {
+	return drainStart.Load() != nil
+}
+
+// IE: liveness only tells the process answers, it must keep passing while
+// draining or the kubelet restarts the pod in the middle of its resolutions
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+// IE: readiness is what takes the pod out of the endpoints, failed as soon as
+// draining starts
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if draining() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("draining\n"))
+		return
+	}
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+// IE: for a preStop httpGet hook, which has no body and would be GET anyway.
+// Blocks for the drain delay, the kubelet only sends SIGTERM once it returns
+func drainHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := Drain(r.Context()); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// IE: keep-alive connections would keep the requests coming to a draining
+// replica, past its grace period. A Connection: close response ends them
+func closeWhileDraining(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if draining() {
+			w.Header().Set("Connection", "close")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func probe(handler http.Handler, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+	return rec
+}
+
+func TestProbes(t *testing.T) {
+	handler := New()
+	assert.Equal(t, http.StatusOK, probe(handler, "/healthz").Code)
+	assert.Equal(t, http.StatusOK, probe(handler, "/readyz").Code)
+	assert.Empty(t, probe(handler, "/cache/stats").Header().Get("Connection"))
+
+	require.Nil(t, Drain(context.Background()))
+	// IE: alive still, only out of the endpoints
+	assert.Equal(t, http.StatusOK, probe(handler, "/healthz").Code)
+	assert.Equal(t, http.StatusServiceUnavailable, probe(handler, "/readyz").Code)
+	assert.Equal(t, "close", probe(handler, "/cache/stats").Header().Get("Connection"))
+
+	// IE: a new instance serves again
+	handler = New()
+	assert.Equal(t, http.StatusOK, probe(handler, "/readyz").Code)
+}
+
+func TestDrainDelay(t *testing.T) {
+	New(WithDrainDelay(50 * time.Millisecond))
+
+	start := time.Now()
+	rec := probe(AdminHandler(), "/debug/drain")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	// IE: SIGTERM after the preStop hook, the delay is already over
+	start = time.Now()
+	require.Nil(t, Drain(context.Background()))
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+
+	New(WithDrainDelay(time.Hour))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, Drain(ctx), context.Canceled)
+	assert.True(t, draining())
+
+	rec = httptest.NewRecorder()
+	AdminHandler().ServeHTTP(rec, httptest.NewRequest("PUT", "/debug/drain", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
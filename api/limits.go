@@ -0,0 +1,55 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// IE: npm refuses to publish longer names, no registry will know one
+const (
+	maxPackageNameLength = 214
+	// IE: a range as long as "1.2.3 || 2.3.4 || ..." needs, far below the URI limit
+	maxVersionLength = 256
+)
+
+var (
+	errURITooLong      = &Error{Code: "uri_too_long", Status: http.StatusRequestURITooLong, message: "request uri too long"}
+	errRequestTooLarge = &Error{Code: "request_too_large", Status: http.StatusRequestEntityTooLarge, message: "request body too large"}
+	errInvalidPackage  = &Error{Code: "invalid_package", Status: http.StatusBadRequest, message: "invalid package"}
+)
+
+// IE: in front of the router, oversized requests don't get as far as the
+// access to the caches. A body announcing more than the limit is refused right
+// away, the others are cut at the limit when read
+func limitInput(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if opts.maxURIBytes > 0 && len(r.RequestURI) > opts.maxURIBytes {
+			httpError(w, r, fmt.Errorf("%w: %d bytes, at most %d", errURITooLong, len(r.RequestURI), opts.maxURIBytes))
+			return
+		}
+		if opts.maxBodyBytes > 0 {
+			if r.ContentLength > opts.maxBodyBytes {
+				httpError(w, r, fmt.Errorf("%w: %d bytes, at most %d", errRequestTooLarge, r.ContentLength, opts.maxBodyBytes))
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, opts.maxBodyBytes)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// IE: before the resolver, whatever isn't a package the registry could have
+// would only cost it a 404
+func checkPackageInput(name, version string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("%w: empty name", errInvalidPackage)
+	case len(name) > maxPackageNameLength:
+		return fmt.Errorf("%w: name of %d characters, at most %d", errInvalidPackage, len(name), maxPackageNameLength)
+	case version == "":
+		return fmt.Errorf("%w: empty version", errInvalidPackage)
+	case len(version) > maxVersionLength:
+		return fmt.Errorf("%w: version of %d characters, at most %d", errInvalidPackage, len(version), maxVersionLength)
+	}
+	return nil
+}
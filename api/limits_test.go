@@ -0,0 +1,56 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInputLimits(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{"app": {"1.0.0": nil}})
+	handler := New(WithRegistryURL(registry.URL), WithInputLimits(512, 16))
+
+	for _, tc := range []struct {
+		path   string
+		status int
+		code   string
+	}{
+		{"/package/app/1.0.0?" + strings.Repeat("a", 512), http.StatusRequestURITooLong, "uri_too_long"},
+		{"/package/" + strings.Repeat("a", maxPackageNameLength+1) + "/1.0.0", http.StatusBadRequest, "invalid_package"},
+		{"/package/app/" + strings.Repeat("1", maxVersionLength+1), http.StatusBadRequest, "invalid_package"},
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", tc.path, nil))
+		assert.Equal(t, tc.status, rec.Code, tc.code)
+		assert.Equal(t, tc.code, decodeErrorPayload(t, rec).Code)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/cache/purge/app", strings.NewReader(strings.Repeat("x", 17))))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Equal(t, "request_too_large", decodeErrorPayload(t, rec).Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestLimitInputCutsBodies(t *testing.T) {
+	New(WithInputLimits(0, 16))
+	var readErr error
+	handler := limitInput(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, readErr = io.ReadAll(r.Body)
+	}))
+
+	// IE: chunked, no Content-Length to refuse it on
+	req := httptest.NewRequest("POST", "/cache/purge/app", io.NopCloser(strings.NewReader(strings.Repeat("x", 32))))
+	req.ContentLength = -1
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	var tooLarge *http.MaxBytesError
+	require.ErrorAs(t, readErr, &tooLarge)
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// IE: messages are constants, the bound only matters if one ever embeds a value
+const maxSampledMessages = 1024
+
+// IE: nil unless WithLogSampling is set, replaced by every New()
+var logSampling *logSampler
+
+// IE: an upstream outage fails every fetch the same way, thousands of identical
+// lines a second tell nothing more than the first few. Per message and level,
+// the first records of every interval pass, then one in thereafter
+type logSampler struct {
+	first      int
+	thereafter int
+	interval   time.Duration
+	now        func() time.Time
+
+	mu       sync.Mutex
+	messages map[sampleKey]*sampledMessage
+
+	suppressed atomic.Uint64
+}
+
+type sampleKey struct {
+	level   slog.Level
+	message string
+}
+
+type sampledMessage struct {
+	start time.Time
+	seen  int
+	// IE: dropped since the last one that passed, which reports them
+	dropped int
+}
+
+func newLogSampler(first, thereafter int, interval time.Duration) *logSampler {
+	if first <= 0 || interval <= 0 {
+		return nil
+	}
+	return &logSampler{
+		first:      first,
+		thereafter: thereafter,
+		interval:   interval,
+		now:        time.Now,
+		messages:   make(map[sampleKey]*sampledMessage),
+	}
+}
+
+// IE: whether the record passes, and then how many like it were dropped before it
+func (s *logSampler) allow(level slog.Level, message string) (bool, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	key := sampleKey{level, message}
+	m, ok := s.messages[key]
+	if !ok {
+		if len(s.messages) >= maxSampledMessages {
+			clear(s.messages)
+		}
+		m = &sampledMessage{start: now}
+		s.messages[key] = m
+	}
+	if now.Sub(m.start) >= s.interval {
+		m.start = now
+		m.seen = 0
+	}
+
+	m.seen++
+	if m.seen > s.first && (s.thereafter <= 0 || (m.seen-s.first)%s.thereafter != 0) {
+		m.dropped++
+		s.suppressed.Add(1)
+		return false, 0
+	}
+	dropped := m.dropped
+	m.dropped = 0
+	return true, dropped
+}
+
+// IE: only warnings and errors are sampled, the info lines of every request are
+// what the operators count on, the debug ones are asked for
+type samplingHandler struct {
+	slog.Handler
+	sampler *logSampler
+}
+
+func (h samplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level < slog.LevelWarn {
+		return h.Handler.Handle(ctx, r)
+	}
+	ok, dropped := h.sampler.allow(r.Level, r.Message)
+	if !ok {
+		return nil
+	}
+	if dropped > 0 {
+		r = r.Clone()
+		r.AddAttrs(slog.Int("suppressed", dropped))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+// IE: the request loggers derive from the package one, they share its sampler
+func (h samplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return samplingHandler{h.Handler.WithAttrs(attrs), h.sampler}
+}
+
+func (h samplingHandler) WithGroup(name string) slog.Handler {
+	return samplingHandler{h.Handler.WithGroup(name), h.sampler}
+}
+
+func sampledLogger(l *slog.Logger, s *logSampler) *slog.Logger {
+	if s == nil {
+		return l
+	}
+	return slog.New(samplingHandler{l.Handler(), s})
+}
+
+func registerLogMetrics(registry *prometheus.Registry) {
+	registry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Name: "deps_log_records_suppressed_total",
+		Help: "Warning and error log records dropped by the log sampling.",
+	}, func() float64 {
+		if logSampling == nil {
+			return 0
+		}
+		return float64(logSampling.suppressed.Load())
+	}))
+}
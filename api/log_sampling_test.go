@@ -0,0 +1,110 @@
+package api
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogSamplerAllowsFirstThenOneInThereafter(t *testing.T) {
+	now := time.Unix(0, 0)
+	s := newLogSampler(2, 3, time.Second)
+	s.now = func() time.Time { return now }
+
+	var passed []int
+	for i := 1; i <= 8; i++ {
+		if ok, _ := s.allow(slog.LevelError, "Registry call failed"); ok {
+			passed = append(passed, i)
+		}
+	}
+	assert.Equal(t, []int{1, 2, 5, 8}, passed)
+	assert.EqualValues(t, 4, s.suppressed.Load())
+
+	// IE: counted apart, by level and message
+	ok, _ := s.allow(slog.LevelWarn, "Registry call failed")
+	assert.True(t, ok)
+	ok, _ = s.allow(slog.LevelError, "Could not read packument")
+	assert.True(t, ok)
+
+	// IE: a new interval starts over, reporting the ones dropped meanwhile
+	s.allow(slog.LevelError, "Registry call failed")
+	now = now.Add(time.Second)
+	ok, dropped := s.allow(slog.LevelError, "Registry call failed")
+	assert.True(t, ok)
+	assert.Equal(t, 1, dropped)
+}
+
+func TestLogSamplerDisabled(t *testing.T) {
+	assert.Nil(t, newLogSampler(0, 100, time.Second))
+	assert.Nil(t, newLogSampler(10, 100, 0))
+
+	l := slog.New(slog.DiscardHandler)
+	assert.Same(t, l, sampledLogger(l, nil))
+}
+
+func TestSampledLoggerKeepsInfoAndRequestFields(t *testing.T) {
+	var buf bytes.Buffer
+	base, err := NewLogger(&buf, LogFormatJSON, slog.LevelInfo)
+	require.Nil(t, err)
+	l := sampledLogger(base, newLogSampler(1, 0, time.Minute)).With("package", "react")
+
+	for i := 0; i < 3; i++ {
+		l.Info("Request completed")
+		l.Error("Registry call failed")
+	}
+
+	var infos, errors int
+	for _, record := range readLogRecords(t, &buf) {
+		assert.Equal(t, "react", record["package"])
+		switch record["level"] {
+		case "INFO":
+			infos++
+		case "ERROR":
+			errors++
+		}
+	}
+	assert.Equal(t, 3, infos)
+	assert.Equal(t, 1, errors)
+}
+
+func TestPackageHandlerSamplesUpstreamErrors(t *testing.T) {
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusInternalServerError)
+	}))
+	defer registry.Close()
+
+	var buf bytes.Buffer
+	l, err := NewLogger(&buf, LogFormatJSON, slog.LevelInfo)
+	require.Nil(t, err)
+	handler := New(WithRegistryURL(registry.URL), WithLogger(l), WithLogSampling(2, 0, time.Minute), WithResponseCache(0, 0), WithNegativeCache(0))
+
+	for i := 0; i < 5; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/react/16.13.0", nil))
+		require.NotEqual(t, http.StatusOK, rec.Code)
+	}
+
+	counts := make(map[string]int)
+	for _, record := range readLogRecords(t, &buf) {
+		counts[record["msg"].(string)]++
+	}
+	assert.Equal(t, 2, counts["Could not resolve tree"])
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	var suppressed string
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if strings.HasPrefix(line, "deps_log_records_suppressed_total ") {
+			suppressed = strings.TrimPrefix(line, "deps_log_records_suppressed_total ")
+		}
+	}
+	assert.NotEqual(t, "", suppressed)
+	assert.NotEqual(t, "0", suppressed)
+}
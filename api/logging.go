@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+)
+
+// Log formats accepted by NewLogger.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// IE: replaced by every New(), either by the one of WithLogger or by the default (text, info level)
+var logger = slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+// NewLogger returns a structured logger writing to w in the given format
+// (LogFormatText or LogFormatJSON), dropping the records below level.
+func NewLogger(w io.Writer, format string, level slog.Leveler) (*slog.Logger, error) {
+	handler, err := newLogHandler(w, format, level)
+	if err != nil {
+		return nil, err
+	}
+	return slog.New(handler), nil
+}
+
+// NewSplitLogger is NewLogger writing the warnings and errors to errW, and
+// only the records below to w.
+func NewSplitLogger(w, errW io.Writer, format string, level slog.Leveler) (*slog.Logger, error) {
+	low, err := newLogHandler(w, format, level)
+	if err != nil {
+		return nil, err
+	}
+	high, err := newLogHandler(errW, format, level)
+	if err != nil {
+		return nil, err
+	}
+	return slog.New(levelSplitHandler{low: low, high: high}), nil
+}
+
+func newLogHandler(w io.Writer, format string, level slog.Leveler) (slog.Handler, error) {
+	handlerOpts := &slog.HandlerOptions{Level: level}
+	switch format {
+	case LogFormatText, "":
+		return slog.NewTextHandler(w, handlerOpts), nil
+	case LogFormatJSON:
+		return slog.NewJSONHandler(w, handlerOpts), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q, expected %s or %s", format, LogFormatText, LogFormatJSON)
+	}
+}
+
+// IE: warnings go with the errors, they are what gets looked at in an incident
+type levelSplitHandler struct {
+	low, high slog.Handler
+}
+
+func (h levelSplitHandler) pick(level slog.Level) slog.Handler {
+	if level >= slog.LevelWarn {
+		return h.high
+	}
+	return h.low
+}
+
+func (h levelSplitHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.pick(level).Enabled(ctx, level)
+}
+
+func (h levelSplitHandler) Handle(ctx context.Context, record slog.Record) error {
+	return h.pick(record.Level).Handle(ctx, record)
+}
+
+func (h levelSplitHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return levelSplitHandler{low: h.low.WithAttrs(attrs), high: h.high.WithAttrs(attrs)}
+}
+
+func (h levelSplitHandler) WithGroup(name string) slog.Handler {
+	return levelSplitHandler{low: h.low.WithGroup(name), high: h.high.WithGroup(name)}
+}
+
+type loggerKey struct{}
+
+// IE: carried by the context like the resolution stats, so everything logged
+// while resolving a tree comes with the fields of its request
+func withLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// IE: background jobs (warm-up, revalidation) have no request, the package logger then
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return logger
+}
+
+// IE: the fields every line of a package request carries, on top of its request id
+func requestLogger(r *http.Request, name, version string) *slog.Logger {
+	return loggerFrom(r.Context()).With("package", name, "version", version, "client", requestClient(r))
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readLogRecords(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var records []map[string]interface{}
+	scanner := bufio.NewScanner(bytes.NewReader(buf.Bytes()))
+	for scanner.Scan() {
+		var record map[string]interface{}
+		require.Nil(t, json.Unmarshal(scanner.Bytes(), &record), scanner.Text())
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := NewLogger(&buf, LogFormatJSON, slog.LevelInfo)
+	require.Nil(t, err)
+	l.Debug("dropped")
+	l.Info("kept", "package", "react")
+
+	records := readLogRecords(t, &buf)
+	require.Len(t, records, 1)
+	assert.Equal(t, "kept", records[0]["msg"])
+	assert.Equal(t, "INFO", records[0]["level"])
+	assert.Equal(t, "react", records[0]["package"])
+
+	buf.Reset()
+	l, err = NewLogger(&buf, LogFormatText, slog.LevelDebug)
+	require.Nil(t, err)
+	l.Debug("kept")
+	assert.Contains(t, buf.String(), "level=DEBUG msg=kept")
+
+	_, err = NewLogger(&buf, "xml", slog.LevelInfo)
+	assert.NotNil(t, err)
+}
+
+func TestNewSplitLogger(t *testing.T) {
+	var debug, errs bytes.Buffer
+	l, err := NewSplitLogger(&debug, &errs, LogFormatJSON, slog.LevelDebug)
+	require.Nil(t, err)
+	l = l.With("request_id", "r1")
+	l.Debug("resolving")
+	l.Info("resolved")
+	l.Warn("slow")
+	l.Error("failed")
+
+	records := readLogRecords(t, &debug)
+	require.Len(t, records, 2)
+	assert.Equal(t, "resolving", records[0]["msg"])
+	assert.Equal(t, "r1", records[1]["request_id"])
+
+	records = readLogRecords(t, &errs)
+	require.Len(t, records, 2)
+	assert.Equal(t, "slow", records[0]["msg"])
+	assert.Equal(t, "r1", records[1]["request_id"])
+}
+
+func TestPackageHandlerLogsRequestFields(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{
+		"app": {"1.0.0": {"missing": "^1.0.0"}},
+		"a":   {"1.0.0": nil},
+	})
+	var buf bytes.Buffer
+	l, err := NewLogger(&buf, LogFormatJSON, slog.LevelInfo)
+	require.Nil(t, err)
+	handler := New(WithRegistryURL(registry.URL), WithLogger(l))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/a/1.0.0", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	var completed, failed map[string]interface{}
+	for _, record := range readLogRecords(t, &buf) {
+		switch record["msg"] {
+		case "Request completed":
+			completed = record
+		case "Could not resolve tree":
+			failed = record
+		}
+	}
+	require.NotNil(t, completed)
+	assert.Equal(t, "a", completed["package"])
+	assert.Equal(t, "1.0.0", completed["version"])
+	assert.Equal(t, cacheStatusMiss, completed["cache"])
+	assert.Contains(t, completed, "duration")
+	assert.Contains(t, completed, "client")
+
+	require.NotNil(t, failed)
+	assert.Equal(t, "ERROR", failed["level"])
+	assert.Equal(t, "app", failed["package"])
+	assert.Contains(t, failed["error"], "missing")
+}
+
+func TestLoggerFromFallsBackOnPackageLogger(t *testing.T) {
+	New()
+	assert.Same(t, logger, loggerFrom(context.Background()))
+
+	l := logger.With("package", "react")
+	assert.Same(t, l, loggerFrom(withLogger(context.Background(), l)))
+}
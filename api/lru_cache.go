@@ -0,0 +1,214 @@
+package api
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// IE: size bounded LRU with per entry expiry, replaces the old unbounded lastRequest map
+type lruCache struct {
+	mu       sync.Mutex
+	capacity int
+
+	// IE: one npm@8.19.2 tree weighs as much as thousands of small ones, so bound bytes as well as entries
+	maxBytes int64
+	bytes    int64
+
+	// IE: the bytes of all the shards of a shardedCache, nil for a plain LRU
+	total *atomic.Int64
+
+	ll    *list.List
+	items map[string]*list.Element
+	cacheCounters
+
+	// IE: overridable for tests
+	now func() time.Time
+
+	// IE: called outside the lock with every entry pushed out by capacity/budget (not expiry), i.e. to spill it to disk
+	onEvict func(key string, value []byte, expires time.Time)
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	stored  time.Time
+	expires time.Time
+}
+
+// IE: a capacity below 1 disables caching altogether, a maxBytes of 0 doesn't bound the size
+func newLRUCache(capacity int, maxBytes int64) *lruCache {
+	return &lruCache{
+		capacity: capacity,
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+		now:      time.Now,
+	}
+}
+
+func (c *lruCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, found := c.items[key]
+	if !found {
+		c.record(false)
+		return nil, false
+	}
+
+	entry := elem.Value.(*lruEntry)
+	if !entry.expires.IsZero() && c.now().After(entry.expires) {
+		c.removeElement(elem)
+		c.recordEviction()
+		c.record(false)
+		return nil, false
+	}
+
+	c.ll.MoveToFront(elem)
+	c.record(true)
+	return entry.value, true
+}
+
+// IE: a zero ttl never expires the entry
+func (c *lruCache) Set(key string, value []byte, ttl time.Duration) {
+	if c.capacity < 1 {
+		return
+	}
+
+	var expires time.Time
+	if ttl > 0 {
+		expires = c.now().Add(ttl)
+	}
+
+	// IE: would evict everything else and still not fit
+	if c.maxBytes > 0 && int64(len(value)) > c.maxBytes {
+		c.Delete(key)
+		if c.onEvict != nil {
+			c.onEvict(key, value, expires)
+		}
+		return
+	}
+
+	c.mu.Lock()
+
+	if elem, found := c.items[key]; found {
+		entry := elem.Value.(*lruEntry)
+		c.addBytes(int64(len(value)) - int64(len(entry.value)))
+		entry.value = value
+		entry.stored = c.now()
+		entry.expires = expires
+		c.ll.MoveToFront(elem)
+	} else {
+		c.items[key] = c.ll.PushFront(&lruEntry{key: key, value: value, stored: c.now(), expires: expires})
+		c.addBytes(int64(len(value)))
+	}
+
+	var evicted []*lruEntry
+	for c.ll.Len() > c.capacity || (c.maxBytes > 0 && c.bytes > c.maxBytes) {
+		back := c.ll.Back()
+		c.removeElement(back)
+		c.recordEviction()
+		evicted = append(evicted, back.Value.(*lruEntry))
+	}
+	c.mu.Unlock()
+
+	if c.onEvict != nil {
+		for _, entry := range evicted {
+			c.onEvict(entry.key, entry.value, entry.expires)
+		}
+	}
+}
+
+// IE: drops the least recently used entry unless it is keep, false when there is none to drop
+func (c *lruCache) evictOldest(keep string) bool {
+	c.mu.Lock()
+	back := c.ll.Back()
+	if back == nil || back.Value.(*lruEntry).key == keep {
+		c.mu.Unlock()
+		return false
+	}
+	c.removeElement(back)
+	c.recordEviction()
+	c.mu.Unlock()
+
+	if c.onEvict != nil {
+		entry := back.Value.(*lruEntry)
+		c.onEvict(entry.key, entry.value, entry.expires)
+	}
+	return true
+}
+
+func (c *lruCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, found := c.items[key]; found {
+		c.removeElement(elem)
+	}
+}
+
+func (c *lruCache) Entries(prefix string) []CacheEntryInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	var entries []CacheEntryInfo
+	for key, elem := range c.items {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		entry := elem.Value.(*lruEntry)
+		if !entry.expires.IsZero() && now.After(entry.expires) {
+			continue
+		}
+		entries = append(entries, newCacheEntryInfo(key, len(entry.value), now, entry.stored, entry.expires))
+	}
+	return entries
+}
+
+func (c *lruCache) DeletePrefix(prefix string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	deleted := 0
+	for key, elem := range c.items {
+		if strings.HasPrefix(key, prefix) {
+			c.removeElement(elem)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+func (c *lruCache) Stats() CacheStats {
+	c.mu.Lock()
+	entries, bytes := c.ll.Len(), c.bytes
+	c.mu.Unlock()
+
+	stats := c.stats(CacheBackendMemory, entries)
+	stats.Bytes = bytes
+	return stats
+}
+
+func (c *lruCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+func (c *lruCache) removeElement(elem *list.Element) {
+	entry := elem.Value.(*lruEntry)
+	c.ll.Remove(elem)
+	delete(c.items, entry.key)
+	c.addBytes(-int64(len(entry.value)))
+}
+
+func (c *lruCache) addBytes(n int64) {
+	c.bytes += n
+	if c.total != nil {
+		c.total.Add(n)
+	}
+}
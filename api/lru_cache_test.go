@@ -0,0 +1,81 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRUCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newLRUCache(2, 0)
+
+	cache.Set("a", []byte("1"), 0)
+	cache.Set("b", []byte("2"), 0)
+
+	// IE: touch 'a' so 'b' becomes the least recently used
+	_, found := cache.Get("a")
+	assert.True(t, found)
+
+	cache.Set("c", []byte("3"), 0)
+
+	_, found = cache.Get("b")
+	assert.False(t, found)
+
+	value, found := cache.Get("a")
+	assert.True(t, found)
+	assert.Equal(t, []byte("1"), value)
+
+	assert.Equal(t, 2, cache.Len())
+}
+
+func TestLRUCacheExpiresEntries(t *testing.T) {
+	now := time.Now()
+	cache := newLRUCache(10, 0)
+	cache.now = func() time.Time { return now }
+
+	cache.Set("a", []byte("1"), time.Minute)
+
+	now = now.Add(30 * time.Second)
+	_, found := cache.Get("a")
+	assert.True(t, found)
+
+	now = now.Add(time.Minute)
+	_, found = cache.Get("a")
+	assert.False(t, found)
+	assert.Equal(t, 0, cache.Len())
+}
+
+func TestLRUCacheDisabled(t *testing.T) {
+	cache := newLRUCache(0, 0)
+
+	cache.Set("a", []byte("1"), time.Minute)
+
+	_, found := cache.Get("a")
+	assert.False(t, found)
+}
+
+func TestLRUCacheEnforcesMemoryBudget(t *testing.T) {
+	cache := newLRUCache(100, 10)
+
+	cache.Set("a", []byte("1234"), 0)
+	cache.Set("b", []byte("1234"), 0)
+	assert.Equal(t, int64(8), cache.Stats().Bytes)
+
+	// IE: one big entry pushes out both small ones
+	cache.Set("c", []byte("12345678"), 0)
+	assert.Equal(t, 1, cache.Len())
+	assert.Equal(t, int64(8), cache.Stats().Bytes)
+	assert.Equal(t, uint64(2), cache.Stats().Evictions)
+
+	// IE: bigger than the whole budget, not cached at all
+	cache.Set("d", []byte("12345678901"), 0)
+	_, found := cache.Get("d")
+	assert.False(t, found)
+	_, found = cache.Get("c")
+	assert.True(t, found)
+
+	// IE: replacing an entry accounts for the size difference
+	cache.Set("c", []byte("12"), 0)
+	assert.Equal(t, int64(2), cache.Stats().Bytes)
+}
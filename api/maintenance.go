@@ -0,0 +1,195 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// IE: the weights of the maintenance score, out of 100
+const (
+	maintenanceRecencyWeight     = 40
+	maintenanceCadenceWeight     = 30
+	maintenanceMaintainersWeight = 30
+
+	// IE: a package last published that long ago gets nothing for recency
+	maintenanceStaleAfter = 3 * 365 * 24 * time.Hour
+	// IE: releases in the last year (and maintainers) past which the score is full
+	maintenanceFullCadence     = 6
+	maintenanceFullMaintainers = 3
+)
+
+// MaintenanceScore rates how actively a package is maintained, from its
+// packument, on every node of the package with ?maintenance=true.
+type MaintenanceScore struct {
+	// Score goes from 0 (abandoned) to 100: 40 for the recency of the last
+	// publish, 30 for the releases of the last year and 30 for the maintainers.
+	Score            int       `json:"score"`
+	LastPublish      time.Time `json:"lastPublish"`
+	ReleasesLastYear int       `json:"releasesLastYear"`
+	Maintainers      int       `json:"maintainers"`
+}
+
+// IE: the time field of a packument, version -> publish date next to the
+// "created" and "modified" ones. Unpublished packages have an object there,
+// the entries that aren't dates are left out
+type publishTimes map[string]time.Time
+
+func (t *publishTimes) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		*t = nil
+		return nil
+	}
+	times := make(publishTimes, len(raw))
+	for key, value := range raw {
+		var date time.Time
+		if err := json.Unmarshal(value, &date); err == nil {
+			times[key] = date
+		}
+	}
+	*t = times
+	return nil
+}
+
+// IE: of the versions still listed, zero without publish dates
+func (m *npmPackageMetaResponse) lastPublish() time.Time {
+	var last time.Time
+	for version, published := range m.Time {
+		if _, found := m.Versions[version]; found && published.After(last) {
+			last = published
+		}
+	}
+	return last
+}
+
+func requestMaintenance(query url.Values) (bool, error) {
+	value := strings.TrimSpace(query.Get("maintenance"))
+	if value == "" {
+		return false, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%w: maintenance must be a boolean, got %q", ErrInvalidQuery, value)
+	}
+	return enabled, nil
+}
+
+// IE: nil for the packuments without publish dates (i.e. from a CDN), there
+// is nothing to tell then
+func maintenanceScore(meta *npmPackageMetaResponse, now time.Time) *MaintenanceScore {
+	score := &MaintenanceScore{Maintainers: len(meta.Maintainers), LastPublish: meta.lastPublish()}
+	for version, published := range meta.Time {
+		if _, found := meta.Versions[version]; found && now.Sub(published) <= 365*24*time.Hour {
+			score.ReleasesLastYear++
+		}
+	}
+	if score.LastPublish.IsZero() {
+		return nil
+	}
+
+	age := min(max(now.Sub(score.LastPublish), 0), maintenanceStaleAfter)
+	recency := maintenanceRecencyWeight * (1 - float64(age)/float64(maintenanceStaleAfter))
+	cadence := maintenanceCadenceWeight * float64(min(score.ReleasesLastYear, maintenanceFullCadence)) / maintenanceFullCadence
+	maintainers := maintenanceMaintainersWeight * float64(min(score.Maintainers, maintenanceFullMaintainers)) / maintenanceFullMaintainers
+	score.Score = int(math.Round(recency + cadence + maintainers))
+	return score
+}
+
+// IE: one score per package, from the packuments the resolution cached. The
+// ones that can't be fetched (again) only get logged, the tree is still right
+func maintenanceScores(ctx context.Context, names []string) map[string]*MaintenanceScore {
+	scores := make(map[string]*MaintenanceScore, len(names))
+	results := make([]*MaintenanceScore, len(names))
+	now := time.Now()
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(live().concurrency, 1))
+	for i, name := range names {
+		g.Go(func() error {
+			meta, err := fetchPackageMeta(gctx, name)
+			if err != nil {
+				loggerFrom(ctx).Warn("Could not score the maintenance", "name", name, "error", err)
+				return nil
+			}
+			results[i] = maintenanceScore(meta, now)
+			return nil
+		})
+	}
+	_ = g.Wait()
+	for i, name := range names {
+		scores[name] = results[i]
+	}
+	return scores
+}
+
+func annotateMaintenance(ctx context.Context, root *NpmPackageVersion) {
+	var nodes []*NpmPackageVersion
+	var names []string
+	listed := make(map[string]bool)
+	visited := map[*NpmPackageVersion]bool{root: true}
+	stack := []*NpmPackageVersion{root}
+	for len(stack) > 0 {
+		pkg := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		nodes = append(nodes, pkg)
+		if !listed[pkg.Name] {
+			listed[pkg.Name] = true
+			names = append(names, pkg.Name)
+		}
+		for _, dep := range pkg.Dependencies {
+			if dep != nil && !visited[dep] {
+				visited[dep] = true
+				stack = append(stack, dep)
+			}
+		}
+	}
+
+	scores := maintenanceScores(ctx, names)
+	for _, pkg := range nodes {
+		pkg.Maintenance = scores[pkg.Name]
+	}
+}
+
+// IE: like the advisories, lines of their own referring to the nodes by id,
+// once every node is written
+func (s *nodeStream) writeMaintenance(ctx context.Context) error {
+	s.mu.Lock()
+	nodes := s.nodes
+	s.mu.Unlock()
+
+	var names []string
+	listed := make(map[string]bool)
+	for _, node := range nodes {
+		if !listed[node.name] {
+			listed[node.name] = true
+			names = append(names, node.name)
+		}
+	}
+	scores := maintenanceScores(ctx, names)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, node := range nodes {
+		score := scores[node.name]
+		if score == nil {
+			continue
+		}
+		for _, id := range node.ids {
+			line := struct {
+				Node        uint64            `json:"node"`
+				Maintenance *MaintenanceScore `json:"maintenance"`
+			}{id, score}
+			if err := s.enc.Encode(line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/snyk/snyk-code-review-exercise/internal/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// IE: fixtures whose packuments have publish dates (version -> days ago) and maintainers
+func maintainedRegistry(t *testing.T, packages fixtures.Registry, published map[string]map[string]int, maintainers map[string]int) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/")
+		if days, found := published[name]; found {
+			doc := map[string]any{"versions": map[string]any{}, "maintainers": []any{}}
+			times := map[string]any{"created": "2010-01-01T00:00:00.000Z"}
+			for version, deps := range packages[name] {
+				doc["versions"].(map[string]any)[version] = npmPackageResponse{Name: name, Version: version, Dependencies: deps}
+				times[version] = time.Now().AddDate(0, 0, -days[version]).UTC().Format(time.RFC3339)
+			}
+			doc["time"] = times
+			for i := 0; i < maintainers[name]; i++ {
+				doc["maintainers"] = append(doc["maintainers"].([]any), map[string]string{"name": fmt.Sprintf("maintainer-%d", i)})
+			}
+			_ = json.NewEncoder(w).Encode(doc)
+			return
+		}
+		packages.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestMaintenanceScore(t *testing.T) {
+	now := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	meta := &npmPackageMetaResponse{
+		Versions: map[string]npmPackageResponse{"1.0.0": {}, "1.1.0": {}, "1.2.0": {}},
+		Time: publishTimes{
+			"created":  now.AddDate(-5, 0, 0),
+			"modified": now,
+			"1.0.0":    now.AddDate(-2, 0, 0),
+			"1.1.0":    now.AddDate(0, -6, 0),
+			"1.2.0":    now.AddDate(0, -3, 0),
+			// IE: unpublished since
+			"0.9.0": now,
+		},
+		Maintainers: make([]json.RawMessage, 2),
+	}
+	score := maintenanceScore(meta, now)
+	require.NotNil(t, score)
+	assert.Equal(t, now.AddDate(0, -3, 0), score.LastPublish)
+	assert.Equal(t, 2, score.ReleasesLastYear)
+	assert.Equal(t, 2, score.Maintainers)
+	// IE: 40 * (1 - 92/1095) + 30 * 2/6 + 30 * 2/3
+	assert.Equal(t, 67, score.Score)
+
+	abandoned := maintenanceScore(&npmPackageMetaResponse{
+		Versions: map[string]npmPackageResponse{"0.1.0": {}},
+		Time:     publishTimes{"0.1.0": now.AddDate(-8, 0, 0)},
+	}, now)
+	assert.Equal(t, 0, abandoned.Score)
+
+	assert.Nil(t, maintenanceScore(&npmPackageMetaResponse{Versions: meta.Versions}, now))
+}
+
+func TestPublishTimesOfUnpublishedPackages(t *testing.T) {
+	var meta npmPackageMetaResponse
+	require.Nil(t, json.Unmarshal([]byte(`{"time": {"created": "2016-03-23T00:00:00.000Z", "unpublished": {"time": "2016-03-23T00:00:00.000Z"}}}`), &meta))
+	assert.Equal(t, publishTimes{"created": time.Date(2016, 3, 23, 0, 0, 0, 0, time.UTC)}, meta.Time)
+}
+
+func TestMaintenanceAnnotations(t *testing.T) {
+	registry := maintainedRegistry(t, fixtures.Registry{
+		"app":    {"1.0.0": {"active": "^1.0.0", "stale": "^1.0.0"}},
+		"active": {"1.0.0": {"stale": "^1.0.0"}, "1.1.0": {"stale": "^1.0.0"}},
+		"stale":  {"1.0.0": nil},
+	}, map[string]map[string]int{"active": {"1.0.0": 100, "1.1.0": 1}, "stale": {"1.0.0": 2000}}, map[string]int{"active": 3})
+	handler := New(WithRegistryURL(registry.URL))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "maintenance")
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0?maintenance=true", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var tree NpmPackageVersion
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &tree))
+	// IE: the fixtures of app have no publish dates
+	assert.Nil(t, tree.Maintenance)
+	active := tree.Dependencies["active"].Maintenance
+	require.NotNil(t, active)
+	assert.Equal(t, 2, active.ReleasesLastYear)
+	assert.Equal(t, 3, active.Maintainers)
+	assert.Equal(t, 80, active.Score)
+	stale := tree.Dependencies["stale"].Maintenance
+	require.NotNil(t, stale)
+	assert.Equal(t, 0, stale.Score)
+	assert.Equal(t, stale, tree.Dependencies["active"].Dependencies["stale"].Maintenance)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/active/1.1.0?format=ndjson&maintenance=true", nil))
+	lines := readNDJSON(t, rec.Body.String())
+	require.Len(t, lines, 4)
+	assert.Equal(t, "stale", lines[1]["name"])
+	scored := map[any]float64{}
+	for _, line := range lines[2:] {
+		scored[line["node"]] = line["maintenance"].(map[string]any)["score"].(float64)
+	}
+	assert.Equal(t, map[any]float64{lines[0]["id"]: 80, lines[1]["id"]: 0}, scored)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0?maintenance=often", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// IE: memcached treats expirations above 30 days as absolute unix timestamps
+const memcachedMaxRelativeTTL = 30 * 24 * time.Hour
+
+// IE: the longest key memcached accepts
+const memcachedMaxKeyLength = 250
+
+type memcachedCache struct {
+	client *memcache.Client
+	prefix string
+	cacheCounters
+}
+
+// IE: servers is a comma separated list of host:port, keys get spread over all of them
+func newMemcachedCache(servers string) *memcachedCache {
+	client := memcache.New(strings.Split(servers, ",")...)
+	client.Timeout = time.Second
+	return &memcachedCache{client: client, prefix: "deps:"}
+}
+
+func (c *memcachedCache) Get(key string) ([]byte, bool) {
+	item, err := c.client.Get(c.key(key))
+	if err != nil {
+		if !errors.Is(err, memcache.ErrCacheMiss) {
+			logger.Error("Memcached get failed", "key", key, "error", err)
+		}
+		c.record(false)
+		return nil, false
+	}
+	c.record(true)
+	return item.Value, true
+}
+
+func (c *memcachedCache) Set(key string, value []byte, ttl time.Duration) {
+	item := &memcache.Item{Key: c.key(key), Value: value, Expiration: memcachedExpiration(ttl)}
+	if err := c.client.Set(item); err != nil {
+		logger.Error("Memcached set failed", "key", key, "error", err)
+	}
+}
+
+func (c *memcachedCache) Delete(key string) {
+	if err := c.client.Delete(c.key(key)); err != nil && !errors.Is(err, memcache.ErrCacheMiss) {
+		logger.Error("Memcached delete failed", "key", key, "error", err)
+	}
+}
+
+// IE: memcached refuses keys with spaces or control characters (i.e. the
+// ranges of tree keys) and keys over 250 bytes, those are stored under their
+// sha256 instead. Only the keys we make are hashed, so they can't collide
+func (c *memcachedCache) key(key string) string {
+	full := c.prefix + key
+	if len(full) <= memcachedMaxKeyLength && !strings.ContainsFunc(full, func(r rune) bool { return r <= ' ' || r == 0x7f }) {
+		return full
+	}
+	sum := sha256.Sum256([]byte(key))
+	return c.prefix + "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// IE: memcached has no cheap way to count keys under a prefix
+func (c *memcachedCache) Stats() CacheStats {
+	return c.stats(CacheBackendMemcached, -1)
+}
+
+func memcachedExpiration(ttl time.Duration) int32 {
+	if ttl <= 0 {
+		return 0
+	}
+	if ttl > memcachedMaxRelativeTTL {
+		return int32(time.Now().Add(ttl).Unix())
+	}
+	// IE: round up, a zero expiration would mean never expire
+	return int32((ttl + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemcachedExpiration(t *testing.T) {
+	assert.Equal(t, int32(0), memcachedExpiration(0))
+	assert.Equal(t, int32(1), memcachedExpiration(10*time.Millisecond))
+	assert.Equal(t, int32(300), memcachedExpiration(5*time.Minute))
+
+	// IE: beyond 30 days memcached wants an absolute timestamp
+	assert.Greater(t, memcachedExpiration(60*24*time.Hour), int32(time.Now().Unix()))
+}
+
+func TestMemcachedKeys(t *testing.T) {
+	cache := newMemcachedCache("127.0.0.1:1")
+	assert.Equal(t, "deps:tree:react@16.13.0", cache.key("tree:react@16.13.0"))
+
+	spaced := "tree:react@>=16.0.0 <17.0.0"
+	long := "tree:" + strings.Repeat("a", 300)
+	for _, key := range []string{spaced, long, "tree:react\n"} {
+		mapped := cache.key(key)
+		assert.Equal(t, mapped, cache.key(key), "the same key every time")
+		assert.True(t, strings.HasPrefix(mapped, "deps:sha256:"), key)
+		assert.LessOrEqual(t, len(mapped), memcachedMaxKeyLength)
+
+		// IE: the client checks the key before dialing, nothing listens there
+		err := cache.client.Set(&memcache.Item{Key: mapped, Value: []byte("{}")})
+		assert.NotErrorIs(t, err, memcache.ErrMalformedKey, key)
+	}
+	assert.NotEqual(t, cache.key(spaced), cache.key(long))
+}
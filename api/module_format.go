@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// IE: how Node loads a package, what an ESM migration has to deal with
+const (
+	moduleESM  = "esm"
+	moduleCJS  = "cjs"
+	moduleDual = "dual"
+)
+
+type moduleFormatReport struct {
+	Packages int `json:"packages"`
+	ESM      int `json:"esm"`
+	CJS      int `json:"cjs"`
+	Dual     int `json:"dual"`
+	// IE: the share of the packages a require() can't load, 0 to 1
+	ESMOnly float64 `json:"esmOnly"`
+	// IE: every version of the tree but the root, by name@version
+	Formats []packageModuleFormat `json:"formats"`
+}
+
+type packageModuleFormat struct {
+	Package string `json:"package"`
+	Format  string `json:"format"`
+	// IE: as published, "commonjs" when left out
+	Type    string `json:"type"`
+	Exports bool   `json:"exports,omitempty"`
+}
+
+// IE: the conditions an exports map uses anywhere, subpaths and nested
+// conditions (i.e. "node": {"import": ...}) included
+func exportConditions(raw json.RawMessage, conditions map[string]bool) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &object); err == nil {
+		for key, value := range object {
+			if !strings.HasPrefix(key, ".") {
+				conditions[key] = true
+			}
+			exportConditions(value, conditions)
+		}
+		return
+	}
+	var fallbacks []json.RawMessage
+	if err := json.Unmarshal(raw, &fallbacks); err == nil {
+		for _, value := range fallbacks {
+			exportConditions(value, conditions)
+		}
+	}
+}
+
+// IE: an exports map with import and require conditions serves both, one
+// with either only the one. Otherwise the extension of main, then the type of
+// the package, tell what Node makes of its .js files
+func moduleFormat(doc *npmPackageResponse) string {
+	if len(doc.Exports) > 0 {
+		conditions := make(map[string]bool)
+		exportConditions(doc.Exports, conditions)
+		switch {
+		case conditions["import"] && conditions["require"]:
+			return moduleDual
+		case conditions["import"]:
+			return moduleESM
+		case conditions["require"]:
+			return moduleCJS
+		}
+	}
+	switch {
+	case strings.HasSuffix(doc.Main, ".mjs"):
+		return moduleESM
+	case strings.HasSuffix(doc.Main, ".cjs"):
+		return moduleCJS
+	case doc.Type == "module":
+		return moduleESM
+	}
+	return moduleCJS
+}
+
+func moduleFormatSection(ctx context.Context, tree *NpmPackageVersion, query url.Values, report *treeReport) error {
+	docs, err := versionDocuments(ctx, tree)
+	if err != nil {
+		return err
+	}
+	rootKey := tree.Name + "@" + tree.Version
+	formats := &moduleFormatReport{Formats: []packageModuleFormat{}}
+	for key, doc := range docs {
+		if key == rootKey {
+			continue
+		}
+		format := packageModuleFormat{Package: key, Format: moduleFormat(doc), Type: doc.Type, Exports: len(doc.Exports) > 0 && string(doc.Exports) != "null"}
+		if format.Type == "" {
+			format.Type = "commonjs"
+		}
+		switch format.Format {
+		case moduleESM:
+			formats.ESM++
+		case moduleDual:
+			formats.Dual++
+		default:
+			formats.CJS++
+		}
+		formats.Formats = append(formats.Formats, format)
+	}
+	formats.Packages = len(formats.Formats)
+	if formats.Packages > 0 {
+		formats.ESMOnly = math.Round(float64(formats.ESM)/float64(formats.Packages)*100) / 100
+	}
+	sort.Slice(formats.Formats, func(i, j int) bool { return formats.Formats[i].Package < formats.Formats[j].Package })
+	report.ModuleFormats = formats
+	return nil
+}
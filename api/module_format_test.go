@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/snyk/snyk-code-review-exercise/internal/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModuleFormat(t *testing.T) {
+	for name, test := range map[string]struct {
+		doc  npmPackageResponse
+		want string
+	}{
+		"nothing":          {npmPackageResponse{}, moduleCJS},
+		"type module":      {npmPackageResponse{Type: "module"}, moduleESM},
+		"mjs main":         {npmPackageResponse{Main: "index.mjs"}, moduleESM},
+		"cjs main":         {npmPackageResponse{Type: "module", Main: "index.cjs"}, moduleCJS},
+		"string exports":   {npmPackageResponse{Type: "module", Exports: json.RawMessage(`"./index.js"`)}, moduleESM},
+		"dual":             {npmPackageResponse{Exports: json.RawMessage(`{".": {"import": "./index.mjs", "require": "./index.cjs"}}`)}, moduleDual},
+		"nested condition": {npmPackageResponse{Exports: json.RawMessage(`{"node": {"import": "./index.mjs"}, "default": "./index.js"}`)}, moduleESM},
+		"require only":     {npmPackageResponse{Type: "module", Exports: json.RawMessage(`[{"require": "./index.cjs"}, "./index.cjs"]`)}, moduleCJS},
+		"subpaths":         {npmPackageResponse{Exports: json.RawMessage(`{"./a": {"import": "./a.mjs"}, "./b": {"require": "./b.cjs"}}`)}, moduleDual},
+	} {
+		assert.Equal(t, test.want, moduleFormat(&test.doc), name)
+	}
+}
+
+func TestModuleFormats(t *testing.T) {
+	registry := scriptedRegistry(t, fixtures.Registry{
+		"app":  {"1.0.0": {"esm": "^1.0.0", "cjs": "^1.0.0", "dual": "^1.0.0", "more": "^1.0.0"}},
+		"esm":  {"1.0.0": nil},
+		"cjs":  {"1.0.0": nil},
+		"dual": {"1.0.0": nil},
+		"more": {"1.0.0": {"esm": "^1.0.0"}},
+	}, map[string]npmPackageResponse{
+		"app@1.0.0":  {Type: "module"},
+		"esm@1.0.0":  {Type: "module"},
+		"more@1.0.0": {Exports: json.RawMessage(`{"import": "./index.js"}`)},
+		"dual@1.0.0": {Exports: json.RawMessage(`{"import": "./index.mjs", "require": "./index.js"}`)},
+	})
+	handler := New(WithRegistryURL(registry.URL))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0/report?sections=module-formats", nil))
+	report := decodeReport(t, rec)
+	require.NotNil(t, report.ModuleFormats)
+	assert.Equal(t, &moduleFormatReport{
+		Packages: 4, ESM: 2, CJS: 1, Dual: 1, ESMOnly: 0.5,
+		Formats: []packageModuleFormat{
+			{Package: "cjs@1.0.0", Format: moduleCJS, Type: "commonjs"},
+			{Package: "dual@1.0.0", Format: moduleDual, Type: "commonjs", Exports: true},
+			{Package: "esm@1.0.0", Format: moduleESM, Type: "module"},
+			{Package: "more@1.0.0", Format: moduleESM, Type: "commonjs", Exports: true},
+		},
+	}, report.ModuleFormats)
+}
@@ -0,0 +1,33 @@
+package api
+
+import "strings"
+
+// IE: the tools an install script builds (or fetches prebuilt) native addons
+// with, node-gyp-build before node-gyp which it contains
+var nativeBuilders = []string{"node-gyp-build", "node-pre-gyp", "prebuild-install", "cmake-js", "node-gyp"}
+
+// IE: npm publishes gypfile: true for the packages with a binding.gyp, and
+// runs node-gyp rebuild on install for them unless they have install scripts
+// of their own
+const gypInstallCommand = "node-gyp rebuild"
+
+func implicitGypInstall(doc *npmPackageResponse) bool {
+	return doc.GypFile && doc.Scripts["install"] == "" && doc.Scripts["preinstall"] == ""
+}
+
+// IE: what gives the native addon away, "" for the pure JavaScript packages.
+// A prebuilt binary still needs a toolchain wherever there is none for the platform
+func nativeAddon(doc *npmPackageResponse) string {
+	if doc.GypFile {
+		return "binding.gyp"
+	}
+	for _, hook := range installHooks {
+		script := doc.Scripts[hook]
+		for _, builder := range nativeBuilders {
+			if strings.Contains(script, builder) {
+				return builder
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/snyk/snyk-code-review-exercise/internal/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNativeAddon(t *testing.T) {
+	for want, doc := range map[string]npmPackageResponse{
+		"":                 {Scripts: map[string]string{"build": "node-gyp rebuild", "postinstall": "node ./banner.js"}},
+		"binding.gyp":      {GypFile: true},
+		"node-gyp":         {Scripts: map[string]string{"install": "node-gyp rebuild --release"}},
+		"node-gyp-build":   {Scripts: map[string]string{"install": "node-gyp-build"}},
+		"node-pre-gyp":     {Scripts: map[string]string{"install": "node-pre-gyp install --fallback-to-build"}},
+		"prebuild-install": {Scripts: map[string]string{"install": "prebuild-install || node-gyp rebuild"}},
+		"cmake-js":         {Scripts: map[string]string{"preinstall": "cmake-js compile"}},
+	} {
+		assert.Equal(t, want, nativeAddon(&doc), want)
+	}
+}
+
+func TestNativeAddonNodes(t *testing.T) {
+	registry := scriptedRegistry(t, fixtures.Registry{
+		"app":      {"1.0.0": {"bindings": "^1.0.0", "built": "^1.0.0", "pure": "^1.0.0"}},
+		"bindings": {"1.0.0": nil},
+		"built":    {"1.0.0": nil},
+		"pure":     {"1.0.0": nil},
+	}, map[string]npmPackageResponse{
+		"bindings@1.0.0": {GypFile: true},
+		"built@1.0.0":    {GypFile: true, Scripts: map[string]string{"install": "prebuild-install || node-gyp rebuild"}},
+	})
+	handler := New(WithRegistryURL(registry.URL))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0", nil))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	tree := &NpmPackageVersion{}
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), tree))
+	assert.Equal(t, "binding.gyp", tree.Dependencies["bindings"].Native)
+	assert.Equal(t, "binding.gyp", tree.Dependencies["built"].Native)
+	assert.Empty(t, tree.Dependencies["pure"].Native)
+	// IE: npm runs node-gyp rebuild for bindings, which doesn't say so
+	assert.Equal(t, []string{"install"}, tree.Dependencies["bindings"].InstallScripts)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0/report?sections=install-scripts", nil))
+	assert.Equal(t, []installScriptPackage{
+		{Package: "bindings@1.0.0", Scripts: map[string]string{"install": gypInstallCommand}},
+		{Package: "built@1.0.0", Scripts: map[string]string{"install": "prebuild-install || node-gyp rebuild"}},
+	}, decodeReport(t, rec).InstallScripts)
+}
@@ -0,0 +1,221 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IE: values of the format query parameter
+const (
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+	formatCSV    = "csv"
+	formatCypher = "cypher"
+)
+
+// IE: one line of a ?format=ndjson response, nodes refer to their parent by id
+// and every parent comes before its children. The root has no parent
+type ndjsonNode struct {
+	ID         uint64       `json:"id"`
+	Parent     uint64       `json:"parent,omitempty"`
+	Name       string       `json:"name"`
+	Version    string       `json:"version"`
+	Tarball    *TarballInfo `json:"tarball,omitempty"`
+	Truncated  bool         `json:"truncated,omitempty"`
+	Policy     string       `json:"policy,omitempty"`
+	Provenance string       `json:"provenance,omitempty"`
+	Typosquat  string       `json:"typosquat,omitempty"`
+	// IE: see installScripts
+	InstallScripts []string `json:"installScripts,omitempty"`
+	Native         string   `json:"native,omitempty"`
+}
+
+func requestFormat(query url.Values) (string, error) {
+	format := strings.ToLower(strings.TrimSpace(query.Get("format")))
+	switch format {
+	case "", formatJSON:
+		return formatJSON, nil
+	case formatNDJSON:
+		return formatNDJSON, nil
+	case formatCSV, formatCypher:
+		return format, nil
+	}
+	return "", fmt.Errorf("%w: format must be json, ndjson, csv or cypher, got %q", ErrInvalidQuery, format)
+}
+
+// IE: written to by every worker, the status is only sent along the first line,
+// i.e. a root that can't be resolved still gets a proper error status
+type nodeStream struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	enc     *json.Encoder
+	lastID  uint64
+	started bool
+
+	// IE: every node written, by version, when the advisories are looked up
+	// or the maintenance scored
+	versions    map[string]*streamedVersion
+	nodes       []*streamedVersion
+	maintenance bool
+	// IE: every node written, with ?stats=true
+	countStats bool
+	counted    []streamedNode
+}
+
+func newNodeStream(w http.ResponseWriter) *nodeStream {
+	return &nodeStream{w: w, enc: json.NewEncoder(w)}
+}
+
+// IE: flushed line by line, the client can start on the tree while the rest resolves
+func (s *nodeStream) write(parent uint64, pkg *NpmPackageVersion, truncated bool) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.started {
+		s.w.Header().Set("Content-Type", "application/x-ndjson")
+		s.w.Header().Set("Trailer", resolutionStatsHeader)
+		s.w.WriteHeader(http.StatusOK)
+		s.started = true
+	}
+
+	s.lastID++
+	line := ndjsonNode{ID: s.lastID, Parent: parent, Name: pkg.Name, Version: pkg.Version, Tarball: pkg.Tarball, Truncated: truncated, Policy: pkg.Policy, Provenance: pkg.Provenance, Typosquat: pkg.Typosquat, InstallScripts: pkg.InstallScripts, Native: pkg.Native}
+	if err := s.enc.Encode(line); err != nil {
+		return 0, err
+	}
+	if opts.vulnerabilitySource != "" || s.maintenance {
+		s.record(pkg, s.lastID)
+	}
+	if s.countStats {
+		s.countNode(parent, pkg)
+	}
+	if flusher, ok := s.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return s.lastID, nil
+}
+
+// IE: cached subtrees come in one piece, their nodes are written depth first in name order
+func (s *nodeStream) writeSubtree(parent uint64, pkg *NpmPackageVersion) error {
+	id, err := s.write(parent, pkg, false)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(pkg.Dependencies))
+	for name := range pkg.Dependencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := s.writeSubtree(id, pkg.Dependencies[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IE: last line of a tree cut by the node budget
+func (s *nodeStream) writePartial() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(struct {
+		Partial bool `json:"partial"`
+	}{true})
+}
+
+// IE: false once the status is sent, the error can only be reported in the stream then
+func (s *nodeStream) writeError(err error, requestID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.started {
+		return false
+	}
+	_ = s.enc.Encode(newErrorPayload(err, requestID))
+	if flusher, ok := s.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return true
+}
+
+// IE: no-op unless the nodes are streamed as they resolve
+func (r *resolver) emit(task *resolveTask, truncated bool) error {
+	if r.stream == nil {
+		return nil
+	}
+
+	var parent uint64
+	if task.parent != nil {
+		parent = task.parent.id
+	}
+	id, err := r.stream.write(parent, task.pkg, truncated)
+	task.id = id
+	return err
+}
+
+// IE: the nodes aren't linked into a tree, each one can be collected once its
+// subtree is resolved, memory is bounded by the frontier instead of the tree.
+// Nothing is cached but the registry documents then, there is no tree to cache.
+// With stats (or maintenance scores), every node is kept track of (its name,
+// version and depth) though
+func resolveTreeNDJSON(ctx context.Context, w http.ResponseWriter, pkgName, pkgVersion string, maxDepth int, annotations treeAnnotations) (*nodeStream, error) {
+	start := time.Now()
+	r := newResolver(maxDepth)
+	r.stream = newNodeStream(w)
+	r.stream.countStats = annotations.stats
+	r.stream.maintenance = annotations.maintenance
+	err := r.run(ctx, &resolveTask{pkg: newNode(pkgName, pkgVersion), constraint: pkgVersion}, live().concurrency)
+	if err == nil && opts.vulnerabilitySource != "" {
+		err = r.stream.writeAdvisories(ctx)
+	}
+	if err == nil && annotations.maintenance {
+		err = r.stream.writeMaintenance(ctx)
+	}
+	if err == nil && annotations.stats {
+		err = r.stream.writeStats(start, r.stats.snapshot().UpstreamCalls)
+	}
+	if err == nil && r.exhausted() {
+		err = r.stream.writePartial()
+	}
+	return r.stream, err
+}
+
+func ndjsonHandler(w http.ResponseWriter, r *http.Request, pkgName, pkgVersion string, start time.Time) {
+	maxDepth, err := requestMaxDepth(r.URL.Query())
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	annotations, err := requestAnnotations(r.URL.Query())
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+
+	ctx, stats := requestResolutionStats(r.Context())
+	stream, err := resolveTreeNDJSON(ctx, w, pkgName, pkgVersion, maxDepth, annotations)
+	if stream.started {
+		w.Header().Set(resolutionStatsHeader, stats.snapshot().String())
+	}
+	if err == nil {
+		loggerFrom(r.Context()).Info("Request completed", "duration", time.Since(start), "format", formatNDJSON)
+		return
+	}
+	// IE: with the status long sent, the last line tells the client the stream is incomplete
+	if !errors.Is(r.Context().Err(), context.Canceled) && stream.writeError(err, requestIDFrom(r.Context())) {
+		loggerFrom(r.Context()).Error("Streaming failed", "error", err)
+		reportResolveError(r.Context(), err, classifyError(err).Status)
+		auditError(r.Context(), err)
+		return
+	}
+	writeResolveError(w, r, err)
+}
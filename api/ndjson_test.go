@@ -0,0 +1,115 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readNDJSON(t *testing.T, body string) []map[string]interface{} {
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		var line map[string]interface{}
+		require.Nil(t, json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestPackageHandlerStreamsNDJSON(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{
+		"a": {"1.0.0": {"b": "^1.0.0"}},
+		"b": {"1.0.0": {"a": "^1.0.0"}},
+	})
+	handler := New(WithRegistryURL(registry.URL))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/a/1.0.0?format=ndjson", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/x-ndjson", rec.Header().Get("Content-Type"))
+
+	assert.Equal(t, `{"id":1,"name":"a","version":"1.0.0"}
+{"id":2,"parent":1,"name":"b","version":"1.0.0"}
+{"id":3,"parent":2,"name":"a","version":"1.0.0","truncated":true}
+`, rec.Body.String())
+}
+
+func TestPackageHandlerNDJSONMatchesTree(t *testing.T) {
+	registry := newFakeRegistry(t, loadRegistryFixture(t, "react-16.13.0"))
+	handler := New(WithRegistryURL(registry.URL))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/react/16.13.0?format=ndjson", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	// IE: rebuild the tree from the lines, parents always come first
+	nodes := map[float64]map[string]interface{}{}
+	var root map[string]interface{}
+	for _, line := range readNDJSON(t, rec.Body.String()) {
+		node := map[string]interface{}{"name": line["name"], "version": line["version"], "dependencies": map[string]interface{}{}}
+		nodes[line["id"].(float64)] = node
+		if parent, ok := line["parent"]; ok {
+			require.Contains(t, nodes, parent)
+			nodes[parent.(float64)]["dependencies"].(map[string]interface{})[line["name"].(string)] = node
+		} else {
+			root = node
+		}
+	}
+	tree, err := json.Marshal(root)
+	require.Nil(t, err)
+
+	fixture, err := os.ReadFile(filepath.Join("testdata", "react-16.13.0.json"))
+	require.Nil(t, err)
+	assert.JSONEq(t, string(fixture), string(tree))
+}
+
+func TestPackageHandlerNDJSONErrors(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{
+		"app": {"1.0.0": {"missing": "^1.0.0"}},
+	})
+	handler := New(WithRegistryURL(registry.URL))
+
+	// IE: nothing streamed yet, the status still tells
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/missing/1.0.0?format=ndjson", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0?format=ndjson", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	lines := readNDJSON(t, rec.Body.String())
+	require.Len(t, lines, 2)
+	assert.Equal(t, "app", lines[0]["name"])
+	assert.Contains(t, lines[1]["error"], "missing")
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0?format=xml", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestPackageHandlerNDJSONFlagsPartialTrees(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{
+		"a":    {"1.0.0": {"b": "^1.0.0"}},
+		"b":    {"1.0.0": {"leaf": "^1.0.0"}},
+		"leaf": {"1.0.0": nil},
+	})
+	handler := New(WithRegistryURL(registry.URL), WithMaxNodes(2))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/a/1.0.0?format=ndjson", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	assert.Equal(t, `{"id":1,"name":"a","version":"1.0.0"}
+{"id":2,"parent":1,"name":"b","version":"1.0.0","truncated":true}
+{"partial":true}
+`, rec.Body.String())
+}
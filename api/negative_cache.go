@@ -0,0 +1,29 @@
+package api
+
+// IE: negative entries share the packument cache but live under their own prefix
+const negativeKeyPrefix = "negative:"
+
+func negativePackumentKey(name string) string {
+	return negativeKeyPrefix + "packument:" + name
+}
+
+func negativeVersionKey(name, constraint string) string {
+	return negativeKeyPrefix + "version:" + name + "@" + constraint
+}
+
+// IE: remember failures for a short while so repeated requests for nonexistent
+// packages (or impossible ranges) don't hit the upstream again
+func cacheNegative(key string) {
+	if live().negativeTTL <= 0 {
+		return
+	}
+	packumentCache.Set(key, []byte{1}, ttlFor(key))
+}
+
+func negativelyCached(key string) bool {
+	if live().negativeTTL <= 0 {
+		return false
+	}
+	_, found := packumentCache.Get(key)
+	return found
+}
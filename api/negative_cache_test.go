@@ -0,0 +1,55 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchPackageMetaCachesNotFound(t *testing.T) {
+	var calls int32
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer registry.Close()
+
+	New(WithRegistryURL(registry.URL), WithNegativeCache(time.Minute))
+
+	_, err := fetchPackageMeta(context.Background(), "does-not-exist")
+	assert.True(t, errors.Is(err, ErrPackageNotFound))
+
+	_, err = fetchPackageMeta(context.Background(), "does-not-exist")
+	assert.True(t, errors.Is(err, ErrPackageNotFound))
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestFetchPackageMetaDoesNotCacheOutages(t *testing.T) {
+	var calls int32
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer registry.Close()
+
+	New(WithRegistryURL(registry.URL), WithNegativeCache(time.Minute))
+
+	_, _ = fetchPackageMeta(context.Background(), "left-pad")
+	_, _ = fetchPackageMeta(context.Background(), "left-pad")
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestNegativeCacheDisabled(t *testing.T) {
+	New(WithNegativeCache(0))
+
+	cacheNegative(negativeVersionKey("left-pad", "^9.0.0"))
+	assert.False(t, negativelyCached(negativeVersionKey("left-pad", "^9.0.0")))
+}
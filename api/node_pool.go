@@ -0,0 +1,58 @@
+package api
+
+import "sync"
+
+// IE: large trees allocate tens of thousands of nodes per request, recycle
+// them (and their dependencies maps) once the response is written instead of
+// leaving them all to the GC
+var nodePool = sync.Pool{
+	New: func() interface{} {
+		return &NpmPackageVersion{Dependencies: make(map[string]*NpmPackageVersion)}
+	},
+}
+
+func newNode(name, version string) *NpmPackageVersion {
+	pkg := nodePool.Get().(*NpmPackageVersion)
+	pkg.Name = name
+	pkg.Version = version
+	pkg.Tarball = nil
+	pkg.Partial = false
+	pkg.Policy = ""
+	pkg.Provenance = ""
+	pkg.Typosquat = ""
+	pkg.InstallScripts = nil
+	pkg.Native = ""
+	pkg.Advisories = nil
+	pkg.Maintenance = nil
+	pkg.Stats = nil
+	if pkg.Dependencies == nil {
+		pkg.Dependencies = make(map[string]*NpmPackageVersion)
+	}
+	return pkg
+}
+
+// IE: the same node shows up under every package depending on it, each one
+// goes back to the pool once. Nothing may use the tree afterwards
+func releaseTree(root *NpmPackageVersion) {
+	if root == nil {
+		return
+	}
+
+	visited := map[*NpmPackageVersion]bool{root: true}
+	stack := []*NpmPackageVersion{root}
+	for len(stack) > 0 {
+		pkg := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		for _, dep := range pkg.Dependencies {
+			if dep != nil && !visited[dep] {
+				visited[dep] = true
+				stack = append(stack, dep)
+			}
+		}
+
+		clear(pkg.Dependencies)
+		pkg.Tarball = nil
+		nodePool.Put(pkg)
+	}
+}
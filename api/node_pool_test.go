@@ -0,0 +1,56 @@
+package api
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReleaseTreeHandlesSharedNodes(t *testing.T) {
+	shared := newNode("object-assign", "4.1.1")
+	propTypes := newNode("prop-types", "15.8.1")
+	propTypes.Dependencies["object-assign"] = shared
+	root := newNode("react", "16.13.0")
+	root.Dependencies["object-assign"] = shared
+	root.Dependencies["prop-types"] = propTypes
+
+	releaseTree(root)
+
+	for _, pkg := range []*NpmPackageVersion{root, propTypes, shared} {
+		assert.Empty(t, pkg.Dependencies)
+	}
+
+	// IE: recycled nodes come back clean
+	pkg := newNode("left-pad", "1.3.0")
+	assert.Equal(t, "left-pad", pkg.Name)
+	assert.Empty(t, pkg.Dependencies)
+	assert.Nil(t, pkg.Tarball)
+}
+
+func BenchmarkResolveAndStreamTree(b *testing.B) {
+	registry := newFakeRegistry(b, loadRegistryFixture(b, "react-16.13.0"))
+	New(WithRegistryURL(registry.URL))
+
+	// IE: fill the packument and version caches, only the resolution itself is measured
+	root, err := resolveTree(context.Background(), "react", "16.13.0", 0)
+	require.Nil(b, err)
+	releaseTree(root)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// IE: in-request and subtree hits would short-circuit everything
+		subtreeCache.(prefixDeleter).DeletePrefix(subtreeKeyPrefix)
+		root, err := resolveTree(context.Background(), "react", "16.13.0", 0)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := streamTree(io.Discard, root); err != nil {
+			b.Fatal(err)
+		}
+		releaseTree(root)
+	}
+}
@@ -0,0 +1,667 @@
+package api
+
+import (
+	"io"
+	"log/slog"
+	"net/netip"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// IE: functional options so New() keeps working for existing callers while
+// deployments can opt into extra behaviour
+type Option func(*options)
+
+type options struct {
+	registryURL         string
+	verifyTarballs      bool
+	verifyProvenance    bool
+	cdnFallback         bool
+	jsdelivrURL         string
+	unpkgURL            string
+	upstreamHosts       []string
+	packagePolicy       *PackagePolicy
+	licensePolicy       *LicensePolicy
+	registry            Registry
+	abandonedAfter      time.Duration
+	registryToken       *Secret
+	typosquatList       []string
+	typosquatDistance   int
+	vulnerabilitySource string
+	cacheSize           int
+	cacheTTL            time.Duration
+	staleWindow         time.Duration
+	packumentSize       int
+	packumentTTL        time.Duration
+	versionTTL          time.Duration
+	cacheShards         int
+	cacheBytes          int64
+	packumentBytes      int64
+	subtreeSize         int
+	subtreeBytes        int64
+	negativeTTL         time.Duration
+	cacheBackend        string
+	cacheAddress        string
+	cache               Cache
+	warmupList          string
+	invalidationURL     string
+	snapshotPath        string
+	concurrency         int
+	upstreamLimit       int
+	maxDepth            int
+	maxNodes            int
+	maxInFlight         int
+	maxURIBytes         int
+	maxBodyBytes        int64
+	requestTimeout      time.Duration
+
+	clientHeader     string
+	trustedGateways  []string
+	clientPriorities map[string]int
+	fairScheduling   bool
+
+	rateLimit        float64
+	rateBurst        int
+	clientRateLimits map[string]float64
+
+	precomputeTop      int
+	precomputeInterval time.Duration
+
+	logger         *slog.Logger
+	tracerProvider trace.TracerProvider
+
+	auditLog string
+
+	historyPath      string
+	historyRetention time.Duration
+
+	authIssuer   string
+	authAudience string
+	authJWKSURL  string
+
+	clientCertificates bool
+
+	allowCIDRs []netip.Prefix
+	denyCIDRs  []netip.Prefix
+
+	corsOrigins []string
+	corsMethods []string
+	corsHeaders []string
+	corsMaxAge  time.Duration
+
+	// IE: re-reads the settings and calls Reload, for POST /debug/reload
+	reloader func() error
+	// IE: how long Drain keeps serving with a failing readiness probe
+	drainDelay time.Duration
+
+	// IE: on top of the defaults of knownFeatures
+	features map[string]bool
+
+	errorTrackingDSN         string
+	errorTrackingEnvironment string
+	// IE: tests capture the events instead of sending them
+	errorTrackingTransport sentry.Transport
+
+	logSampleFirst      int
+	logSampleThereafter int
+	logSampleInterval   time.Duration
+
+	accessLog       io.Writer
+	accessLogFormat string
+
+	statsdAddress  string
+	statsdFormat   string
+	statsdInterval time.Duration
+}
+
+func defaultOptions() options {
+	return options{
+		registryURL: "https://registry.npmjs.org",
+		jsdelivrURL: "https://data.jsdelivr.com",
+		unpkgURL:    "https://unpkg.com",
+		cacheSize:   128,
+		cacheTTL:    10 * time.Minute,
+
+		// IE: packuments change whenever a version gets published, keep them for less
+		packumentSize: 1024,
+		packumentTTL:  5 * time.Minute,
+		versionTTL:    24 * time.Hour,
+		cacheShards:   16,
+
+		cacheBytes:     256 << 20,
+		packumentBytes: 128 << 20,
+		subtreeSize:    4096,
+		subtreeBytes:   64 << 20,
+		negativeTTL:    time.Minute,
+		concurrency:    32,
+		upstreamLimit:  128,
+		maxInFlight:    64,
+		maxNodes:       100000,
+		maxURIBytes:    4096,
+		maxBodyBytes:   1 << 20,
+		fairScheduling: true,
+		requestTimeout: 90 * time.Second,
+
+		abandonedAfter: 3 * 365 * 24 * time.Hour,
+
+		// IE: half the response cache TTL, popular trees get refreshed before they expire
+		precomputeInterval: 5 * time.Minute,
+
+		// IE: a handful of identical errors a second is enough to see an outage
+		logSampleFirst:      10,
+		logSampleThereafter: 100,
+		logSampleInterval:   time.Second,
+
+		accessLogFormat: AccessLogCombined,
+
+		statsdFormat:   StatsDFormatDatadog,
+		statsdInterval: 10 * time.Second,
+	}
+}
+
+// IE: package level since the resolver funcs are package level as well
+var opts = defaultOptions()
+
+// WithRegistryURL points the resolver at another npm compatible registry.
+func WithRegistryURL(url string) Option {
+	return func(o *options) {
+		o.registryURL = url
+	}
+}
+
+// WithUpstreamHosts restricts the calls of the API, tarball downloads and
+// redirects included, to these hosts ("*.example.com" for the subdomains of
+// example.com), the others fail with upstream_not_allowed. Empty allows the
+// hosts of the registry and of the CDNs only.
+func WithUpstreamHosts(hosts []string) Option {
+	return func(o *options) {
+		o.upstreamHosts = hosts
+	}
+}
+
+// WithRegistryToken authenticates the calls to the registry with the bearer
+// token read from token, see ParseSecret. nil calls it anonymously.
+func WithRegistryToken(token *Secret) Option {
+	return func(o *options) {
+		o.registryToken = token
+	}
+}
+
+// WithPackagePolicy enforces policy on every package resolved, see
+// LoadPackagePolicy. Trees with a package out of the policy fail with
+// ErrPolicyViolation, or have it flagged with PolicyActionFlag. nil doesn't
+// enforce any.
+func WithPackagePolicy(policy *PackagePolicy) Option {
+	return func(o *options) {
+		o.packagePolicy = policy
+	}
+}
+
+// WithLicensePolicy is the policy the licenses report section evaluates the
+// trees against, see LoadLicensePolicy. Requests may replace its lists with
+// ?allowLicenses= and ?denyLicenses=, and its mode with ?strict=. nil has none
+// configured.
+func WithLicensePolicy(policy *LicensePolicy) Option {
+	return func(o *options) {
+		o.licensePolicy = policy
+	}
+}
+
+// WithAbandonedAfter is how long after its last publish (of any version) the
+// abandoned report section takes a package for abandoned, 3 years by default.
+// Requests may replace it with ?abandonedAfter=.
+func WithAbandonedAfter(after time.Duration) Option {
+	return func(o *options) {
+		o.abandonedAfter = after
+	}
+}
+
+// WithTyposquatCheck flags the resolved packages within maxDistance edits
+// (fewer for short names) of a popular package with a "typosquat" field naming
+// it. popular replaces the built-in list of popular packages when not empty, a
+// maxDistance of 0 disables the check.
+func WithTyposquatCheck(popular []string, maxDistance int) Option {
+	return func(o *options) {
+		o.typosquatList = popular
+		o.typosquatDistance = maxDistance
+	}
+}
+
+// WithVulnerabilitySource looks the advisories of the resolved versions up in
+// source, VulnerabilitySourceNPM, once per tree, and lists the ones affecting a
+// node under its "advisories" field. Streamed trees get a line per affected
+// node once resolved. Empty disables it.
+func WithVulnerabilitySource(source string) Option {
+	return func(o *options) {
+		o.vulnerabilitySource = source
+	}
+}
+
+// WithTarballVerification downloads each resolved tarball, checks it against
+// the integrity hash published by the registry and records its actual size.
+func WithTarballVerification(enabled bool) Option {
+	return func(o *options) {
+		o.verifyTarballs = enabled
+	}
+}
+
+// WithProvenanceVerification checks the registry signature and the provenance
+// attestation of each resolved version, its sigstore bundle included, and
+// records the outcome in its "provenance" field, see ProvenanceVerified.
+func WithProvenanceVerification(enabled bool) Option {
+	return func(o *options) {
+		o.verifyProvenance = enabled
+	}
+}
+
+// WithCDNFallback retrieves version listings from jsDelivr and version
+// documents from unpkg whenever the registry fails for a package.
+func WithCDNFallback(enabled bool) Option {
+	return func(o *options) {
+		o.cdnFallback = enabled
+	}
+}
+
+// WithResponseCache bounds the response cache to size entries, each kept for
+// at most ttl. A size of 0 disables the cache, a ttl of 0 never expires.
+func WithResponseCache(size int, ttl time.Duration) Option {
+	return func(o *options) {
+		o.cacheSize = size
+		o.cacheTTL = ttl
+	}
+}
+
+// WithStaleWhileRevalidate keeps serving a resolved tree for up to window past
+// its TTL, flagged with "X-Cache-Status: stale", while it is re-resolved in the
+// background.
+func WithStaleWhileRevalidate(window time.Duration) Option {
+	return func(o *options) {
+		o.staleWindow = window
+	}
+}
+
+// WithPackumentCache bounds the in-memory cache of registry packuments to size
+// entries, each kept for at most ttl.
+func WithPackumentCache(size int, ttl time.Duration) Option {
+	return func(o *options) {
+		o.packumentSize = size
+		o.packumentTTL = ttl
+	}
+}
+
+// WithVersionDocumentTTL sets how long version documents (immutable once
+// published) are cached, as opposed to packuments which change on publish.
+func WithVersionDocumentTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.versionTTL = ttl
+	}
+}
+
+// WithCacheMemoryBudget bounds the in-memory response and packument caches to
+// the given total serialized sizes in bytes, evicting the least recently used
+// entries beyond them. A budget of 0 only bounds the number of entries.
+func WithCacheMemoryBudget(responses, packuments int64) Option {
+	return func(o *options) {
+		o.cacheBytes = responses
+		o.packumentBytes = packuments
+	}
+}
+
+// WithSubtreeCache bounds the in-memory cache of the subtrees reused across
+// requests to size entries and maxBytes of serialized subtrees, whatever the
+// cache backend. A size of 0 disables it, a budget of 0 only bounds the number
+// of entries.
+func WithSubtreeCache(size int, maxBytes int64) Option {
+	return func(o *options) {
+		o.subtreeSize = size
+		o.subtreeBytes = maxBytes
+	}
+}
+
+// WithCacheShards splits the in-memory caches into n independently locked
+// shards, reducing lock contention between resolver goroutines.
+func WithCacheShards(n int) Option {
+	return func(o *options) {
+		o.cacheShards = n
+	}
+}
+
+// WithNegativeCache remembers registry 404s and constraints without any
+// compatible version for ttl, 0 disables negative caching.
+func WithNegativeCache(ttl time.Duration) Option {
+	return func(o *options) {
+		o.negativeTTL = ttl
+	}
+}
+
+// WithCacheBackend selects where packuments and resolved trees are cached:
+// CacheBackendMemory (default), CacheBackendRedis (address is a redis://
+// url), CacheBackendMemcached (address is a comma separated host:port list)
+// CacheBackendBolt (address is the database file) or CacheBackendTiered
+// (in-memory caches spilling to the database file at address).
+func WithCacheBackend(backend, address string) Option {
+	return func(o *options) {
+		o.cacheBackend = backend
+		o.cacheAddress = address
+	}
+}
+
+// WithRegistry reads the registry documents from r rather than from the
+// registry of WithRegistryURL, see Registry. nil reads them from there.
+func WithRegistry(r Registry) Option {
+	return func(o *options) {
+		o.registry = r
+	}
+}
+
+// WithCache uses c for both packuments and resolved trees, i.e. to plug in a
+// custom backend.
+func WithCache(c Cache) Option {
+	return func(o *options) {
+		o.cache = c
+	}
+}
+
+// WithWarmupList resolves every package@version listed in the file at path in
+// the background on startup, so the first requests after a deploy are fast.
+func WithWarmupList(path string) Option {
+	return func(o *options) {
+		o.warmupList = path
+	}
+}
+
+// WithInvalidationBus broadcasts cache purges through the redis pub/sub
+// instance at url, so a purge on one replica clears all of them.
+func WithInvalidationBus(url string) Option {
+	return func(o *options) {
+		o.invalidationURL = url
+	}
+}
+
+// WithCacheSnapshot restores the in-memory caches from the file at path on
+// startup, SnapshotCaches saves them back to it.
+func WithCacheSnapshot(path string) Option {
+	return func(o *options) {
+		o.snapshotPath = path
+	}
+}
+
+// WithConcurrency bounds the number of dependencies resolved at the same
+// time, and so the number of simultaneous upstream requests, for each tree.
+func WithConcurrency(n int) Option {
+	return func(o *options) {
+		o.concurrency = n
+	}
+}
+
+// WithUpstreamConcurrency bounds the number of upstream requests in flight
+// across all trees. The bound is halved whenever upstream throttles (429s,
+// dropped connections) and grows back as calls succeed. 0 doesn't bound them.
+func WithUpstreamConcurrency(n int) Option {
+	return func(o *options) {
+		o.upstreamLimit = n
+	}
+}
+
+// WithClientHeader identifies the clients by the value of this request header
+// (i.e. X-Client-ID), for fair scheduling, client priorities and rate limits.
+// Only the header of the gateways of WithTrustedGateways is trusted, the other
+// callers are told apart by the subject of their token or client certificate,
+// or by their address without either.
+func WithClientHeader(name string) Option {
+	return func(o *options) {
+		o.clientHeader = name
+	}
+}
+
+// WithTrustedGateways lists the callers allowed to name the client they call
+// for in the header of WithClientHeader, by the subject of their token or the
+// common name of their client certificate.
+func WithTrustedGateways(subjects []string) Option {
+	return func(o *options) {
+		o.trustedGateways = subjects
+	}
+}
+
+// WithClientPriorities sets the priority of some clients, 0 by default and -1
+// for the "background" client (warm-up, revalidation, precomputation). While
+// upstream calls are queued, those of higher priority clients go first.
+func WithClientPriorities(priorities map[string]int) Option {
+	return func(o *options) {
+		o.clientPriorities = priorities
+	}
+}
+
+// WithFairScheduling makes the clients of a priority take turns for upstream
+// calls once queued, otherwise they are served first come first served. On by
+// default.
+func WithFairScheduling(enabled bool) Option {
+	return func(o *options) {
+		o.fairScheduling = enabled
+	}
+}
+
+// WithMaxDepth stops resolving dependencies n levels below the requested
+// package, 0 doesn't limit the depth. Requests may lower it with ?maxDepth=.
+func WithMaxDepth(n int) Option {
+	return func(o *options) {
+		o.maxDepth = n
+	}
+}
+
+// WithMaxNodes bounds the number of nodes resolved for each tree. Past it the
+// remaining nodes are left unexpanded and the tree is flagged partial, with
+// "partial": true on its root and an X-Partial-Tree header. 0 doesn't bound it.
+func WithMaxNodes(n int) Option {
+	return func(o *options) {
+		o.maxNodes = n
+	}
+}
+
+// WithInputLimits bounds the length of the request URIs, answered with 414
+// beyond it, and the size of the request bodies, answered with 413. 0 doesn't
+// limit them. Package names are limited to the 214 characters npm allows.
+func WithInputLimits(maxURIBytes int, maxBodyBytes int64) Option {
+	return func(o *options) {
+		o.maxURIBytes = maxURIBytes
+		o.maxBodyBytes = maxBodyBytes
+	}
+}
+
+// WithMaxInFlight bounds the number of package requests served at the same
+// time, the next ones are answered with 429 and a Retry-After header. 0
+// doesn't limit them.
+func WithMaxInFlight(n int) Option {
+	return func(o *options) {
+		o.maxInFlight = n
+	}
+}
+
+// WithRequestTimeout bounds how long a request, resolution included, may take
+// before it is abandoned with a 504. 0 doesn't bound it.
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.requestTimeout = timeout
+	}
+}
+
+// WithPrecompute re-resolves the top most requested package@version pairs
+// every interval in the background, so their responses are always cached. Keep
+// interval below the response cache TTL. A top of 0 disables it.
+func WithPrecompute(top int, interval time.Duration) Option {
+	return func(o *options) {
+		o.precomputeTop = top
+		o.precomputeInterval = interval
+	}
+}
+
+// WithLogger sets the structured logger of the API, text records of level
+// info and above on stdout by default. See NewLogger.
+func WithLogger(l *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// WithLogSampling caps the identical warning and error records (same level and
+// message) logged every interval to the first ones, then one in thereafter,
+// the next one logged reporting how many were dropped. 0 thereafter drops all
+// past the first, 0 first disables the sampling. Defaults to 10 a second then
+// one in 100.
+func WithLogSampling(first, thereafter int, interval time.Duration) Option {
+	return func(o *options) {
+		o.logSampleFirst = first
+		o.logSampleThereafter = thereafter
+		o.logSampleInterval = interval
+	}
+}
+
+// WithFeatures turns the given features (FeaturePrefetch, ...) on or off for
+// the deployment, see ParseFeatureFlags. Requests may still flip them for
+// themselves with the X-Feature-Flags header.
+func WithFeatures(features map[string]bool) Option {
+	return func(o *options) {
+		o.features = features
+	}
+}
+
+// WithReloader sets what POST /debug/reload on the AdminHandler runs, i.e.
+// re-reading the configuration and passing it to Reload, the same as on
+// SIGHUP. The endpoint answers 501 without it.
+func WithReloader(reload func() error) Option {
+	return func(o *options) {
+		o.reloader = reload
+	}
+}
+
+// WithRateLimit limits every client to rate package requests per second, with
+// bursts of up to burst requests (0 for a second worth of requests), beyond
+// which it gets a 429. Clients are the subject of their token, their client
+// header or their address. overrides sets the rate of some clients, 0 for no
+// limit. A zero rate only limits the overridden clients.
+func WithRateLimit(rate float64, burst int, overrides map[string]float64) Option {
+	return func(o *options) {
+		o.rateLimit = rate
+		o.rateBurst = burst
+		o.clientRateLimits = overrides
+	}
+}
+
+// WithJWTAuth requires the API requests to carry a bearer JWT signed by one of
+// the keys of issuer, at jwksURL or, when empty, at the jwks_uri of the OpenID
+// configuration of issuer. The token must be issued by issuer, for audience
+// unless empty, and not be expired. Its sub claim identifies the client for
+// fair scheduling, priorities and the audit log. Empty issuer turns it off.
+func WithJWTAuth(issuer, audience, jwksURL string) Option {
+	return func(o *options) {
+		o.authIssuer = issuer
+		o.authAudience = audience
+		o.authJWKSURL = jwksURL
+	}
+}
+
+// WithClientCertificates requires the requests to come with a client
+// certificate the TLS handshake verified, for servers verifying them only if
+// given (tls.VerifyClientCertIfGiven); the others get a 401. /healthz and
+// /readyz are served without one. The common name of the certificate
+// identifies the client, unless its bearer token does.
+func WithClientCertificates(required bool) Option {
+	return func(o *options) {
+		o.clientCertificates = required
+	}
+}
+
+// WithAddressFilter only serves the clients whose address is in one of the
+// allow networks, any address when empty, and none in the deny networks, the
+// others get a 403. The address is the one of the peer, /healthz and /readyz
+// are served to anybody.
+func WithAddressFilter(allow, deny []netip.Prefix) Option {
+	return func(o *options) {
+		o.allowCIDRs = allow
+		o.denyCIDRs = deny
+	}
+}
+
+// WithCORS lets the pages of origins (see ParseCORSOrigins) call the API from
+// a browser, with the methods (GET and POST when empty) and request headers
+// (Authorization, Content-Type, X-Request-ID and X-Feature-Flags when empty,
+// the client header always) they may send. Browsers cache the preflights for
+// maxAge. No origins turns it off.
+func WithCORS(origins, methods, headers []string, maxAge time.Duration) Option {
+	return func(o *options) {
+		o.corsOrigins = origins
+		o.corsMethods = methods
+		o.corsHeaders = headers
+		o.corsMaxAge = maxAge
+	}
+}
+
+// WithDrainDelay sets how long Drain keeps serving, the readiness probe
+// failing, before returning, i.e. the time the load balancer takes to stop
+// routing to the replica. 0 (the default) doesn't wait.
+func WithDrainDelay(delay time.Duration) Option {
+	return func(o *options) {
+		o.drainDelay = delay
+	}
+}
+
+// WithAuditLog records every resolution request (client, package, version,
+// outcome, duration, nodes resolved) as one JSON object per line, appended to
+// the file at target or, for an http(s) url, posted there in NDJSON batches.
+// An empty target disables it.
+func WithAuditLog(target string) Option {
+	return func(o *options) {
+		o.auditLog = target
+	}
+}
+
+// WithResolutionHistory keeps every tree resolved or served from the cache in
+// the bolt file at path: when, the range asked, the package set and its
+// fingerprint, served by /history/{package}/{version}. The resolutions
+// older than retention are dropped, none for 0. An empty path disables it.
+func WithResolutionHistory(path string, retention time.Duration) Option {
+	return func(o *options) {
+		o.historyPath = path
+		o.historyRetention = retention
+	}
+}
+
+// WithErrorTracking reports panics and failed resolutions (5xx, with their
+// request id, package, version and client) to the Sentry compatible error
+// tracker of dsn, tagged with environment. An empty dsn disables it.
+func WithErrorTracking(dsn, environment string) Option {
+	return func(o *options) {
+		o.errorTrackingDSN = dsn
+		o.errorTrackingEnvironment = environment
+	}
+}
+
+// WithTracerProvider traces the requests, resolutions and upstream calls with
+// the spans of tp, no-op by default. See NewOTLPTracerProvider.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *options) {
+		o.tracerProvider = tp
+	}
+}
+
+// WithStatsD pushes the metrics served on /metrics to the StatsD (or Datadog
+// agent) at address every interval, in StatsDFormatDatadog or
+// StatsDFormatPlain. An empty address disables it.
+func WithStatsD(address, format string, interval time.Duration) Option {
+	return func(o *options) {
+		o.statsdAddress = address
+		o.statsdFormat = format
+		o.statsdInterval = interval
+	}
+}
+
+// WithAccessLog writes one line per request to w, in AccessLogCombined or
+// AccessLogJSON, apart from the other logs. A nil w disables it.
+func WithAccessLog(w io.Writer, format string) Option {
+	return func(o *options) {
+		o.accessLog = w
+		o.accessLogFormat = format
+	}
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+
+	"github.com/Masterminds/semver/v3"
+	"golang.org/x/sync/errgroup"
+)
+
+// IE: how far the resolved versions of a tree are from the latest dist-tag of
+// their packages, how many of them an upgrade of each kind would take
+type outdatedReport struct {
+	UpToDate int `json:"upToDate"`
+	Patch    int `json:"patch"`
+	Minor    int `json:"minor"`
+	Major    int `json:"major"`
+	// IE: the ones behind, furthest first
+	Packages []outdatedPackage `json:"packages"`
+}
+
+// IE: a lower level only counts with the upper ones equal, 1.2.3 is 1 major
+// behind 2.0.0 and not 2 minors ahead of it
+type outdatedPackage struct {
+	Package string `json:"package"`
+	Latest  string `json:"latest"`
+	// IE: major, minor or patch
+	Behind string `json:"behind"`
+	Major  uint64 `json:"major"`
+	Minor  uint64 `json:"minor"`
+	Patch  uint64 `json:"patch"`
+}
+
+// IE: the levels from the furthest behind
+var outdatedLevels = map[string]int{"major": 0, "minor": 1, "patch": 2}
+
+// IE: the highest stable version stands in for the dist-tag of the registries
+// (and CDNs) not publishing one
+func latestVersion(name string, meta *npmPackageMetaResponse) *semver.Version {
+	if latest, err := semver.NewVersion(meta.DistTags["latest"]); err == nil {
+		return latest
+	}
+	published := parsedVersionsCache.sortedVersions(name, meta)
+	for i := len(published) - 1; i >= 0; i-- {
+		if published[i].Prerelease() == "" {
+			return published[i]
+		}
+	}
+	return nil
+}
+
+func outdatedDistance(version, latest *semver.Version) (outdatedPackage, bool) {
+	if !version.LessThan(latest) {
+		return outdatedPackage{}, false
+	}
+	distance := outdatedPackage{Latest: latest.Original()}
+	switch {
+	case version.Major() < latest.Major():
+		distance.Behind, distance.Major = "major", latest.Major()-version.Major()
+	case version.Minor() < latest.Minor():
+		distance.Behind, distance.Minor = "minor", latest.Minor()-version.Minor()
+	case version.Patch() < latest.Patch():
+		distance.Behind, distance.Patch = "patch", latest.Patch()-version.Patch()
+	default:
+		// IE: a prerelease of latest
+		distance.Behind = "patch"
+	}
+	return distance, true
+}
+
+// IE: the versions ahead of latest (a prerelease, or latest moved back after
+// a bad release) and the ones that don't parse count as up to date
+func outdatedSection(ctx context.Context, tree *NpmPackageVersion, query url.Values, report *treeReport) error {
+	unique := uniqueVersions(tree)
+	// IE: the names listed up front, the goroutines only write to latest
+	seen := make(map[string]bool)
+	var names []string
+	for _, pkg := range unique {
+		if !seen[pkg.Name] {
+			seen[pkg.Name] = true
+			names = append(names, pkg.Name)
+		}
+	}
+
+	latest := make(map[string]*semver.Version, len(names))
+	var mu sync.Mutex
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(live().concurrency, 1))
+	for _, name := range names {
+		g.Go(func() error {
+			meta, err := fetchPackageMeta(gctx, name)
+			if err != nil {
+				return fmt.Errorf("fetching package meta for %s: %w", name, err)
+			}
+			version := latestVersion(name, meta)
+			mu.Lock()
+			latest[name] = version
+			mu.Unlock()
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	outdated := &outdatedReport{Packages: []outdatedPackage{}}
+	for key, pkg := range unique {
+		version, err := semver.NewVersion(pkg.Version)
+		if err != nil || latest[pkg.Name] == nil {
+			outdated.UpToDate++
+			continue
+		}
+		distance, behind := outdatedDistance(version, latest[pkg.Name])
+		if !behind {
+			outdated.UpToDate++
+			continue
+		}
+		distance.Package = key
+		switch distance.Behind {
+		case "major":
+			outdated.Major++
+		case "minor":
+			outdated.Minor++
+		default:
+			outdated.Patch++
+		}
+		outdated.Packages = append(outdated.Packages, distance)
+	}
+
+	packages := outdated.Packages
+	sort.Slice(packages, func(i, j int) bool {
+		a, b := packages[i], packages[j]
+		if outdatedLevels[a.Behind] != outdatedLevels[b.Behind] {
+			return outdatedLevels[a.Behind] < outdatedLevels[b.Behind]
+		}
+		if a.Major+a.Minor+a.Patch != b.Major+b.Minor+b.Patch {
+			return a.Major+a.Minor+a.Patch > b.Major+b.Minor+b.Patch
+		}
+		return a.Package < b.Package
+	})
+	report.Outdated = outdated
+	return nil
+}
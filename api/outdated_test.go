@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/snyk/snyk-code-review-exercise/internal/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// IE: fixtures with the latest dist-tag of some packages, in their packuments
+func taggedRegistry(t *testing.T, packages fixtures.Registry, latest map[string]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/")
+		if tag, found := latest[name]; found {
+			meta := npmPackageMetaResponse{Versions: map[string]npmPackageResponse{}, DistTags: map[string]string{"latest": tag}}
+			for version, deps := range packages[name] {
+				meta.Versions[version] = npmPackageResponse{Name: name, Version: version, Dependencies: deps}
+			}
+			_ = json.NewEncoder(w).Encode(meta)
+			return
+		}
+		packages.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOutdatedReport(t *testing.T) {
+	registry := taggedRegistry(t, fixtures.Registry{
+		"app":    {"1.0.0": {"debug": "~2.6.0", "ms": "2.0.0", "semver": "~7.3.0", "left-pad": "^1.0.0", "next": "3.0.0-rc.1"}},
+		"debug":  {"2.6.9": nil, "4.3.4": nil},
+		"ms":     {"2.0.0": nil, "2.1.3": nil},
+		"semver": {"7.3.8": nil, "7.5.4": nil},
+		// IE: latest moved back to 1.3.0, and no dist-tag for next
+		"left-pad": {"1.3.0": nil, "1.3.1": nil},
+		"next":     {"2.0.0": nil, "3.0.0-rc.1": nil},
+	}, map[string]string{"debug": "4.3.4", "ms": "2.1.3", "semver": "7.5.4", "left-pad": "1.3.0"})
+	handler := New(WithRegistryURL(registry.URL))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0/report?sections=outdated", nil))
+	report := decodeReport(t, rec)
+	require.NotNil(t, report.Outdated)
+	assert.Equal(t, &outdatedReport{
+		UpToDate: 3, Patch: 0, Minor: 2, Major: 1,
+		Packages: []outdatedPackage{
+			{Package: "debug@2.6.9", Latest: "4.3.4", Behind: "major", Major: 2},
+			{Package: "semver@7.3.8", Latest: "7.5.4", Behind: "minor", Minor: 2},
+			{Package: "ms@2.0.0", Latest: "2.1.3", Behind: "minor", Minor: 1},
+		},
+	}, report.Outdated)
+}
+
+func TestOutdatedDistance(t *testing.T) {
+	for version, expected := range map[string]outdatedPackage{
+		"1.9.9":      {Latest: "2.0.0", Behind: "major", Major: 1},
+		"2.0.0-rc.1": {Latest: "2.0.0", Behind: "patch"},
+		"0.1.0":      {Latest: "2.0.0", Behind: "major", Major: 2},
+	} {
+		distance, behind := outdatedDistance(semver.MustParse(version), semver.MustParse("2.0.0"))
+		assert.True(t, behind, version)
+		assert.Equal(t, expected, distance, version)
+	}
+	_, behind := outdatedDistance(semver.MustParse("2.1.0-beta.1"), semver.MustParse("2.0.0"))
+	assert.False(t, behind)
+}
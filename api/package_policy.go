@@ -0,0 +1,194 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// Modes and actions of a PackagePolicy.
+const (
+	// PolicyModeDeny lets every package in but the denied ones.
+	PolicyModeDeny = "deny"
+	// PolicyModeAllow only lets the allowed packages in, the denied ones aside.
+	PolicyModeAllow = "allow"
+
+	// PolicyActionReject fails the resolution of a tree with a package the
+	// policy doesn't let in.
+	PolicyActionReject = "reject"
+	// PolicyActionFlag resolves the tree and marks such packages with a
+	// "policy" field.
+	PolicyActionFlag = "flag"
+)
+
+// PackagePolicy is an organization's rules on the packages trees may contain,
+// loaded with LoadPackagePolicy. A rule is a package name, a glob of names
+// (i.e. "@evil/*", "*-miner") or either of them followed by a semver range
+// (i.e. "event-stream@3.3.6", "lodash@<4.17.21").
+type PackagePolicy struct {
+	Mode   string   `yaml:"mode"`
+	Action string   `yaml:"action"`
+	Deny   []string `yaml:"deny"`
+	Allow  []string `yaml:"allow"`
+
+	deny  []packageRule
+	allow []packageRule
+	// IE: the cached trees were checked against the policy they were resolved under
+	fingerprint string
+}
+
+type packageRule struct {
+	rule    string
+	pattern string
+	// IE: nil for every version
+	versions *semver.Constraints
+}
+
+// IE: the @ of a scope isn't the one of a range
+func parsePackageRule(rule string) (packageRule, error) {
+	rule = strings.TrimSpace(rule)
+	name, versions := rule, ""
+	if at := strings.LastIndex(rule, "@"); at > 0 {
+		name, versions = rule[:at], rule[at+1:]
+	}
+	if name == "" {
+		return packageRule{}, fmt.Errorf("rule %q without a package name", rule)
+	}
+	if _, err := path.Match(name, ""); err != nil {
+		return packageRule{}, fmt.Errorf("rule %q: %w", rule, err)
+	}
+	parsed := packageRule{rule: rule, pattern: strings.ToLower(name)}
+	if versions != "" {
+		constraints, err := semver.NewConstraint(versions)
+		if err != nil {
+			return packageRule{}, fmt.Errorf("rule %q: %w", rule, err)
+		}
+		parsed.versions = constraints
+	}
+	return parsed, nil
+}
+
+func (r packageRule) matches(name string, version *semver.Version) bool {
+	if matched, _ := path.Match(r.pattern, strings.ToLower(name)); !matched {
+		return false
+	}
+	// IE: a version that doesn't parse can't be told out of the range, it's in
+	return r.versions == nil || version == nil || r.versions.Check(version)
+}
+
+// LoadPackagePolicy reads the YAML (or JSON) policy file at path, i.e.
+//
+//	mode: deny        # or allow
+//	action: reject    # or flag
+//	deny:
+//	  - event-stream@3.3.6
+//	  - "@evil/*"
+//	allow:            # allow mode only
+//	  - "@acme/*"
+//	  - react
+func LoadPackagePolicy(path string) (*PackagePolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	policy := &PackagePolicy{}
+	if err := yaml.Unmarshal(data, policy); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := policy.compile(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return policy, nil
+}
+
+func (p *PackagePolicy) compile() error {
+	switch p.Mode {
+	case "":
+		p.Mode = PolicyModeDeny
+	case PolicyModeDeny, PolicyModeAllow:
+	default:
+		return fmt.Errorf("mode: expected deny or allow, got %q", p.Mode)
+	}
+	switch p.Action {
+	case "":
+		p.Action = PolicyActionReject
+	case PolicyActionReject, PolicyActionFlag:
+	default:
+		return fmt.Errorf("action: expected reject or flag, got %q", p.Action)
+	}
+
+	p.deny, p.allow = nil, nil
+	for _, rule := range p.Deny {
+		parsed, err := parsePackageRule(rule)
+		if err != nil {
+			return fmt.Errorf("deny: %w", err)
+		}
+		p.deny = append(p.deny, parsed)
+	}
+	for _, rule := range p.Allow {
+		parsed, err := parsePackageRule(rule)
+		if err != nil {
+			return fmt.Errorf("allow: %w", err)
+		}
+		p.allow = append(p.allow, parsed)
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join([]string{p.Mode, p.Action, strings.Join(p.Deny, "\n"), strings.Join(p.Allow, "\n")}, "\x00")))
+	p.fingerprint = hex.EncodeToString(sum[:4])
+	return nil
+}
+
+// IE: appended to the keys of the trees and subtrees, a tree cached without the
+// policy (or under another one, by another replica) isn't served under this one
+func (p *PackagePolicy) cacheSuffix() string {
+	if p == nil {
+		return ""
+	}
+	return "#policy=" + p.fingerprint
+}
+
+// IE: why the policy doesn't let name@version in, empty when it does
+func (p *PackagePolicy) violation(name, version string) string {
+	if p == nil {
+		return ""
+	}
+	parsed, err := semver.NewVersion(version)
+	if err != nil {
+		parsed = nil
+	}
+	for _, rule := range p.deny {
+		if rule.matches(name, parsed) {
+			return "denied by " + rule.rule
+		}
+	}
+	if p.Mode != PolicyModeAllow {
+		return ""
+	}
+	for _, rule := range p.allow {
+		if rule.matches(name, parsed) {
+			return ""
+		}
+	}
+	return "not allowed"
+}
+
+// IE: rejected trees fail on the first package out of the policy, flagged ones
+// carry the reason on the node
+func (r *resolver) enforcePolicy(pkg *NpmPackageVersion) error {
+	reason := opts.packagePolicy.violation(pkg.Name, pkg.Version)
+	if reason == "" {
+		return nil
+	}
+	if opts.packagePolicy.Action == PolicyActionReject {
+		return fmt.Errorf("%w: %s@%s %s", ErrPolicyViolation, pkg.Name, pkg.Version, reason)
+	}
+	r.log.Warn("Package out of policy", "node", pkg.Name+"@"+pkg.Version, "reason", reason, "code", ErrPolicyViolation.Code)
+	pkg.Policy = reason
+	return nil
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writePolicy(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	require.Nil(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestPackagePolicyRules(t *testing.T) {
+	policy, err := LoadPackagePolicy(writePolicy(t, `
+mode: allow
+deny:
+  - event-stream@3.3.6
+  - "@evil/*"
+  - lodash@<4.17.21
+allow:
+  - "@acme/*"
+  - event-stream
+  - lodash
+`))
+	require.Nil(t, err)
+	assert.Equal(t, PolicyActionReject, policy.Action)
+
+	for node, want := range map[string]string{
+		"event-stream@3.3.6":    "denied by event-stream@3.3.6",
+		"event-stream@4.0.1":    "",
+		"@evil/miner@1.0.0":     `denied by @evil/*`,
+		"@Evil/Miner@1.0.0":     `denied by @evil/*`,
+		"lodash@4.17.20":        "denied by lodash@<4.17.21",
+		"lodash@4.17.21":        "",
+		"@acme/ui@2.0.0":        "",
+		"left-pad@1.3.0":        "not allowed",
+		"@acme-corp/ui@1.0.0":   "not allowed",
+		"event-stream-x@3.3.6":  "not allowed",
+		"lodash@not-a-version!": "denied by lodash@<4.17.21",
+	} {
+		i := len(node) - 1
+		for node[i] != '@' {
+			i--
+		}
+		assert.Equal(t, want, policy.violation(node[:i], node[i+1:]), node)
+	}
+
+	for name, content := range map[string]string{
+		"mode":    "mode: block\n",
+		"action":  "action: warn\n",
+		"range":   "deny:\n  - lodash@>>4\n",
+		"pattern": "deny:\n  - \"[\"\n",
+		"yaml":    "deny: [\n",
+	} {
+		_, err := LoadPackagePolicy(writePolicy(t, content))
+		assert.NotNil(t, err, name)
+	}
+}
+
+func TestPackagePolicyRejects(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{
+		"app":          {"1.0.0": {"event-stream": "^3.3.0", "ok": "^1.0.0"}},
+		"event-stream": {"3.3.6": nil},
+		"ok":           {"1.0.0": nil},
+	})
+	policy, err := LoadPackagePolicy(writePolicy(t, "deny:\n  - event-stream@3.3.6\n"))
+	require.Nil(t, err)
+	handler := New(WithRegistryURL(registry.URL), WithPackagePolicy(policy))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0", nil))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	payload := decodeErrorPayload(t, rec)
+	assert.Equal(t, "policy_violation", payload.Code)
+	assert.Contains(t, payload.Error, "event-stream@3.3.6")
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/ok/1.0.0", nil))
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+}
+
+func TestPackagePolicyFlags(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{
+		"app":          {"1.0.0": {"event-stream": "^3.3.0"}},
+		"event-stream": {"3.3.6": nil},
+	})
+	policy, err := LoadPackagePolicy(writePolicy(t, "action: flag\ndeny:\n  - event-stream@3.3.6\n"))
+	require.Nil(t, err)
+	handler := New(WithRegistryURL(registry.URL), WithPackagePolicy(policy))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var tree NpmPackageVersion
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &tree))
+	assert.Equal(t, "denied by event-stream@3.3.6", tree.Dependencies["event-stream"].Policy)
+	assert.Empty(t, tree.Policy)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0?format=ndjson", nil))
+	lines := readNDJSON(t, rec.Body.String())
+	require.Len(t, lines, 2)
+	assert.Equal(t, "denied by event-stream@3.3.6", lines[1]["policy"])
+}
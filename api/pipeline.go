@@ -0,0 +1,135 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// IE: concurrent fetches of the same document share one upstream call, across
+// requests as well, this is also what lets a worker join a prefetch in flight
+var (
+	packumentFlights singleflight.Group
+	packageFlights   singleflight.Group
+)
+
+// IE: a shared call that failed once the ctx of whoever started it was done.
+// Its error may be anything (the cause of the cancellation, i.e. a policy
+// violation elsewhere in that tree), so it's told apart by this rather than
+// by context.Canceled
+type abandonedFlight struct {
+	err error
+}
+
+func (a *abandonedFlight) Error() string { return a.err.Error() }
+
+func (a *abandonedFlight) Unwrap() error { return a.err }
+
+func sharedFetch(ctx context.Context, group *singleflight.Group, key string, fetch func() (interface{}, error)) (interface{}, error) {
+	leader := func() (interface{}, error) {
+		value, err := fetch()
+		if err != nil && ctx.Err() != nil {
+			return value, &abandonedFlight{err}
+		}
+		return value, err
+	}
+	select {
+	case res := <-group.DoChan(key, leader):
+		// IE: the call ran with the ctx of whoever started it, if that one went
+		// away it doesn't mean we did, fetch it ourselves then
+		var abandoned *abandonedFlight
+		if errors.As(res.Err, &abandoned) {
+			if ctx.Err() == nil {
+				return fetch()
+			}
+			return res.Val, abandoned.err
+		}
+		return res.Val, res.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// IE: pipelines the stages of the children of a node: as soon as it is known,
+// a child's packument is fetched, its version selected and its version
+// document fetched, without waiting for a worker to pick the child up. By the
+// time one does, both documents are cached or in flight (the worker then joins
+// the call). Prefetches only run while the resolver has a free slot, as many
+// as workers, otherwise the worker does the fetching as before. Errors are
+// left for the workers to report
+func (r *resolver) prefetch(ctx context.Context, depth int, deps map[string]string) {
+	if !r.features.enabled(FeaturePrefetch) {
+		return
+	}
+	for name, constraint := range deps {
+		select {
+		case r.prefetchSlots <- struct{}{}:
+		default:
+			return
+		}
+
+		r.prefetches.Add(1)
+		atomic.AddInt64(&r.stats.goroutines, 1)
+		go func(name, constraint string) {
+			defer func() {
+				<-r.prefetchSlots
+				r.prefetches.Done()
+			}()
+
+			meta, err := fetchPackageMeta(ctx, name)
+			if err != nil {
+				return
+			}
+			version, err := r.selectVersion(name, constraint, meta)
+			if err != nil {
+				return
+			}
+			// IE: nodes past the depth limit are never expanded, their document isn't needed
+			if r.maxDepth > 0 && depth >= r.maxDepth {
+				return
+			}
+			_, _ = fetchPackage(ctx, name, version)
+		}(name, constraint)
+	}
+}
+
+type upstreamLimitKey struct{}
+
+// IE: carried by the context rather than passed around, the fetch functions are
+// shared with callers which don't resolve a tree (i.e. cache key normalization)
+func withUpstreamLimit(ctx context.Context, slots chan struct{}) context.Context {
+	return context.WithValue(ctx, upstreamLimitKey{}, slots)
+}
+
+// IE: the slot is held by whoever makes the call, not by whoever waits on it
+// through sharedFetch, so workers joining a prefetch can't starve it
+func acquireUpstream(ctx context.Context) (func(), error) {
+	slots, _ := ctx.Value(upstreamLimitKey{}).(chan struct{})
+	if slots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case slots <- struct{}{}:
+		var once sync.Once
+		return func() { once.Do(func() { <-slots }) }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// IE: the call is over once the body is closed, not when the headers arrive
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
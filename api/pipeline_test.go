@@ -0,0 +1,114 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/singleflight"
+)
+
+func TestSharedFetchDedupesConcurrentCalls(t *testing.T) {
+	var group singleflight.Group
+	var calls int32
+	release := make(chan struct{})
+	fetch := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "packument", nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := sharedFetch(context.Background(), &group, "react", fetch)
+			assert.Nil(t, err)
+			assert.Equal(t, "packument", value)
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestSharedFetchRetriesWhenTheLeaderIsCancelled(t *testing.T) {
+	var group singleflight.Group
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+
+	go func() {
+		_, _ = sharedFetch(leaderCtx, &group, "react", func() (interface{}, error) {
+			close(started)
+			<-leaderCtx.Done()
+			return nil, leaderCtx.Err()
+		})
+	}()
+	<-started
+
+	result := make(chan interface{})
+	go func() {
+		value, err := sharedFetch(context.Background(), &group, "react", func() (interface{}, error) {
+			return "packument", nil
+		})
+		assert.Nil(t, err)
+		result <- value
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	assert.Equal(t, "packument", <-result)
+}
+
+// IE: an errgroup cancels with the error of the failed task, not context.Canceled
+func TestSharedFetchRetriesWhenTheLeaderIsCancelledWithACause(t *testing.T) {
+	var group singleflight.Group
+	leaderCtx, cancel := context.WithCancelCause(context.Background())
+	started := make(chan struct{})
+
+	go func() {
+		_, _ = sharedFetch(leaderCtx, &group, "ok", func() (interface{}, error) {
+			close(started)
+			<-leaderCtx.Done()
+			return nil, context.Cause(leaderCtx)
+		})
+	}()
+	<-started
+
+	result := make(chan interface{})
+	go func() {
+		value, err := sharedFetch(context.Background(), &group, "ok", func() (interface{}, error) {
+			return "packument", nil
+		})
+		assert.Nil(t, err)
+		result <- value
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel(ErrPolicyViolation)
+
+	assert.Equal(t, "packument", <-result)
+}
+
+func TestAcquireUpstreamBoundsCalls(t *testing.T) {
+	ctx := withUpstreamLimit(context.Background(), make(chan struct{}, 1))
+
+	release, err := acquireUpstream(ctx)
+	require.Nil(t, err)
+
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = acquireUpstream(timeout)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	release()
+	release()
+	_, err = acquireUpstream(ctx)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,225 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IE: bounds the memory of the request counts, the least requested go first
+const maxTrackedTrees = 10000
+
+// IE: nil unless WithPrecompute is set, replaced by every New()
+var precomputeJob *precomputer
+
+// IE: counts the requests for each package@version (with the default query
+// only, that's what gets precomputed) and re-resolves the most requested ones
+// every interval, so they are refreshed before they expire instead of once a
+// client asks for them again. Counts are halved after every round, old
+// popularity fades out
+type precomputer struct {
+	mu       sync.Mutex
+	top      int
+	interval time.Duration
+	trees    map[string]*precomputedTree
+	running  bool
+	lastRun  time.Time
+	nextRun  time.Time
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+type precomputedTree struct {
+	Package        string     `json:"package"`
+	Version        string     `json:"version"`
+	Requests       uint64     `json:"requests"`
+	LastRefreshed  *time.Time `json:"lastRefreshed,omitempty"`
+	LastDurationMs int64      `json:"lastDurationMs,omitempty"`
+	LastError      string     `json:"lastError,omitempty"`
+}
+
+type precomputeStatus struct {
+	Top      int               `json:"top"`
+	Interval string            `json:"interval"`
+	Running  bool              `json:"running"`
+	LastRun  *time.Time        `json:"lastRun,omitempty"`
+	NextRun  time.Time         `json:"nextRun"`
+	Trees    []precomputedTree `json:"trees"`
+}
+
+func newPrecomputer(top int, interval time.Duration) *precomputer {
+	if top <= 0 || interval <= 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &precomputer{
+		top:      top,
+		interval: interval,
+		trees:    make(map[string]*precomputedTree),
+		nextRun:  time.Now().Add(interval),
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	go p.loop(ctx)
+	return p
+}
+
+func (p *precomputer) record(name, version string) {
+	if p == nil {
+		return
+	}
+	name, version = normalizePackageName(name), strings.Join(strings.Fields(version), " ")
+	key := name + "@" + version
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	tree, found := p.trees[key]
+	if !found {
+		for len(p.trees) >= maxTrackedTrees {
+			p.decayLocked()
+		}
+		tree = &precomputedTree{Package: name, Version: version}
+		p.trees[key] = tree
+	}
+	tree.Requests++
+}
+
+// IE: trees nobody asked for since the last round(s) drop out
+func (p *precomputer) decayLocked() {
+	for key, tree := range p.trees {
+		tree.Requests /= 2
+		if tree.Requests == 0 {
+			delete(p.trees, key)
+		}
+	}
+}
+
+// IE: most requested first, ties by name so the schedule is stable
+func (p *precomputer) mostRequestedLocked() []*precomputedTree {
+	trees := make([]*precomputedTree, 0, len(p.trees))
+	for _, tree := range p.trees {
+		trees = append(trees, tree)
+	}
+	sort.Slice(trees, func(i, j int) bool {
+		if trees[i].Requests != trees[j].Requests {
+			return trees[i].Requests > trees[j].Requests
+		}
+		return trees[i].Package+"@"+trees[i].Version < trees[j].Package+"@"+trees[j].Version
+	})
+	if len(trees) > p.top {
+		trees = trees[:p.top]
+	}
+	return trees
+}
+
+func (p *precomputer) loop(ctx context.Context) {
+	defer close(p.done)
+
+	timer := time.NewTimer(p.interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		p.run(ctx)
+		timer.Reset(p.interval)
+	}
+}
+
+// IE: sequential like the warm-up, precomputing must not compete with real requests for upstream bandwidth
+func (p *precomputer) run(ctx context.Context) {
+	ctx = withJob(ctx, backgroundClient)
+	p.mu.Lock()
+	p.running = true
+	p.lastRun = time.Now()
+	var scheduled []precomputedTree
+	for _, tree := range p.mostRequestedLocked() {
+		scheduled = append(scheduled, *tree)
+	}
+	p.mu.Unlock()
+
+	for _, tree := range scheduled {
+		if ctx.Err() != nil {
+			break
+		}
+
+		start := time.Now()
+		err := refreshTree(ctx, tree.Package, tree.Version)
+		if err != nil {
+			logger.Error("Could not precompute", "package", tree.Package, "version", tree.Version, "error", err)
+		}
+
+		p.mu.Lock()
+		// IE: may have decayed away meanwhile, nothing left to report on then
+		if tracked, found := p.trees[tree.Package+"@"+tree.Version]; found {
+			tracked.LastRefreshed = &start
+			tracked.LastDurationMs = time.Since(start).Milliseconds()
+			tracked.LastError = ""
+			if err != nil {
+				tracked.LastError = err.Error()
+			}
+		}
+		p.mu.Unlock()
+	}
+
+	p.mu.Lock()
+	p.decayLocked()
+	p.running = false
+	p.nextRun = time.Now().Add(p.interval)
+	p.mu.Unlock()
+	logger.Info("Precomputed popular trees", "trees", len(scheduled), "duration", time.Since(p.lastRun))
+}
+
+// IE: resolved again whether or not the cached tree is still fresh, the point is that it never gets to expire
+func refreshTree(ctx context.Context, name, version string) error {
+	root, err := resolveTree(ctx, name, version, live().maxDepth)
+	if err != nil {
+		return err
+	}
+	defer releaseTree(root)
+	_, err = streamAndCacheTree(io.Discard, treeCacheKey(ctx, name, version, nil), root)
+	return err
+}
+
+func (p *precomputer) status() precomputeStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	status := precomputeStatus{Top: p.top, Interval: p.interval.String(), Running: p.running, NextRun: p.nextRun, Trees: []precomputedTree{}}
+	if !p.lastRun.IsZero() {
+		lastRun := p.lastRun
+		status.LastRun = &lastRun
+	}
+	for _, tree := range p.mostRequestedLocked() {
+		status.Trees = append(status.Trees, *tree)
+	}
+	return status
+}
+
+// IE: waits for a round in progress to notice, New() may replace the loggers and caches next
+func (p *precomputer) Close() {
+	p.cancel()
+	<-p.done
+}
+
+func precomputeHandler(w http.ResponseWriter, r *http.Request) {
+	current := precomputeJob
+	if current == nil {
+		http.Error(w, "precomputation is disabled", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(current.status()); err != nil {
+		logger.Error("Could not write precompute status", "error", err)
+	}
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrecomputerSchedulesMostRequested(t *testing.T) {
+	New(WithPrecompute(2, time.Hour))
+	defer precomputeJob.Close()
+
+	for i := 0; i < 3; i++ {
+		precomputeJob.record("react", "16.13.0")
+	}
+	precomputeJob.record(" react", " 16.13.0")
+	precomputeJob.record("express", "4.18.1")
+	precomputeJob.record("express", "4.18.1")
+	precomputeJob.record("left-pad", "1.3.0")
+
+	trees := precomputeJob.status().Trees
+	require.Len(t, trees, 2)
+	assert.Equal(t, precomputedTree{Package: "react", Version: "16.13.0", Requests: 4}, trees[0])
+	assert.Equal(t, precomputedTree{Package: "express", Version: "4.18.1", Requests: 2}, trees[1])
+
+	// IE: left-pad was requested once, it fades out first
+	precomputeJob.mu.Lock()
+	precomputeJob.decayLocked()
+	precomputeJob.mu.Unlock()
+	_, found := precomputeJob.trees["left-pad@1.3.0"]
+	assert.False(t, found)
+	assert.Equal(t, uint64(2), precomputeJob.trees["react@16.13.0"].Requests)
+}
+
+func TestPrecomputerRefreshesTrees(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{
+		"left-pad": {"1.3.0": nil},
+	})
+	handler := New(WithRegistryURL(registry.URL), WithPrecompute(10, time.Hour))
+	defer precomputeJob.Close()
+
+	// IE: twice, counts are halved after the round
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/left-pad/1.3.0", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+	}
+	// IE: only the default query gets precomputed
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/package/left-pad/1.3.0?maxDepth=1", nil))
+
+	key := treeCacheKey(context.Background(), "left-pad", "1.3.0", nil)
+	responseCache.Delete(key)
+	precomputeJob.run(context.Background())
+
+	_, found := responseCache.Get(key)
+	assert.True(t, found)
+
+	rec := httptest.NewRecorder()
+	AdminHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/precompute", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var status precomputeStatus
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	assert.False(t, status.Running)
+	require.NotNil(t, status.LastRun)
+	require.Len(t, status.Trees, 1)
+	assert.Equal(t, "left-pad", status.Trees[0].Package)
+	assert.NotNil(t, status.Trees[0].LastRefreshed)
+	assert.Empty(t, status.Trees[0].LastError)
+}
+
+func TestPrecomputeHandlerDisabled(t *testing.T) {
+	New()
+
+	rec := httptest.NewRecorder()
+	AdminHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/precompute", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
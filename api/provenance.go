@@ -0,0 +1,244 @@
+package api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/sigstore/sigstore-go/pkg/bundle"
+	"github.com/sigstore/sigstore-go/pkg/root"
+	"github.com/sigstore/sigstore-go/pkg/tuf"
+	"github.com/sigstore/sigstore-go/pkg/verify"
+)
+
+// Provenance of a resolved version, see WithProvenanceVerification.
+const (
+	// ProvenanceVerified is a version signed by the registry, with a
+	// provenance attestation for the very tarball the registry serves, signed
+	// through sigstore and recorded in its transparency log.
+	ProvenanceVerified = "verified"
+	// ProvenanceMissing is a version without a verified provenance: most are
+	// published without a registry signature or a provenance attestation, and
+	// the ones whose signature or attestation doesn't check out are logged.
+	ProvenanceMissing = "missing"
+)
+
+// IE: a signature or an attestation that doesn't check out, as opposed to
+// failing to check it (i.e. the registry being down)
+var errProvenanceMismatch = errors.New("provenance mismatch")
+
+// IE: the predicate npm publishes build provenance with, the publish
+// attestation next to it says nothing about where the tarball was built
+const slsaProvenancePredicate = "https://slsa.dev/provenance/"
+
+type npmSignature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+type npmAttestations struct {
+	URL        string `json:"url"`
+	Provenance struct {
+		PredicateType string `json:"predicateType"`
+	} `json:"provenance"`
+}
+
+// IE: the registry keys, fetched once per New and per Reload moving to another
+// registry, nil until the first resolution needing them. A failed fetch is
+// retried by the next one
+var (
+	registryKeysMu sync.Mutex
+	registryKeys   map[string]*ecdsa.PublicKey
+)
+
+func resetRegistryKeys() {
+	registryKeysMu.Lock()
+	registryKeys = nil
+	registryKeysMu.Unlock()
+}
+
+// IE: the trusted root of the sigstore public good instance npm signs the
+// attestations through, fetched over TUF on first use and refreshed by
+// sigstore-go from then on. A failed fetch is retried by the next resolution
+var (
+	sigstoreVerifierMu sync.Mutex
+	sigstoreVerifier   *verify.Verifier
+
+	// IE: overridable for tests
+	sigstoreTrustedMaterial = func() (root.TrustedMaterial, error) {
+		return root.NewLiveTrustedRoot(tuf.DefaultOptions())
+	}
+)
+
+// IE: the entry in the transparency log proves when the short lived
+// certificate signed the attestation
+func attestationVerifier() (*verify.Verifier, error) {
+	sigstoreVerifierMu.Lock()
+	defer sigstoreVerifierMu.Unlock()
+	if sigstoreVerifier != nil {
+		return sigstoreVerifier, nil
+	}
+
+	trusted, err := sigstoreTrustedMaterial()
+	if err != nil {
+		return nil, fmt.Errorf("sigstore trusted root: %w", err)
+	}
+	verifier, err := verify.NewVerifier(trusted, verify.WithTransparencyLog(1), verify.WithObserverTimestamps(1))
+	if err != nil {
+		return nil, err
+	}
+	sigstoreVerifier = verifier
+	return verifier, nil
+}
+
+// IE: expired keys are kept, a key expires once rotated and the versions it
+// signed before that stay valid
+func fetchRegistryKeys(ctx context.Context) (map[string]*ecdsa.PublicKey, error) {
+	registryKeysMu.Lock()
+	defer registryKeysMu.Unlock()
+	if registryKeys != nil {
+		return registryKeys, nil
+	}
+
+	var listing struct {
+		Keys []struct {
+			KeyID   string `json:"keyid"`
+			KeyType string `json:"keytype"`
+			Key     string `json:"key"`
+		} `json:"keys"`
+	}
+	if err := getJSON(ctx, live().registryURL+"/-/npm/v1/keys", &listing); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*ecdsa.PublicKey, len(listing.Keys))
+	for _, key := range listing.Keys {
+		der, err := base64.StdEncoding.DecodeString(key.Key)
+		if err != nil {
+			return nil, fmt.Errorf("registry key %s: %w", key.KeyID, err)
+		}
+		parsed, err := x509.ParsePKIXPublicKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("registry key %s: %w", key.KeyID, err)
+		}
+		// IE: npm only signs with ecdsa-sha2-nistp256 so far, other keys can't be checked
+		if public, ok := parsed.(*ecdsa.PublicKey); ok {
+			keys[key.KeyID] = public
+		}
+	}
+	registryKeys = keys
+	return keys, nil
+}
+
+// IE: the registry signs "<name>@<version>:<integrity>", a signature by any of
+// its keys will do
+func verifyRegistrySignature(ctx context.Context, name, version string, dist npmDist) (bool, error) {
+	keys, err := fetchRegistryKeys(ctx)
+	if err != nil {
+		return false, err
+	}
+	digest := sha256.Sum256([]byte(name + "@" + version + ":" + dist.Integrity))
+	for _, signature := range dist.Signatures {
+		key, found := keys[signature.KeyID]
+		if !found {
+			continue
+		}
+		sig, err := base64.StdEncoding.DecodeString(signature.Sig)
+		if err != nil {
+			continue
+		}
+		if ecdsa.VerifyASN1(key, digest[:], sig) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// IE: the sigstore bundle of the provenance attestation must verify against
+// the trusted root, whoever signed it (npm takes the identity from the CI
+// that built the tarball, we have nothing to hold it against), and its
+// statement must be about the tarball the registry serves: the package url of
+// the version with the sha512 digest of the integrity. Nil once verified,
+// errProvenanceMismatch when it doesn't check out
+func verifyAttestation(ctx context.Context, name, version string, dist npmDist) error {
+	var listing struct {
+		Attestations []struct {
+			PredicateType string          `json:"predicateType"`
+			Bundle        json.RawMessage `json:"bundle"`
+		} `json:"attestations"`
+	}
+	if err := getJSON(ctx, dist.Attestations.URL, &listing); err != nil {
+		return err
+	}
+
+	sri, found := strings.CutPrefix(strings.Fields(dist.Integrity)[0], "sha512-")
+	if !found {
+		return fmt.Errorf("%w: integrity %s isn't sha512", errProvenanceMismatch, dist.Integrity)
+	}
+	expected, err := base64.StdEncoding.DecodeString(sri)
+	if err != nil {
+		return fmt.Errorf("%w: integrity %s: %w", errProvenanceMismatch, dist.Integrity, err)
+	}
+	purl := "pkg:npm/" + strings.Replace(name, "@", "%40", 1) + "@" + version
+
+	for _, attestation := range listing.Attestations {
+		if !strings.HasPrefix(attestation.PredicateType, slsaProvenancePredicate) {
+			continue
+		}
+		var signed bundle.Bundle
+		if err := signed.UnmarshalJSON(attestation.Bundle); err != nil {
+			return fmt.Errorf("%w: bundle: %w", errProvenanceMismatch, err)
+		}
+		verifier, err := attestationVerifier()
+		if err != nil {
+			return err
+		}
+		result, err := verifier.Verify(&signed, verify.NewPolicy(verify.WithArtifactDigest("sha512", expected), verify.WithoutIdentitiesUnsafe()))
+		if err != nil {
+			return fmt.Errorf("%w: %w", errProvenanceMismatch, err)
+		}
+		for _, subject := range result.Statement.GetSubject() {
+			if subject.GetName() == purl && subject.GetDigest()["sha512"] == hex.EncodeToString(expected) {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: the attestation isn't about %s", errProvenanceMismatch, purl)
+	}
+	return fmt.Errorf("%w: no provenance attestation", errProvenanceMismatch)
+}
+
+// IE: verified once both the registry signature and the provenance
+// attestation check out, missing otherwise. Those not checking out come with
+// errProvenanceMismatch, for the log
+func verifyProvenance(ctx context.Context, name, version string, dist npmDist) (string, error) {
+	if len(dist.Signatures) == 0 || dist.Integrity == "" || dist.Attestations == nil ||
+		!strings.HasPrefix(dist.Attestations.Provenance.PredicateType, slsaProvenancePredicate) {
+		return ProvenanceMissing, nil
+	}
+
+	signed, err := verifyRegistrySignature(ctx, name, version, dist)
+	if err != nil {
+		return "", fmt.Errorf("registry signature: %w", err)
+	}
+	if !signed {
+		return ProvenanceMissing, fmt.Errorf("%w: no registry signature matches", errProvenanceMismatch)
+	}
+	err = verifyAttestation(ctx, name, version, dist)
+	if errors.Is(err, ErrPackageNotFound) {
+		return ProvenanceMissing, nil
+	}
+	if errors.Is(err, errProvenanceMismatch) {
+		return ProvenanceMissing, err
+	}
+	if err != nil {
+		return "", fmt.Errorf("attestation: %w", err)
+	}
+	return ProvenanceVerified, nil
+}
@@ -0,0 +1,226 @@
+package api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	protobundle "github.com/sigstore/protobuf-specs/gen/pb-go/bundle/v1"
+	protocommon "github.com/sigstore/protobuf-specs/gen/pb-go/common/v1"
+	protodsse "github.com/sigstore/protobuf-specs/gen/pb-go/dsse"
+	protorekor "github.com/sigstore/protobuf-specs/gen/pb-go/rekor/v1"
+	sigstorebundle "github.com/sigstore/sigstore-go/pkg/bundle"
+	"github.com/sigstore/sigstore-go/pkg/root"
+	"github.com/sigstore/sigstore-go/pkg/testing/ca"
+	"github.com/snyk/snyk-code-review-exercise/internal/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// IE: a sigstore bundle of the attestation, the way npm serves them, signed
+// through signer (a trusted one unless the test forges the attestation)
+func attestationBundle(t *testing.T, signer *ca.VirtualSigstore, statement []byte) json.RawMessage {
+	entity, err := signer.AttestAtTime("https://github.com/acme/app/.github/workflows/release.yml@refs/heads/main",
+		"https://token.actions.githubusercontent.com", statement, time.Now().Add(5*time.Minute), true)
+	require.Nil(t, err)
+
+	content, err := entity.VerificationContent()
+	require.Nil(t, err)
+	signature, err := entity.SignatureContent()
+	require.Nil(t, err)
+	envelope := signature.(*sigstorebundle.Envelope).Envelope
+	payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+	require.Nil(t, err)
+	sig, err := base64.StdEncoding.DecodeString(envelope.Signatures[0].Sig)
+	require.Nil(t, err)
+	entries, err := entity.TlogEntries()
+	require.Nil(t, err)
+	logEntry := entries[0].TransparencyLogEntry()
+	logEntry.KindVersion = &protorekor.KindVersion{Kind: "intoto", Version: "0.0.2"}
+	timestamps, err := entity.Timestamps()
+	require.Nil(t, err)
+
+	encoded, err := protojson.Marshal(&protobundle.Bundle{
+		MediaType: "application/vnd.dev.sigstore.bundle.v0.3+json",
+		VerificationMaterial: &protobundle.VerificationMaterial{
+			Content: &protobundle.VerificationMaterial_Certificate{Certificate: &protocommon.X509Certificate{
+				RawBytes: content.(*sigstorebundle.Certificate).Certificate().Raw,
+			}},
+			TlogEntries: []*protorekor.TransparencyLogEntry{logEntry},
+			TimestampVerificationData: &protobundle.TimestampVerificationData{Rfc3161Timestamps: []*protocommon.RFC3161SignedTimestamp{
+				{SignedTimestamp: timestamps[0]},
+			}},
+		},
+		Content: &protobundle.Bundle_DsseEnvelope{DsseEnvelope: &protodsse.Envelope{
+			Payload:     payload,
+			PayloadType: envelope.PayloadType,
+			Signatures:  []*protodsse.Signature{{Sig: sig}},
+		}},
+	})
+	require.Nil(t, err)
+	return encoded
+}
+
+// IE: a registry signing its versions like registry.npmjs.org does, the dist of
+// each version is what the test gives it. The attestations of the versions in
+// forged are signed through a sigstore nobody trusts
+func provenanceRegistry(t *testing.T, packages fixtures.Registry, dists map[string]func(url string) npmDist, forged ...string) *httptest.Server {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+
+	trusted, err := ca.NewVirtualSigstore()
+	require.Nil(t, err)
+	untrusted, err := ca.NewVirtualSigstore()
+	require.Nil(t, err)
+	trustedMaterial := sigstoreTrustedMaterial
+	sigstoreTrustedMaterial = func() (root.TrustedMaterial, error) { return trusted, nil }
+	sigstoreVerifier = nil
+	t.Cleanup(func() {
+		sigstoreTrustedMaterial = trustedMaterial
+		sigstoreVerifier = nil
+	})
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.Nil(t, err)
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/-/npm/v1/keys" {
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+				{"keyid": "SHA256:test", "keytype": "ecdsa-sha2-nistp256", "key": base64.StdEncoding.EncodeToString(der)},
+			}})
+			return
+		}
+		if node, found := strings.CutPrefix(r.URL.Path, "/-/npm/v1/attestations/"); found {
+			at := strings.LastIndex(node, "@")
+			dist := dists[node](server.URL)
+			sum, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(dist.Integrity, "sha512-"))
+			statement, _ := json.Marshal(map[string]interface{}{
+				"_type": "https://in-toto.io/Statement/v1",
+				"subject": []map[string]interface{}{
+					{"name": "pkg:npm/" + node[:at] + "@" + node[at+1:], "digest": map[string]string{"sha512": hex.EncodeToString(sum)}},
+				},
+				"predicateType": "https://slsa.dev/provenance/v1",
+				"predicate":     map[string]interface{}{},
+			})
+			signer := trusted
+			if slices.Contains(forged, node) {
+				signer = untrusted
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"attestations": []map[string]interface{}{
+				{"predicateType": "https://slsa.dev/provenance/v1", "bundle": attestationBundle(t, signer, statement)},
+			}})
+			return
+		}
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		if len(parts) == 2 && dists[parts[0]+"@"+parts[1]] != nil {
+			dist := dists[parts[0]+"@"+parts[1]](server.URL)
+			for i, signature := range dist.Signatures {
+				digest := sha256.Sum256([]byte(signature.Sig))
+				sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+				require.Nil(t, err)
+				dist.Signatures[i].Sig = base64.StdEncoding.EncodeToString(sig)
+			}
+			_ = json.NewEncoder(w).Encode(npmPackageResponse{Name: parts[0], Version: parts[1], Dependencies: packages[parts[0]][parts[1]], Dist: dist})
+			return
+		}
+		packages.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// IE: Sig holds what gets signed, the registry replaces it by the signature
+func signedDist(name, version, content, signed string, attested bool) func(string) npmDist {
+	sum := sha512.Sum512([]byte(content))
+	integrity := "sha512-" + base64.StdEncoding.EncodeToString(sum[:])
+	return func(url string) npmDist {
+		dist := npmDist{Integrity: integrity, Signatures: []npmSignature{{KeyID: "SHA256:test", Sig: name + "@" + version + ":" + integrity}}}
+		if signed != "" {
+			dist.Signatures[0].Sig = signed
+		}
+		if attested {
+			dist.Attestations = &npmAttestations{URL: url + "/-/npm/v1/attestations/" + name + "@" + version}
+			dist.Attestations.Provenance.PredicateType = "https://slsa.dev/provenance/v1"
+		}
+		return dist
+	}
+}
+
+func TestProvenanceVerification(t *testing.T) {
+	registry := provenanceRegistry(t, fixtures.Registry{
+		"app":        {"1.0.0": {"signed": "^1.0.0", "unsigned": "^1.0.0", "tampered": "^1.0.0", "forged": "^1.0.0", "unattested": "^1.0.0"}},
+		"signed":     {"1.0.0": nil},
+		"unsigned":   {"1.0.0": nil},
+		"tampered":   {"1.0.0": nil},
+		"forged":     {"1.0.0": nil},
+		"unattested": {"1.0.0": nil},
+	}, map[string]func(string) npmDist{
+		"signed@1.0.0":     signedDist("signed", "1.0.0", "signed", "", true),
+		"tampered@1.0.0":   signedDist("tampered", "1.0.0", "tampered", "tampered@1.0.0:sha512-other", true),
+		"forged@1.0.0":     signedDist("forged", "1.0.0", "forged", "", true),
+		"unattested@1.0.0": signedDist("unattested", "1.0.0", "unattested", "", false),
+	}, "forged@1.0.0")
+	handler := New(WithRegistryURL(registry.URL), WithProvenanceVerification(true))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var tree NpmPackageVersion
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &tree))
+	assert.Equal(t, ProvenanceMissing, tree.Provenance)
+	assert.Equal(t, ProvenanceVerified, tree.Dependencies["signed"].Provenance)
+	assert.Equal(t, ProvenanceMissing, tree.Dependencies["unsigned"].Provenance)
+	assert.Equal(t, ProvenanceMissing, tree.Dependencies["tampered"].Provenance)
+	assert.Equal(t, ProvenanceMissing, tree.Dependencies["forged"].Provenance)
+	assert.Equal(t, ProvenanceMissing, tree.Dependencies["unattested"].Provenance)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/signed/1.0.0?format=ndjson", nil))
+	lines := readNDJSON(t, rec.Body.String())
+	require.Len(t, lines, 1)
+	assert.Equal(t, ProvenanceVerified, lines[0]["provenance"])
+}
+
+func TestProvenanceAttestationOfAnotherTarball(t *testing.T) {
+	registry := provenanceRegistry(t, fixtures.Registry{"signed": {"1.0.0": nil}}, map[string]func(string) npmDist{
+		"signed@1.0.0": signedDist("signed", "1.0.0", "signed", "", true),
+	})
+	New(WithRegistryURL(registry.URL))
+
+	response, err := fetchPackage(context.Background(), "signed", "1.0.0")
+	require.Nil(t, err)
+	assert.Nil(t, verifyAttestation(context.Background(), "signed", "1.0.0", response.Dist))
+
+	// IE: the attestation is about the tarball the registry used to serve
+	rebuilt := sha512.Sum512([]byte("rebuilt"))
+	response.Dist.Integrity = "sha512-" + base64.StdEncoding.EncodeToString(rebuilt[:])
+	assert.ErrorIs(t, verifyAttestation(context.Background(), "signed", "1.0.0", response.Dist), errProvenanceMismatch)
+}
+
+func TestReloadFetchesTheKeysOfTheNewRegistry(t *testing.T) {
+	registry := provenanceRegistry(t, fixtures.Registry{}, nil)
+	New(WithRegistryURL(registry.URL))
+	_, err := fetchRegistryKeys(context.Background())
+	require.Nil(t, err)
+
+	require.Nil(t, Reload(WithRegistryURL(registry.URL)))
+	assert.NotNil(t, registryKeys)
+
+	moved := provenanceRegistry(t, fixtures.Registry{}, nil)
+	require.Nil(t, Reload(WithRegistryURL(moved.URL)))
+	assert.Nil(t, registryKeys)
+}
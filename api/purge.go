@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// IE: optional, only the backends able to enumerate their keys implement it
+type prefixDeleter interface {
+	DeletePrefix(prefix string) int
+}
+
+// IE: drops everything cached about a package on this instance, returns the number of entries dropped when known
+func purgeLocal(name string) int {
+	name = normalizePackageName(name)
+	purged := 0
+
+	for _, key := range []string{packumentKeyPrefix + name, negativePackumentKey(name)} {
+		packumentCache.Delete(key)
+	}
+
+	// IE: always in memory, see selectVersion() and getCachedDeps()
+	purged += selectionCache.(prefixDeleter).DeletePrefix(selectionKeyPrefix + name + "@")
+	purged += lastSelections.(prefixDeleter).DeletePrefix(selectionKeyPrefix + name + "@")
+	purged += subtreeCache.(prefixDeleter).DeletePrefix(subtreeKeyPrefix + name + "@")
+
+	prefixes := map[Cache][]string{
+		responseCache:  {treeKeyPrefix + name + "@"},
+		packumentCache: {versionKeyPrefix + name + "@", negativeVersionKey(name, "")},
+	}
+	// IE: both layers may be the very same backend
+	if responseCache == packumentCache {
+		prefixes = map[Cache][]string{responseCache: append(prefixes[responseCache], prefixes[packumentCache]...)}
+	}
+
+	for cache, cachePrefixes := range prefixes {
+		deleter, ok := cache.(prefixDeleter)
+		if !ok {
+			logger.Warn("Cache backend cannot purge by prefix, the trees expire with their TTL", "backend", cache.Stats().Backend, "package", name)
+			continue
+		}
+		for _, prefix := range cachePrefixes {
+			purged += deleter.DeletePrefix(prefix)
+		}
+	}
+
+	return purged
+}
+
+// IE: purge here and tell the other replicas to do the same
+func purgeHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["package"]
+
+	purged := purgeLocal(name)
+	if invalidations != nil {
+		invalidations.Publish(name)
+	}
+
+	logger.Info("Purged cache entries", "package", name, "entries", purged)
+	w.WriteHeader(http.StatusNoContent)
+}
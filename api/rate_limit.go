@@ -0,0 +1,202 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// IE: idle clients' buckets are full again and dropped this often, the map
+// would otherwise keep every address that ever called
+const rateLimitSweepInterval = time.Minute
+
+var errRateLimited = &Error{Code: "rate_limited", Status: http.StatusTooManyRequests, message: "rate limit exceeded, retry later"}
+
+// IE: nil unless WithRateLimit is set, replaced by every New()
+var rateLimits *rateLimiter
+
+// IE: a token bucket per client, refilled at its rate up to its burst
+type rateLimiter struct {
+	rate      float64
+	burst     float64
+	overrides map[string]float64
+	now       func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+
+	limited atomic.Uint64
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	rate   float64
+}
+
+func newRateLimiter(rate float64, burst int, overrides map[string]float64) *rateLimiter {
+	if rate <= 0 && len(overrides) == 0 {
+		return nil
+	}
+	return &rateLimiter{
+		rate:      rate,
+		burst:     float64(burst),
+		overrides: overrides,
+		now:       time.Now,
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// IE: without a burst of its own a client may spend a second of its rate at once
+func (l *rateLimiter) burstOf(rate float64) float64 {
+	if l.burst > 0 {
+		return l.burst
+	}
+	return math.Max(1, math.Ceil(rate))
+}
+
+func (l *rateLimiter) rateOf(client string) float64 {
+	if rate, found := l.overrides[client]; found {
+		return rate
+	}
+	return l.rate
+}
+
+// IE: what the RateLimit headers of a response tell
+type rateLimitState struct {
+	limit     int
+	remaining int
+	// IE: until the bucket is full again, and until the next token when it's empty
+	reset      time.Duration
+	retryAfter time.Duration
+	window     time.Duration
+}
+
+// IE: takes a token if there is one. A rate of 0 (override or default) doesn't limit the client
+func (l *rateLimiter) allow(client string) (bool, rateLimitState) {
+	rate := l.rateOf(client)
+	if rate <= 0 {
+		return true, rateLimitState{}
+	}
+	burst := l.burstOf(rate)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.sweep(now)
+
+	b, found := l.buckets[client]
+	if !found {
+		b = &tokenBucket{tokens: burst, last: now, rate: rate}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	state := rateLimitState{
+		limit:     int(burst),
+		remaining: int(b.tokens),
+		reset:     seconds((burst - b.tokens) / rate),
+		window:    seconds(burst / rate),
+	}
+	if !allowed {
+		state.retryAfter = seconds((1 - b.tokens) / rate)
+		l.limited.Add(1)
+	}
+	return allowed, state
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// IE: under the lock, cheap enough once a minute
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for client, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*b.rate >= l.burstOf(b.rate) {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// IE: in whole seconds rounded up, 0 would tell the client to retry right away
+func headerSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// IE: the RateLimit-* headers of the IETF draft, and Retry-After on a 429.
+// Keyed by requestClient, so by the client header of authenticated callers,
+// the subject of their token or certificate, the address of the others
+func limitRate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limiter := rateLimits
+		if limiter == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		client := requestClient(r)
+		allowed, state := limiter.allow(client)
+		if state.limit > 0 {
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(state.limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(state.remaining))
+			w.Header().Set("RateLimit-Reset", headerSeconds(state.reset))
+			w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%s", state.limit, headerSeconds(state.window)))
+		}
+		if !allowed {
+			loggerFrom(r.Context()).Debug("Rate limited", "client", client)
+			w.Header().Set("Retry-After", headerSeconds(state.retryAfter))
+			httpError(w, r, errRateLimited)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ParseClientRateLimits parses a comma separated list of client=requests per
+// second pairs, i.e. "ci=0.5,dashboard=20", for WithRateLimit. 0 doesn't
+// limit the client.
+func ParseClientRateLimits(value string) (map[string]float64, error) {
+	limits := make(map[string]float64)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		client, rate, found := strings.Cut(pair, "=")
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(rate), 64)
+		if !found || strings.TrimSpace(client) == "" || err != nil || parsed < 0 {
+			return nil, fmt.Errorf("expected client=requests per second, got %q", pair)
+		}
+		limits[strings.TrimSpace(client)] = parsed
+	}
+	return limits, nil
+}
+
+func registerRateLimitMetrics(registry *prometheus.Registry) {
+	registry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Name: "deps_rate_limited_requests_total",
+		Help: "Package requests rejected by the per client rate limit.",
+	}, func() float64 {
+		if rateLimits == nil {
+			return 0
+		}
+		return float64(rateLimits.limited.Load())
+	}))
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	l := newRateLimiter(2, 3, map[string]float64{"ci": 0.5, "dashboard": 0})
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		allowed, state := l.allow("a")
+		require.True(t, allowed, i)
+		assert.Equal(t, 2-i, state.remaining)
+	}
+	allowed, state := l.allow("a")
+	assert.False(t, allowed)
+	assert.Equal(t, 3, state.limit)
+	assert.Equal(t, 500*time.Millisecond, state.retryAfter)
+	assert.Equal(t, 1500*time.Millisecond, state.reset)
+	// IE: nobody else pays for it
+	allowed, _ = l.allow("b")
+	assert.True(t, allowed)
+
+	now = now.Add(500 * time.Millisecond)
+	allowed, _ = l.allow("a")
+	assert.True(t, allowed)
+
+	// IE: the burst of the overridden rate, a second worth of requests rounded up
+	allowed, state = l.allow("ci")
+	assert.True(t, allowed)
+	assert.Equal(t, 3, state.limit)
+	for i := 0; i < 10; i++ {
+		allowed, _ = l.allow("dashboard")
+		assert.True(t, allowed)
+	}
+	assert.Equal(t, uint64(1), l.limited.Load())
+
+	// IE: full again by then, dropped
+	now = now.Add(rateLimitSweepInterval)
+	l.allow("b")
+	assert.Len(t, l.buckets, 1)
+
+	assert.Nil(t, newRateLimiter(0, 10, nil))
+}
+
+func TestLimitRate(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{"app": {"1.0.0": nil}})
+	handler := New(WithRegistryURL(registry.URL), WithRateLimit(1, 2, nil), WithClientHeader("X-API-Key"), WithTrustedGateways([]string{"gateway"}))
+
+	request := func(key string) *httptest.ResponseRecorder {
+		req := withClientCertificate(httptest.NewRequest("GET", "/package/app/1.0.0", nil), "gateway")
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := request("ci")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", rec.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "2;w=2", rec.Header().Get("RateLimit-Policy"))
+	require.Equal(t, http.StatusOK, request("ci").Code)
+
+	rec = request("ci")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "0", rec.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+	assert.Equal(t, "rate_limited", decodeErrorPayload(t, rec).Code)
+
+	assert.Equal(t, http.StatusOK, request("dashboard").Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, rec.Body.String(), "deps_rate_limited_requests_total 1")
+}
+
+func TestLimitRateOfAuthenticatedCallers(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{"app": {"1.0.0": nil}})
+	handler := New(WithRegistryURL(registry.URL), WithRateLimit(1, 2, nil), WithClientHeader("X-API-Key"), WithTrustedGateways([]string{"gateway"}))
+
+	// IE: a new name on every request, as a caller trying to get around the limit would
+	codes := []int{}
+	for _, key := range []string{"a", "b", "c"} {
+		req := withClientCertificate(httptest.NewRequest("GET", "/package/app/1.0.0", nil), "alice")
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		codes = append(codes, rec.Code)
+	}
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}, codes)
+}
+
+func TestParseClientRateLimits(t *testing.T) {
+	limits, err := ParseClientRateLimits(" ci=0.5, dashboard=20 ")
+	require.Nil(t, err)
+	assert.Equal(t, map[string]float64{"ci": 0.5, "dashboard": 20}, limits)
+
+	for _, invalid := range []string{"ci", "ci=fast", "=1", "ci=-1"} {
+		_, err = ParseClientRateLimits(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// IE: lets several replicas share a warm cache that also survives restarts
+type redisCache struct {
+	client *redis.Client
+	prefix string
+
+	// IE: bound each round trip, a slow redis must not be slower than asking the registry
+	timeout time.Duration
+	cacheCounters
+}
+
+func newRedisCache(url string) (*redisCache, error) {
+	redisOpts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	return &redisCache{client: redis.NewClient(redisOpts), prefix: "deps:", timeout: time.Second}, nil
+}
+
+func (c *redisCache) Get(key string) ([]byte, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	value, err := c.client.Get(ctx, c.prefix+key).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			logger.Error("Redis get failed", "key", key, "error", err)
+		}
+		c.record(false)
+		return nil, false
+	}
+	c.record(true)
+	return value, true
+}
+
+func (c *redisCache) Set(key string, value []byte, ttl time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	if err := c.client.Set(ctx, c.prefix+key, value, ttl).Err(); err != nil {
+		logger.Error("Redis set failed", "key", key, "error", err)
+	}
+}
+
+func (c *redisCache) Delete(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	if err := c.client.Del(ctx, c.prefix+key).Err(); err != nil {
+		logger.Error("Redis delete failed", "key", key, "error", err)
+	}
+}
+
+// IE: SCAN instead of KEYS, the instance must keep serving while we iterate
+func (c *redisCache) DeletePrefix(prefix string) int {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*c.timeout)
+	defer cancel()
+
+	deleted := 0
+	iter := c.client.Scan(ctx, 0, c.prefix+escapeRedisPattern(prefix)+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		if err := c.client.Del(ctx, iter.Val()).Err(); err != nil {
+			logger.Error("Redis delete failed", "key", iter.Val(), "error", err)
+			continue
+		}
+		deleted++
+	}
+	if err := iter.Err(); err != nil {
+		logger.Error("Redis scan failed", "prefix", prefix, "error", err)
+	}
+	return deleted
+}
+
+// IE: two extra round trips per key, fine for an operator endpoint
+func (c *redisCache) Entries(prefix string) []CacheEntryInfo {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*c.timeout)
+	defer cancel()
+
+	now := time.Now()
+	var entries []CacheEntryInfo
+	iter := c.client.Scan(ctx, 0, c.prefix+escapeRedisPattern(prefix)+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		size, err := c.client.StrLen(ctx, iter.Val()).Result()
+		if err != nil {
+			continue
+		}
+		ttl, err := c.client.PTTL(ctx, iter.Val()).Result()
+		if err != nil {
+			continue
+		}
+		var expires time.Time
+		if ttl > 0 {
+			expires = now.Add(ttl)
+		}
+		entries = append(entries, newCacheEntryInfo(strings.TrimPrefix(iter.Val(), c.prefix), int(size), now, time.Time{}, expires))
+	}
+	if err := iter.Err(); err != nil {
+		logger.Error("Redis scan failed", "prefix", prefix, "error", err)
+	}
+	return entries
+}
+
+// IE: keys are matched as globs by SCAN, escape whatever redis would interpret
+func escapeRedisPattern(s string) string {
+	return redisPatternEscaper.Replace(s)
+}
+
+var redisPatternEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+// IE: the instance may be shared with other services, so no DBSIZE
+func (c *redisCache) Stats() CacheStats {
+	return c.stats(CacheBackendRedis, -1)
+}
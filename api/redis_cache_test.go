@@ -0,0 +1,48 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisCacheRoundTrip(t *testing.T) {
+	server := miniredis.RunT(t)
+	New()
+
+	cache, err := newRedisCache("redis://" + server.Addr())
+	require.Nil(t, err)
+
+	_, found := cache.Get("tree:react@16.13.0")
+	assert.False(t, found)
+
+	cache.Set("tree:react@16.13.0", []byte(`{"name":"react"}`), time.Minute)
+
+	value, found := cache.Get("tree:react@16.13.0")
+	assert.True(t, found)
+	assert.Equal(t, []byte(`{"name":"react"}`), value)
+
+	// IE: keys are namespaced so the instance can be shared with other services
+	assert.True(t, server.Exists("deps:tree:react@16.13.0"))
+
+	server.FastForward(2 * time.Minute)
+	_, found = cache.Get("tree:react@16.13.0")
+	assert.False(t, found)
+}
+
+func TestRedisCachePackuments(t *testing.T) {
+	server := miniredis.RunT(t)
+	New(WithCacheBackend(CacheBackendRedis, "redis://"+server.Addr()))
+
+	cachePackageMeta("left-pad", &npmPackageMetaResponse{Versions: map[string]npmPackageResponse{
+		"1.3.0": {Name: "left-pad", Version: "1.3.0"},
+	}})
+
+	meta, found := cachedPackageMeta("left-pad")
+	require.True(t, found)
+	assert.Contains(t, meta.Versions, "1.3.0")
+	assert.True(t, server.Exists("deps:"+packumentKeyPrefix+"left-pad"))
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Registry answers the registry documents the resolver reads, as the JSON the
+// npm registry serves, i.e. to resolve from another source or offline in
+// tests. The tarballs, signatures and advisories are still downloaded from the
+// urls in the documents and from the registry URL, when asked for.
+type Registry interface {
+	// Packument answers the document listing every version of name, an error
+	// wrapping ErrPackageNotFound when there is no such package.
+	Packument(ctx context.Context, name string) ([]byte, error)
+	// Version answers the document of name at version, always a concrete one.
+	Version(ctx context.Context, name, version string) ([]byte, error)
+}
+
+// IE: the registry of WithRegistryURL, unless WithRegistry replaces it
+type httpRegistry struct{}
+
+func registry() Registry {
+	if opts.registry != nil {
+		return opts.registry
+	}
+	return httpRegistry{}
+}
+
+func (httpRegistry) Version(ctx context.Context, name, version string) ([]byte, error) {
+	resp, err := httpGet(ctx, fmt.Sprintf("%s/%s/%s", live().registryURL, name, version))
+	if err != nil {
+		return nil, upstreamError(ctx, err)
+	}
+
+	// IE: I would honestly close the stream right after io.ReadAll
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: unexpected status %d for package %s version %s", ErrRegistryUnavailable, resp.StatusCode, name, version)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		// IE: log the error
+		loggerFrom(ctx).Error("Could not read version document", "name", name, "version", version, "error", err)
+		return nil, err
+	}
+	return body, nil
+}
+
+func (httpRegistry) Packument(ctx context.Context, p string) ([]byte, error) {
+	registry := live().registryURL
+	resp, err := httpGet(ctx, fmt.Sprintf("%s/%s", registry, p))
+	if err != nil {
+		// IE: log the error
+		loggerFrom(ctx).Error("Registry call failed", "registry", registry, "name", p, "error", err)
+		return nil, upstreamError(ctx, err)
+	}
+
+	// IE: I would honestly close the stream right after io.ReadAll
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrPackageNotFound, p)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: unexpected status %d for package %s", ErrRegistryUnavailable, resp.StatusCode, p)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		// IE: log the error
+		loggerFrom(ctx).Error("Could not read packument", "name", p, "error", err)
+		return nil, err
+	}
+	return body, nil
+}
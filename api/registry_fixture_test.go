@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/snyk/snyk-code-review-exercise/internal/fixtures"
+)
+
+// IE: in-process registry serving fixtures, counting the calls it gets
+type fakeRegistry struct {
+	*httptest.Server
+	calls    int64
+	inFlight int64
+	peak     int64
+
+	// IE: set before the first request, slows every response down so concurrent requests overlap
+	delay time.Duration
+}
+
+func newFakeRegistry(t testing.TB, packages fixtures.Registry) *fakeRegistry {
+	registry := &fakeRegistry{}
+	registry.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&registry.calls, 1)
+		inFlight := atomic.AddInt64(&registry.inFlight, 1)
+		defer atomic.AddInt64(&registry.inFlight, -1)
+		for peak := atomic.LoadInt64(&registry.peak); inFlight > peak; peak = atomic.LoadInt64(&registry.peak) {
+			if atomic.CompareAndSwapInt64(&registry.peak, peak, inFlight) {
+				break
+			}
+		}
+		time.Sleep(registry.delay)
+
+		packages.ServeHTTP(w, r)
+	}))
+	t.Cleanup(registry.Close)
+	return registry
+}
+
+// IE: registries recorded under testdata/registry, trimmed down to the dependencies
+func loadRegistryFixture(t testing.TB, name string) fixtures.Registry {
+	registry, err := fixtures.Load(filepath.Join("testdata", "registry", name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return registry
+}
+
+func (r *fakeRegistry) Calls() int64 {
+	return atomic.LoadInt64(&r.calls)
+}
+
+// IE: highest number of requests the registry served at the same time
+func (r *fakeRegistry) PeakInFlight() int64 {
+	return atomic.LoadInt64(&r.peak)
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/snyk/snyk-code-review-exercise/internal/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// IE: the documents of a fixtures.Registry without a server in between
+type memoryRegistry struct {
+	packages fixtures.Registry
+	calls    int32
+}
+
+func (m *memoryRegistry) document(path string) ([]byte, error) {
+	atomic.AddInt32(&m.calls, 1)
+	rec := httptest.NewRecorder()
+	m.packages.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+	if rec.Code == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrPackageNotFound, path)
+	}
+	return rec.Body.Bytes(), nil
+}
+
+func (m *memoryRegistry) Packument(_ context.Context, name string) ([]byte, error) {
+	return m.document("/" + name)
+}
+
+func (m *memoryRegistry) Version(_ context.Context, name, version string) ([]byte, error) {
+	return m.document("/" + name + "/" + version)
+}
+
+func TestWithRegistry(t *testing.T) {
+	registry := &memoryRegistry{packages: fixtures.Registry{
+		"app":  {"1.0.0": {"a": "^1.0.0", "@s/b": "^1.0.0"}},
+		"a":    {"1.0.0": nil, "1.1.0": nil},
+		"@s/b": {"1.0.0": {"a": "^1.0.0"}},
+	}}
+	// IE: nothing answers there, every document has to come from registry
+	handler := New(WithRegistryURL("http://127.0.0.1:1"), WithRegistry(registry))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0", nil))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var tree NpmPackageVersion
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &tree))
+	assert.Equal(t, "1.1.0", tree.Dependencies["a"].Version)
+	assert.Equal(t, "1.1.0", tree.Dependencies["@s/b"].Dependencies["a"].Version)
+	assert.NotZero(t, atomic.LoadInt32(&registry.calls))
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/missing/1.0.0", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code, rec.Body.String())
+}
+
+func TestWithRegistryErrors(t *testing.T) {
+	New(WithRegistry(registryFunc(func() error { return errors.New("offline") })))
+
+	_, err := fetchPackageMeta(context.Background(), "left-pad")
+	assert.ErrorContains(t, err, "offline")
+	_, err = fetchPackage(context.Background(), "left-pad", "1.3.0")
+	assert.ErrorContains(t, err, "offline")
+}
+
+// IE: a registry failing every call with err()
+type registryFunc func() error
+
+func (f registryFunc) Packument(context.Context, string) ([]byte, error) { return nil, f() }
+
+func (f registryFunc) Version(context.Context, string, string) ([]byte, error) { return nil, f() }
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// IE: the settings Reload may change while serving. Requests read them through
+// live(), all at once, so none of them sees half of a reload
+type liveSettings struct {
+	registryURL string
+	concurrency int
+	maxInFlight int
+	maxNodes    int
+	maxDepth    int
+
+	cacheTTL     time.Duration
+	staleWindow  time.Duration
+	packumentTTL time.Duration
+	versionTTL   time.Duration
+	negativeTTL  time.Duration
+}
+
+var settings atomic.Pointer[liveSettings]
+
+func live() *liveSettings {
+	if s := settings.Load(); s != nil {
+		return s
+	}
+	// IE: before the first New(), i.e. the funcs of a test calling them directly
+	return liveSettingsOf(&opts)
+}
+
+func liveSettingsOf(o *options) *liveSettings {
+	return &liveSettings{
+		registryURL:  o.registryURL,
+		concurrency:  o.concurrency,
+		maxInFlight:  o.maxInFlight,
+		maxNodes:     o.maxNodes,
+		maxDepth:     o.maxDepth,
+		cacheTTL:     o.cacheTTL,
+		staleWindow:  o.staleWindow,
+		packumentTTL: o.packumentTTL,
+		versionTTL:   o.versionTTL,
+		negativeTTL:  o.negativeTTL,
+	}
+}
+
+// Reload applies the registry URL, concurrency, upstream concurrency, max in
+// flight, max nodes, max depth and cache TTLs of optFns to the running API,
+// keeping its caches. The resolutions already running pick the new registry
+// and TTLs up from their next upstream call on. Other options are ignored,
+// they need a New().
+func Reload(optFns ...Option) error {
+	// IE: a copy, opts itself is only written by New()
+	next := opts
+	for _, o := range optFns {
+		o(&next)
+	}
+	if (next.upstreamLimit > 0) != (upstreamLimiter != nil) {
+		return errors.New("upstream concurrency can't be turned on or off without a restart")
+	}
+
+	upstreamLimiter.setMax(next.upstreamLimit)
+	previous := live()
+	settings.Store(liveSettingsOf(&next))
+	// IE: another registry signs with other keys
+	if next.registryURL != previous.registryURL {
+		resetRegistryKeys()
+	}
+	logger.Info("Reloaded settings", "registry", next.registryURL, "concurrency", next.concurrency,
+		"upstream_concurrency", next.upstreamLimit, "max_in_flight", next.maxInFlight)
+	return nil
+}
+
+// IE: POST only, reloading isn't something a crawler should trigger
+func reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if opts.reloader == nil {
+		http.Error(w, "reloading isn't set up", http.StatusNotImplemented)
+		return
+	}
+	if err := opts.reloader(); err != nil {
+		logger.Error("Could not reload settings", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
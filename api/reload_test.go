@@ -0,0 +1,104 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloadKeepsCaches(t *testing.T) {
+	old := newFakeRegistry(t, map[string]map[string]map[string]string{
+		"a": {"1.0.0": nil},
+	})
+	handler := New(WithRegistryURL(old.URL), WithConcurrency(4))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/a/1.0.0", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	moved := newFakeRegistry(t, map[string]map[string]map[string]string{
+		"b": {"1.0.0": nil},
+	})
+	require.Nil(t, Reload(WithRegistryURL(moved.URL), WithConcurrency(8), WithUpstreamConcurrency(16), WithResponseCache(1, time.Hour)))
+	assert.Equal(t, moved.URL, live().registryURL)
+	assert.Equal(t, 8, live().concurrency)
+	assert.Equal(t, time.Hour, live().cacheTTL)
+	assert.Equal(t, 16, upstreamLimiter.Limit())
+
+	// IE: still cached, the new registry doesn't know a
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/a/1.0.0", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, cacheStatusHit, rec.Header().Get("X-Cache-Status"))
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/b/1.0.0", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestReloadMaxInFlight(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/slow") {
+			entered <- struct{}{}
+			<-release
+		}
+		http.NotFound(w, r)
+	}))
+	defer registry.Close()
+	handler := New(WithRegistryURL(registry.URL), WithMaxInFlight(0))
+
+	require.Nil(t, Reload(WithRegistryURL(registry.URL), WithMaxInFlight(1)))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/package/slow/1.0.0", nil))
+	}()
+	<-entered
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/other/1.0.0", nil))
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	close(release)
+	<-done
+}
+
+func TestReloadRejectsTogglingUpstreamLimit(t *testing.T) {
+	New(WithUpstreamConcurrency(0))
+	assert.NotNil(t, Reload(WithUpstreamConcurrency(8)))
+
+	New()
+	assert.NotNil(t, Reload(WithUpstreamConcurrency(0)))
+}
+
+func TestReloadHandler(t *testing.T) {
+	New()
+	rec := httptest.NewRecorder()
+	AdminHandler().ServeHTTP(rec, httptest.NewRequest("POST", "/debug/reload", nil))
+	assert.Equal(t, http.StatusNotImplemented, rec.Code)
+
+	var reloads int
+	var failure error
+	New(WithReloader(func() error {
+		reloads++
+		return failure
+	}))
+	rec = httptest.NewRecorder()
+	AdminHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/reload", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	rec = httptest.NewRecorder()
+	AdminHandler().ServeHTTP(rec, httptest.NewRequest("POST", "/debug/reload", nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	failure = errors.New("invalid -cache-ttl")
+	rec = httptest.NewRecorder()
+	AdminHandler().ServeHTTP(rec, httptest.NewRequest("POST", "/debug/reload", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid -cache-ttl")
+	assert.Equal(t, 2, reloads)
+}
@@ -0,0 +1,228 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/sync/errgroup"
+)
+
+const reportRoute = "report"
+
+// IE: the routes resolving trees share their limits, told apart past them
+func resolvingHandler(w http.ResponseWriter, r *http.Request) {
+	route := mux.CurrentRoute(r)
+	switch {
+	case route != nil && route.GetName() == reportRoute:
+		reportHandler(w, r)
+	case route != nil && route.GetName() == driftRoute:
+		driftHandler(w, r)
+	case route != nil && route.GetName() == trendRoute:
+		trendHandler(w, r)
+	default:
+		packageHandler(w, r)
+	}
+}
+
+// IE: the analysis of a resolved tree served by /package/{package}/{version}/report,
+// a field per section, the ones not asked for are left out
+type treeReport struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+
+	HeaviestPaths     []heavyDependency      `json:"heaviestPaths,omitempty"`
+	Dedupe            []dedupeSuggestion     `json:"dedupe,omitempty"`
+	LicenseViolations []licenseViolation     `json:"licenseViolations,omitempty"`
+	Outdated          *outdatedReport        `json:"outdated,omitempty"`
+	Footprint         *diskFootprint         `json:"footprint,omitempty"`
+	Abandoned         []abandonedPackage     `json:"abandoned,omitempty"`
+	BusFactor         *busFactorReport       `json:"busFactor,omitempty"`
+	InstallScripts    []installScriptPackage `json:"installScripts,omitempty"`
+	ModuleFormats     *moduleFormatReport    `json:"moduleFormats,omitempty"`
+	Engines           *engineMatrix          `json:"engines,omitempty"`
+	Upgrade           *upgradeReport         `json:"upgrade,omitempty"`
+}
+
+// IE: name -> builder, in no particular order, a section only reads the tree
+// and fills its own field in
+var reportSections = map[string]func(ctx context.Context, tree *NpmPackageVersion, query url.Values, report *treeReport) error{
+	"heaviest-paths":  heaviestPathsSection,
+	"dedupe":          dedupeSection,
+	"licenses":        licensesSection,
+	"outdated":        outdatedSection,
+	"footprint":       footprintSection,
+	"abandoned":       abandonedSection,
+	"bus-factor":      busFactorSection,
+	"install-scripts": installScriptsSection,
+	"module-formats":  moduleFormatSection,
+	"engines":         enginesSection,
+	"upgrade":         upgradeSection,
+}
+
+// IE: every section when ?sections= is left out
+func requestSections(query url.Values) ([]string, error) {
+	value := strings.TrimSpace(query.Get("sections"))
+	if value == "" {
+		sections := make([]string, 0, len(reportSections))
+		for name := range reportSections {
+			sections = append(sections, name)
+		}
+		return sections, nil
+	}
+
+	var sections []string
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, found := reportSections[name]; !found {
+			return nil, fmt.Errorf("%w: unknown report section %q", ErrInvalidQuery, name)
+		}
+		sections = append(sections, name)
+	}
+	return sections, nil
+}
+
+func reportHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	vars := mux.Vars(r)
+	pkgName, pkgVersion := vars["package"], vars["version"]
+
+	log := requestLogger(r, pkgName, pkgVersion)
+	r = r.WithContext(withLogger(r.Context(), log))
+	if err := checkPackageInput(pkgName, pkgVersion); err != nil {
+		httpError(w, r, err)
+		return
+	}
+	tracePackageRequest(r.Context(), pkgName, pkgVersion)
+	tagErrors(r.Context(), r, pkgName, pkgVersion)
+
+	query := r.URL.Query()
+	sections, err := requestSections(query)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+
+	ctx, _ := requestResolutionStats(r.Context())
+	tree, release, status, err := loadTree(ctx, pkgName, pkgVersion, query)
+	if err != nil {
+		writeResolveError(w, r, err)
+		return
+	}
+	defer release()
+
+	report := &treeReport{Name: tree.Name, Version: tree.Version}
+	for _, section := range sections {
+		if err := reportSections[section](ctx, tree, query, report); err != nil {
+			writeResolveError(w, r, fmt.Errorf("report section %s: %w", section, err))
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache-Status", status)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Debug("Could not write response", "error", err)
+	}
+	log.Info("Report completed", "duration", time.Since(start), "cache", status, "sections", sections)
+}
+
+// IE: the tree the package route would answer, cached on the way when it had
+// to be resolved. The format and annotations of the route don't apply to reports
+func loadTree(ctx context.Context, pkgName, pkgVersion string, query url.Values) (*NpmPackageVersion, func(), string, error) {
+	treeQuery := url.Values{}
+	for param, values := range query {
+		if param != "format" && param != "stats" && param != "maintenance" {
+			treeQuery[param] = values
+		}
+	}
+
+	tree, err := cachedTree(ctx, pkgName, pkgVersion, treeQuery)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if tree.root == nil {
+		root := &NpmPackageVersion{}
+		if err := decodeJSON(tree.cached, root); err != nil {
+			return nil, nil, "", err
+		}
+		recordCachedResolution(pkgVersion, treeQuery, root, nil)
+		return root, func() {}, tree.status, nil
+	}
+	if _, err := streamAndCacheTree(io.Discard, tree.cacheKey, tree.root); err != nil {
+		releaseTree(tree.root)
+		return nil, nil, "", err
+	}
+	return tree.root, func() { releaseTree(tree.root) }, tree.status, nil
+}
+
+// IE: one node per name@version, for the sections about the packages rather
+// than about where they show up. A cycle or the depth limit cuts some of the
+// nodes of a version, the one with the most dependencies is kept
+func uniqueVersions(root *NpmPackageVersion) map[string]*NpmPackageVersion {
+	unique := make(map[string]*NpmPackageVersion)
+	stack := []*NpmPackageVersion{root}
+	for len(stack) > 0 {
+		pkg := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		key := pkg.Name + "@" + pkg.Version
+		if kept, found := unique[key]; !found || len(pkg.Dependencies) > len(kept.Dependencies) {
+			unique[key] = pkg
+		}
+		for _, dep := range pkg.Dependencies {
+			if dep != nil {
+				stack = append(stack, dep)
+			}
+		}
+	}
+	return unique
+}
+
+// IE: name@version -> the paths from the root down to it, in dependency name
+// order, limit of them at most
+func pathsTo(root *NpmPackageVersion, keys map[string]bool, limit int) map[string][][]string {
+	paths := make(map[string][][]string, len(keys))
+	var walk func(pkg *NpmPackageVersion, path []string)
+	walk = func(pkg *NpmPackageVersion, path []string) {
+		key := pkg.Name + "@" + pkg.Version
+		path = append(path, key)
+		if keys[key] && len(paths[key]) < limit {
+			paths[key] = append(paths[key], append([]string(nil), path...))
+		}
+		for _, dep := range sortedDependencies(pkg) {
+			walk(dep, path)
+		}
+	}
+	walk(root, nil)
+	return paths
+}
+
+// IE: the version documents were fetched (and cached) while resolving, a tree
+// served from cache may need them fetched again
+func versionDocuments(ctx context.Context, root *NpmPackageVersion) (map[string]*npmPackageResponse, error) {
+	unique := uniqueVersions(root)
+	docs := make(map[string]*npmPackageResponse, len(unique))
+	var mu sync.Mutex
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(live().concurrency, 1))
+	for key, pkg := range unique {
+		g.Go(func() error {
+			doc, err := fetchPackage(ctx, pkg.Name, pkg.Version)
+			if err != nil {
+				return fmt.Errorf("fetching package %s: %w", key, err)
+			}
+			mu.Lock()
+			docs[key] = doc
+			mu.Unlock()
+			return nil
+		})
+	}
+	return docs, g.Wait()
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// IE: ids sent by clients end up in logs and response bodies, anything longer or
+// with other characters is replaced by a generated one
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// IE: a proxy in front (or the client) may already have set one, it is kept then
+// so the same id traces the request through every hop
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		log := loggerFrom(ctx).With("request_id", id)
+		// IE: from the logs to the trace of the request, when it is sampled
+		if span := trace.SpanContextFromContext(ctx); span.IsSampled() {
+			log = log.With("trace_id", span.TraceID().String())
+		}
+		ctx = withLogger(ctx, log)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-' || c == '_' || c == '.' || c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	var id [16]byte
+	// IE: crypto/rand never fails on the supported platforms
+	_, _ = rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
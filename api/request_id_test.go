@@ -0,0 +1,89 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestIDIsGeneratedOrPropagated(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{
+		"a": {"1.0.0": nil},
+	})
+	handler := New(WithRegistryURL(registry.URL))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/a/1.0.0", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	generated := rec.Header().Get(requestIDHeader)
+	assert.Len(t, generated, 32)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/a/1.0.0", nil))
+	assert.NotEqual(t, generated, rec.Header().Get(requestIDHeader))
+
+	req := httptest.NewRequest("GET", "/package/a/1.0.0", nil)
+	req.Header.Set(requestIDHeader, "edge-1234")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, "edge-1234", rec.Header().Get(requestIDHeader))
+
+	// IE: would end up as is in the logs
+	req = httptest.NewRequest("GET", "/package/a/1.0.0", nil)
+	req.Header.Set(requestIDHeader, "forged\nlevel=ERROR")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Len(t, rec.Header().Get(requestIDHeader), 32)
+}
+
+func TestRequestIDInLogsAndErrors(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{
+		"app": {"1.0.0": {"missing": "^1.0.0"}},
+	})
+	var buf bytes.Buffer
+	l, err := NewLogger(&buf, LogFormatJSON, slog.LevelDebug)
+	require.Nil(t, err)
+	handler := New(WithRegistryURL(registry.URL), WithLogger(l))
+
+	req := httptest.NewRequest("GET", "/package/app/1.0.0", nil)
+	req.Header.Set(requestIDHeader, "trace-me")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	var payload errorPayload
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &payload))
+	assert.Equal(t, "trace-me", payload.RequestID)
+
+	// IE: the lines of the resolver workers included
+	var traced int
+	for _, record := range readLogRecords(t, &buf) {
+		if record["package"] == "app" {
+			assert.Equal(t, "trace-me", record["request_id"], record["msg"])
+			traced++
+		}
+	}
+	assert.Greater(t, traced, 2)
+
+	req = httptest.NewRequest("GET", "/package/app/1.0.0?format=ndjson", nil)
+	req.Header.Set(requestIDHeader, "trace-me-too")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	lines := readNDJSON(t, rec.Body.String())
+	require.Len(t, lines, 2)
+	assert.Equal(t, "trace-me-too", lines[1]["requestId"])
+}
+
+func TestValidRequestID(t *testing.T) {
+	assert.True(t, validRequestID("0f8fad5b-d9cb-469f-a165-70867728950e"))
+	assert.True(t, validRequestID("edge:1.2_3"))
+	assert.False(t, validRequestID(""))
+	assert.False(t, validRequestID("with space"))
+	assert.False(t, validRequestID(strings.Repeat("a", maxRequestIDLength+1)))
+}
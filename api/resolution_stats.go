@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// IE: trailer of the package responses, the stats are only complete once the body is written
+const resolutionStatsHeader = "X-Resolution-Stats"
+
+// IE: progress of a single request, updated by its resolver and by every
+// upstream call made on its behalf (cache key normalization included)
+type resolutionStats struct {
+	goroutines    int64
+	resolved      int64
+	pending       int64
+	inFlight      int64
+	upstreamCalls int64
+}
+
+type resolutionSnapshot struct {
+	Goroutines    int64 `json:"goroutines"`
+	Resolved      int64 `json:"resolved"`
+	Pending       int64 `json:"pending"`
+	InFlight      int64 `json:"inFlight"`
+	UpstreamCalls int64 `json:"upstreamCalls"`
+}
+
+func (s *resolutionStats) snapshot() resolutionSnapshot {
+	return resolutionSnapshot{
+		Goroutines:    atomic.LoadInt64(&s.goroutines),
+		Resolved:      atomic.LoadInt64(&s.resolved),
+		Pending:       atomic.LoadInt64(&s.pending),
+		InFlight:      atomic.LoadInt64(&s.inFlight),
+		UpstreamCalls: atomic.LoadInt64(&s.upstreamCalls),
+	}
+}
+
+// IE: same key=value list as Server-Timing, easy on curl -v and on parsers
+func (s resolutionSnapshot) String() string {
+	return fmt.Sprintf("goroutines=%d, resolved=%d, pending=%d, in-flight=%d, upstream-calls=%d",
+		s.Goroutines, s.Resolved, s.Pending, s.InFlight, s.UpstreamCalls)
+}
+
+type resolutionStatsKey struct{}
+
+func withResolutionStats(ctx context.Context, stats *resolutionStats) context.Context {
+	return context.WithValue(ctx, resolutionStatsKey{}, stats)
+}
+
+// IE: nil outside of a request, i.e. warm-up and background refreshes
+func resolutionStatsFrom(ctx context.Context) *resolutionStats {
+	stats, _ := ctx.Value(resolutionStatsKey{}).(*resolutionStats)
+	return stats
+}
+
+// IE: the one of the audit log when it records the request, a fresh one otherwise
+func requestResolutionStats(ctx context.Context) (context.Context, *resolutionStats) {
+	if stats := resolutionStatsFrom(ctx); stats != nil {
+		return ctx, stats
+	}
+	stats := &resolutionStats{}
+	return withResolutionStats(ctx, stats), stats
+}
+
+func countUpstreamCall(ctx context.Context) {
+	if stats := resolutionStatsFrom(ctx); stats != nil {
+		atomic.AddInt64(&stats.upstreamCalls, 1)
+	}
+}
+
+// IE: resolutions currently running, for /debug/resolutions
+var activeResolutions sync.Map
+
+type activeResolution struct {
+	Package   string             `json:"package"`
+	Version   string             `json:"version"`
+	StartedAt time.Time          `json:"startedAt"`
+	ElapsedMs int64              `json:"elapsedMs"`
+	Stats     resolutionSnapshot `json:"stats"`
+}
+
+func trackResolution(r *resolver, root *resolveTask) func() {
+	r.startedAt = time.Now()
+	r.rootName, r.rootVersion = root.pkg.Name, root.constraint
+	activeResolutions.Store(r, struct{}{})
+	return func() { activeResolutions.Delete(r) }
+}
+
+// IE: longest running first, those are the ones worth looking at
+func resolutionsHandler(w http.ResponseWriter, r *http.Request) {
+	resolutions := []activeResolution{}
+	activeResolutions.Range(func(key, _ interface{}) bool {
+		res := key.(*resolver)
+		resolutions = append(resolutions, activeResolution{
+			Package:   res.rootName,
+			Version:   res.rootVersion,
+			StartedAt: res.startedAt,
+			ElapsedMs: time.Since(res.startedAt).Milliseconds(),
+			Stats:     res.stats.snapshot(),
+		})
+		return true
+	})
+	sort.Slice(resolutions, func(i, j int) bool {
+		return resolutions[i].StartedAt.Before(resolutions[j].StartedAt)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resolutions); err != nil {
+		logger.Error("Could not write in-flight resolutions", "error", err)
+	}
+}
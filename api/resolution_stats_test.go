@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPackageHandlerReportsResolutionStats(t *testing.T) {
+	registry := newFakeRegistry(t, loadRegistryFixture(t, "react-16.13.0"))
+	server := httptest.NewServer(New(WithRegistryURL(registry.URL), WithConcurrency(4)))
+	defer server.Close()
+
+	get := func() string {
+		resp, err := server.Client().Get(server.URL + "/package/react/16.13.0")
+		require.Nil(t, err)
+		defer resp.Body.Close()
+		_, err = io.Copy(io.Discard, resp.Body)
+		require.Nil(t, err)
+		return resp.Trailer.Get(resolutionStatsHeader)
+	}
+
+	calls := registry.Calls()
+	stats := get()
+	assert.Regexp(t, `^goroutines=\d+, resolved=\d+, pending=0, in-flight=0, upstream-calls=\d+$`, stats)
+	assert.NotContains(t, stats, "resolved=0")
+	assert.Contains(t, stats, "upstream-calls="+strconv.FormatInt(registry.Calls()-calls, 10))
+
+	// IE: served from the cache, nothing resolved
+	assert.Equal(t, "goroutines=0, resolved=0, pending=0, in-flight=0, upstream-calls=0", get())
+}
+
+func TestResolutionsHandlerListsResolutionsInFlight(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	New(WithRegistryURL(server.URL))
+
+	done := make(chan struct{})
+	go func() {
+		_, _ = resolveTree(context.Background(), "slow", "1.0.0", 0)
+		close(done)
+	}()
+
+	var resolutions []activeResolution
+	assert.Eventually(t, func() bool {
+		rec := httptest.NewRecorder()
+		AdminHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/resolutions", nil))
+		resolutions = nil
+		_ = json.Unmarshal(rec.Body.Bytes(), &resolutions)
+		return len(resolutions) == 1 && resolutions[0].Stats.InFlight == 1
+	}, time.Second, 10*time.Millisecond)
+	require.Len(t, resolutions, 1)
+	assert.Equal(t, "slow", resolutions[0].Package)
+	assert.Equal(t, int64(1), resolutions[0].Stats.UpstreamCalls)
+
+	close(release)
+	<-done
+	running := 0
+	activeResolutions.Range(func(_, _ interface{}) bool {
+		running++
+		return true
+	})
+	assert.Equal(t, 0, running)
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func resolveTreeJSON(t *testing.T, name, version string, maxDepth int) string {
+	tree, err := resolveTree(context.Background(), name, version, maxDepth)
+	require.Nil(t, err)
+
+	encoded, err := json.Marshal(tree)
+	require.Nil(t, err)
+	return string(encoded)
+}
+
+func TestResolveTreeMatchesFixture(t *testing.T) {
+	registry := newFakeRegistry(t, loadRegistryFixture(t, "react-16.13.0"))
+	New(WithRegistryURL(registry.URL))
+
+	tree := resolveTreeJSON(t, "react", "16.13.0", 0)
+
+	fixture, err := os.ReadFile(filepath.Join("testdata", "react-16.13.0.json"))
+	require.Nil(t, err)
+
+	assert.JSONEq(t, string(fixture), tree)
+}
+
+func TestResolveTreeReusesSubtrees(t *testing.T) {
+	registry := newFakeRegistry(t, loadRegistryFixture(t, "react-16.13.0"))
+	New(WithRegistryURL(registry.URL))
+
+	_, err := resolveTree(context.Background(), "react", "16.13.0", 0)
+	require.Nil(t, err)
+	calls := registry.Calls()
+
+	// IE: prop-types@15.8.1 was fully resolved as part of react, only its packument is needed
+	tree := resolveTreeJSON(t, "prop-types", "^15.8.0", 0)
+	assert.Contains(t, tree, `"react-is"`)
+	assert.Equal(t, calls, registry.Calls())
+}
+
+func TestResolveTreeStopsOnCycles(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{
+		"a": {"1.0.0": {"b": "^1.0.0"}},
+		"b": {"1.0.0": {"a": "^1.0.0"}},
+	})
+	New(WithRegistryURL(registry.URL))
+
+	tree := resolveTreeJSON(t, "a", "1.0.0", 0)
+
+	assert.JSONEq(t, `{
+		"name": "a", "version": "1.0.0", "dependencies": {
+			"b": {"name": "b", "version": "1.0.0", "dependencies": {
+				"a": {"name": "a", "version": "1.0.0", "dependencies": {}}
+			}}
+		}
+	}`, tree)
+
+	// IE: b's subtree was cut by the cycle, it must not be reused as is
+	_, found := newResolver(0).getCachedDeps("b@1.0.0")
+	assert.False(t, found)
+}
+
+func TestResolveTreeLimitsDepth(t *testing.T) {
+	registry := newFakeRegistry(t, loadRegistryFixture(t, "react-16.13.0"))
+	New(WithRegistryURL(registry.URL))
+
+	tree := resolveTreeJSON(t, "react", "16.13.0", 1)
+
+	assert.JSONEq(t, `{
+		"name": "react", "version": "16.13.0", "dependencies": {
+			"loose-envify": {"name": "loose-envify", "version": "1.4.0", "dependencies": {}},
+			"object-assign": {"name": "object-assign", "version": "4.1.1", "dependencies": {}},
+			"prop-types": {"name": "prop-types", "version": "15.8.1", "dependencies": {}}
+		}
+	}`, tree)
+
+	// IE: cut subtrees must not be reused by unlimited requests
+	_, found := newResolver(0).getCachedDeps("prop-types@15.8.1")
+	assert.False(t, found)
+}
+
+func TestResolveTreeConcurrentRequests(t *testing.T) {
+	registry := newFakeRegistry(t, loadRegistryFixture(t, "react-16.13.0"))
+	registry.delay = time.Millisecond
+	New(WithRegistryURL(registry.URL))
+
+	fixture, err := os.ReadFile(filepath.Join("testdata", "react-16.13.0.json"))
+	require.Nil(t, err)
+
+	// IE: each request has its own resolver, none of them may see a half resolved tree of another
+	var wg sync.WaitGroup
+	trees := make([]*NpmPackageVersion, 8)
+	errs := make([]error, len(trees))
+	for i := range trees {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			trees[i], errs[i] = resolveTree(context.Background(), "react", "16.13.0", 0)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range trees {
+		require.Nil(t, errs[i])
+		tree, err := json.Marshal(trees[i])
+		require.Nil(t, err)
+		assert.JSONEq(t, string(fixture), string(tree))
+	}
+}
+
+func TestResolveTreeNodeBudget(t *testing.T) {
+	packages := map[string]map[string]map[string]string{
+		"wide": {"1.0.0": {}},
+		"leaf": {"1.0.0": nil},
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		packages["wide"]["1.0.0"][name] = "^1.0.0"
+		packages[name] = map[string]map[string]string{"1.0.0": {"leaf": "^1.0.0"}}
+	}
+	registry := newFakeRegistry(t, packages)
+	handler := New(WithRegistryURL(registry.URL), WithMaxNodes(5), WithConcurrency(1))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/wide/1.0.0", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "true", rec.Header().Get("X-Partial-Tree"))
+
+	var root NpmPackageVersion
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &root))
+	assert.True(t, root.Partial)
+	require.Len(t, root.Dependencies, 3)
+	// IE: the root and its 3 dependencies, then room for one more leaf only
+	expanded := 0
+	for _, dep := range root.Dependencies {
+		expanded += len(dep.Dependencies)
+		assert.False(t, dep.Partial)
+	}
+	assert.Equal(t, 1, expanded)
+
+	// IE: a partial tree is never served from the cache
+	_, found := responseCache.Get(treeCacheKey(context.Background(), "wide", "1.0.0", nil))
+	assert.False(t, found)
+
+	New(WithRegistryURL(registry.URL), WithMaxNodes(0))
+	tree := resolveTreeJSON(t, "wide", "1.0.0", 0)
+	assert.NotContains(t, tree, "partial")
+}
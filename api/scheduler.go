@@ -0,0 +1,193 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// IE: client of the jobs not started by a request (warm-up, revalidation, precomputation)
+const backgroundClient = "background"
+
+// IE: whom an upstream call is made for, carried by the context like the upstream limit of the tree
+type job struct {
+	client   string
+	priority int
+}
+
+type jobKey struct{}
+
+// IE: without fair scheduling every client shares a single queue, i.e. first come first served
+func withJob(ctx context.Context, client string) context.Context {
+	priority := clientPriority(client)
+	if !opts.fairScheduling {
+		client = ""
+	}
+	return context.WithValue(ctx, jobKey{}, job{client: client, priority: priority})
+}
+
+func jobFrom(ctx context.Context) job {
+	j, _ := ctx.Value(jobKey{}).(job)
+	return j
+}
+
+// IE: background work yields to requests unless configured otherwise
+func clientPriority(client string) int {
+	if priority, found := opts.clientPriorities[client]; found {
+		return priority
+	}
+	if client == backgroundClient {
+		return -1
+	}
+	return 0
+}
+
+// IE: the configured header when a trusted gateway names the client it calls
+// for, the subject of the token or of the client certificate otherwise, the
+// address without either. Any other caller can send the header, even an
+// authenticated one: rotating it would get around the rate limit, and a
+// privileged name would take that client's limit and priority
+func requestClient(r *http.Request) string {
+	subject := claimsSubject(r.Context())
+	if subject == "" {
+		subject = certificateSubject(r)
+	}
+	if subject == "" {
+		return clientIP(r)
+	}
+	if opts.clientHeader != "" && slices.Contains(opts.trustedGateways, subject) {
+		if client := strings.TrimSpace(r.Header.Get(opts.clientHeader)); client != "" {
+			return client
+		}
+	}
+	return subject
+}
+
+func identifyClient(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(withJob(r.Context(), requestClient(r))))
+	})
+}
+
+// ParseClientPriorities parses a comma separated list of client=priority
+// pairs, i.e. "dashboard=1,ci=-1", for WithClientPriorities.
+func ParseClientPriorities(value string) (map[string]int, error) {
+	priorities := make(map[string]int)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		client, priority, found := strings.Cut(pair, "=")
+		parsed, err := strconv.Atoi(strings.TrimSpace(priority))
+		if !found || strings.TrimSpace(client) == "" || err != nil {
+			return nil, fmt.Errorf("expected client=priority, got %q", pair)
+		}
+		priorities[strings.TrimSpace(client)] = parsed
+	}
+	return priorities, nil
+}
+
+// IE: an upstream call waiting for a slot, granted under the limiter lock
+type upstreamWaiter struct {
+	ready   chan struct{}
+	granted bool
+	client  *clientQueue
+}
+
+type clientQueue struct {
+	name    string
+	level   *priorityLevel
+	waiters []*upstreamWaiter
+}
+
+// IE: clients with waiting calls take turns, one call each, so a client
+// resolving a huge tree gets one slot in turn like everybody else instead of
+// the slots in proportion to its calls
+type priorityLevel struct {
+	priority int
+	turns    []*clientQueue
+	clients  map[string]*clientQueue
+}
+
+// IE: strict priorities between levels, round robin between the clients of a level
+type jobQueue struct {
+	levels []*priorityLevel
+	size   int
+}
+
+func (q *jobQueue) push(j job) *upstreamWaiter {
+	var level *priorityLevel
+	at := sort.Search(len(q.levels), func(i int) bool { return q.levels[i].priority <= j.priority })
+	if at < len(q.levels) && q.levels[at].priority == j.priority {
+		level = q.levels[at]
+	} else {
+		level = &priorityLevel{priority: j.priority, clients: make(map[string]*clientQueue)}
+		q.levels = append(q.levels, nil)
+		copy(q.levels[at+1:], q.levels[at:])
+		q.levels[at] = level
+	}
+
+	client, found := level.clients[j.client]
+	if !found {
+		client = &clientQueue{name: j.client, level: level}
+		level.clients[j.client] = client
+		level.turns = append(level.turns, client)
+	}
+
+	waiter := &upstreamWaiter{ready: make(chan struct{}), client: client}
+	client.waiters = append(client.waiters, waiter)
+	q.size++
+	return waiter
+}
+
+// IE: the first call of the client whose turn it is, in the highest priority level with any
+func (q *jobQueue) pop() *upstreamWaiter {
+	for _, level := range q.levels {
+		if len(level.turns) == 0 {
+			continue
+		}
+
+		client := level.turns[0]
+		waiter := client.waiters[0]
+		client.waiters[0] = nil
+		client.waiters = client.waiters[1:]
+		level.turns = level.turns[1:]
+		if len(client.waiters) > 0 {
+			level.turns = append(level.turns, client)
+		} else {
+			delete(level.clients, client.name)
+		}
+		q.size--
+		return waiter
+	}
+	return nil
+}
+
+// IE: the caller gave up before its turn came
+func (q *jobQueue) remove(waiter *upstreamWaiter) {
+	client := waiter.client
+	for i, w := range client.waiters {
+		if w == waiter {
+			client.waiters = append(client.waiters[:i], client.waiters[i+1:]...)
+			q.size--
+			break
+		}
+	}
+	if len(client.waiters) > 0 {
+		return
+	}
+
+	level := client.level
+	delete(level.clients, client.name)
+	for i, c := range level.turns {
+		if c == client {
+			level.turns = append(level.turns[:i], level.turns[i+1:]...)
+			break
+		}
+	}
+}
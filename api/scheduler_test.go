@@ -0,0 +1,121 @@
+package api
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobQueueTakesTurns(t *testing.T) {
+	var q jobQueue
+	names := map[*upstreamWaiter]string{}
+	push := func(client string, priority int, name string) {
+		names[q.push(job{client: client, priority: priority})] = name
+	}
+
+	for _, name := range []string{"big-1", "big-2", "big-3"} {
+		push("big", 0, name)
+	}
+	push("small", 0, "small-1")
+	push("other", 0, "other-1")
+	push(backgroundClient, -1, "background-1")
+	push("vip", 1, "vip-1")
+	removed := q.push(job{client: "small", priority: 0})
+	q.remove(removed)
+
+	var order []string
+	for waiter := q.pop(); waiter != nil; waiter = q.pop() {
+		order = append(order, names[waiter])
+	}
+	assert.Equal(t, []string{"vip-1", "big-1", "small-1", "other-1", "big-2", "big-3", "background-1"}, order)
+	assert.Equal(t, 0, q.size)
+}
+
+func TestAdaptiveLimiterServesClientsInTurn(t *testing.T) {
+	New()
+	limiter := newAdaptiveLimiter(1)
+	release, err := limiter.acquire(context.Background())
+	require.Nil(t, err)
+
+	granted := make(chan string, 4)
+	wait := func(client string, queued int) {
+		ctx := withJob(context.Background(), client)
+		go func() {
+			release, err := limiter.acquire(ctx)
+			if err == nil {
+				granted <- client
+				release()
+			}
+		}()
+		// IE: queue them in a known order
+		assert.Eventually(t, func() bool { return limiter.Queued() == queued }, time.Second, time.Millisecond)
+	}
+	wait("big", 1)
+	wait("big", 2)
+	wait("small", 3)
+
+	release()
+	var order []string
+	for i := 0; i < 3; i++ {
+		order = append(order, <-granted)
+	}
+	assert.Equal(t, []string{"big", "small", "big"}, order)
+}
+
+func TestAdaptiveLimiterDropsCancelledWaiters(t *testing.T) {
+	limiter := newAdaptiveLimiter(1)
+	release, err := limiter.acquire(context.Background())
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = limiter.acquire(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 0, limiter.Queued())
+
+	release()
+	release, err = limiter.acquire(context.Background())
+	require.Nil(t, err)
+	release()
+}
+
+func TestRequestClient(t *testing.T) {
+	New(WithClientHeader("X-Client-ID"), WithTrustedGateways([]string{"gateway"}), WithClientPriorities(map[string]int{"ci": -2}))
+
+	r := httptest.NewRequest("GET", "/package/react/16.13.0", nil)
+	r.RemoteAddr = "10.0.0.1:51234"
+	assert.Equal(t, "10.0.0.1", requestClient(r))
+	// IE: anybody could send it, only authenticated callers are taken at their word
+	r.Header.Set("X-Client-ID", "ci")
+	assert.Equal(t, "10.0.0.1", requestClient(r))
+	r = withClientCertificate(r, "gateway")
+	assert.Equal(t, "ci", requestClient(r))
+	r.Header.Del("X-Client-ID")
+	assert.Equal(t, "gateway", requestClient(r))
+	// IE: authenticated but not a gateway, it is its own client whatever it claims
+	r = withClientCertificate(httptest.NewRequest("GET", "/package/react/16.13.0", nil), "alice")
+	r.Header.Set("X-Client-ID", "ci")
+	assert.Equal(t, "alice", requestClient(r))
+
+	assert.Equal(t, job{client: "ci", priority: -2}, jobFrom(withJob(context.Background(), "ci")))
+	assert.Equal(t, job{client: backgroundClient, priority: -1}, jobFrom(withJob(context.Background(), backgroundClient)))
+
+	// IE: everybody in the same queue, priorities still apply
+	New(WithFairScheduling(false), WithClientPriorities(map[string]int{"ci": -2}))
+	assert.Equal(t, job{priority: -2}, jobFrom(withJob(context.Background(), "ci")))
+}
+
+func TestParseClientPriorities(t *testing.T) {
+	priorities, err := ParseClientPriorities(" dashboard=1, ci = -1,")
+	require.Nil(t, err)
+	assert.Equal(t, map[string]int{"dashboard": 1, "ci": -1}, priorities)
+
+	_, err = ParseClientPriorities("dashboard")
+	assert.NotNil(t, err)
+	_, err = ParseClientPriorities("=1")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IE: file and Vault secrets get rotated, they are read again past this
+const secretRefresh = 5 * time.Minute
+
+var vaultClient = &http.Client{Timeout: 10 * time.Second}
+
+// Secret is a credential read from where its reference points, parsed by
+// ParseSecret. Printed or logged it shows the reference, never the value.
+type Secret struct {
+	ref      string
+	scheme   string
+	location string
+	// IE: the key of the Vault secret
+	field string
+
+	mu       sync.Mutex
+	value    string
+	resolved time.Time
+}
+
+// ParseSecret parses a reference to a credential:
+//
+//	env:NPM_TOKEN                  the NPM_TOKEN environment variable
+//	file:/run/secrets/npm-token    the content of the file, trailing newline aside
+//	vault:secret/data/npm#token    the token key of a Vault secret, read from
+//	                               VAULT_ADDR with VAULT_TOKEN (KV v1 or v2)
+//
+// Plain values are refused, they would end up in config files and process lists.
+func ParseSecret(ref string) (*Secret, error) {
+	scheme, location, found := strings.Cut(strings.TrimSpace(ref), ":")
+	if !found || location == "" {
+		return nil, fmt.Errorf("expected env:NAME, file:PATH or vault:PATH#KEY, got a plain value")
+	}
+	secret := &Secret{ref: scheme + ":" + location, scheme: scheme, location: location}
+	switch scheme {
+	case "env", "file":
+	case "vault":
+		secret.location, secret.field, found = strings.Cut(location, "#")
+		if !found || secret.location == "" || secret.field == "" {
+			return nil, fmt.Errorf("expected vault:PATH#KEY, got %q", ref)
+		}
+		secret.location = strings.Trim(secret.location, "/")
+	default:
+		return nil, fmt.Errorf("expected env:NAME, file:PATH or vault:PATH#KEY, got a %q reference", scheme)
+	}
+	return secret, nil
+}
+
+// String returns the reference of the secret.
+func (s *Secret) String() string {
+	if s == nil {
+		return ""
+	}
+	return s.ref
+}
+
+// GoString returns the reference of the secret, so %#v doesn't print the value.
+func (s *Secret) GoString() string {
+	return s.String()
+}
+
+// LogValue logs the reference of the secret.
+func (s *Secret) LogValue() slog.Value {
+	return slog.StringValue(s.String())
+}
+
+// IE: the last value read stays in use while its source fails, a Vault outage
+// shouldn't cut the registry off until the token actually expires
+func (s *Secret) resolve(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.value != "" && time.Since(s.resolved) < secretRefresh {
+		return s.value, nil
+	}
+
+	value, err := s.read(ctx)
+	if err == nil && value == "" {
+		err = errors.New("empty")
+	}
+	if err != nil {
+		if s.value != "" {
+			loggerFrom(ctx).Warn("Could not refresh secret, using the last value read", "secret", s, "error", err)
+			s.resolved = time.Now()
+			return s.value, nil
+		}
+		return "", fmt.Errorf("%s: %w", s.ref, err)
+	}
+	s.value, s.resolved = value, time.Now()
+	return value, nil
+}
+
+func (s *Secret) read(ctx context.Context) (string, error) {
+	switch s.scheme {
+	case "env":
+		return os.Getenv(s.location), nil
+	case "file":
+		data, err := os.ReadFile(s.location)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	return readVaultSecret(ctx, s.location, s.field)
+}
+
+// IE: KV v2 nests the keys under data.data, v1 right under data
+func readVaultSecret(ctx context.Context, path, field string) (string, error) {
+	addr, token := os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return "", errors.New("VAULT_ADDR and VAULT_TOKEN must be set")
+	}
+	endpoint, err := url.JoinPath(addr, "v1", path)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+	resp, err := vaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault answered %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	values := body.Data
+	if nested, ok := values["data"].(map[string]interface{}); ok {
+		values = nested
+	}
+	value, ok := values[field].(string)
+	if !ok {
+		return "", fmt.Errorf("no %q key in the vault secret", field)
+	}
+	return value, nil
+}
+
+// IE: the token only goes to the host of the registry, tarballs it serves
+// included, never to the CDNs or another host a document points to. The
+// client drops the header itself on a redirect to another domain
+func authorizeRegistryCall(ctx context.Context, req *http.Request) error {
+	if opts.registryToken == nil {
+		return nil
+	}
+	registry, err := url.Parse(live().registryURL)
+	if err != nil || !strings.EqualFold(registry.Host, req.URL.Host) {
+		return nil
+	}
+	token, err := opts.registryToken.resolve(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: registry token %v", ErrRegistryUnavailable, err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
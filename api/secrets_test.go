@@ -0,0 +1,115 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/snyk/snyk-code-review-exercise/internal/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSecret(t *testing.T) {
+	for _, valid := range []string{"env:NPM_TOKEN", "file:/run/secrets/npm-token", "vault:secret/data/npm#token"} {
+		secret, err := ParseSecret(valid)
+		require.Nil(t, err, valid)
+		assert.Equal(t, valid, secret.String())
+	}
+	for _, invalid := range []string{"npm_0123456789", "env:", "kms:arn:aws:kms:key", "vault:secret/data/npm", "vault:#token"} {
+		_, err := ParseSecret(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+func TestSecretSources(t *testing.T) {
+	t.Setenv("NPM_TOKEN", "from-env")
+	path := filepath.Join(t.TempDir(), "npm-token")
+	require.Nil(t, os.WriteFile(path, []byte("from-file\n"), 0o600))
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" || r.URL.Path != "/v1/secret/data/npm" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `{"data": {"data": {"token": "from-vault"}, "metadata": {"version": 3}}}`)
+	}))
+	defer vault.Close()
+	t.Setenv("VAULT_ADDR", vault.URL)
+	t.Setenv("VAULT_TOKEN", "root")
+
+	for ref, want := range map[string]string{
+		"env:NPM_TOKEN":               "from-env",
+		"file:" + path:                "from-file",
+		"vault:secret/data/npm#token": "from-vault",
+	} {
+		secret, err := ParseSecret(ref)
+		require.Nil(t, err)
+		value, err := secret.resolve(context.Background())
+		require.Nil(t, err, ref)
+		assert.Equal(t, want, value, ref)
+	}
+
+	for _, ref := range []string{"env:UNSET_NPM_TOKEN", "file:" + path + ".missing", "vault:secret/data/other#token", "vault:secret/data/npm#password"} {
+		secret, err := ParseSecret(ref)
+		require.Nil(t, err)
+		_, err = secret.resolve(context.Background())
+		assert.NotNil(t, err, ref)
+	}
+}
+
+func TestSecretRedacted(t *testing.T) {
+	t.Setenv("NPM_TOKEN", "npm_0123456789")
+	secret, err := ParseSecret("env:NPM_TOKEN")
+	require.Nil(t, err)
+	_, err = secret.resolve(context.Background())
+	require.Nil(t, err)
+
+	var logs bytes.Buffer
+	slog.New(slog.NewJSONHandler(&logs, nil)).Info("Starting", "token", secret)
+	for _, printed := range []string{logs.String(), fmt.Sprintf("%v %+v %#v %s", secret, secret, secret, secret)} {
+		assert.NotContains(t, printed, "npm_0123456789")
+		assert.Contains(t, printed, "env:NPM_TOKEN")
+	}
+}
+
+func TestRegistryToken(t *testing.T) {
+	packages := fixtures.Registry{"app": {"1.0.0": nil}}
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer npm_0123456789" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		packages.ServeHTTP(w, r)
+	}))
+	defer registry.Close()
+	// IE: same address, another host, as a CDN would be
+	var leaked string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaked = r.Header.Get("Authorization")
+	}))
+	defer other.Close()
+	otherURL, err := url.Parse(other.URL)
+	require.Nil(t, err)
+	otherURL.Host = "localhost:" + otherURL.Port()
+
+	t.Setenv("NPM_TOKEN", "npm_0123456789")
+	token, err := ParseSecret("env:NPM_TOKEN")
+	require.Nil(t, err)
+	handler := New(WithRegistryURL(registry.URL), WithRegistryToken(token), WithUpstreamHosts([]string{"127.0.0.1", "localhost"}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	resp, err := httpGet(context.Background(), otherURL.String()+"/pkg.tgz")
+	require.Nil(t, err)
+	resp.Body.Close()
+	assert.Empty(t, leaked)
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// IE: set by New() when the configured cache backend couldn't be set up and the
+// in-memory caches serve instead, nil otherwise
+var cacheSetupErr error
+
+// SelfCheck verifies, once New() is done, that the registry answers and that
+// the cache backends store and return values. Every failure is logged with
+// what to look at, and they are all returned, joined. Startup goes on
+// regardless, it's up to the caller to refuse to start.
+func SelfCheck(ctx context.Context) error {
+	start := time.Now()
+	errs := []error{checkRegistry(ctx)}
+	if cacheSetupErr != nil {
+		logger.Error("Self-check: cache backend unusable, running on the in-memory caches",
+			"backend", opts.cacheBackend, "error", cacheSetupErr, "hint", "check -cache-backend and -cache-address")
+		errs = append(errs, fmt.Errorf("cache backend %s: %w", opts.cacheBackend, cacheSetupErr))
+	} else {
+		errs = append(errs, checkCache("responses", responseCache))
+		// IE: shared by both layers on the external backends, once is enough
+		if packumentCache != responseCache {
+			errs = append(errs, checkCache("packuments", packumentCache))
+		}
+	}
+
+	err := errors.Join(errs...)
+	if err == nil {
+		logger.Info("Self-check passed", "registry", live().registryURL, "backend", opts.cacheBackend, "duration", time.Since(start))
+	}
+	return err
+}
+
+// IE: the root of the registry, any answer but a 5xx means it's there. A tree
+// is the wrong probe, it needs a package the registry is known to have. A
+// Registry of WithRegistry is the caller's to check
+func checkRegistry(ctx context.Context) error {
+	if opts.registry != nil {
+		return nil
+	}
+	registry := live().registryURL
+	resp, err := httpGet(withJob(ctx, backgroundClient), registry+"/")
+	if err != nil {
+		logger.Error("Self-check: registry unreachable", "registry", registry, "error", err,
+			"hint", "check -registry, DNS and the proxy settings (HTTPS_PROXY) of the host")
+		return fmt.Errorf("registry %s: %w", registry, err)
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= http.StatusInternalServerError:
+		logger.Error("Self-check: registry failing", "registry", registry, "status", resp.StatusCode,
+			"hint", "the registry itself is down, or -registry points at something else")
+		return fmt.Errorf("registry %s answered %s", registry, resp.Status)
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		// IE: some registries only let the packuments through, a warning then
+		logger.Warn("Self-check: registry refuses anonymous requests", "registry", registry, "status", resp.StatusCode,
+			"hint", "resolutions fail if the packuments need credentials too")
+	}
+	return nil
+}
+
+// IE: a write then a read of a key of its own. Redis and memcached log their
+// errors and report misses, a value not coming back is all that can be told.
+// The in-memory caches can't fail, and keep nothing when sized 0 on purpose
+func checkCache(layer string, cache Cache) error {
+	if cache.Stats().Backend == CacheBackendMemory {
+		return nil
+	}
+	key := "self-check:" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	value := []byte("ok " + key)
+	cache.Set(key, value, time.Minute)
+	got, found := cache.Get(key)
+	cache.Delete(key)
+
+	if !found || !bytes.Equal(got, value) {
+		backend := cache.Stats().Backend
+		logger.Error("Self-check: cache backend doesn't keep values", "layer", layer, "backend", backend,
+			"hint", "check -cache-address, the backend is reachable and has memory left")
+		return fmt.Errorf("%s cache (%s) doesn't keep values", layer, backend)
+	}
+	return nil
+}
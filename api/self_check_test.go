@@ -0,0 +1,60 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelfCheck(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{"a": {"1.0.0": nil}})
+	redis := miniredis.RunT(t)
+
+	New(WithRegistryURL(registry.URL), WithCacheBackend(CacheBackendRedis, "redis://"+redis.Addr()))
+	require.Nil(t, SelfCheck(context.Background()))
+	// IE: cleaned up behind itself
+	assert.Empty(t, redis.Keys())
+
+	redis.Close()
+	err := SelfCheck(context.Background())
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "responses cache (redis) doesn't keep values")
+}
+
+func TestSelfCheckRegistry(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	New(WithRegistryURL(failing.URL))
+	err := SelfCheck(context.Background())
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "502 Bad Gateway")
+
+	// IE: only a warning, the packuments may still come through
+	private := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer private.Close()
+	New(WithRegistryURL(private.URL))
+	assert.Nil(t, SelfCheck(context.Background()))
+
+	private.Close()
+	err = SelfCheck(context.Background())
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "registry "+private.URL)
+}
+
+func TestSelfCheckCacheFallback(t *testing.T) {
+	registry := newFakeRegistry(t, nil)
+	New(WithRegistryURL(registry.URL), WithCacheBackend(CacheBackendBolt, filepath.Join(t.TempDir(), "missing", "cache.db")))
+	err := SelfCheck(context.Background())
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "cache backend bolt")
+}
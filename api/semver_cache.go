@@ -0,0 +1,94 @@
+package api
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// IE: packages whose parsed version list is kept, popular ones list hundreds of versions
+const parsedVersionsCapacity = 4096
+
+// IE: the published versions of a package, parsed and sorted once instead of on
+// every constraint evaluation. Packuments are decoded anew from the cache on
+// every fetch, so the entries are keyed by name and checked against the
+// packument at hand: a publish (or an unpublish) changes the list
+type parsedVersions struct {
+	name    string
+	sorted  semver.Collection
+	invalid int
+}
+
+func (p *parsedVersions) matches(meta *npmPackageMetaResponse) bool {
+	if len(meta.Versions) != len(p.sorted)+p.invalid {
+		return false
+	}
+	for _, version := range p.sorted {
+		if _, found := meta.Versions[version.Original()]; !found {
+			return false
+		}
+	}
+	return true
+}
+
+func parseVersions(name string, meta *npmPackageMetaResponse) *parsedVersions {
+	parsed := &parsedVersions{name: name, sorted: make(semver.Collection, 0, len(meta.Versions))}
+	for version := range meta.Versions {
+		semVer, err := semver.NewVersion(version)
+		if err != nil {
+			parsed.invalid++
+			continue
+		}
+		parsed.sorted = append(parsed.sorted, semVer)
+	}
+	sort.Sort(parsed.sorted)
+	return parsed
+}
+
+// IE: plain LRU, the values are Go objects so the []byte caches don't fit
+type versionsCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List
+}
+
+var parsedVersionsCache = newVersionsCache(parsedVersionsCapacity)
+
+func newVersionsCache(capacity int) *versionsCache {
+	return &versionsCache{capacity: capacity, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+// IE: ascending, shared between callers, must not be modified
+func (c *versionsCache) sortedVersions(name string, meta *npmPackageMetaResponse) semver.Collection {
+	c.mu.Lock()
+	if element, found := c.entries[name]; found {
+		parsed := element.Value.(*parsedVersions)
+		if parsed.matches(meta) {
+			c.order.MoveToFront(element)
+			c.mu.Unlock()
+			return parsed.sorted
+		}
+	}
+	c.mu.Unlock()
+
+	// IE: parsed outside of the lock, concurrent misses on the same package at worst both parse it
+	parsed := parseVersions(name, meta)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, found := c.entries[name]; found {
+		element.Value = parsed
+		c.order.MoveToFront(element)
+	} else {
+		c.entries[name] = c.order.PushFront(parsed)
+	}
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*parsedVersions).name)
+	}
+	return parsed.sorted
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionsCacheParsesOnce(t *testing.T) {
+	cache := newVersionsCache(2)
+	meta := metaWithVersions("1.0.0", "1.10.0", "1.2.0", "not-a-version")
+
+	sorted := cache.sortedVersions("left-pad", meta)
+	require.Len(t, sorted, 3)
+	assert.Equal(t, "1.10.0", sorted[2].String())
+	// IE: same packument, same parsed list
+	assert.Same(t, &sorted[0], &cache.sortedVersions("left-pad", metaWithVersions("1.0.0", "1.10.0", "1.2.0", "not-a-version"))[0])
+
+	// IE: a version got published
+	sorted = cache.sortedVersions("left-pad", metaWithVersions("1.0.0", "1.10.0", "1.2.0", "not-a-version", "2.0.0"))
+	assert.Equal(t, "2.0.0", sorted[len(sorted)-1].String())
+
+	cache.sortedVersions("react", metaWithVersions("16.13.0"))
+	cache.sortedVersions("express", metaWithVersions("4.18.1"))
+	_, found := cache.entries["left-pad"]
+	assert.False(t, found)
+	assert.Len(t, cache.entries, 2)
+}
+
+func TestHighestCompatibleVersion(t *testing.T) {
+	New()
+	meta := metaWithVersions("1.0.0", "1.2.0", "1.10.0", "2.0.0-beta.1", "v0.9.0")
+
+	for constraint, expected := range map[string]string{
+		"^1.0.0":    "1.10.0",
+		"~1.2.0":    "1.2.0",
+		"<1.0.0":    "0.9.0",
+		">=2.0.0-0": "2.0.0-beta.1",
+	} {
+		version, err := highestCompatibleVersion("left-pad", constraint, meta)
+		require.Nil(t, err, constraint)
+		assert.Equal(t, expected, version, constraint)
+	}
+
+	_, err := highestCompatibleVersion("left-pad", "^3.0.0", meta)
+	assert.ErrorIs(t, err, ErrNoCompatibleVersion)
+
+	meta.DistTags = map[string]string{"latest": "1.2.0", "next": "2.0.0-beta.1", "gone": "3.0.0"}
+	version, err := highestCompatibleVersion("left-pad", "next", meta)
+	require.Nil(t, err)
+	assert.Equal(t, "2.0.0-beta.1", version)
+	_, err = highestCompatibleVersion("left-pad", "gone", meta)
+	assert.ErrorIs(t, err, ErrNoCompatibleVersion)
+	_, err = highestCompatibleVersion("left-pad", "beta", meta)
+	assert.ErrorIs(t, err, errInvalidRange)
+}
+
+func BenchmarkHighestCompatibleVersion(b *testing.B) {
+	New()
+	var versions []string
+	for major := 0; major < 10; major++ {
+		for minor := 0; minor < 50; minor++ {
+			versions = append(versions, fmt.Sprintf("%d.%d.0", major, minor))
+		}
+	}
+	meta := metaWithVersions(versions...)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := highestCompatibleVersion("wide", "^4.2.0", meta); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
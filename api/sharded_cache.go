@@ -0,0 +1,110 @@
+package api
+
+import (
+	"hash/fnv"
+	"sync/atomic"
+	"time"
+)
+
+// IE: spread keys over several independently locked LRUs so hundreds of
+// resolver goroutines don't queue up behind a single mutex; the eviction
+// order becomes per shard, which is close enough for a cache
+type shardedCache struct {
+	shards []*lruCache
+
+	// IE: the byte budget is shared, a single tree may take most of it
+	maxBytes int64
+	bytes    atomic.Int64
+}
+
+// IE: capacity is a total across shards, rounded up so each shard holds at
+// least one entry. maxBytes is a total too, but any shard may use all of it
+func newShardedCache(capacity int, maxBytes int64, shards int) *shardedCache {
+	if shards < 1 {
+		shards = 1
+	}
+
+	perShard := 0
+	if capacity > 0 {
+		perShard = (capacity + shards - 1) / shards
+	}
+
+	c := &shardedCache{shards: make([]*lruCache, shards), maxBytes: maxBytes}
+	for i := range c.shards {
+		c.shards[i] = newLRUCache(perShard, maxBytes)
+		c.shards[i].total = &c.bytes
+	}
+	return c
+}
+
+func (c *shardedCache) shardIndex(key string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(c.shards)))
+}
+
+func (c *shardedCache) shard(key string) *lruCache {
+	return c.shards[c.shardIndex(key)]
+}
+
+func (c *shardedCache) Get(key string) ([]byte, bool) {
+	return c.shard(key).Get(key)
+}
+
+// IE: over the shared budget, the other shards give up their least recently
+// used entries in turn, the shard of key last and never key itself
+func (c *shardedCache) Set(key string, value []byte, ttl time.Duration) {
+	index := c.shardIndex(key)
+	c.shards[index].Set(key, value, ttl)
+
+	for c.maxBytes > 0 && c.bytes.Load() > c.maxBytes {
+		evicted := false
+		for i := 1; i <= len(c.shards) && c.bytes.Load() > c.maxBytes; i++ {
+			if c.shards[(index+i)%len(c.shards)].evictOldest(key) {
+				evicted = true
+			}
+		}
+		if !evicted {
+			return
+		}
+	}
+}
+
+func (c *shardedCache) Delete(key string) {
+	c.shard(key).Delete(key)
+}
+
+func (c *shardedCache) setOnEvict(fn func(key string, value []byte, expires time.Time)) {
+	for _, shard := range c.shards {
+		shard.onEvict = fn
+	}
+}
+
+func (c *shardedCache) Entries(prefix string) []CacheEntryInfo {
+	var entries []CacheEntryInfo
+	for _, shard := range c.shards {
+		entries = append(entries, shard.Entries(prefix)...)
+	}
+	return entries
+}
+
+func (c *shardedCache) DeletePrefix(prefix string) int {
+	deleted := 0
+	for _, shard := range c.shards {
+		deleted += shard.DeletePrefix(prefix)
+	}
+	return deleted
+}
+
+func (c *shardedCache) Stats() CacheStats {
+	total := CacheStats{Backend: CacheBackendMemory}
+	for _, shard := range c.shards {
+		stats := shard.Stats()
+		total.Entries += stats.Entries
+		total.Hits += stats.Hits
+		total.Misses += stats.Misses
+		total.Evictions += stats.Evictions
+		total.Bytes += stats.Bytes
+	}
+	return total
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShardedCacheAggregatesShards(t *testing.T) {
+	cache := newShardedCache(64, 0, 4)
+
+	for i := 0; i < 32; i++ {
+		cache.Set(fmt.Sprintf("packument:pkg-%d", i), []byte("{}"), 0)
+	}
+	for i := 0; i < 32; i++ {
+		_, found := cache.Get(fmt.Sprintf("packument:pkg-%d", i))
+		assert.True(t, found)
+	}
+	cache.Get("packument:missing")
+
+	stats := cache.Stats()
+	assert.Equal(t, 32, stats.Entries)
+	assert.Equal(t, uint64(32), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+
+	cache.Delete("packument:pkg-0")
+	_, found := cache.Get("packument:pkg-0")
+	assert.False(t, found)
+}
+
+func TestShardedCacheBoundsTotalSize(t *testing.T) {
+	cache := newShardedCache(8, 0, 4)
+
+	for i := 0; i < 100; i++ {
+		cache.Set(fmt.Sprintf("tree:pkg-%d", i), []byte("{}"), 0)
+	}
+
+	assert.LessOrEqual(t, cache.Stats().Entries, 8)
+}
+
+func TestShardedCacheSharesTheByteBudget(t *testing.T) {
+	cache := newShardedCache(64, 1000, 16)
+
+	// IE: 10 times what an even split across the 16 shards would allow
+	cache.Set("tree:npm@8.19.2", make([]byte, 640), 0)
+	_, found := cache.Get("tree:npm@8.19.2")
+	assert.True(t, found)
+
+	for i := 0; i < 40; i++ {
+		cache.Set(fmt.Sprintf("tree:pkg-%d", i), make([]byte, 50), 0)
+		assert.LessOrEqual(t, cache.Stats().Bytes, int64(1000))
+	}
+	_, found = cache.Get("tree:pkg-39")
+	assert.True(t, found)
+
+	cache.Set("tree:too-large", make([]byte, 1001), 0)
+	_, found = cache.Get("tree:too-large")
+	assert.False(t, found)
+}
+
+func TestShardedCacheConcurrentAccess(t *testing.T) {
+	cache := newShardedCache(1024, 0, 16)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 50; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				key := fmt.Sprintf("packument:pkg-%d", (g*i)%200)
+				cache.Set(key, []byte("{}"), 0)
+				cache.Get(key)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	assert.Equal(t, uint64(5000), cache.Stats().Hits+cache.Stats().Misses)
+}
+
+func BenchmarkLRUCacheParallel(b *testing.B) {
+	benchmarkCacheParallel(b, newLRUCache(1024, 0))
+}
+
+func BenchmarkShardedCacheParallel(b *testing.B) {
+	benchmarkCacheParallel(b, newShardedCache(1024, 0, 16))
+}
+
+func benchmarkCacheParallel(b *testing.B, cache Cache) {
+	for i := 0; i < 512; i++ {
+		cache.Set(fmt.Sprintf("packument:pkg-%d", i), []byte("{}"), 0)
+	}
+
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			cache.Get(fmt.Sprintf("packument:pkg-%d", i%512))
+			i++
+		}
+	})
+}
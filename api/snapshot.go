@@ -0,0 +1,145 @@
+package api
+
+import (
+	"encoding/gob"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type snapshotEntry struct {
+	Key     string
+	Value   []byte
+	Expires time.Time
+}
+
+type cacheSnapshot struct {
+	SavedAt time.Time
+	// IE: restoring entries of another schema would only waste memory, they are never hit
+	TreeSchema     string
+	RegistrySchema string
+	Responses      []snapshotEntry
+	Packuments     []snapshotEntry
+}
+
+// IE: only the in-memory caches need it, the other backends persist by themselves
+type snapshotter interface {
+	snapshot() []snapshotEntry
+	restore(entries []snapshotEntry)
+}
+
+// IE: least recently used first, so restoring in order rebuilds the same recency
+func (c *lruCache) snapshot() []snapshotEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	entries := make([]snapshotEntry, 0, c.ll.Len())
+	for elem := c.ll.Back(); elem != nil; elem = elem.Prev() {
+		entry := elem.Value.(*lruEntry)
+		if !entry.expires.IsZero() && now.After(entry.expires) {
+			continue
+		}
+		entries = append(entries, snapshotEntry{Key: entry.key, Value: entry.value, Expires: entry.expires})
+	}
+	return entries
+}
+
+func (c *lruCache) restore(entries []snapshotEntry) {
+	now := c.now()
+	for _, entry := range entries {
+		ttl := time.Duration(0)
+		if !entry.Expires.IsZero() {
+			ttl = entry.Expires.Sub(now)
+			if ttl <= 0 {
+				continue
+			}
+		}
+		c.Set(entry.Key, entry.Value, ttl)
+	}
+}
+
+func (c *shardedCache) snapshot() []snapshotEntry {
+	var entries []snapshotEntry
+	for _, shard := range c.shards {
+		entries = append(entries, shard.snapshot()...)
+	}
+	return entries
+}
+
+func (c *shardedCache) restore(entries []snapshotEntry) {
+	for _, entry := range entries {
+		c.shard(entry.Key).restore([]snapshotEntry{entry})
+	}
+}
+
+// SnapshotCaches writes the in-memory caches to the snapshot file configured
+// with WithCacheSnapshot, meant to be called during graceful shutdown.
+func SnapshotCaches() error {
+	if opts.snapshotPath == "" {
+		return nil
+	}
+
+	snapshot := cacheSnapshot{SavedAt: time.Now(), TreeSchema: treeSchemaVersion, RegistrySchema: registrySchemaVersion}
+	if s, ok := responseCache.(snapshotter); ok {
+		snapshot.Responses = s.snapshot()
+	}
+	if s, ok := packumentCache.(snapshotter); ok {
+		snapshot.Packuments = s.snapshot()
+	}
+
+	// IE: write next to the target and rename, a crash mid-write must not leave a truncated snapshot
+	tmp, err := os.CreateTemp(filepath.Dir(opts.snapshotPath), filepath.Base(opts.snapshotPath)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := gob.NewEncoder(tmp).Encode(snapshot); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	logger.Info("Saved cache snapshot", "path", opts.snapshotPath, "responses", len(snapshot.Responses), "packuments", len(snapshot.Packuments))
+	return os.Rename(tmp.Name(), opts.snapshotPath)
+}
+
+func restoreCaches(path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		// IE: first boot
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var snapshot cacheSnapshot
+	if err := gob.NewDecoder(f).Decode(&snapshot); err != nil {
+		return err
+	}
+
+	if snapshot.TreeSchema != treeSchemaVersion {
+		logger.Info("Discarding snapshot responses of another tree schema", "schema", snapshot.TreeSchema)
+		snapshot.Responses = nil
+	}
+	if snapshot.RegistrySchema != registrySchemaVersion {
+		logger.Info("Discarding snapshot packuments of another registry schema", "schema", snapshot.RegistrySchema)
+		snapshot.Packuments = nil
+	}
+
+	if s, ok := responseCache.(snapshotter); ok {
+		s.restore(snapshot.Responses)
+	}
+	if s, ok := packumentCache.(snapshotter); ok {
+		s.restore(snapshot.Packuments)
+	}
+
+	logger.Info("Restored cache snapshot", "responses", len(snapshot.Responses), "packuments", len(snapshot.Packuments), "saved-at", snapshot.SavedAt)
+	return nil
+}
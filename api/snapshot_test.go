@@ -0,0 +1,77 @@
+package api
+
+import (
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheSnapshotRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "caches.gob")
+
+	New(WithCacheSnapshot(path))
+	responseCache.Set(treeKeyPrefix+"react@16.13.0", []byte(`{"name":"react"}`), time.Hour)
+	packumentCache.Set(packumentKeyPrefix+"react", []byte("{}"), 0)
+	require.Nil(t, SnapshotCaches())
+
+	New(WithCacheSnapshot(path))
+
+	value, found := responseCache.Get(treeKeyPrefix + "react@16.13.0")
+	assert.True(t, found)
+	assert.Equal(t, []byte(`{"name":"react"}`), value)
+	_, found = packumentCache.Get(packumentKeyPrefix + "react")
+	assert.True(t, found)
+}
+
+func TestCacheSnapshotMissingFile(t *testing.T) {
+	New(WithCacheSnapshot(filepath.Join(t.TempDir(), "caches.gob")))
+	assert.Equal(t, 0, responseCache.Stats().Entries)
+}
+
+func TestLRUSnapshotKeepsRecencyAndSkipsExpired(t *testing.T) {
+	now := time.Now()
+	cache := newLRUCache(3, 0)
+	cache.now = func() time.Time { return now }
+
+	cache.Set("a", []byte("1"), 0)
+	cache.Set("b", []byte("2"), time.Second)
+	cache.Set("c", []byte("3"), 0)
+	cache.Get("a")
+
+	now = now.Add(time.Minute)
+	entries := cache.snapshot()
+
+	restored := newLRUCache(2, 0)
+	restored.restore(entries)
+	restored.Set("d", []byte("4"), 0)
+
+	// IE: 'a' was used last, 'c' is the one to go
+	_, found := restored.Get("a")
+	assert.True(t, found)
+	_, found = restored.Get("c")
+	assert.False(t, found)
+}
+
+func TestCacheSnapshotDiscardsOtherSchemas(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "caches.gob")
+
+	f, err := os.Create(path)
+	require.Nil(t, err)
+	require.Nil(t, gob.NewEncoder(f).Encode(cacheSnapshot{
+		TreeSchema:     "0",
+		RegistrySchema: registrySchemaVersion,
+		Responses:      []snapshotEntry{{Key: treeKeyPrefix + "react@16.13.0", Value: []byte("{}")}},
+		Packuments:     []snapshotEntry{{Key: packumentKeyPrefix + "react", Value: []byte("{}")}},
+	}))
+	require.Nil(t, f.Close())
+
+	New(WithCacheSnapshot(path))
+
+	assert.Equal(t, 0, responseCache.Stats().Entries)
+	assert.Equal(t, 1, packumentCache.Stats().Entries)
+}
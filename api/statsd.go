@@ -0,0 +1,220 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Wire formats accepted by WithStatsD.
+const (
+	// StatsDFormatDatadog sends the metric labels as DogStatsD tags.
+	StatsDFormatDatadog = "datadog"
+	// StatsDFormatPlain appends the label values to the metric names, plain StatsD has no tags.
+	StatsDFormatPlain = "statsd"
+)
+
+// IE: lines are batched into datagrams of at most this size, below the usual
+// 1500 bytes MTU once the IP and UDP headers are added
+const maxStatsDPacket = 1432
+
+// IE: nil unless WithStatsD is set, replaced by every New()
+var statsdSink *statsdEmitter
+
+// IE: pushes what /metrics serves every interval, for the setups (i.e. a
+// Datadog agent next to each replica) that can't scrape. Counters are sent as
+// the increase since the previous flush, gauges as their current value
+type statsdEmitter struct {
+	conn     net.Conn
+	gatherer prometheus.Gatherer
+	format   string
+	interval time.Duration
+
+	// IE: flushes come from the loop and from FlushMetrics
+	mu sync.Mutex
+	// IE: counter values sent so far, keyed by their line name and tags
+	sent map[string]float64
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newStatsdEmitter(address, format string, interval time.Duration, gatherer prometheus.Gatherer) (*statsdEmitter, error) {
+	if address == "" {
+		return nil, nil
+	}
+	if format != StatsDFormatDatadog && format != StatsDFormatPlain {
+		return nil, fmt.Errorf("unknown statsd format %q, expected %s or %s", format, StatsDFormatDatadog, StatsDFormatPlain)
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("statsd interval must be positive, got %s", interval)
+	}
+	// IE: UDP, only resolves the address, nothing is listening necessarily
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	e := &statsdEmitter{
+		conn:     conn,
+		gatherer: gatherer,
+		format:   format,
+		interval: interval,
+		sent:     make(map[string]float64),
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	go e.loop(ctx)
+	return e, nil
+}
+
+func (e *statsdEmitter) loop(ctx context.Context) {
+	defer close(e.done)
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := e.flush(); err != nil {
+			logger.Error("Could not send metrics to statsd", "error", err)
+		}
+	}
+}
+
+func (e *statsdEmitter) flush() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	families, err := e.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+
+	var packet []byte
+	for _, line := range e.lines(families) {
+		if len(packet) > 0 && len(packet)+1+len(line) > maxStatsDPacket {
+			if _, err := e.conn.Write(packet); err != nil {
+				return err
+			}
+			packet = packet[:0]
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+	if len(packet) > 0 {
+		_, err = e.conn.Write(packet)
+	}
+	return err
+}
+
+// IE: called with mu held
+func (e *statsdEmitter) lines(families []*dto.MetricFamily) []string {
+	var lines []string
+	for _, family := range families {
+		name := statsdName(family.GetName())
+		for _, metric := range family.GetMetric() {
+			key := e.key(name, metric.GetLabel())
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				value := metric.GetCounter().GetValue()
+				delta := value - e.sent[key]
+				// IE: the counter was reset (New() again), all of it is new then
+				if delta < 0 {
+					delta = value
+				}
+				e.sent[key] = value
+				if delta > 0 {
+					lines = append(lines, e.line(key, delta, "c"))
+				}
+			case dto.MetricType_GAUGE:
+				value := metric.GetGauge().GetValue()
+				// IE: plain statsd takes a signed gauge as a change to the previous value
+				if value < 0 && e.format == StatsDFormatPlain {
+					lines = append(lines, e.line(key, 0, "g"))
+				}
+				lines = append(lines, e.line(key, value, "g"))
+			}
+		}
+	}
+	return lines
+}
+
+// IE: name|#tags with tags, name.value1.value2 otherwise, in label name order
+func (e *statsdEmitter) key(name string, labels []*dto.LabelPair) string {
+	sort.Slice(labels, func(i, j int) bool { return labels[i].GetName() < labels[j].GetName() })
+	if e.format == StatsDFormatPlain {
+		for _, label := range labels {
+			name += "." + sanitizeStatsD(label.GetValue())
+		}
+		return name
+	}
+
+	tags := make([]string, 0, len(labels))
+	for _, label := range labels {
+		tags = append(tags, label.GetName()+":"+sanitizeStatsD(label.GetValue()))
+	}
+	if len(tags) == 0 {
+		return name
+	}
+	return name + "|#" + strings.Join(tags, ",")
+}
+
+func (e *statsdEmitter) line(key string, value float64, kind string) string {
+	name, tags, _ := strings.Cut(key, "|")
+	line := name + ":" + strconv.FormatFloat(value, 'f', -1, 64) + "|" + kind
+	if tags != "" {
+		line += "|" + tags
+	}
+	return line
+}
+
+// IE: deps_cache_hits_total becomes deps.cache.hits, the usual statsd naming
+func statsdName(name string) string {
+	return strings.ReplaceAll(strings.TrimSuffix(name, "_total"), "_", ".")
+}
+
+// IE: the separators of the protocol can't appear in names or tags
+func sanitizeStatsD(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '|', ',', '#', '@', '\n', ' ':
+			return '_'
+		}
+		return r
+	}, value)
+}
+
+// IE: a last flush, the increase since the previous one would be lost otherwise
+func (e *statsdEmitter) Close() {
+	e.cancel()
+	<-e.done
+	if err := e.flush(); err != nil {
+		logger.Error("Could not send metrics to statsd", "error", err)
+	}
+	e.conn.Close()
+}
+
+// FlushMetrics sends the metrics to StatsD right away, on shutdown the
+// increase since the last interval would be lost otherwise. A no-op without
+// WithStatsD.
+func FlushMetrics() error {
+	if statsdSink == nil {
+		return nil
+	}
+	return statsdSink.flush()
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func listenStatsD(t *testing.T) *net.UDPConn {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.Nil(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readStatsD(t *testing.T, conn *net.UDPConn) []string {
+	buf := make([]byte, 65536)
+	require.Nil(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, err := conn.Read(buf)
+	require.Nil(t, err)
+	return strings.Split(string(buf[:n]), "\n")
+}
+
+func TestStatsDLines(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	hits := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "deps_cache_hits_total", Help: "hits"}, []string{"layer", "backend"})
+	entries := prometheus.NewGauge(prometheus.GaugeOpts{Name: "deps_cache_entries", Help: "entries"})
+	registry.MustRegister(hits, entries)
+	hits.WithLabelValues("responses", "memory").Add(3)
+	entries.Set(-1)
+
+	e := &statsdEmitter{format: StatsDFormatDatadog, sent: make(map[string]float64)}
+	families, err := registry.Gather()
+	require.Nil(t, err)
+	assert.Equal(t, []string{
+		"deps.cache.entries:-1|g",
+		"deps.cache.hits:3|c|#backend:memory,layer:responses",
+	}, e.lines(families))
+
+	// IE: only the increase since the previous flush, nothing when there is none
+	hits.WithLabelValues("responses", "memory").Add(2)
+	families, err = registry.Gather()
+	require.Nil(t, err)
+	assert.Equal(t, []string{
+		"deps.cache.entries:-1|g",
+		"deps.cache.hits:2|c|#backend:memory,layer:responses",
+	}, e.lines(families))
+	families, err = registry.Gather()
+	require.Nil(t, err)
+	assert.Equal(t, []string{"deps.cache.entries:-1|g"}, e.lines(families))
+
+	plain := &statsdEmitter{format: StatsDFormatPlain, sent: make(map[string]float64)}
+	assert.Equal(t, []string{
+		"deps.cache.entries:0|g",
+		"deps.cache.entries:-1|g",
+		"deps.cache.hits.memory.responses:5|c",
+	}, plain.lines(families))
+}
+
+func TestStatsDPushesMetrics(t *testing.T) {
+	statsd := listenStatsD(t)
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{
+		"a": {"1.0.0": nil},
+	})
+	handler := New(WithRegistryURL(registry.URL), WithStatsD(statsd.LocalAddr().String(), StatsDFormatDatadog, time.Hour))
+	defer New()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/a/1.0.0", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	require.Nil(t, FlushMetrics())
+	lines := readStatsD(t, statsd)
+	assert.Contains(t, lines, "deps.cache.misses:1|c|#backend:memory,layer:responses")
+	assert.Contains(t, lines, "deps.cache.misses:1|c|#backend:memory,layer:subtrees")
+	assert.Contains(t, lines, "deps.upstream.concurrency.limit:128|g")
+}
+
+func TestStatsDPacketsStayBelowTheMTU(t *testing.T) {
+	statsd := listenStatsD(t)
+	registry := prometheus.NewRegistry()
+	gauges := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "deps_test", Help: "test"}, []string{"n"})
+	registry.MustRegister(gauges)
+	for i := 0; i < 200; i++ {
+		gauges.WithLabelValues(strings.Repeat("x", i%10) + string(rune('a'+i%26)) + time.Duration(i).String()).Set(float64(i))
+	}
+
+	e, err := newStatsdEmitter(statsd.LocalAddr().String(), StatsDFormatDatadog, time.Hour, registry)
+	require.Nil(t, err)
+	require.Nil(t, e.flush())
+	var received int
+	for received < 200 {
+		lines := readStatsD(t, statsd)
+		assert.LessOrEqual(t, len(strings.Join(lines, "\n")), maxStatsDPacket)
+		received += len(lines)
+	}
+	assert.Equal(t, 200, received)
+	e.cancel()
+	<-e.done
+	e.conn.Close()
+}
+
+func TestStatsDRejectsUnknownFormats(t *testing.T) {
+	_, err := newStatsdEmitter("localhost:8125", "graphite", time.Second, prometheus.NewRegistry())
+	assert.NotNil(t, err)
+	e, err := newStatsdEmitter("", StatsDFormatDatadog, time.Second, prometheus.NewRegistry())
+	assert.Nil(t, err)
+	assert.Nil(t, e)
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+)
+
+type npmDist struct {
+	Tarball      string `json:"tarball"`
+	Integrity    string `json:"integrity"`
+	Shasum       string `json:"shasum"`
+	UnpackedSize int64  `json:"unpackedSize"`
+	// IE: see verifyProvenance
+	Signatures   []npmSignature   `json:"signatures"`
+	Attestations *npmAttestations `json:"attestations"`
+}
+
+// TarballInfo is the ground truth recorded after downloading a tarball,
+// as opposed to what the registry metadata claims.
+type TarballInfo struct {
+	URL       string `json:"url"`
+	Integrity string `json:"integrity"`
+	Size      int64  `json:"size"`
+	Verified  bool   `json:"verified"`
+}
+
+// IE: pick the hash from the SRI prefix (i.e. "sha512-<base64>"), fallback on the legacy hex sha1 shasum
+func integrityHash(dist npmDist) (hash.Hash, []byte, string, error) {
+	if dist.Integrity != "" {
+		// IE: SRI strings may contain several space separated hashes, the first one is enough
+		sri := strings.Fields(dist.Integrity)[0]
+		parts := strings.SplitN(sri, "-", 2)
+		if len(parts) != 2 {
+			return nil, nil, "", fmt.Errorf("malformed integrity %q", dist.Integrity)
+		}
+		algo := parts[0]
+		expected, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return nil, nil, "", err
+		}
+		switch algo {
+		case "sha512":
+			return sha512.New(), expected, sri, nil
+		case "sha384":
+			return sha512.New384(), expected, sri, nil
+		case "sha256":
+			return sha256.New(), expected, sri, nil
+		case "sha1":
+			return sha1.New(), expected, sri, nil
+		}
+		return nil, nil, "", fmt.Errorf("unsupported integrity algorithm %q", algo)
+	}
+
+	if dist.Shasum != "" {
+		expected, err := hex.DecodeString(dist.Shasum)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		return sha1.New(), expected, "sha1-" + base64.StdEncoding.EncodeToString(expected), nil
+	}
+
+	return nil, nil, "", errors.New("no integrity information published")
+}
+
+// IE: stream the tarball through the hash instead of holding it in memory, some are huge
+func verifyTarball(ctx context.Context, dist npmDist) (*TarballInfo, error) {
+	if dist.Tarball == "" {
+		return nil, errors.New("no tarball url published")
+	}
+
+	h, expected, sri, err := integrityHash(dist)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := httpGet(ctx, dist.Tarball)
+	if err != nil {
+		return nil, upstreamError(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: unexpected status %d for %s", ErrRegistryUnavailable, resp.StatusCode, dist.Tarball)
+	}
+
+	size, err := io.Copy(h, resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TarballInfo{
+		URL:       dist.Tarball,
+		Integrity: sri,
+		Size:      size,
+		Verified:  bytes.Equal(h.Sum(nil), expected),
+	}, nil
+}
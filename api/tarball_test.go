@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var tarballContent = []byte("not really a gzipped tarball")
+
+func tarballServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(tarballContent)
+	}))
+	t.Cleanup(server.Close)
+	// IE: the upstream hosts allowed are the one of the registry
+	New(WithRegistryURL(server.URL))
+	return server
+}
+
+func TestVerifyTarballIntegrity(t *testing.T) {
+	server := tarballServer(t)
+
+	sum := sha512.Sum512(tarballContent)
+	integrity := "sha512-" + base64.StdEncoding.EncodeToString(sum[:])
+
+	info, err := verifyTarball(context.Background(), npmDist{Tarball: server.URL + "/pkg.tgz", Integrity: integrity})
+	require.Nil(t, err)
+
+	assert.True(t, info.Verified)
+	assert.Equal(t, int64(len(tarballContent)), info.Size)
+	assert.Equal(t, integrity, info.Integrity)
+}
+
+func TestVerifyTarballShasumFallback(t *testing.T) {
+	server := tarballServer(t)
+
+	sum := sha1.Sum(tarballContent)
+
+	info, err := verifyTarball(context.Background(), npmDist{Tarball: server.URL + "/pkg.tgz", Shasum: hex.EncodeToString(sum[:])})
+	require.Nil(t, err)
+
+	assert.True(t, info.Verified)
+	assert.Equal(t, "sha1-"+base64.StdEncoding.EncodeToString(sum[:]), info.Integrity)
+}
+
+func TestVerifyTarballMismatch(t *testing.T) {
+	server := tarballServer(t)
+
+	sum := sha512.Sum512([]byte("something else"))
+
+	info, err := verifyTarball(context.Background(), npmDist{Tarball: server.URL + "/pkg.tgz", Integrity: "sha512-" + base64.StdEncoding.EncodeToString(sum[:])})
+	require.Nil(t, err)
+
+	assert.False(t, info.Verified)
+	assert.Equal(t, int64(len(tarballContent)), info.Size)
+}
+
+func TestVerifyTarballNoIntegrity(t *testing.T) {
+	server := tarballServer(t)
+
+	_, err := verifyTarball(context.Background(), npmDist{Tarball: server.URL + "/pkg.tgz"})
+	assert.NotNil(t, err)
+}
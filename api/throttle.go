@@ -0,0 +1,222 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// IE: a burst of 429s answers the same overload, cut the limit once for all of them
+	throttleCooldown = time.Second
+	// IE: a throttled call is retried this many times before failing the tree
+	throttleRetries = 2
+	// IE: Retry-After values past this would outlast most requests anyway
+	maxThrottleWait = 5 * time.Second
+)
+
+// IE: throttling is the registry's answer to the whole process rather than to
+// a single tree, so one limit is shared by every resolution. Nil doesn't limit
+var upstreamLimiter *adaptiveLimiter
+
+// IE: AIMD like TCP congestion control, the limit is halved whenever upstream
+// throttles and grows back by about one per limit successful calls. Calls
+// past the limit wait their turn in the job queue, see scheduler.go
+type adaptiveLimiter struct {
+	mu        sync.Mutex
+	limit     float64
+	max       float64
+	inFlight  int
+	queue     jobQueue
+	lastCut   time.Time
+	throttled uint64
+}
+
+func newAdaptiveLimiter(max int) *adaptiveLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &adaptiveLimiter{limit: float64(max), max: float64(max)}
+}
+
+// IE: blocks while the calls in flight already reach the current limit, or
+// other calls are already waiting, they come first then
+func (l *adaptiveLimiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	l.mu.Lock()
+	if l.inFlight < int(l.limit) && l.queue.size == 0 {
+		l.inFlight++
+		l.mu.Unlock()
+		return l.releaser(), nil
+	}
+	waiter := l.queue.push(jobFrom(ctx))
+	l.mu.Unlock()
+
+	select {
+	case <-waiter.ready:
+		return l.releaser(), nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		granted := waiter.granted
+		if !granted {
+			l.queue.remove(waiter)
+		}
+		l.mu.Unlock()
+		// IE: granted meanwhile, hand the slot over to the next one
+		if granted {
+			l.release()
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func (l *adaptiveLimiter) releaser() func() {
+	var once sync.Once
+	return func() { once.Do(l.release) }
+}
+
+func (l *adaptiveLimiter) release() {
+	l.mu.Lock()
+	l.inFlight--
+	l.dispatchLocked()
+	l.mu.Unlock()
+}
+
+// IE: hands the free slots over to the waiters whose turn it is
+func (l *adaptiveLimiter) dispatchLocked() {
+	for l.inFlight < int(l.limit) {
+		waiter := l.queue.pop()
+		if waiter == nil {
+			return
+		}
+		waiter.granted = true
+		l.inFlight++
+		close(waiter.ready)
+	}
+}
+
+// IE: reported once the response headers (or the error) are in, not on release
+func (l *adaptiveLimiter) observe(throttled bool) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !throttled {
+		if l.limit < l.max {
+			l.limit = math.Min(l.max, l.limit+1/l.limit)
+			l.dispatchLocked()
+		}
+		return
+	}
+
+	l.throttled++
+	if time.Since(l.lastCut) < throttleCooldown {
+		return
+	}
+	l.lastCut = time.Now()
+	l.limit = math.Max(1, l.limit/2)
+	logger.Warn("Upstream is throttling, limiting calls in flight", "limit", int(l.limit))
+}
+
+// IE: on reload. A limit cut by throttling stays where it is and grows back to
+// the new max as usual, otherwise it moves along with it
+func (l *adaptiveLimiter) setMax(max int) {
+	if l == nil || max <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	atMax := l.limit >= l.max
+	l.max = float64(max)
+	if atMax || l.limit > l.max {
+		l.limit = l.max
+	}
+	// IE: a higher limit frees slots for the waiters right away
+	l.dispatchLocked()
+}
+
+func (l *adaptiveLimiter) Limit() int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+func (l *adaptiveLimiter) Queued() int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.queue.size
+}
+
+func (l *adaptiveLimiter) Throttled() uint64 {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.throttled
+}
+
+// IE: 429s, and connections upstream goes away from (http2 GOAWAY, resets)
+func isThrottled(resp *http.Response, err error) bool {
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return false
+		}
+		// IE: net/http doesn't export its http2 GOAWAY error type
+		return strings.Contains(err.Error(), "GOAWAY") || errors.Is(err, syscall.ECONNRESET) ||
+			errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+	}
+	return resp.StatusCode == http.StatusTooManyRequests
+}
+
+// IE: honours Retry-After in seconds, backs off exponentially otherwise
+func throttleWait(resp *http.Response, attempt int) time.Duration {
+	wait := 250 * time.Millisecond << attempt
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			wait = time.Duration(seconds) * time.Second
+		}
+	}
+	if wait > maxThrottleWait {
+		wait = maxThrottleWait
+	}
+	return wait
+}
+
+func registerUpstreamMetrics(registry *prometheus.Registry) {
+	registry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "deps_upstream_concurrency_limit",
+			Help: "Upstream calls currently allowed in flight, lowered while upstream throttles.",
+		}, func() float64 { return float64(upstreamLimiter.Limit()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "deps_upstream_throttled_total",
+			Help: "Upstream calls answered with a 429 or a dropped connection.",
+		}, func() float64 { return float64(upstreamLimiter.Throttled()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "deps_upstream_queued",
+			Help: "Upstream calls waiting for their turn.",
+		}, func() float64 { return float64(upstreamLimiter.Queued()) }),
+	)
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdaptiveLimiterBacksOffAndRecovers(t *testing.T) {
+	// IE: sets up the loggers
+	New()
+	limiter := newAdaptiveLimiter(8)
+
+	limiter.observe(true)
+	assert.Equal(t, 4, limiter.Limit())
+	// IE: same burst, within the cooldown
+	limiter.observe(true)
+	assert.Equal(t, 4, limiter.Limit())
+	assert.Equal(t, uint64(2), limiter.Throttled())
+
+	for i := 0; i < 100; i++ {
+		limiter.observe(false)
+	}
+	assert.Equal(t, 8, limiter.Limit())
+}
+
+func TestAdaptiveLimiterBlocksAtLimit(t *testing.T) {
+	limiter := newAdaptiveLimiter(1)
+
+	release, err := limiter.acquire(context.Background())
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = limiter.acquire(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	acquired := make(chan struct{})
+	go func() {
+		releaseNext, err := limiter.acquire(context.Background())
+		if err == nil {
+			releaseNext()
+		}
+		close(acquired)
+	}()
+	release()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("waiter was not woken up by the release")
+	}
+
+	// IE: nil doesn't limit
+	var unlimited *adaptiveLimiter
+	_, err = unlimited.acquire(context.Background())
+	assert.Nil(t, err)
+}
+
+func TestAdaptiveLimiterSetMax(t *testing.T) {
+	New()
+	limiter := newAdaptiveLimiter(8)
+
+	limiter.setMax(16)
+	assert.Equal(t, 16, limiter.Limit())
+	limiter.setMax(4)
+	assert.Equal(t, 4, limiter.Limit())
+
+	// IE: cut by throttling, grows back to the new max as calls succeed
+	limiter.observe(true)
+	limiter.setMax(8)
+	assert.Equal(t, 2, limiter.Limit())
+	for i := 0; i < 100; i++ {
+		limiter.observe(false)
+	}
+	assert.Equal(t, 8, limiter.Limit())
+
+	// IE: a raised limit lets the waiters in
+	limiter = newAdaptiveLimiter(1)
+	release, err := limiter.acquire(context.Background())
+	require.Nil(t, err)
+	defer release()
+	acquired := make(chan struct{})
+	go func() {
+		if releaseNext, err := limiter.acquire(context.Background()); err == nil {
+			releaseNext()
+		}
+		close(acquired)
+	}()
+	assert.Eventually(t, func() bool { return limiter.Queued() == 1 }, time.Second, time.Millisecond)
+	limiter.setMax(2)
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("waiter was not let in by the raised limit")
+	}
+}
+
+func TestIsThrottled(t *testing.T) {
+	assert.True(t, isThrottled(&http.Response{StatusCode: http.StatusTooManyRequests}, nil))
+	assert.False(t, isThrottled(&http.Response{StatusCode: http.StatusNotFound}, nil))
+	assert.True(t, isThrottled(nil, errors.New("http2: server sent GOAWAY and closed the connection")))
+	assert.True(t, isThrottled(nil, io.ErrUnexpectedEOF))
+	assert.False(t, isThrottled(nil, context.Canceled))
+}
+
+func TestResolveTreeRetriesThrottledCalls(t *testing.T) {
+	var throttled int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&throttled, 1) <= 2 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		switch r.URL.Path {
+		case "/left-pad":
+			_ = json.NewEncoder(w).Encode(npmPackageMetaResponse{Versions: map[string]npmPackageResponse{"1.3.0": {}}})
+		default:
+			_ = json.NewEncoder(w).Encode(npmPackageResponse{Name: "left-pad", Version: "1.3.0"})
+		}
+	}))
+	defer server.Close()
+	New(WithRegistryURL(server.URL), WithUpstreamConcurrency(16))
+
+	root, err := resolveTree(context.Background(), "left-pad", "1.3.0", 0)
+	require.Nil(t, err)
+	assert.Equal(t, "1.3.0", root.Version)
+	assert.Less(t, upstreamLimiter.Limit(), 16)
+}
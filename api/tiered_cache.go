@@ -0,0 +1,90 @@
+package api
+
+import (
+	"time"
+)
+
+// IE: hot entries in memory, whatever the memory tier pushes out spills to disk
+// and gets promoted back on access, so memory stays bounded while the effective
+// cache stays large
+type tieredCache struct {
+	memory *shardedCache
+	disk   *boltCache
+	cacheCounters
+}
+
+func newTieredCache(memory *shardedCache, disk *boltCache) *tieredCache {
+	c := &tieredCache{memory: memory, disk: disk}
+	memory.setOnEvict(c.spill)
+	return c
+}
+
+func (c *tieredCache) spill(key string, value []byte, expires time.Time) {
+	ttl := time.Duration(0)
+	if !expires.IsZero() {
+		ttl = time.Until(expires)
+		if ttl <= 0 {
+			return
+		}
+	}
+	c.disk.Set(key, value, ttl)
+}
+
+func (c *tieredCache) Get(key string) ([]byte, bool) {
+	if value, found := c.memory.Get(key); found {
+		c.record(true)
+		return value, true
+	}
+
+	value, expires, found := c.disk.getWithExpiry(key)
+	if !found {
+		c.record(false)
+		return nil, false
+	}
+
+	// IE: promote, the entry lives in one tier at a time. One expiring right now
+	// would never expire in memory (a ttl of 0), it's a miss instead
+	ttl := time.Duration(0)
+	if !expires.IsZero() {
+		ttl = time.Until(expires)
+		if ttl <= 0 {
+			c.disk.Delete(key)
+			c.record(false)
+			return nil, false
+		}
+	}
+	c.disk.Delete(key)
+	c.memory.Set(key, value, ttl)
+
+	c.record(true)
+	return value, true
+}
+
+func (c *tieredCache) Set(key string, value []byte, ttl time.Duration) {
+	c.disk.Delete(key)
+	c.memory.Set(key, value, ttl)
+}
+
+func (c *tieredCache) Delete(key string) {
+	c.memory.Delete(key)
+	c.disk.Delete(key)
+}
+
+func (c *tieredCache) Entries(prefix string) []CacheEntryInfo {
+	// IE: an entry lives in one tier at a time, so no duplicates here
+	return append(c.memory.Entries(prefix), c.disk.Entries(prefix)...)
+}
+
+func (c *tieredCache) DeletePrefix(prefix string) int {
+	return c.memory.DeletePrefix(prefix) + c.disk.DeletePrefix(prefix)
+}
+
+func (c *tieredCache) Stats() CacheStats {
+	memory, disk := c.memory.Stats(), c.disk.Stats()
+
+	stats := c.stats(CacheBackendTiered, memory.Entries+disk.Entries)
+	stats.Bytes = memory.Bytes
+	// IE: memory evictions are spills, only disk expiries really leave the cache
+	stats.Evictions = disk.Evictions
+	return stats
+}
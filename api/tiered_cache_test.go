@@ -0,0 +1,82 @@
+package api
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTieredCache(t *testing.T, capacity int) *tieredCache {
+	New()
+	disk, err := newBoltCache(filepath.Join(t.TempDir(), "cache.db"))
+	require.Nil(t, err)
+	t.Cleanup(func() { _ = disk.Close() })
+
+	return newTieredCache(newShardedCache(capacity, 0, 1), disk)
+}
+
+func TestTieredCacheSpillsAndPromotes(t *testing.T) {
+	cache := newTestTieredCache(t, 2)
+
+	cache.Set("a", []byte("1"), time.Minute)
+	cache.Set("b", []byte("2"), 0)
+	cache.Set("c", []byte("3"), 0)
+
+	// IE: 'a' got pushed out of memory onto disk
+	_, found := cache.memory.Get("a")
+	assert.False(t, found)
+	_, found = cache.disk.Get("a")
+	assert.True(t, found)
+
+	value, found := cache.Get("a")
+	assert.True(t, found)
+	assert.Equal(t, []byte("1"), value)
+
+	// IE: promoted back, which spilled 'b' in turn
+	_, found = cache.memory.Get("a")
+	assert.True(t, found)
+	_, found = cache.disk.Get("b")
+	assert.True(t, found)
+
+	assert.Equal(t, 3, cache.Stats().Entries)
+}
+
+func TestTieredCacheDelete(t *testing.T) {
+	cache := newTestTieredCache(t, 1)
+
+	cache.Set("tree:react@1.0.0", []byte("1"), 0)
+	cache.Set("tree:react@2.0.0", []byte("2"), 0)
+
+	assert.Equal(t, 2, cache.DeletePrefix("tree:react@"))
+
+	_, found := cache.Get("tree:react@1.0.0")
+	assert.False(t, found)
+	_, found = cache.Get("tree:react@2.0.0")
+	assert.False(t, found)
+}
+
+func TestTieredCacheDoesNotSpillExpired(t *testing.T) {
+	cache := newTestTieredCache(t, 1)
+
+	cache.spill("a", []byte("1"), time.Now().Add(-time.Second))
+
+	_, found := cache.disk.Get("a")
+	assert.False(t, found)
+}
+
+func TestTieredCacheDoesNotPromoteExpired(t *testing.T) {
+	cache := newTestTieredCache(t, 1)
+	// IE: the disk tier still takes it for live, by the time it's promoted it's not
+	cache.disk.now = func() time.Time { return time.Now().Add(-2 * time.Minute) }
+	cache.disk.Set("a", []byte("1"), time.Minute)
+
+	_, found := cache.Get("a")
+	assert.False(t, found)
+	_, found = cache.memory.Get("a")
+	assert.False(t, found)
+	_, found = cache.disk.Get("a")
+	assert.False(t, found)
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const (
+	tracerName = "github.com/snyk/snyk-code-review-exercise/api"
+	// ServiceName is the service.name of the spans exported by NewOTLPTracerProvider.
+	ServiceName = "deps-api"
+)
+
+// IE: no-op unless WithTracerProvider is set, replaced by every New()
+var tracer trace.Tracer = noop.NewTracerProvider().Tracer(tracerName)
+
+// IE: W3C trace context both ways, a traced caller gets our spans in its trace
+// and a traced registry gets its spans in ours
+var propagator propagation.TextMapPropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// NewOTLPTracerProvider returns a tracer provider batching spans to the
+// OTLP/HTTP collector at endpoint (i.e. http://localhost:4318), sampling the
+// given ratio of the traces not already sampled (or not) by the caller. Shut it
+// down on exit, so the spans still batched get exported.
+func NewOTLPTracerProvider(ctx context.Context, endpoint string, sampleRatio float64) (*sdktrace.TracerProvider, error) {
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, err
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", ServiceName))),
+	), nil
+}
+
+// IE: ends the span, flagged as failed when err is set
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// IE: one server span per request, joining the trace of the caller if it sent one
+func traceRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method+" "+r.URL.Path, trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attribute.String("http.request.method", r.Method), attribute.String("url.path", r.URL.Path)))
+		defer span.End()
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		span.SetAttributes(attribute.Int("http.response.status_code", rec.status))
+		if rec.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rec.status))
+		}
+	})
+}
+
+// IE: the request span, named after the route once the router matched it
+func tracePackageRequest(ctx context.Context, name, version string) {
+	span := trace.SpanFromContext(ctx)
+	span.SetName("GET /package/{package}/{version}")
+	span.SetAttributes(attribute.String("http.route", "/package/{package}/{version}"),
+		attribute.String("package.name", name), attribute.String("package.version", version))
+}
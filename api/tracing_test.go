@@ -0,0 +1,130 @@
+package api
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/snyk/snyk-code-review-exercise/internal/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func spanAttributes(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func spansNamed(spans tracetest.SpanStubs, name string) []tracetest.SpanStub {
+	var named []tracetest.SpanStub
+	for _, span := range spans {
+		if span.Name == name {
+			named = append(named, span)
+		}
+	}
+	return named
+}
+
+func TestPackageHandlerTracesResolution(t *testing.T) {
+	var mu sync.Mutex
+	var traceparents []string
+	packages := fixtures.Registry{
+		"a": {"1.0.0": {"b": "^1.0.0"}},
+		"b": {"1.0.0": nil},
+	}
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		traceparents = append(traceparents, r.Header.Get("traceparent"))
+		mu.Unlock()
+		packages.ServeHTTP(w, r)
+	}))
+	defer registry.Close()
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	var logs bytes.Buffer
+	l, err := NewLogger(&logs, LogFormatJSON, slog.LevelInfo)
+	require.Nil(t, err)
+	handler := New(WithRegistryURL(registry.URL), WithTracerProvider(provider), WithLogger(l))
+
+	req := httptest.NewRequest("GET", "/package/a/1.0.0", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	spans := exporter.GetSpans()
+	requests := spansNamed(spans, "GET /package/{package}/{version}")
+	require.Len(t, requests, 1)
+	request := requests[0]
+	// IE: joined the trace of the caller
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", request.SpanContext.TraceID().String())
+	attrs := spanAttributes(request)
+	assert.Equal(t, "a", attrs["package.name"].AsString())
+	assert.Equal(t, cacheStatusMiss, attrs["cache.status"].AsString())
+	assert.Equal(t, int64(http.StatusOK), attrs["http.response.status_code"].AsInt64())
+	// IE: the logs lead to the trace
+	records := readLogRecords(t, &logs)
+	require.NotEmpty(t, records)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", records[len(records)-1]["trace_id"])
+
+	resolves := spansNamed(spans, "resolve tree")
+	require.Len(t, resolves, 1)
+	assert.Equal(t, request.SpanContext.SpanID(), resolves[0].Parent.SpanID())
+	assert.Equal(t, int64(2), spanAttributes(resolves[0])["resolve.nodes"].AsInt64())
+
+	// IE: one per package fetch, b is fetched by its prefetch and by its worker (joining the same call, or from the cache)
+	fetched := map[string]bool{}
+	for _, span := range spansNamed(spans, "fetch packument") {
+		attrs := spanAttributes(span)
+		if !attrs["cache.hit"].AsBool() {
+			fetched[attrs["package.name"].AsString()] = true
+		}
+		assert.Equal(t, request.SpanContext.TraceID(), span.SpanContext.TraceID())
+	}
+	assert.Equal(t, map[string]bool{"a": true, "b": true}, fetched)
+	assert.NotEmpty(t, spansNamed(spans, "fetch version document"))
+
+	calls := spansNamed(spans, "GET")
+	assert.Len(t, calls, 4)
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, traceparents, 4)
+	for _, traceparent := range traceparents {
+		assert.Contains(t, traceparent, "4bf92f3577b34da6a3ce929d0e0e4736")
+	}
+
+	// IE: served from the cache, nothing resolved
+	exporter.Reset()
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/a/1.0.0", nil))
+	spans = exporter.GetSpans()
+	assert.Empty(t, spansNamed(spans, "resolve tree"))
+	requests = spansNamed(spans, "GET /package/{package}/{version}")
+	require.Len(t, requests, 1)
+	assert.Equal(t, cacheStatusHit, spanAttributes(requests[0])["cache.status"].AsString())
+}
+
+func TestFailedFetchesAreFlagged(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{})
+	exporter := tracetest.NewInMemoryExporter()
+	handler := New(WithRegistryURL(registry.URL), WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/missing/1.0.0", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	fetches := spansNamed(exporter.GetSpans(), "fetch packument")
+	require.Len(t, fetches, 1)
+	assert.Equal(t, "Error", fetches[0].Status.Code.String())
+	assert.Contains(t, fetches[0].Status.Description, "missing")
+}
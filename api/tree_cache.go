@@ -0,0 +1,180 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IE: values of the X-Cache-Status response header
+const (
+	cacheStatusHit   = "hit"
+	cacheStatusMiss  = "miss"
+	cacheStatusStale = "stale"
+)
+
+// IE: the server wide limit can only be lowered by the request, 0 means unlimited
+func requestMaxDepth(query url.Values) (int, error) {
+	maxDepth := live().maxDepth
+	value := strings.TrimSpace(query.Get("maxDepth"))
+	if value == "" {
+		return maxDepth, nil
+	}
+
+	requested, err := strconv.Atoi(value)
+	if err != nil || requested < 1 {
+		return 0, fmt.Errorf("%w: maxDepth must be a positive integer, got %q", ErrInvalidQuery, value)
+	}
+	if maxDepth == 0 || requested < maxDepth {
+		maxDepth = requested
+	}
+	return maxDepth, nil
+}
+
+// IE: what ?stats= and ?maintenance= add to a resolved tree
+type treeAnnotations struct {
+	stats       bool
+	maintenance bool
+}
+
+func requestAnnotations(query url.Values) (treeAnnotations, error) {
+	stats, err := requestStats(query)
+	if err != nil {
+		return treeAnnotations{}, err
+	}
+	maintenance, err := requestMaintenance(query)
+	if err != nil {
+		return treeAnnotations{}, err
+	}
+	return treeAnnotations{stats: stats, maintenance: maintenance}, nil
+}
+
+// IE: keys currently re-resolved in the background, one revalidation per key is plenty
+var revalidating sync.Map
+
+// IE: either a cached document or a freshly resolved tree, the latter is only
+// encoded while written out, and cached on the way
+type treeResponse struct {
+	status   string
+	cached   []byte
+	root     *NpmPackageVersion
+	cacheKey string
+}
+
+// IE: may only be called once, the resolved nodes are recycled afterwards
+func (t *treeResponse) WriteTo(w io.Writer) (int64, error) {
+	if t.root == nil {
+		n, err := w.Write(t.cached)
+		return int64(n), err
+	}
+	defer releaseTree(t.root)
+	return streamAndCacheTree(w, t.cacheKey, t.root)
+}
+
+// IE: serve from the response cache, resolve otherwise, the cache is filled once the tree is written out
+func cachedTree(ctx context.Context, pkgName, pkgVersion string, query url.Values) (*treeResponse, error) {
+	maxDepth, err := requestMaxDepth(query)
+	if err != nil {
+		return nil, err
+	}
+	annotations, err := requestAnnotations(query)
+	if err != nil {
+		return nil, err
+	}
+	cacheKey := treeCacheKey(ctx, pkgName, pkgVersion, query)
+
+	if cached, found := responseCache.Get(cacheKey); found {
+		tree, freshUntil, ok := decodeTreeEntry(cached)
+		if ok {
+			if freshUntil.IsZero() || time.Now().Before(freshUntil) {
+				// IE: request is identical to a previous one, return from cached response
+				return &treeResponse{status: cacheStatusHit, cached: tree}, nil
+			}
+
+			// IE: past its TTL but within the stale window, trade slight staleness for latency
+			if _, already := revalidating.LoadOrStore(cacheKey, struct{}{}); !already {
+				go revalidateTree(cacheKey, pkgName, pkgVersion, maxDepth, annotations)
+			}
+			return &treeResponse{status: cacheStatusStale, cached: tree}, nil
+		}
+		responseCache.Delete(cacheKey)
+	}
+
+	root, err := resolveAnnotatedTree(ctx, pkgName, pkgVersion, maxDepth, annotations)
+	if err != nil {
+		return nil, err
+	}
+	return &treeResponse{status: cacheStatusMiss, root: root, cacheKey: cacheKey}, nil
+}
+
+// IE: detached from the request that triggered it, it has already been answered
+func revalidateTree(cacheKey, pkgName, pkgVersion string, maxDepth int, annotations treeAnnotations) {
+	defer revalidating.Delete(cacheKey)
+
+	root, err := resolveAnnotatedTree(withJob(context.Background(), backgroundClient), pkgName, pkgVersion, maxDepth, annotations)
+	if err == nil {
+		_, err = streamAndCacheTree(io.Discard, cacheKey, root)
+		releaseTree(root)
+	}
+	if err != nil {
+		logger.Error("Could not revalidate", "package", pkgName, "version", pkgVersion, "error", err)
+		return
+	}
+	logger.Debug("Revalidated", "package", pkgName, "version", pkgVersion)
+}
+
+// IE: the entry is built in place behind its header, the document is never held twice
+func streamAndCacheTree(w io.Writer, cacheKey string, root *NpmPackageVersion) (int64, error) {
+	// IE: which nodes got cut depends on the scheduling, the next request may as well get another partial tree
+	if root.Partial {
+		counted := &countingWriter{w: w}
+		err := streamTree(counted, root)
+		return counted.n, err
+	}
+
+	// IE: keep the entry around for the stale window on top of its TTL
+	ttl := ttlFor(cacheKey)
+	var freshUntil time.Time
+	if ttl > 0 {
+		freshUntil = time.Now().Add(ttl)
+		ttl += live().staleWindow
+	}
+
+	entry := bytes.NewBuffer(encodeTreeEntry(nil, freshUntil))
+	tee := &cacheTeeWriter{entry: entry, client: w}
+	if err := streamTree(tee, root); err != nil {
+		return 0, err
+	}
+
+	responseCache.Set(cacheKey, entry.Bytes(), ttl)
+	return int64(entry.Len() - 8), tee.clientErr
+}
+
+// IE: entries are <8 bytes unix nano fresh until><tree json>, a zero fresh until never goes stale
+func encodeTreeEntry(tree []byte, freshUntil time.Time) []byte {
+	entry := make([]byte, 8+len(tree))
+	if !freshUntil.IsZero() {
+		binary.BigEndian.PutUint64(entry[:8], uint64(freshUntil.UnixNano()))
+	}
+	copy(entry[8:], tree)
+	return entry
+}
+
+func decodeTreeEntry(entry []byte) ([]byte, time.Time, bool) {
+	if len(entry) < 8 {
+		return nil, time.Time{}, false
+	}
+
+	var freshUntil time.Time
+	if nanos := int64(binary.BigEndian.Uint64(entry[:8])); nanos != 0 {
+		freshUntil = time.Unix(0, nanos)
+	}
+	return entry[8:], freshUntil, true
+}
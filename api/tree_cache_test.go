@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTreeEntryRoundTrip(t *testing.T) {
+	freshUntil := time.Unix(0, time.Now().UnixNano())
+
+	tree, decodedFreshUntil, ok := decodeTreeEntry(encodeTreeEntry([]byte(`{"name":"react"}`), freshUntil))
+	require.True(t, ok)
+	assert.Equal(t, []byte(`{"name":"react"}`), tree)
+	assert.True(t, freshUntil.Equal(decodedFreshUntil))
+
+	_, decodedFreshUntil, ok = decodeTreeEntry(encodeTreeEntry([]byte("{}"), time.Time{}))
+	require.True(t, ok)
+	assert.True(t, decodedFreshUntil.IsZero())
+
+	_, _, ok = decodeTreeEntry([]byte("{}"))
+	assert.False(t, ok)
+}
+
+func TestCachedTreeStaleWhileRevalidate(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{
+		"left-pad": {"1.3.0": nil},
+	})
+	handler := New(WithRegistryURL(registry.URL), WithResponseCache(10, time.Minute), WithStaleWhileRevalidate(time.Hour))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/left-pad/1.3.0", nil))
+	require.Equal(t, 200, rec.Code)
+	assert.Equal(t, cacheStatusMiss, rec.Header().Get("X-Cache-Status"))
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/left-pad/1.3.0", nil))
+	assert.Equal(t, cacheStatusHit, rec.Header().Get("X-Cache-Status"))
+
+	// IE: age the entry past its TTL
+	key := treeCacheKey(context.Background(), "left-pad", "1.3.0", nil)
+	cached, _ := responseCache.Get(key)
+	tree, _, _ := decodeTreeEntry(cached)
+	responseCache.Set(key, encodeTreeEntry(tree, time.Now().Add(-time.Second)), time.Hour)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/left-pad/1.3.0", nil))
+	assert.Equal(t, cacheStatusStale, rec.Header().Get("X-Cache-Status"))
+	assert.Equal(t, tree, rec.Body.Bytes())
+
+	assert.Eventually(t, func() bool {
+		cached, _ := responseCache.Get(key)
+		_, freshUntil, _ := decodeTreeEntry(cached)
+		return freshUntil.After(time.Now())
+	}, time.Second, 10*time.Millisecond)
+
+	// IE: don't leave the revalidation running into the next test
+	assert.Eventually(t, func() bool {
+		_, running := revalidating.Load(key)
+		return !running
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRequestMaxDepth(t *testing.T) {
+	New(WithMaxDepth(5))
+
+	maxDepth, err := requestMaxDepth(nil)
+	require.Nil(t, err)
+	assert.Equal(t, 5, maxDepth)
+
+	maxDepth, err = requestMaxDepth(url.Values{"maxDepth": {"2"}})
+	require.Nil(t, err)
+	assert.Equal(t, 2, maxDepth)
+
+	// IE: requests can't go past the server wide limit
+	maxDepth, err = requestMaxDepth(url.Values{"maxDepth": {"10"}})
+	require.Nil(t, err)
+	assert.Equal(t, 5, maxDepth)
+
+	_, err = requestMaxDepth(url.Values{"maxDepth": {"-1"}})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+}
+
+func TestPackageHandlerRejectsInvalidMaxDepth(t *testing.T) {
+	handler := New()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/left-pad/1.3.0?maxDepth=deep", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestCachedTreeSurvivesLargeResolution(t *testing.T) {
+	packages := map[string]map[string]map[string]string{
+		"left-pad": {"1.3.0": nil},
+		"big":      {"1.0.0": {}},
+	}
+	for i := 0; i < 50; i++ {
+		name := fmt.Sprintf("dep-%d", i)
+		packages["big"]["1.0.0"][name] = "^1.0.0"
+		packages[name] = map[string]map[string]string{"1.0.0": nil}
+	}
+	registry := newFakeRegistry(t, packages)
+	handler := New(WithRegistryURL(registry.URL), WithResponseCache(4, time.Minute), WithCacheShards(1))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/left-pad/1.3.0", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/big/1.0.0", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, hasCachedSubtree("dep-0@1.0.0"))
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/left-pad/1.3.0", nil))
+	assert.Equal(t, cacheStatusHit, rec.Header().Get("X-Cache-Status"))
+}
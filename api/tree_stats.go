@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// TreeStats are the metrics of a resolved tree, on its root with ?stats=true.
+type TreeStats struct {
+	// UniquePackages counts the distinct name@version of the tree.
+	UniquePackages int `json:"uniquePackages"`
+	// DuplicatedPackages counts the names resolved to more than one version.
+	DuplicatedPackages int `json:"duplicatedPackages"`
+	// MaxDepth is the depth of the deepest node, the root is at 0.
+	MaxDepth int `json:"maxDepth"`
+	// AverageFanOut is the mean number of dependencies of the unique packages.
+	AverageFanOut float64 `json:"averageFanOut"`
+	// ResolutionMs is the wall time of the resolution, cached trees keep the
+	// one they were resolved in.
+	ResolutionMs int64 `json:"resolutionMs"`
+	// UpstreamCalls counts the registry (and CDN) calls of the resolution.
+	UpstreamCalls int64 `json:"upstreamCalls"`
+}
+
+func requestStats(query url.Values) (bool, error) {
+	value := strings.TrimSpace(query.Get("stats"))
+	if value == "" {
+		return false, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%w: stats must be a boolean, got %q", ErrInvalidQuery, value)
+	}
+	return enabled, nil
+}
+
+// IE: a version shows up under several parents, and with fewer dependencies
+// where a cycle or the depth limit cut it, its fan-out is the one of the
+// instance expanded the most
+type treeStatsCounter struct {
+	fanOut   map[string]int
+	versions map[string]int
+	maxDepth int
+}
+
+func newTreeStatsCounter() *treeStatsCounter {
+	return &treeStatsCounter{fanOut: make(map[string]int), versions: make(map[string]int)}
+}
+
+func (c *treeStatsCounter) add(name, version string, depth, dependencies int) {
+	key := name + "@" + version
+	if previous, found := c.fanOut[key]; !found {
+		c.versions[name]++
+		c.fanOut[key] = dependencies
+	} else if dependencies > previous {
+		c.fanOut[key] = dependencies
+	}
+	c.maxDepth = max(c.maxDepth, depth)
+}
+
+func (c *treeStatsCounter) stats(elapsed time.Duration, upstreamCalls int64) *TreeStats {
+	stats := &TreeStats{UniquePackages: len(c.fanOut), MaxDepth: c.maxDepth, ResolutionMs: elapsed.Milliseconds(), UpstreamCalls: upstreamCalls}
+	for _, versions := range c.versions {
+		if versions > 1 {
+			stats.DuplicatedPackages++
+		}
+	}
+	dependencies := 0
+	for _, fanOut := range c.fanOut {
+		dependencies += fanOut
+	}
+	if len(c.fanOut) > 0 {
+		stats.AverageFanOut = math.Round(float64(dependencies)/float64(len(c.fanOut))*100) / 100
+	}
+	return stats
+}
+
+// IE: the cached tree keeps the stats (and scores) it was resolved with, the
+// variants of ?stats=true and ?maintenance=true are cached apart so the
+// default trees don't carry them
+func resolveAnnotatedTree(ctx context.Context, pkgName, pkgVersion string, maxDepth int, annotations treeAnnotations) (*NpmPackageVersion, error) {
+	ctx, upstream := requestResolutionStats(ctx)
+	start := time.Now()
+	root, err := resolveTree(ctx, pkgName, pkgVersion, maxDepth)
+	if err == nil {
+		recordResolution(pkgVersion, maxDepth, root, false)
+	}
+	if err == nil && annotations.maintenance {
+		annotateMaintenance(ctx, root)
+	}
+	if err != nil || !annotations.stats {
+		return root, err
+	}
+
+	counter := newTreeStatsCounter()
+	type visit struct {
+		pkg   *NpmPackageVersion
+		depth int
+	}
+	stack := []visit{{root, 0}}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		counter.add(node.pkg.Name, node.pkg.Version, node.depth, len(node.pkg.Dependencies))
+		for _, dep := range node.pkg.Dependencies {
+			if dep != nil {
+				stack = append(stack, visit{dep, node.depth + 1})
+			}
+		}
+	}
+	root.Stats = counter.stats(time.Since(start), atomic.LoadInt64(&upstream.upstreamCalls))
+	return root, nil
+}
+
+// IE: one per node written, ids start at 1 so the node of id is at id-1
+type streamedNode struct {
+	name         string
+	version      string
+	depth        int
+	dependencies int
+}
+
+// IE: called with the stream locked
+func (s *nodeStream) countNode(parent uint64, pkg *NpmPackageVersion) {
+	depth := 0
+	if parent > 0 {
+		s.counted[parent-1].dependencies++
+		depth = s.counted[parent-1].depth + 1
+	}
+	s.counted = append(s.counted, streamedNode{name: pkg.Name, version: pkg.Version, depth: depth})
+}
+
+// IE: last line of the stream with ?stats=true, before the partial one
+func (s *nodeStream) writeStats(start time.Time, upstreamCalls int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counter := newTreeStatsCounter()
+	for _, node := range s.counted {
+		counter.add(node.name, node.version, node.depth, node.dependencies)
+	}
+	return s.enc.Encode(struct {
+		Stats *TreeStats `json:"stats"`
+	}{counter.stats(time.Since(start), upstreamCalls)})
+}
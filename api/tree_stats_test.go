@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func statsRegistry(t *testing.T) *fakeRegistry {
+	return newFakeRegistry(t, map[string]map[string]map[string]string{
+		"app": {"1.0.0": {"a": "^1.0.0", "b": "^1.0.0"}},
+		"a":   {"1.0.0": {"c": "^1.0.0"}},
+		"b":   {"1.0.0": {"a": "^1.0.0", "c": "^2.0.0"}},
+		"c":   {"1.0.0": nil, "2.0.0": nil},
+	})
+}
+
+func TestTreeStats(t *testing.T) {
+	registry := statsRegistry(t)
+	handler := New(WithRegistryURL(registry.URL))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0?stats=true", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var tree NpmPackageVersion
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &tree))
+	require.NotNil(t, tree.Stats)
+	assert.Equal(t, 5, tree.Stats.UniquePackages)
+	assert.Equal(t, 1, tree.Stats.DuplicatedPackages)
+	assert.Equal(t, 3, tree.Stats.MaxDepth)
+	assert.Equal(t, 1.0, tree.Stats.AverageFanOut)
+	assert.Positive(t, tree.Stats.UpstreamCalls)
+	assert.Nil(t, tree.Dependencies["a"].Stats)
+
+	// IE: the stats of the resolution the cached tree comes from
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0?stats=1", nil))
+	assert.Equal(t, cacheStatusHit, rec.Header().Get("X-Cache-Status"))
+	var cached NpmPackageVersion
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &cached))
+	assert.Equal(t, tree.Stats, cached.Stats)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0", nil))
+	assert.Equal(t, cacheStatusMiss, rec.Header().Get("X-Cache-Status"))
+	assert.NotContains(t, rec.Body.String(), `"stats"`)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0?stats=maybe", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "invalid_query", decodeErrorPayload(t, rec).Code)
+}
+
+func TestTreeStatsNDJSON(t *testing.T) {
+	registry := statsRegistry(t)
+	handler := New(WithRegistryURL(registry.URL))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0?format=ndjson&stats=true", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	lines := readNDJSON(t, rec.Body.String())
+	require.Len(t, lines, 8)
+	stats := lines[7]["stats"].(map[string]interface{})
+	assert.Equal(t, 5.0, stats["uniquePackages"])
+	assert.Equal(t, 1.0, stats["duplicatedPackages"])
+	assert.Equal(t, 3.0, stats["maxDepth"])
+	assert.Equal(t, 1.0, stats["averageFanOut"])
+}
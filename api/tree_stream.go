@@ -0,0 +1,199 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// IE: same bytes as json.MarshalIndent(root, "", "  "), the fields in the
+// order of NpmPackageVersion, written node by node
+// instead of building the whole document in memory first (json.Encoder does
+// that as well, twice with SetIndent)
+func streamTree(w io.Writer, root *NpmPackageVersion) error {
+	buffered := streamBufferPool.Get().(*bufio.Writer)
+	buffered.Reset(w)
+	defer func() {
+		buffered.Reset(nil)
+		streamBufferPool.Put(buffered)
+	}()
+
+	if err := writeTreeNode(buffered, root, ""); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+var streamBufferPool = sync.Pool{
+	New: func() interface{} {
+		return bufio.NewWriterSize(nil, 32<<10)
+	},
+}
+
+func writeTreeNode(w *bufio.Writer, pkg *NpmPackageVersion, indent string) error {
+	if pkg == nil {
+		_, err := w.WriteString("null")
+		return err
+	}
+
+	inner := indent + "  "
+	w.WriteString("{\n" + inner + `"name": `)
+	writeJSONString(w, pkg.Name)
+	w.WriteString(",\n" + inner + `"version": `)
+	writeJSONString(w, pkg.Version)
+	w.WriteString(",\n" + inner + `"dependencies": `)
+	if err := writeTreeDependencies(w, pkg.Dependencies, inner); err != nil {
+		return err
+	}
+
+	if pkg.Tarball != nil {
+		tarball, err := json.MarshalIndent(pkg.Tarball, inner, "  ")
+		if err != nil {
+			return err
+		}
+		w.WriteString(",\n" + inner + `"tarball": `)
+		w.Write(tarball)
+	}
+	if pkg.Partial {
+		w.WriteString(",\n" + inner + `"partial": true`)
+	}
+	if pkg.Policy != "" {
+		w.WriteString(",\n" + inner + `"policy": `)
+		writeJSONString(w, pkg.Policy)
+	}
+	if pkg.Provenance != "" {
+		w.WriteString(",\n" + inner + `"provenance": `)
+		writeJSONString(w, pkg.Provenance)
+	}
+	if pkg.Typosquat != "" {
+		w.WriteString(",\n" + inner + `"typosquat": `)
+		writeJSONString(w, pkg.Typosquat)
+	}
+	if len(pkg.InstallScripts) > 0 {
+		scripts, err := json.MarshalIndent(pkg.InstallScripts, inner, "  ")
+		if err != nil {
+			return err
+		}
+		w.WriteString(",\n" + inner + `"installScripts": `)
+		w.Write(scripts)
+	}
+	if pkg.Native != "" {
+		w.WriteString(",\n" + inner + `"native": `)
+		writeJSONString(w, pkg.Native)
+	}
+	if len(pkg.Advisories) > 0 {
+		advisories, err := json.MarshalIndent(pkg.Advisories, inner, "  ")
+		if err != nil {
+			return err
+		}
+		w.WriteString(",\n" + inner + `"advisories": `)
+		w.Write(advisories)
+	}
+	if pkg.Maintenance != nil {
+		maintenance, err := json.MarshalIndent(pkg.Maintenance, inner, "  ")
+		if err != nil {
+			return err
+		}
+		w.WriteString(",\n" + inner + `"maintenance": `)
+		w.Write(maintenance)
+	}
+	if pkg.Stats != nil {
+		stats, err := json.MarshalIndent(pkg.Stats, inner, "  ")
+		if err != nil {
+			return err
+		}
+		w.WriteString(",\n" + inner + `"stats": `)
+		w.Write(stats)
+	}
+
+	_, err := w.WriteString("\n" + indent + "}")
+	return err
+}
+
+// IE: keys sorted like encoding/json does, so the output doesn't depend on map order
+func writeTreeDependencies(w *bufio.Writer, deps map[string]*NpmPackageVersion, indent string) error {
+	if deps == nil {
+		_, err := w.WriteString("null")
+		return err
+	}
+	if len(deps) == 0 {
+		_, err := w.WriteString("{}")
+		return err
+	}
+
+	names := make([]string, 0, len(deps))
+	for name := range deps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	inner := indent + "  "
+	w.WriteString("{")
+	for i, name := range names {
+		if i > 0 {
+			w.WriteString(",")
+		}
+		w.WriteString("\n" + inner)
+		writeJSONString(w, name)
+		w.WriteString(": ")
+		if err := writeTreeNode(w, deps[name], inner); err != nil {
+			return err
+		}
+	}
+	_, err := w.WriteString("\n" + indent + "}")
+	return err
+}
+
+// IE: bufio.Writer keeps the first error and reports it on Flush, no need to check every write
+func writeJSONString(w *bufio.Writer, s string) {
+	// IE: plain names and versions need no escaping, saves an allocation for nearly all of them
+	if isPlainJSONString(s) {
+		w.WriteByte('"')
+		w.WriteString(s)
+		w.WriteByte('"')
+		return
+	}
+	encoded, _ := json.Marshal(s)
+	w.Write(encoded)
+}
+
+func isPlainJSONString(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c >= 0x7f || strings.IndexByte(`"\<>&`, c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// IE: tees the tree into the cache entry while streaming it, a client going
+// away mid response must not prevent the entry from being cached
+type cacheTeeWriter struct {
+	entry     *bytes.Buffer
+	client    io.Writer
+	clientErr error
+}
+
+func (t *cacheTeeWriter) Write(p []byte) (int, error) {
+	t.entry.Write(p)
+	if t.clientErr == nil {
+		_, t.clientErr = t.client.Write(p)
+	}
+	return len(p), nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamTreeMatchesMarshalIndent(t *testing.T) {
+	fixture, err := os.ReadFile(filepath.Join("testdata", "react-16.13.0.json"))
+	require.Nil(t, err)
+
+	var root NpmPackageVersion
+	require.Nil(t, json.Unmarshal(fixture, &root))
+	root.Dependencies["object-assign"].Tarball = &TarballInfo{URL: "https://registry.npmjs.org/object-assign/-/object-assign-4.1.1.tgz", Size: 4152, Verified: true}
+	root.Dependencies["weird\"<name>"] = &NpmPackageVersion{Name: "weird\"<name>", Version: "1.0.0"}
+	root.Partial = true
+
+	expected, err := json.MarshalIndent(&root, "", "  ")
+	require.Nil(t, err)
+
+	var streamed bytes.Buffer
+	require.Nil(t, streamTree(&streamed, &root))
+	assert.Equal(t, string(expected), streamed.String())
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("client went away")
+}
+
+func TestStreamTreeMatchesMarshalIndentWithEveryField(t *testing.T) {
+	node := func(name string) *NpmPackageVersion {
+		return &NpmPackageVersion{
+			Name:           name,
+			Version:        "1.0.0",
+			Dependencies:   map[string]*NpmPackageVersion{},
+			Tarball:        &TarballInfo{URL: "https://registry.npmjs.org/" + name + "/-/" + name + "-1.0.0.tgz", Integrity: "sha512-abc", Size: 1024, Verified: true},
+			Partial:        true,
+			Policy:         "denied by license",
+			Provenance:     ProvenanceVerified,
+			Typosquat:      "lodash",
+			InstallScripts: []string{"preinstall", "postinstall"},
+			Native:         "binding.gyp",
+			Advisories:     []Advisory{{ID: 1, Severity: "high", Title: "Prototype pollution", URL: "https://github.com/advisories/1"}, {ID: 2, Severity: "low"}},
+			Maintenance:    &MaintenanceScore{Score: 70, LastPublish: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), ReleasesLastYear: 4, Maintainers: 2},
+			Stats:          &TreeStats{UniquePackages: 2, DuplicatedPackages: 1, MaxDepth: 1, AverageFanOut: 0.5, ResolutionMs: 12, UpstreamCalls: 3},
+		}
+	}
+	root := node("app")
+	root.Dependencies["lodahs"] = node("lodahs")
+	// IE: empty, omitted all the same
+	root.Dependencies["plain"] = &NpmPackageVersion{Name: "plain", Version: "1.0.0", InstallScripts: []string{}, Advisories: []Advisory{}}
+
+	expected, err := json.MarshalIndent(root, "", "  ")
+	require.Nil(t, err)
+
+	var streamed bytes.Buffer
+	require.Nil(t, streamTree(&streamed, root))
+	assert.Equal(t, string(expected), streamed.String())
+}
+
+func TestStreamAndCacheTreeCachesDespiteClientErrors(t *testing.T) {
+	New()
+
+	root := &NpmPackageVersion{Name: "left-pad", Version: "1.3.0", Dependencies: map[string]*NpmPackageVersion{}}
+	_, err := streamAndCacheTree(failingWriter{}, treeKeyPrefix+"left-pad@1.3.0", root)
+	assert.NotNil(t, err)
+
+	cached, found := responseCache.Get(treeKeyPrefix + "left-pad@1.3.0")
+	require.True(t, found)
+	tree, _, ok := decodeTreeEntry(cached)
+	require.True(t, ok)
+	assert.JSONEq(t, `{"name": "left-pad", "version": "1.3.0", "dependencies": {}}`, string(tree))
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/gorilla/mux"
+)
+
+const trendRoute = "trend"
+
+// IE: the granularities of ?every=, the last release of each is kept
+var trendGranularities = map[string]func(v *semver.Version) string{
+	"major": func(v *semver.Version) string { return fmt.Sprint(v.Major()) },
+	"minor": func(v *semver.Version) string { return fmt.Sprintf("%d.%d", v.Major(), v.Minor()) },
+	"patch": func(v *semver.Version) string { return v.String() },
+}
+
+// IE: a release of the package and what its tree holds
+type trendPoint struct {
+	Version        string `json:"version"`
+	UniquePackages int    `json:"uniquePackages"`
+	Depth          int    `json:"depth"`
+	Partial        bool   `json:"partial,omitempty"`
+	// IE: against the previous point, 0 for the first
+	UniquePackagesChange int `json:"uniquePackagesChange"`
+	DepthChange          int `json:"depthChange"`
+	// IE: history or resolved
+	Source string `json:"source"`
+}
+
+// IE: the stable versions ?range= accepts (every one by default), the last
+// release of each ?every= (minor by default), the ?limit= most recent of them
+func trendVersions(name string, meta *npmPackageMetaResponse, query url.Values) ([]string, error) {
+	constraint := (*semver.Constraints)(nil)
+	if value := strings.TrimSpace(query.Get("range")); value != "" {
+		parsed, err := semver.NewConstraint(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: range %q: %w", ErrInvalidQuery, value, err)
+		}
+		constraint = parsed
+	}
+	every := strings.ToLower(strings.TrimSpace(query.Get("every")))
+	if every == "" {
+		every = "minor"
+	}
+	group, found := trendGranularities[every]
+	if !found {
+		return nil, fmt.Errorf("%w: every must be major, minor or patch, got %q", ErrInvalidQuery, every)
+	}
+	limit, err := requestLimit(query)
+	if err != nil {
+		return nil, err
+	}
+
+	// IE: ascending, the last of a group is its last release
+	var versions []string
+	lastGroup := ""
+	for _, version := range parsedVersionsCache.sortedVersions(name, meta) {
+		if version.Prerelease() != "" || (constraint != nil && !constraint.Check(version)) {
+			continue
+		}
+		if g := group(version); g == lastGroup && len(versions) > 0 {
+			versions[len(versions)-1] = version.Original()
+		} else {
+			lastGroup = g
+			versions = append(versions, version.Original())
+		}
+	}
+	if len(versions) > limit {
+		versions = versions[len(versions)-limit:]
+	}
+	return versions, nil
+}
+
+// IE: the last resolution kept for the version when it was resolved under the
+// same depth limit, fully
+func recordedTrendPoint(name, version string) (trendPoint, bool) {
+	if history == nil {
+		return trendPoint{}, false
+	}
+	records, err := history.list(name, version, 1)
+	if err != nil || len(records) == 0 || records[0].Partial || records[0].MaxDepth != live().maxDepth {
+		return trendPoint{}, false
+	}
+	return trendPoint{Version: version, UniquePackages: len(records[0].Packages), Depth: records[0].Depth, Source: "history"}, true
+}
+
+// IE: one after the other, the releases of a package share most of their
+// subtrees, the later ones find them cached
+func dependencyTrend(ctx context.Context, name string, query url.Values) ([]trendPoint, error) {
+	meta, err := fetchPackageMeta(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("fetching package meta for %s: %w", name, err)
+	}
+	versions, err := trendVersions(name, meta, query)
+	if err != nil {
+		return nil, err
+	}
+
+	points := make([]trendPoint, 0, len(versions))
+	for _, version := range versions {
+		point, found := recordedTrendPoint(name, version)
+		if !found {
+			tree, release, _, err := loadTree(ctx, name, version, url.Values{})
+			if err != nil {
+				return nil, err
+			}
+			record := newHistoryRecord(version, live().maxDepth, tree, false, time.Now())
+			release()
+			point = trendPoint{Version: version, UniquePackages: len(record.Packages), Depth: record.Depth, Partial: record.Partial, Source: "resolved"}
+		}
+		if len(points) > 0 {
+			previous := points[len(points)-1]
+			point.UniquePackagesChange = point.UniquePackages - previous.UniquePackages
+			point.DepthChange = point.Depth - previous.Depth
+		}
+		points = append(points, point)
+	}
+	return points, nil
+}
+
+func trendHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	pkgName := mux.Vars(r)["package"]
+	log := requestLogger(r, pkgName, "")
+	r = r.WithContext(withLogger(r.Context(), log))
+	if err := checkPackageInput(pkgName, "*"); err != nil {
+		httpError(w, r, err)
+		return
+	}
+
+	ctx, _ := requestResolutionStats(r.Context())
+	points, err := dependencyTrend(ctx, pkgName, r.URL.Query())
+	if err != nil {
+		writeResolveError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(struct {
+		Name   string       `json:"name"`
+		Points []trendPoint `json:"points"`
+	}{pkgName, points}); err != nil {
+		log.Debug("Could not write response", "error", err)
+	}
+	log.Info("Trend completed", "duration", time.Since(start), "versions", len(points))
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/snyk/snyk-code-review-exercise/internal/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type trendResponse struct {
+	Name   string       `json:"name"`
+	Points []trendPoint `json:"points"`
+}
+
+var trendFixtures = fixtures.Registry{
+	"lib": {
+		"1.0.0":      {"a": "^1.0.0"},
+		"1.0.1":      {"a": "^1.0.0", "b": "^1.0.0"},
+		"1.1.0":      {"a": "^1.0.0", "b": "^1.0.0", "c": "^1.0.0"},
+		"2.0.0-rc.1": nil,
+		"2.0.0":      {"c": "^1.0.0"},
+	},
+	"a": {"1.0.0": {"b": "^1.0.0"}},
+	"b": {"1.0.0": nil},
+	"c": {"1.0.0": nil},
+}
+
+func getTrend(t *testing.T, handler http.Handler, path string) trendResponse {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var trend trendResponse
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &trend))
+	return trend
+}
+
+func TestDependencyTrend(t *testing.T) {
+	handler := New(WithRegistryURL(newFakeRegistry(t, trendFixtures).URL))
+
+	trend := getTrend(t, handler, "/trend/lib")
+	assert.Equal(t, "lib", trend.Name)
+	assert.Equal(t, []trendPoint{
+		{Version: "1.0.1", UniquePackages: 2, Depth: 2, Source: "resolved"},
+		{Version: "1.1.0", UniquePackages: 3, Depth: 2, UniquePackagesChange: 1, Source: "resolved"},
+		{Version: "2.0.0", UniquePackages: 1, Depth: 1, UniquePackagesChange: -2, DepthChange: -1, Source: "resolved"},
+	}, trend.Points)
+
+	trend = getTrend(t, handler, "/trend/lib?range=1.x&every=patch")
+	require.Len(t, trend.Points, 3)
+	assert.Equal(t, "1.0.0", trend.Points[0].Version)
+	assert.Equal(t, 2, trend.Points[0].UniquePackages)
+	assert.Equal(t, 0, trend.Points[1].UniquePackagesChange)
+
+	trend = getTrend(t, handler, "/trend/lib?every=major&limit=1")
+	require.Len(t, trend.Points, 1)
+	assert.Equal(t, "2.0.0", trend.Points[0].Version)
+
+	for _, query := range []string{"?every=week", "?range=nope", "?limit=0"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/trend/lib"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+}
+
+func TestDependencyTrendFromHistory(t *testing.T) {
+	handler := New(WithRegistryURL(newFakeRegistry(t, trendFixtures).URL), WithResolutionHistory(filepath.Join(t.TempDir(), "history.db"), 0))
+	t.Cleanup(func() { New() })
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/lib/1.1.0", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	trend := getTrend(t, handler, "/trend/lib?range=>=1.1.0")
+	require.Len(t, trend.Points, 2)
+	assert.Equal(t, trendPoint{Version: "1.1.0", UniquePackages: 3, Depth: 2, Source: "history"}, trend.Points[0])
+	assert.Equal(t, "resolved", trend.Points[1].Source)
+}
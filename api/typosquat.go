@@ -0,0 +1,153 @@
+package api
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// IE: the names of the trees served lately, the ones past it are checked again
+const typosquatVerdicts = 16384
+
+// IE: among the most downloaded packages of the registry, the ones worth
+// squatting. -typosquat-list replaces them with an organization's own top list
+// (popular packages close to one another, i.e. "color" and "colors", are both
+// in so neither gets flagged)
+var popularPackages = []string{
+	"@babel/core", "@types/node", "@types/react", "ajv", "angular", "async",
+	"axios", "babel-core", "babel-loader", "bluebird", "body-parser", "chalk",
+	"cheerio", "classnames", "color", "colors", "commander", "cookie",
+	"cookie-parser", "core-js", "cors", "cross-env", "css-loader", "dayjs",
+	"debug", "dotenv", "electron", "eslint", "eslint-plugin-react",
+	"event-stream", "express", "fs-extra", "glob", "graphql", "gulp",
+	"handlebars", "inherits", "inquirer", "jest", "jquery", "js-yaml",
+	"jsonwebtoken", "lodash", "mime", "minimatch", "minimist", "mkdirp",
+	"mocha", "moment", "mongodb", "mongoose", "morgan", "mysql", "next",
+	"node-fetch", "node-sass", "nodemailer", "nodemon", "prettier",
+	"prop-types", "puppeteer", "react", "react-dom", "react-redux",
+	"react-router", "react-router-dom", "readable-stream", "redis", "redux",
+	"request", "rimraf", "rxjs", "safe-buffer", "semver", "sequelize",
+	"socket.io", "styled-components", "supertest", "tslib", "typescript",
+	"underscore", "uuid", "vue", "webpack", "webpack-cli", "ws", "yargs", "zod",
+}
+
+// IE: set by New, nil unless WithTyposquatCheck is
+var typosquats *typosquatDetector
+
+type typosquatDetector struct {
+	popular     []string
+	isPopular   map[string]bool
+	maxDistance int
+	// IE: name -> the popular package it is close to, the same packages show up
+	// in tree after tree. Bounded, every name of the registry goes through it
+	verdicts *lruCache
+}
+
+// IE: nil when disabled, so the resolver checks a single pointer
+func newTyposquatDetector(popular []string, maxDistance int) *typosquatDetector {
+	if maxDistance <= 0 {
+		return nil
+	}
+	if len(popular) == 0 {
+		popular = popularPackages
+	}
+	detector := &typosquatDetector{popular: popular, isPopular: make(map[string]bool, len(popular)), maxDistance: maxDistance, verdicts: newLRUCache(typosquatVerdicts, 0)}
+	for _, name := range popular {
+		detector.isPopular[strings.ToLower(name)] = true
+	}
+	return detector
+}
+
+// IE: the popular package name is suspiciously close to, empty when none. The
+// distance allowed grows with the length of the popular name, one edit away
+// from a short name (i.e. "ms" and "qs") is just another package
+func (d *typosquatDetector) lookalike(name string) string {
+	if d == nil {
+		return ""
+	}
+	name = strings.ToLower(name)
+	if d.isPopular[name] {
+		return ""
+	}
+	if verdict, found := d.verdicts.Get(name); found {
+		return string(verdict)
+	}
+
+	lookalike := ""
+	best := d.maxDistance + 1
+	for _, popular := range d.popular {
+		limit := min(d.maxDistance, len(popular)/4)
+		if limit == 0 || abs(len(popular)-len(name)) > limit {
+			continue
+		}
+		if distance := editDistance(name, strings.ToLower(popular)); distance <= limit && distance < best {
+			lookalike, best = popular, distance
+		}
+	}
+	d.verdicts.Set(name, []byte(lookalike), 0)
+	return lookalike
+}
+
+// IE: optimal string alignment, a swap of two adjacent letters (i.e.
+// "lodahs") is one edit like in a Damerau-Levenshtein distance
+func editDistance(a, b string) int {
+	previous2 := make([]int, len(b)+1)
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				current[j] = min(current[j], previous2[j-2]+1)
+			}
+		}
+		previous2, previous, current = previous, current, previous2
+	}
+	return previous[len(b)]
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// LoadPopularPackages reads the package names of a -typosquat-list file, one
+// per line. Blank lines and lines starting with # are skipped.
+func LoadPopularPackages(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var names []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		names = append(names, line)
+	}
+	return names, scanner.Err()
+}
+
+// IE: a warning rather than a failure, most lookalikes are legitimate packages
+func (r *resolver) flagTyposquat(pkg *NpmPackageVersion) {
+	lookalike := typosquats.lookalike(pkg.Name)
+	if lookalike == "" {
+		return
+	}
+	r.log.Warn("Possible typosquat", "node", pkg.Name+"@"+pkg.Version, "lookalike", lookalike)
+	pkg.Typosquat = lookalike
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEditDistance(t *testing.T) {
+	for pair, want := range map[[2]string]int{
+		{"lodash", "lodash"}:         0,
+		{"lodahs", "lodash"}:         1,
+		{"crossenv", "cross-env"}:    1,
+		{"expres", "express"}:        1,
+		{"reactt", "react"}:          1,
+		{"typescirpt", "typescript"}: 1,
+		{"", "ws"}:                   2,
+		{"axios", "lodash"}:          5,
+	} {
+		assert.Equal(t, want, editDistance(pair[0], pair[1]), pair)
+	}
+}
+
+func TestTyposquatLookalike(t *testing.T) {
+	detector := newTyposquatDetector(nil, 2)
+	for name, want := range map[string]string{
+		"lodash":       "",
+		"lodahs":       "lodash",
+		"Lodahs":       "lodash",
+		"crossenv":     "cross-env",
+		"typescirpt":   "typescript",
+		"typescripts":  "typescript",
+		"expresss":     "express",
+		"exprezs":      "express",
+		"qs":           "",
+		"colors":       "",
+		"color":        "",
+		"left-pad":     "",
+		"@types/nodes": "@types/node",
+	} {
+		assert.Equal(t, want, detector.lookalike(name), name)
+	}
+
+	assert.Nil(t, newTyposquatDetector(nil, 0))
+	assert.Equal(t, "", (*typosquatDetector)(nil).lookalike("lodahs"))
+	assert.Equal(t, "acme-ui", newTyposquatDetector([]string{"acme-ui"}, 1).lookalike("acme-iu"))
+}
+
+func TestTyposquatVerdictsAreBounded(t *testing.T) {
+	detector := newTyposquatDetector(nil, 2)
+	assert.Equal(t, "lodash", detector.lookalike("lodahs"))
+	for i := 0; i < typosquatVerdicts+100; i++ {
+		detector.lookalike(fmt.Sprintf("package-%d", i))
+	}
+	assert.Equal(t, typosquatVerdicts, detector.verdicts.Len())
+
+	// IE: pushed out, checked again all the same
+	assert.Equal(t, "lodash", detector.lookalike("lodahs"))
+}
+
+func TestTyposquatFlagged(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{
+		"app":    {"1.0.0": {"lodahs": "^1.0.0", "lodash": "^4.0.0"}},
+		"lodahs": {"1.0.0": nil},
+		"lodash": {"4.17.21": nil},
+	})
+	handler := New(WithRegistryURL(registry.URL), WithTyposquatCheck(nil, 2))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var tree NpmPackageVersion
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &tree))
+	assert.Equal(t, "lodash", tree.Dependencies["lodahs"].Typosquat)
+	assert.Empty(t, tree.Dependencies["lodash"].Typosquat)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/lodahs/1.0.0?format=ndjson", nil))
+	lines := readNDJSON(t, rec.Body.String())
+	require.Len(t, lines, 1)
+	assert.Equal(t, "lodash", lines[0]["typosquat"])
+}
+
+func TestLoadPopularPackages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "popular.txt")
+	require.Nil(t, os.WriteFile(path, []byte("# internal top list\nacme-ui\n\n  @acme/core \n"), 0o600))
+	names, err := LoadPopularPackages(path)
+	require.Nil(t, err)
+	assert.Equal(t, []string{"acme-ui", "@acme/core"}, names)
+
+	_, err = LoadPopularPackages(path + ".missing")
+	assert.NotNil(t, err)
+}
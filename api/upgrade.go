@@ -0,0 +1,178 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"golang.org/x/sync/errgroup"
+)
+
+// IE: how a package of the tree asks for the upgraded one
+const (
+	upgradeDependency = "dependency"
+	upgradePeer       = "peer"
+)
+
+// IE: the upgrade of ?upgrade=, and what in the tree stands in its way
+type upgradeReport struct {
+	Package string `json:"package"`
+	Range   string `json:"range"`
+	// IE: the highest version of the range, the one the upgrade would install
+	Target  string   `json:"target"`
+	Current []string `json:"current"`
+	// IE: by package then kind
+	Blockers []upgradeBlocker `json:"blockers"`
+}
+
+// IE: a package whose range leaves the target out. A dependency gets its own
+// copy of an older version nested, a peer dependency breaks
+type upgradeBlocker struct {
+	Package string `json:"package"`
+	Kind    string `json:"kind"`
+	Range   string `json:"range"`
+	// IE: from the root down to the package, maxViolationPaths of them at most
+	Chains [][]string `json:"chains"`
+	// IE: the first later version of the package whose range has the target, if any
+	UpgradeTo string `json:"upgradeTo,omitempty"`
+}
+
+// IE: name@range, the range defaults to latest. A leading @ belongs to the scope
+func requestUpgrade(query url.Values) (string, string, error) {
+	value := strings.TrimSpace(query.Get("upgrade"))
+	if value == "" {
+		return "", "", nil
+	}
+	name, constraint := value, "latest"
+	if at := strings.LastIndex(value, "@"); at > 0 {
+		name, constraint = value[:at], value[at+1:]
+	}
+	if err := checkPackageInput(name, constraint); err != nil {
+		return "", "", fmt.Errorf("%w: upgrade %q: %w", ErrInvalidQuery, value, err)
+	}
+	return name, constraint, nil
+}
+
+// IE: the range a version document gives name, with the kind of dependency
+func upgradeRange(doc *npmPackageResponse, name string) (string, string) {
+	if constraint, found := doc.Dependencies[name]; found {
+		return constraint, upgradeDependency
+	}
+	if constraint, found := doc.PeerDependencies[name]; found {
+		return constraint, upgradePeer
+	}
+	return "", ""
+}
+
+// IE: a dist-tag (latest standing for the highest stable version where the
+// registry has none) or the highest version of a range
+func upgradeTarget(name, constraint string, meta *npmPackageMetaResponse) (*semver.Version, error) {
+	if constraint == "latest" {
+		if latest := latestVersion(name, meta); latest != nil {
+			return latest, nil
+		}
+		return nil, fmt.Errorf("%w: %s@latest", ErrNoCompatibleVersion, name)
+	}
+	target, err := highestCompatibleVersion(name, constraint, meta)
+	if errors.Is(err, errInvalidRange) {
+		return nil, fmt.Errorf("%w: upgrade %s@%s: %w", ErrInvalidQuery, name, constraint, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s@%s: %w", name, constraint, err)
+	}
+	return semver.NewVersion(target)
+}
+
+func acceptsVersion(constraint string, version *semver.Version) bool {
+	parsed, err := semver.NewConstraint(constraint)
+	return err == nil && parsed.Check(version)
+}
+
+// IE: nothing to analyse without ?upgrade=. The root is the project being
+// upgraded, its own ranges are the ones to change rather than blockers
+func upgradeSection(ctx context.Context, tree *NpmPackageVersion, query url.Values, report *treeReport) error {
+	name, constraint, err := requestUpgrade(query)
+	if err != nil || name == "" {
+		return err
+	}
+	meta, err := fetchPackageMeta(ctx, name)
+	if err != nil {
+		return fmt.Errorf("fetching package meta for %s: %w", name, err)
+	}
+	targetVersion, err := upgradeTarget(name, constraint, meta)
+	if err != nil {
+		return err
+	}
+	target := targetVersion.Original()
+	docs, err := versionDocuments(ctx, tree)
+	if err != nil {
+		return err
+	}
+
+	upgrade := &upgradeReport{Package: name, Range: constraint, Target: target, Current: []string{}, Blockers: []upgradeBlocker{}}
+	rootKey := tree.Name + "@" + tree.Version
+	blocked := make(map[string]bool)
+	for key, pkg := range uniqueVersions(tree) {
+		if pkg.Name == name {
+			upgrade.Current = append(upgrade.Current, pkg.Version)
+		}
+		if key == rootKey {
+			continue
+		}
+		if constraint, kind := upgradeRange(docs[key], name); kind != "" && !acceptsVersion(constraint, targetVersion) {
+			upgrade.Blockers = append(upgrade.Blockers, upgradeBlocker{Package: key, Kind: kind, Range: constraint})
+			blocked[key] = true
+		}
+	}
+	sortVersions(upgrade.Current)
+	sort.Slice(upgrade.Blockers, func(i, j int) bool { return upgrade.Blockers[i].Package < upgrade.Blockers[j].Package })
+
+	chains := pathsTo(tree, blocked, maxViolationPaths)
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(live().concurrency, 1))
+	for i := range upgrade.Blockers {
+		blocker := &upgrade.Blockers[i]
+		blocker.Chains = chains[blocker.Package]
+		g.Go(func() error {
+			at := strings.LastIndex(blocker.Package, "@")
+			upgradeTo, err := firstAccepting(gctx, blocker.Package[:at], blocker.Package[at+1:], name, targetVersion)
+			if err != nil {
+				return err
+			}
+			blocker.UpgradeTo = upgradeTo
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	report.Upgrade = upgrade
+	return nil
+}
+
+// IE: the lowest stable version of pkg past the current one whose range for
+// name (of either kind) has the target, or drops name altogether
+func firstAccepting(ctx context.Context, pkg, current, name string, target *semver.Version) (string, error) {
+	meta, err := fetchPackageMeta(ctx, pkg)
+	if err != nil {
+		return "", fmt.Errorf("fetching package meta for %s: %w", pkg, err)
+	}
+	currentVersion, err := semver.NewVersion(current)
+	if err != nil {
+		return "", nil
+	}
+	for _, version := range parsedVersionsCache.sortedVersions(pkg, meta) {
+		if version.Prerelease() != "" || !version.GreaterThan(currentVersion) {
+			continue
+		}
+		doc := meta.Versions[version.Original()]
+		if constraint, kind := upgradeRange(&doc, name); kind == "" || acceptsVersion(constraint, target) {
+			return version.Original(), nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/snyk/snyk-code-review-exercise/internal/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpgradeBlockers(t *testing.T) {
+	registry := scriptedRegistry(t, fixtures.Registry{
+		"app":       {"1.0.0": {"react": "^16.0.0", "react-dom": "^16.0.0", "ui": "^1.0.0"}},
+		"react":     {"16.14.0": nil, "17.0.2": nil, "18.2.0": nil, "19.0.0-rc.1": nil},
+		"react-dom": {"16.14.0": nil, "18.2.0": nil},
+		"ui":        {"1.0.0": {"legacy": "^1.0.0", "either": "^1.0.0"}, "2.0.0": nil, "2.1.0": nil, "3.0.0-beta.1": nil},
+		"legacy":    {"1.0.0": {"react": "^16.8.0"}},
+		"either":    {"1.0.0": {"react": "^16.0.0 || ^18.0.0"}},
+	}, map[string]npmPackageResponse{
+		"react-dom@16.14.0": {PeerDependencies: map[string]string{"react": "^16.14.0"}},
+		"react-dom@18.2.0":  {PeerDependencies: map[string]string{"react": "^18.2.0"}},
+		"ui@1.0.0":          {PeerDependencies: map[string]string{"react": ">=16 <18"}},
+		"ui@2.0.0":          {PeerDependencies: map[string]string{"react": ">=16"}},
+		"ui@2.1.0":          {PeerDependencies: map[string]string{"react": ">=16"}},
+	})
+	handler := New(WithRegistryURL(registry.URL))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0/report?sections=upgrade&upgrade=react@^18", nil))
+	report := decodeReport(t, rec)
+	require.NotNil(t, report.Upgrade)
+	assert.Equal(t, &upgradeReport{
+		Package: "react", Range: "^18", Target: "18.2.0", Current: []string{"16.14.0", "18.2.0"},
+		Blockers: []upgradeBlocker{
+			{Package: "legacy@1.0.0", Kind: upgradeDependency, Range: "^16.8.0", Chains: [][]string{{"app@1.0.0", "ui@1.0.0", "legacy@1.0.0"}}},
+			{Package: "react-dom@16.14.0", Kind: upgradePeer, Range: "^16.14.0", Chains: [][]string{{"app@1.0.0", "react-dom@16.14.0"}}, UpgradeTo: "18.2.0"},
+			{Package: "ui@1.0.0", Kind: upgradePeer, Range: ">=16 <18", Chains: [][]string{{"app@1.0.0", "ui@1.0.0"}}, UpgradeTo: "2.0.0"},
+		},
+	}, report.Upgrade)
+
+	// IE: latest by default, the prerelease left out
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0/report?sections=upgrade&upgrade=react", nil))
+	report = decodeReport(t, rec)
+	require.NotNil(t, report.Upgrade)
+	assert.Equal(t, "18.2.0", report.Upgrade.Target)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0/report?sections=upgrade", nil))
+	assert.Nil(t, decodeReport(t, rec).Upgrade)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0/report?sections=upgrade&upgrade=react@^20", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0/report?sections=upgrade&upgrade=react@notarange", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+}
+
+func TestRequestUpgrade(t *testing.T) {
+	for value, want := range map[string][2]string{
+		"react@^18":        {"react", "^18"},
+		"@types/node@20.x": {"@types/node", "20.x"},
+		"@types/node":      {"@types/node", "latest"},
+		"react":            {"react", "latest"},
+	} {
+		name, constraint, err := requestUpgrade(map[string][]string{"upgrade": {value}})
+		require.Nil(t, err, value)
+		assert.Equal(t, want, [2]string{name, constraint}, value)
+	}
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// IE: as many as http.Client follows by default
+const maxUpstreamRedirects = 10
+
+var errUpstreamNotAllowed = &Error{Code: "upstream_not_allowed", Status: http.StatusBadGateway, message: "upstream host not allowed"}
+
+// IE: the redirects are checked as well, a registry (or a document it serves)
+// must not send the calls anywhere else
+var upstreamClient = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxUpstreamRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxUpstreamRedirects)
+		}
+		return checkUpstreamURL(req.URL)
+	},
+}
+
+// IE: the explicit list if there is one, the hosts of the registry and of the
+// CDNs otherwise. Read at every call, a reload may change the registry
+func upstreamHostAllowed(host string) bool {
+	host = strings.ToLower(host)
+	if len(opts.upstreamHosts) == 0 {
+		for _, configured := range []string{live().registryURL, opts.jsdelivrURL, opts.unpkgURL} {
+			if u, err := url.Parse(configured); err == nil && strings.ToLower(u.Hostname()) == host {
+				return true
+			}
+		}
+		return false
+	}
+	for _, allowed := range opts.upstreamHosts {
+		if suffix, wildcard := strings.CutPrefix(allowed, "*"); wildcard {
+			if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+				return true
+			}
+		} else if host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// IE: the tarball urls come from the documents of the registry, anything but
+// http(s) to an allowed host is refused before a connection is made
+func checkUpstreamURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: scheme of %s", errUpstreamNotAllowed, u.Redacted())
+	}
+	if !upstreamHostAllowed(u.Hostname()) {
+		return fmt.Errorf("%w: %s", errUpstreamNotAllowed, u.Hostname())
+	}
+	return nil
+}
+
+// ParseUpstreamHosts parses a comma separated list of host names the API may
+// call, for WithUpstreamHosts. "*.example.com" allows the subdomains of
+// example.com.
+func ParseUpstreamHosts(value string) ([]string, error) {
+	var hosts []string
+	for _, host := range strings.Split(value, ",") {
+		host = strings.ToLower(strings.TrimSpace(host))
+		if host == "" {
+			continue
+		}
+		name := strings.TrimPrefix(host, "*.")
+		if name == "" || strings.ContainsAny(name, "*/:@ ") {
+			return nil, fmt.Errorf("expected a host name or *.domain, got %q", host)
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts, nil
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpstreamHosts(t *testing.T) {
+	New(WithRegistryURL("https://registry.example.com"))
+	for raw, allowed := range map[string]bool{
+		"https://registry.example.com/app":     true,
+		"https://REGISTRY.example.com:443/app": true,
+		"https://unpkg.com/app@1.0.0":          true,
+		"https://metadata.internal/latest":     false,
+		"file:///etc/passwd":                   false,
+		"gopher://registry.example.com/app":    false,
+	} {
+		u, err := url.Parse(raw)
+		require.Nil(t, err)
+		assert.Equal(t, allowed, checkUpstreamURL(u) == nil, raw)
+	}
+
+	New(WithRegistryURL("https://registry.example.com"), WithUpstreamHosts([]string{"registry.example.com", "*.cdn.example.com"}))
+	for host, allowed := range map[string]bool{
+		"registry.example.com":    true,
+		"eu.cdn.example.com":      true,
+		"cdn.example.com":         false,
+		"unpkg.com":               false,
+		"evilcdn.example.com":     false,
+		"registry.example.com.io": false,
+	} {
+		assert.Equal(t, allowed, upstreamHostAllowed(host), host)
+	}
+}
+
+func TestUpstreamHostsRefuseTarballsAndRedirects(t *testing.T) {
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("called %s", r.URL)
+	}))
+	defer internal.Close()
+	// IE: both listen on 127.0.0.1, the internal one is called by another name
+	internalURL, err := url.Parse(internal.URL)
+	require.Nil(t, err)
+	internalURL.Host = "localhost:" + internalURL.Port()
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, internalURL.String()+"/latest/meta-data", http.StatusFound)
+	}))
+	defer registry.Close()
+
+	handler := New(WithRegistryURL(registry.URL))
+	_, err = httpGet(context.Background(), internalURL.String()+"/pkg.tgz")
+	assert.ErrorIs(t, err, errUpstreamNotAllowed)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/app/1.0.0", nil))
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.Equal(t, "upstream_not_allowed", decodeErrorPayload(t, rec).Code)
+}
+
+func TestParseUpstreamHosts(t *testing.T) {
+	hosts, err := ParseUpstreamHosts(" Registry.example.com, *.cdn.example.com ")
+	require.Nil(t, err)
+	assert.Equal(t, []string{"registry.example.com", "*.cdn.example.com"}, hosts)
+
+	for _, invalid := range []string{"https://registry.example.com", "registry.example.com:8080", "*", "a.*.example.com"} {
+		_, err = ParseUpstreamHosts(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"strings"
+	"time"
+)
+
+// IE: the same constraint of the same package shows up all over a tree (i.e.
+// "^1.0.0" of loose-envify) and each evaluation parses and checks every
+// published version. Selections are memoized per request (the tree stays
+// consistent even if the packument changes midway) and across requests, the
+// latter in memory whatever the cache backend: a round trip to redis would
+// cost about as much as the evaluation itself
+const selectionKeyPrefix = "selection:"
+
+var selectionCache Cache
+
+// IE: the last version each range was keyed by, with no TTL, so the cache key
+// of a range still finds its tree while the registry is down, see
+// normalizeVersion. Always in memory, like the selections
+var lastSelections Cache
+
+// IE: entries are a name, a constraint and a version, tiny
+const (
+	selectionCacheSize  = 16384
+	selectionCacheBytes = 4 << 20
+)
+
+func selectionKey(name, constraint string) string {
+	return selectionKeyPrefix + normalizePackageName(name) + "@" + strings.Join(strings.Fields(constraint), " ")
+}
+
+// IE: a selection can't outlive the packument it was made on for long, a newer version may have been published
+func selectionTTL() time.Duration {
+	return live().packumentTTL
+}
+
+// IE: only successful selections are memoized, unsatisfiable ones are negatively cached by the caller
+func selectVersion(name, constraint string, meta *npmPackageMetaResponse) (string, error) {
+	key := selectionKey(name, constraint)
+	if cached, found := selectionCache.Get(key); found {
+		return string(cached), nil
+	}
+
+	version, err := highestCompatibleVersion(name, constraint, meta)
+	if err != nil {
+		return "", err
+	}
+	selectionCache.Set(key, []byte(version), selectionTTL())
+	return version, nil
+}
+
+func (r *resolver) selectVersion(name, constraint string, meta *npmPackageMetaResponse) (string, error) {
+	key := name + "@" + constraint
+	if cached, found := r.selections.Load(key); found {
+		return cached.(string), nil
+	}
+
+	version, err := selectVersion(name, constraint, meta)
+	if err != nil {
+		return "", err
+	}
+	r.selections.Store(key, version)
+	return version, nil
+}
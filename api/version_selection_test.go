@@ -0,0 +1,54 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func metaWithVersions(versions ...string) *npmPackageMetaResponse {
+	meta := &npmPackageMetaResponse{Versions: map[string]npmPackageResponse{}}
+	for _, version := range versions {
+		meta.Versions[version] = npmPackageResponse{}
+	}
+	return meta
+}
+
+func TestSelectVersionIsMemoized(t *testing.T) {
+	New()
+
+	version, err := selectVersion("left-pad", "^1.0.0", metaWithVersions("1.0.0", "1.1.0"))
+	require.Nil(t, err)
+	assert.Equal(t, "1.1.0", version)
+
+	// IE: same constraint, spelled differently, within the TTL
+	version, err = selectVersion(" left-pad", " ^1.0.0 ", metaWithVersions("1.0.0", "1.1.0", "1.2.0"))
+	require.Nil(t, err)
+	assert.Equal(t, "1.1.0", version)
+
+	purgeLocal("left-pad")
+	version, err = selectVersion("left-pad", "^1.0.0", metaWithVersions("1.0.0", "1.1.0", "1.2.0"))
+	require.Nil(t, err)
+	assert.Equal(t, "1.2.0", version)
+
+	_, err = selectVersion("left-pad", "^2.0.0", metaWithVersions("1.0.0"))
+	assert.ErrorIs(t, err, ErrNoCompatibleVersion)
+	_, found := selectionCache.Get(selectionKey("left-pad", "^2.0.0"))
+	assert.False(t, found)
+}
+
+func TestResolverSelectionsOutliveTheGlobalOnes(t *testing.T) {
+	New()
+	r := newResolver(0)
+
+	version, err := r.selectVersion("left-pad", "^1.0.0", metaWithVersions("1.0.0", "1.1.0"))
+	require.Nil(t, err)
+	assert.Equal(t, "1.1.0", version)
+
+	// IE: the tree stays consistent even if a version gets published midway
+	purgeLocal("left-pad")
+	version, err = r.selectVersion("left-pad", "^1.0.0", metaWithVersions("1.0.0", "1.1.0", "1.2.0"))
+	require.Nil(t, err)
+	assert.Equal(t, "1.1.0", version)
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+type warmupEntry struct {
+	Name    string
+	Version string
+}
+
+// IE: one package@version per line, blank lines and # comments are ignored
+func parseWarmupList(r io.Reader) ([]warmupEntry, error) {
+	var entries []warmupEntry
+
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if line == "" {
+			continue
+		}
+
+		// IE: skip the leading '@' of scoped packages when looking for the version separator
+		at := strings.LastIndex(line, "@")
+		if at <= 0 || at == len(line)-1 {
+			return nil, fmt.Errorf("line %d: expected package@version, got %q", lineNo, line)
+		}
+		entries = append(entries, warmupEntry{Name: line[:at], Version: line[at+1:]})
+	}
+
+	return entries, scanner.Err()
+}
+
+func loadWarmupList(path string) ([]warmupEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseWarmupList(f)
+}
+
+// IE: resolve sequentially in the background, warming must not compete with real requests for upstream bandwidth
+func warmCache(entries []warmupEntry) {
+	start := time.Now()
+	ctx := withJob(context.Background(), backgroundClient)
+	for _, entry := range entries {
+		tree, err := cachedTree(ctx, entry.Name, entry.Version, nil)
+		if err == nil {
+			_, err = tree.WriteTo(io.Discard)
+		}
+		if err != nil {
+			logger.Error("Could not warm cache", "package", entry.Name, "version", entry.Version, "error", err)
+			continue
+		}
+		logger.Debug("Warmed cache", "package", entry.Name, "version", entry.Version)
+	}
+	logger.Info("Cache warm-up completed", "packages", len(entries), "duration", time.Since(start))
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseWarmupList(t *testing.T) {
+	entries, err := parseWarmupList(strings.NewReader(`
+# popular packages
+react@16.13.0
+@babel/core@7.19.3   # scoped
+
+express@4.18.1
+`))
+	require.Nil(t, err)
+
+	assert.Equal(t, []warmupEntry{
+		{Name: "react", Version: "16.13.0"},
+		{Name: "@babel/core", Version: "7.19.3"},
+		{Name: "express", Version: "4.18.1"},
+	}, entries)
+}
+
+func TestParseWarmupListRejectsMissingVersion(t *testing.T) {
+	_, err := parseWarmupList(strings.NewReader("react\n"))
+	assert.NotNil(t, err)
+
+	_, err = parseWarmupList(strings.NewReader("react@\n"))
+	assert.NotNil(t, err)
+}
+
+func TestWarmCacheFillsResponseCache(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{
+		"left-pad": {"1.3.0": nil},
+	})
+	New(WithRegistryURL(registry.URL))
+
+	warmCache([]warmupEntry{{Name: "left-pad", Version: "1.3.0"}})
+
+	_, found := responseCache.Get(treeKeyPrefix + "left-pad@1.3.0")
+	assert.True(t, found)
+
+	calls := registry.Calls()
+	tree, err := cachedTree(context.Background(), "left-pad", "1.3.0", nil)
+	require.Nil(t, err)
+	assert.Equal(t, cacheStatusHit, tree.status)
+	assert.Equal(t, calls, registry.Calls())
+}
+
+func TestWithWarmupListMissingFile(t *testing.T) {
+	// IE: a bad warm-up list must not prevent the server from starting
+	handler := New(WithWarmupList("/does/not/exist"))
+	assert.NotNil(t, handler)
+}
@@ -0,0 +1,315 @@
+package api
+
+import (
+	"container/heap"
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
+)
+
+// IE: one node of the tree waiting to be resolved, a task never blocks on its
+// children (a bounded pool would deadlock on deep trees), it counts them down
+// instead and the last child to finish completes its parent
+type resolveTask struct {
+	pkg        *NpmPackageVersion
+	constraint string
+	ancestors  map[string]bool
+	parent     *resolveTask
+	depth      int
+	seq        uint64
+	// IE: line number of the node once streamed, see nodeStream
+	id uint64
+
+	// IE: set once the package document is fetched, i.e. the subtree may be cached
+	key       string
+	pending   int32
+	truncated int32
+}
+
+// IE: all the state of a single resolution, one per request so concurrent
+// requests share nothing but the caches.
+// IE: fixed number of workers consuming an unbounded priority queue, i.e. the
+// frontier of unresolved nodes, shallowest first so the top of the tree is
+// complete early even when a slow subtree lags behind. Workers enqueue the
+// children they discover so the queue can't be a bounded channel, memory is
+// bounded by the width of the tree instead
+type resolver struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	queue    taskQueue
+	seq      uint64
+	stopped  bool
+	done     chan struct{}
+	maxDepth int
+
+	// IE: nodes queued so far (the root included) against the node budget, 0 doesn't limit them
+	maxNodes int64
+	nodes    int64
+	partial  int32
+
+	// IE: name@version resolved during this request, shared as is between the
+	// nodes. Each key is written once and read by every worker running into it
+	// again, the case sync.Map is made for, readers don't contend on a lock
+	scanned sync.Map
+	// IE: name@constraint to the version selected for it, see selectVersion()
+	selections sync.Map
+
+	// IE: progress of the request, shared with its upstream calls through the context
+	stats       *resolutionStats
+	log         *slog.Logger
+	features    featureSet
+	startedAt   time.Time
+	rootName    string
+	rootVersion string
+
+	// IE: prefetches run next to the workers, see prefetch()
+	prefetchSlots chan struct{}
+	prefetches    sync.WaitGroup
+
+	// IE: nil unless the nodes are streamed as they resolve instead of linked into a tree
+	stream *nodeStream
+}
+
+// IE: a maxDepth of 0 doesn't limit the depth
+func newResolver(maxDepth int) *resolver {
+	r := &resolver{
+		done:     make(chan struct{}),
+		maxDepth: maxDepth,
+		maxNodes: int64(live().maxNodes),
+		nodes:    1,
+		stats:    &resolutionStats{},
+		log:      logger,
+	}
+	r.cond = sync.NewCond(&r.mu)
+	return r
+}
+
+// IE: resolves the tree under root with n workers and returns once it is
+// complete, or with the first error, which cancels whatever is still in flight
+func (r *resolver) run(ctx context.Context, root *resolveTask, n int) (err error) {
+	if n < 1 {
+		n = 1
+	}
+	ctx, span := tracer.Start(ctx, "resolve tree", trace.WithAttributes(
+		attribute.String("package.name", root.pkg.Name), attribute.String("package.constraint", root.constraint)))
+	defer func() {
+		snapshot := r.stats.snapshot()
+		span.SetAttributes(attribute.Int64("resolve.nodes", atomic.LoadInt64(&r.nodes)),
+			attribute.Bool("resolve.partial", r.exhausted()), attribute.Int64("resolve.upstream_calls", snapshot.UpstreamCalls))
+		endSpan(span, err)
+	}()
+	if stats := resolutionStatsFrom(ctx); stats != nil {
+		r.stats = stats
+	} else {
+		ctx = withResolutionStats(ctx, r.stats)
+	}
+	r.log = loggerFrom(ctx)
+	r.features = featuresFrom(ctx)
+	defer trackResolution(r, root)()
+
+	r.prefetchSlots = make(chan struct{}, n)
+	// IE: whatever is still prefetching is of no use anymore, and is cancelled with ctx
+	defer r.prefetches.Wait()
+	// IE: workers and prefetches together make at most n upstream calls at a time
+	ctx = withUpstreamLimit(ctx, make(chan struct{}, n))
+
+	g, ctx := errgroup.WithContext(ctx)
+	if !r.features.enabled(FeatureWorkerPool) {
+		r.fanOut(ctx, g, root)
+		return g.Wait()
+	}
+	r.push(root)
+	atomic.AddInt64(&r.stats.goroutines, int64(n))
+	for i := 0; i < n; i++ {
+		g.Go(func() (err error) {
+			defer func() {
+				if p := recover(); p != nil {
+					reportPanic(ctx, p)
+					err = &panicError{p}
+				}
+			}()
+			return r.work(ctx)
+		})
+	}
+
+	// IE: idle workers wait on the cond, wake them up once there is nothing left to wait for
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-r.done:
+		}
+		r.stop()
+	}()
+
+	return g.Wait()
+}
+
+func (r *resolver) work(ctx context.Context) error {
+	for {
+		task := r.next()
+		if task == nil {
+			return ctx.Err()
+		}
+
+		children, err := r.resolveDependencies(ctx, task)
+		atomic.AddInt64(&r.stats.pending, -1)
+		if err != nil {
+			return err
+		}
+		atomic.AddInt64(&r.stats.resolved, 1)
+		if len(children) == 0 {
+			r.complete(task)
+			continue
+		}
+		atomic.StoreInt32(&task.pending, int32(len(children)))
+		r.push(children...)
+	}
+}
+
+// IE: the resolver from before the worker pool, a goroutine per node, for
+// FeatureWorkerPool turned off. Each goroutine ends once its node is resolved
+// and its children started, the children complete it like the workers do.
+// The upstream calls are still bounded by the limit run sets, the goroutines
+// aren't: there are as many as nodes waiting on a call
+func (r *resolver) fanOut(ctx context.Context, g *errgroup.Group, task *resolveTask) {
+	atomic.AddInt64(&r.stats.goroutines, 1)
+	atomic.AddInt64(&r.stats.pending, 1)
+	g.Go(func() (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				reportPanic(ctx, p)
+				err = &panicError{p}
+			}
+		}()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		children, err := r.resolveDependencies(ctx, task)
+		atomic.AddInt64(&r.stats.pending, -1)
+		if err != nil {
+			return err
+		}
+		atomic.AddInt64(&r.stats.resolved, 1)
+		if len(children) == 0 {
+			r.complete(task)
+			return nil
+		}
+		atomic.StoreInt32(&task.pending, int32(len(children)))
+		for _, child := range children {
+			r.fanOut(ctx, g, child)
+		}
+		return nil
+	})
+}
+
+// IE: all the children of a node are counted at once, a node is either fully
+// expanded or not at all. Subtrees reused as is cost nothing to resolve and
+// aren't counted
+func (r *resolver) reserveNodes(n int) bool {
+	if r.maxNodes <= 0 || n == 0 {
+		return true
+	}
+	if atomic.AddInt64(&r.nodes, int64(n)) <= r.maxNodes {
+		return true
+	}
+	atomic.AddInt64(&r.nodes, -int64(n))
+	atomic.StoreInt32(&r.partial, 1)
+	return false
+}
+
+// IE: whether some node was left unexpanded because of the node budget
+func (r *resolver) exhausted() bool {
+	return atomic.LoadInt32(&r.partial) == 1
+}
+
+func (r *resolver) push(tasks ...*resolveTask) {
+	atomic.AddInt64(&r.stats.pending, int64(len(tasks)))
+	r.mu.Lock()
+	for _, task := range tasks {
+		r.seq++
+		task.seq = r.seq
+		heap.Push(&r.queue, task)
+	}
+	r.mu.Unlock()
+	r.cond.Broadcast()
+}
+
+// IE: blocks until a task is queued, nil once the resolver is stopped
+func (r *resolver) next() *resolveTask {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for len(r.queue) == 0 && !r.stopped {
+		r.cond.Wait()
+	}
+	if r.stopped {
+		return nil
+	}
+
+	return heap.Pop(&r.queue).(*resolveTask)
+}
+
+func (r *resolver) stop() {
+	r.mu.Lock()
+	r.stopped = true
+	r.queue = nil
+	r.mu.Unlock()
+	r.cond.Broadcast()
+}
+
+// IE: walks up as long as the finished node was the last pending child
+func (r *resolver) complete(task *resolveTask) {
+	for task != nil {
+		truncated := atomic.LoadInt32(&task.truncated) == 1
+		if task.key != "" {
+			// IE: streamed nodes aren't linked, there is no subtree to cache
+			if !truncated && r.stream == nil {
+				r.cacheDeps(task.key, task.pkg)
+			}
+			r.log.Debug("Scanned package", "node", task.key)
+		}
+
+		parent := task.parent
+		if parent == nil {
+			close(r.done)
+			return
+		}
+		if truncated {
+			atomic.StoreInt32(&parent.truncated, 1)
+		}
+		if atomic.AddInt32(&parent.pending, -1) != 0 {
+			return
+		}
+		task = parent
+	}
+}
+
+// IE: min-heap on depth, ties in queueing order so siblings stay breadth-first
+type taskQueue []*resolveTask
+
+func (q taskQueue) Len() int { return len(q) }
+
+func (q taskQueue) Less(i, j int) bool {
+	if q[i].depth != q[j].depth {
+		return q[i].depth < q[j].depth
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q taskQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *taskQueue) Push(x interface{}) { *q = append(*q, x.(*resolveTask)) }
+
+func (q *taskQueue) Pop() interface{} {
+	old := *q
+	task := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return task
+}
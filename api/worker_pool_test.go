@@ -0,0 +1,138 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveTreeBoundsConcurrency(t *testing.T) {
+	packages := map[string]map[string]map[string]string{
+		"wide": {"1.0.0": {}},
+	}
+	for i := 0; i < 40; i++ {
+		name := fmt.Sprintf("dep-%d", i)
+		packages["wide"]["1.0.0"][name] = "^1.0.0"
+		packages[name] = map[string]map[string]string{"1.0.0": {"leaf": "^1.0.0"}}
+	}
+	packages["leaf"] = map[string]map[string]string{"1.0.0": nil}
+
+	registry := newFakeRegistry(t, packages)
+	registry.delay = 5 * time.Millisecond
+	New(WithRegistryURL(registry.URL), WithConcurrency(4))
+
+	root, err := resolveTree(context.Background(), "wide", "1.0.0", 0)
+	require.Nil(t, err)
+
+	require.Len(t, root.Dependencies, 40)
+	for _, dep := range root.Dependencies {
+		assert.Equal(t, "1.0.0", dep.Version)
+		assert.Contains(t, dep.Dependencies, "leaf")
+	}
+
+	assert.LessOrEqual(t, registry.PeakInFlight(), int64(4))
+}
+
+func TestResolveTreeCancelsOnFirstError(t *testing.T) {
+	started, cancelled := make(chan struct{}), make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/app":
+			_ = json.NewEncoder(w).Encode(npmPackageMetaResponse{Versions: map[string]npmPackageResponse{"1.0.0": {}}})
+		case "/app/1.0.0":
+			_ = json.NewEncoder(w).Encode(npmPackageResponse{Name: "app", Version: "1.0.0", Dependencies: map[string]string{"slow": "^1.0.0", "broken": "^1.0.0"}})
+		case "/slow":
+			// IE: only returns once the failure of broken cancelled it
+			close(started)
+			<-r.Context().Done()
+			close(cancelled)
+		default:
+			<-started
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	New(WithRegistryURL(server.URL))
+
+	_, err := resolveTree(context.Background(), "app", "1.0.0", 0)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "broken")
+	assert.Equal(t, http.StatusBadGateway, classifyError(err).Status)
+
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request for slow was not cancelled")
+	}
+}
+
+func TestPackageHandlerReportsMissingPackages(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]map[string]map[string]string{
+		"app": {"1.0.0": {"missing": "^1.0.0"}},
+	})
+	server := httptest.NewServer(New(WithRegistryURL(registry.URL)))
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL + "/package/app/1.0.0")
+	require.Nil(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	_, found := responseCache.Get(treeCacheKey(context.Background(), "app", "1.0.0", nil))
+	assert.False(t, found)
+}
+
+func TestResolverSchedulesShallowTasksFirst(t *testing.T) {
+	r := newResolver(0)
+	for _, depth := range []int{3, 1, 2, 1, 0} {
+		r.push(&resolveTask{depth: depth, constraint: fmt.Sprint(depth)})
+	}
+	r.push(&resolveTask{depth: 1, constraint: "1 (last)"})
+
+	var order []string
+	for i := 0; i < 6; i++ {
+		order = append(order, r.next().constraint)
+	}
+	assert.Equal(t, []string{"0", "1", "1", "1 (last)", "2", "3"}, order)
+}
+
+func TestResolveTreeWithoutWorkerPool(t *testing.T) {
+	packages := map[string]map[string]map[string]string{
+		"wide": {"1.0.0": {}},
+	}
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("dep-%d", i)
+		packages["wide"]["1.0.0"][name] = "^1.0.0"
+		packages[name] = map[string]map[string]string{"1.0.0": {"leaf": "^1.0.0"}}
+	}
+	packages["leaf"] = map[string]map[string]string{"1.0.0": nil}
+
+	registry := newFakeRegistry(t, packages)
+	registry.delay = 5 * time.Millisecond
+	server := httptest.NewServer(New(WithRegistryURL(registry.URL), WithConcurrency(4), WithFeatures(map[string]bool{FeatureWorkerPool: false, FeaturePrefetch: false})))
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL + "/package/wide/1.0.0")
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var root NpmPackageVersion
+	require.Nil(t, json.NewDecoder(resp.Body).Decode(&root))
+	require.Len(t, root.Dependencies, 20)
+	for _, dep := range root.Dependencies {
+		assert.Equal(t, "1.0.0", dep.Version)
+		assert.Contains(t, dep.Dependencies, "leaf")
+	}
+
+	// IE: a goroutine per node, the calls to the registry still bounded
+	assert.NotContains(t, resp.Trailer.Get(resolutionStatsHeader), "goroutines=4,")
+	assert.LessOrEqual(t, registry.PeakInFlight(), int64(4))
+}
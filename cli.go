@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/snyk/snyk-code-review-exercise/api"
+	"github.com/snyk/snyk-code-review-exercise/internal/config"
+	"github.com/snyk/snyk-code-review-exercise/resolver"
+	"github.com/spf13/cobra"
+)
+
+const cliName = "depresolve"
+
+func main() {
+	if err := newRootCommand(os.Stdout, os.Stderr).Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// IE: the flags of the subcommands are those of internal/config, files and
+// environment included, so cobra hands them over as they are. Without a
+// subcommand the flags alone start the service, as before there were any
+func newRootCommand(stdout, stderr io.Writer) *cobra.Command {
+	root := &cobra.Command{
+		Use:                cliName,
+		Short:              "Resolve the dependency trees of npm packages",
+		Args:               cobra.ArbitraryArgs,
+		DisableFlagParsing: true,
+		SilenceUsage:       true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+				return cmd.Help()
+			}
+			if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+				return fmt.Errorf("unknown command %q, see %s --help", args[0], cliName)
+			}
+			serve(cliName, args)
+			return nil
+		},
+	}
+	root.SetOut(stdout)
+	root.SetErr(stderr)
+	root.AddCommand(newServeCommand(), newResolveCommand())
+	return root
+}
+
+func newServeCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:                "serve [flags]",
+		Short:              "Run the HTTP service (i.e. serve --port 3000), -h lists the flags",
+		DisableFlagParsing: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			serve(cliName+" serve", args)
+		},
+	}
+}
+
+func newResolveCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "resolve <name>[@range] [flags]",
+		Short: "Print the dependency graph of a package as JSON (i.e. resolve react@16.13.0)",
+		Long: `Print the dependency graph of a package as JSON, the graph of the resolver
+package: the name@version of the root and every name@version once, with the
+name@version of each of its dependencies. The range (or dist-tag) defaults to
+any version, the highest. The flags are those of serve (serve -h lists them),
+those about serving HTTP do nothing here.`,
+		DisableFlagParsing: true,
+		SilenceUsage:       true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+				if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+					return cmd.Help()
+				}
+				return errors.New("resolve needs a package first, i.e. resolve react@16.13.0")
+			}
+			name, constraint := splitPackageSpec(args[0])
+			return resolveGraph(cmd.Context(), name, constraint, args[1:], cmd.OutOrStdout(), cmd.ErrOrStderr())
+		},
+	}
+}
+
+// IE: name@range, a leading @ belongs to the scope
+func splitPackageSpec(spec string) (string, string) {
+	if at := strings.LastIndex(spec, "@"); at > 0 {
+		return spec[:at], spec[at+1:]
+	}
+	return spec, "*"
+}
+
+// IE: one graph and done, through the resolver package like the programs
+// embedding it. The logs go to stderr so stdout is only the graph
+func resolveGraph(ctx context.Context, name, constraint string, args []string, stdout, stderr io.Writer) error {
+	cfg, err := config.Load(cliName+" resolve "+name+"@"+constraint, args, os.LookupEnv, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	optFns, err := cfg.APIOptions()
+	if err != nil {
+		return fmt.Errorf("invalid settings: %w", err)
+	}
+	logger, err := api.NewLogger(stderr, cfg.LogFormat, cfg.LogLevel)
+	if err != nil {
+		return err
+	}
+	r := resolver.New(append(optFns, api.WithLogger(logger))...)
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	graph, err := r.Resolve(ctx, name, constraint)
+	if err != nil {
+		return fmt.Errorf("resolving %s@%s: %w", name, constraint, err)
+	}
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(graph)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/snyk/snyk-code-review-exercise/api"
+	"github.com/snyk/snyk-code-review-exercise/internal/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitPackageSpec(t *testing.T) {
+	for spec, want := range map[string][2]string{
+		"react@16.13.0":      {"react", "16.13.0"},
+		"react":              {"react", "*"},
+		"@babel/core@^7.0.0": {"@babel/core", "^7.0.0"},
+		"@babel/core":        {"@babel/core", "*"},
+	} {
+		name, constraint := splitPackageSpec(spec)
+		assert.Equal(t, want, [2]string{name, constraint}, spec)
+	}
+}
+
+func TestResolveCommand(t *testing.T) {
+	registry := httptest.NewServer(fixtures.Registry{
+		"app": {"1.0.0": {"a": "^1.0.0"}},
+		"a":   {"1.0.0": nil, "1.1.0": nil},
+	})
+	t.Cleanup(registry.Close)
+
+	var stdout, stderr bytes.Buffer
+	root := newRootCommand(&stdout, &stderr)
+	root.SetArgs([]string{"resolve", "app@^1.0.0", "--registry", registry.URL, "-log-level", "error"})
+	require.Nil(t, root.Execute(), stderr.String())
+
+	assert.JSONEq(t, `{"root": "app@1.0.0", "nodes": [
+		{"name": "a", "version": "1.1.0"},
+		{"name": "app", "version": "1.0.0", "dependencies": {"a": "a@1.1.0"}}
+	]}`, stdout.String())
+
+	stdout.Reset()
+	root = newRootCommand(&stdout, &stderr)
+	root.SetArgs([]string{"resolve", "missing@1.0.0", "--registry", registry.URL, "-log-level", "error"})
+	assert.ErrorIs(t, root.Execute(), api.ErrPackageNotFound)
+	assert.Empty(t, stdout.String())
+}
+
+func TestRootCommandErrors(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	root := newRootCommand(&stdout, &stderr)
+	root.SetArgs([]string{"resovle", "react"})
+	assert.ErrorContains(t, root.Execute(), `unknown command "resovle"`)
+
+	root = newRootCommand(&stdout, &stderr)
+	root.SetArgs([]string{"resolve", "--registry", "http://localhost"})
+	assert.ErrorContains(t, root.Execute(), "resolve needs a package first")
+}
@@ -0,0 +1,141 @@
+// Command genfixtures resolves the packages the tests compare against and
+// rewrites their expected trees under api/testdata, either from the live
+// registry or from the registries recorded under api/testdata/registry.
+// The output is deterministic (sorted keys, fixed indentation), so a
+// regeneration only shows up in the diff where the trees actually changed.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/snyk/snyk-code-review-exercise/api"
+	"github.com/snyk/snyk-code-review-exercise/internal/fixtures"
+)
+
+// IE: the trees the api tests compare against
+const testPackages = "react@16.13.0,react@15.0.1,express@4.18.1,npm@8.19.2"
+
+type target struct {
+	name, version string
+}
+
+func main() {
+	packages := flag.String("packages", testPackages, "comma separated package@version list to regenerate")
+	out := flag.String("out", "api/testdata", "directory the trees are written to, as <name>-<version>.json")
+	recorded := flag.String("recorded", "", "directory of recorded registries (i.e. api/testdata/registry) to resolve from instead of the live registry")
+	registry := flag.String("registry", "", "npm compatible registry to resolve from, the public one by default")
+	flag.Parse()
+
+	logger := log.New(os.Stderr, "GENFIXTURES: ", log.Ldate|log.Ltime)
+
+	targets, err := parseTargets(*packages)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	for _, t := range targets {
+		var optFns []api.Option
+		if *registry != "" {
+			optFns = append(optFns, api.WithRegistryURL(*registry))
+		}
+		stop := func() {}
+		if *recorded != "" {
+			packages, err := fixtures.Load(filepath.Join(*recorded, fixtureName(t.name, t.version)))
+			if err != nil {
+				logger.Fatal(err)
+			}
+			server := httptest.NewServer(packages)
+			stop = server.Close
+			optFns = append(optFns, api.WithRegistryURL(server.URL))
+		}
+
+		tree, err := generate(newHandler(optFns...), t.name, t.version)
+		stop()
+		if err != nil {
+			logger.Fatalf("%s@%s: %v", t.name, t.version, err)
+		}
+
+		path := filepath.Join(*out, fixtureName(t.name, t.version))
+		changed, err := writeFixture(path, tree)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		if changed {
+			logger.Println("Rewrote", path)
+		} else {
+			logger.Println("Unchanged", path)
+		}
+	}
+}
+
+// IE: the fixtures are the plain trees, no cached leftovers from a previous package
+func newHandler(optFns ...api.Option) http.Handler {
+	return api.New(append(optFns, api.WithResponseCache(0, 0), api.WithMaxInFlight(0), api.WithLogger(slog.New(slog.DiscardHandler)))...)
+}
+
+// IE: scoped names start with an @ of their own, the version is after the last one
+func parseTargets(list string) ([]target, error) {
+	var targets []target
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		at := strings.LastIndex(entry, "@")
+		if at <= 0 || at == len(entry)-1 {
+			return nil, fmt.Errorf("expected package@version, got %q", entry)
+		}
+		targets = append(targets, target{name: entry[:at], version: entry[at+1:]})
+	}
+	return targets, nil
+}
+
+// IE: i.e. react-16.13.0.json, @babel/core gives babel-core-7.19.3.json
+func fixtureName(name, version string) string {
+	name = strings.ReplaceAll(strings.TrimPrefix(name, "@"), "/", "-")
+	return name + "-" + version + ".json"
+}
+
+// IE: decoded and encoded again rather than copied, the response is compact
+// and streamed in resolution order
+func generate(handler http.Handler, name, version string) ([]byte, error) {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/package/"+name+"/"+version, nil))
+	if rec.Code != http.StatusOK {
+		return nil, fmt.Errorf("status %d: %s", rec.Code, strings.TrimSpace(rec.Body.String()))
+	}
+	if rec.Header().Get("X-Partial-Tree") != "" {
+		return nil, fmt.Errorf("the tree is partial, resolving it hit the node budget")
+	}
+
+	var tree api.NpmPackageVersion
+	if err := json.Unmarshal(rec.Body.Bytes(), &tree); err != nil {
+		return nil, err
+	}
+	// IE: encoding/json sorts the map keys, the indentation is the one of the existing fixtures
+	data, err := json.MarshalIndent(&tree, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// IE: left alone when nothing changed, keeps the timestamps for make and friends
+func writeFixture(path string, data []byte) (bool, error) {
+	if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, data) {
+		return false, nil
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return false, err
+	}
+	return true, os.Rename(tmp, path)
+}
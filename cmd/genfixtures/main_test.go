@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/snyk/snyk-code-review-exercise/api"
+	"github.com/snyk/snyk-code-review-exercise/internal/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTargets(t *testing.T) {
+	targets, err := parseTargets("react@16.13.0, @babel/core@7.19.3")
+	require.Nil(t, err)
+	assert.Equal(t, []target{{"react", "16.13.0"}, {"@babel/core", "7.19.3"}}, targets)
+
+	_, err = parseTargets("react")
+	assert.NotNil(t, err)
+}
+
+func TestFixtureName(t *testing.T) {
+	assert.Equal(t, "react-16.13.0.json", fixtureName("react", "16.13.0"))
+	assert.Equal(t, "babel-core-7.19.3.json", fixtureName("@babel/core", "7.19.3"))
+}
+
+// IE: regenerating from the recorded registry must give the checked in tree byte for byte
+func TestGenerateIsDeterministic(t *testing.T) {
+	testdata := filepath.Join("..", "..", "api", "testdata")
+	packages, err := fixtures.Load(filepath.Join(testdata, "registry", "react-16.13.0.json"))
+	require.Nil(t, err)
+	registry := httptest.NewServer(packages)
+	defer registry.Close()
+
+	tree, err := generate(newHandler(api.WithRegistryURL(registry.URL)), "react", "16.13.0")
+	require.Nil(t, err)
+	expected, err := os.ReadFile(filepath.Join(testdata, "react-16.13.0.json"))
+	require.Nil(t, err)
+	assert.Equal(t, string(expected), string(tree))
+
+	path := filepath.Join(t.TempDir(), "react-16.13.0.json")
+	changed, err := writeFixture(path, tree)
+	require.Nil(t, err)
+	assert.True(t, changed)
+	changed, err = writeFixture(path, tree)
+	require.Nil(t, err)
+	assert.False(t, changed)
+}
+
+func TestGenerateRejectsPartialTrees(t *testing.T) {
+	registry := httptest.NewServer(fixtures.Registry{
+		"a": {"1.0.0": {"b": "^1.0.0"}},
+		"b": {"1.0.0": {"c": "^1.0.0"}},
+		"c": {"1.0.0": nil},
+	})
+	defer registry.Close()
+
+	_, err := generate(newHandler(api.WithRegistryURL(registry.URL), api.WithMaxNodes(2)), "a", "1.0.0")
+	assert.NotNil(t, err)
+	_, err = generate(newHandler(api.WithRegistryURL(registry.URL)), "missing", "1.0.0")
+	assert.NotNil(t, err)
+}
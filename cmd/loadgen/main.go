@@ -0,0 +1,173 @@
+// Command loadgen drives the deps API with concurrent package requests and
+// reports latency percentiles, either against a running server or against an
+// in-process one resolving from a recorded registry fixture.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/snyk/snyk-code-review-exercise/api"
+	"github.com/snyk/snyk-code-review-exercise/internal/fixtures"
+)
+
+type result struct {
+	latency time.Duration
+	status  int
+	err     error
+}
+
+func main() {
+	target := flag.String("target", "", "base url of a running server, an in-process one resolving from -fixture is used otherwise")
+	fixture := flag.String("fixture", "api/testdata/registry/react-16.13.0.json", "recorded registry the in-process server resolves from")
+	packages := flag.String("packages", "react@16.13.0", "comma separated package@version list, requested round robin")
+	concurrency := flag.Int("concurrency", 8, "number of concurrent clients")
+	requests := flag.Int("requests", 1000, "total number of requests")
+	cache := flag.Bool("cache", false, "keep the response cache of the in-process server, every request is a full resolution otherwise")
+	flag.Parse()
+
+	logger := log.New(os.Stderr, "LOADGEN: ", log.Ldate|log.Ltime)
+
+	paths, err := packagePaths(*packages)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	baseURL := *target
+	if baseURL == "" {
+		server, err := inProcessServer(*fixture, *cache)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer server.Close()
+		baseURL = server.URL
+	}
+
+	client := &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: *concurrency}}
+
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+
+	results := make([]result, *requests)
+	var next int64 = -1
+	var wg sync.WaitGroup
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				n := int(atomic.AddInt64(&next, 1))
+				if n >= len(results) {
+					return
+				}
+				results[n] = get(client, baseURL+paths[n%len(paths)])
+			}
+		}()
+	}
+	wg.Wait()
+
+	elapsed := time.Since(start)
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+
+	report(os.Stdout, results, elapsed)
+	// IE: only meaningful in-process, the server shares the memory stats then
+	if *target == "" {
+		fmt.Printf("allocs/request: %d (%d bytes, client and server)\n",
+			(after.Mallocs-before.Mallocs)/uint64(len(results)),
+			(after.TotalAlloc-before.TotalAlloc)/uint64(len(results)))
+	}
+}
+
+// IE: scoped names start with an @ of their own, the version is after the last one
+func packagePaths(list string) ([]string, error) {
+	var paths []string
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		at := strings.LastIndex(entry, "@")
+		if at <= 0 || at == len(entry)-1 {
+			return nil, fmt.Errorf("expected package@version, got %q", entry)
+		}
+		paths = append(paths, "/package/"+entry[:at]+"/"+entry[at+1:])
+	}
+	return paths, nil
+}
+
+func inProcessServer(fixture string, cache bool) (*httptest.Server, error) {
+	packages, err := fixtures.Load(fixture)
+	if err != nil {
+		return nil, err
+	}
+	registry := httptest.NewServer(packages)
+
+	// IE: keep the api logs out of the report
+	optFns := []api.Option{api.WithRegistryURL(registry.URL), api.WithMaxInFlight(0), api.WithLogger(slog.New(slog.DiscardHandler))}
+	if !cache {
+		optFns = append(optFns, api.WithResponseCache(0, 0))
+	}
+	handler := api.New(optFns...)
+
+	server := httptest.NewServer(handler)
+	server.Config.RegisterOnShutdown(registry.Close)
+	return server, nil
+}
+
+func get(client *http.Client, url string) result {
+	start := time.Now()
+	resp, err := client.Get(url)
+	if err != nil {
+		return result{latency: time.Since(start), err: err}
+	}
+	_, err = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return result{latency: time.Since(start), status: resp.StatusCode, err: err}
+}
+
+func report(w io.Writer, results []result, elapsed time.Duration) {
+	latencies := make([]time.Duration, 0, len(results))
+	statuses := make(map[int]int)
+	errors := 0
+	for _, r := range results {
+		if r.err != nil {
+			errors++
+			continue
+		}
+		statuses[r.status]++
+		latencies = append(latencies, r.latency)
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	fmt.Fprintf(w, "requests: %d in %s (%.1f/s)\n", len(results), elapsed.Round(time.Millisecond), float64(len(results))/elapsed.Seconds())
+	fmt.Fprintf(w, "errors: %d\n", errors)
+	codes := make([]int, 0, len(statuses))
+	for status := range statuses {
+		codes = append(codes, status)
+	}
+	sort.Ints(codes)
+	for _, status := range codes {
+		fmt.Fprintf(w, "status %d: %d\n", status, statuses[status])
+	}
+	if len(latencies) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "p50: %s p90: %s p99: %s max: %s\n",
+		percentile(latencies, 50), percentile(latencies, 90), percentile(latencies, 99), latencies[len(latencies)-1])
+}
+
+// IE: latencies must be sorted
+func percentile(latencies []time.Duration, p int) time.Duration {
+	return latencies[(len(latencies)-1)*p/100]
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPackagePaths(t *testing.T) {
+	paths, err := packagePaths("react@16.13.0, @babel/core@7.19.3")
+	require.Nil(t, err)
+	assert.Equal(t, []string{"/package/react/16.13.0", "/package/@babel/core/7.19.3"}, paths)
+
+	_, err = packagePaths("react")
+	assert.NotNil(t, err)
+	_, err = packagePaths("@babel/core")
+	assert.NotNil(t, err)
+}
+
+func TestPercentile(t *testing.T) {
+	latencies := []time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	assert.Equal(t, time.Duration(5), percentile(latencies, 50))
+	assert.Equal(t, time.Duration(9), percentile(latencies, 99))
+}
@@ -0,0 +1,590 @@
+// Package config loads the settings of the server from, in increasing order of
+// precedence, their defaults, a YAML or TOML file, DEPS_* environment
+// variables and command line flags. Every setting has a flag, its name is the
+// key in the file and, upper cased with dashes as underscores after DEPS_,
+// the environment variable (i.e. -cache-ttl, cache-ttl and DEPS_CACHE_TTL).
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/snyk/snyk-code-review-exercise/api"
+	"github.com/snyk/snyk-code-review-exercise/internal/logsink"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is the prefix of the environment variables setting the flags.
+const EnvPrefix = "DEPS_"
+
+// IE: the flag naming the file can't be set from the file itself
+const configFlag = "config"
+
+// Values of the -tls-client-auth flag.
+const (
+	ClientAuthRequire = "require"
+	ClientAuthVerify  = "verify"
+)
+
+// Values of the -self-check flag.
+const (
+	SelfCheckOff  = "off"
+	SelfCheckWarn = "warn"
+	SelfCheckFail = "fail"
+)
+
+// Config holds every setting of the server.
+type Config struct {
+	ConfigFile string
+
+	Address         string
+	Port            int
+	ListenFD        int
+	AdminAddress    string
+	ShutdownTimeout time.Duration
+	DrainDelay      time.Duration
+	SelfCheck       string
+
+	TLSCert           string
+	TLSKey            string
+	TLSReloadInterval time.Duration
+	TLSClientCA       string
+	TLSClientAuth     string
+
+	RegistryURL         string
+	RegistryToken       string
+	UpstreamHosts       string
+	PackagePolicy       string
+	LicensePolicy       string
+	AbandonedAfter      time.Duration
+	CDNFallback         bool
+	VerifyTarballs      bool
+	VerifyProvenance    bool
+	TyposquatList       string
+	TyposquatDistance   int
+	VulnerabilitySource string
+
+	CacheSize            int
+	CacheTTL             time.Duration
+	StaleWhileRevalidate time.Duration
+	PackumentCacheSize   int
+	PackumentTTL         time.Duration
+	VersionTTL           time.Duration
+	CacheBytes           int64
+	PackumentBytes       int64
+	SubtreeCacheSize     int
+	SubtreeCacheBytes    int64
+	CacheShards          int
+	NegativeCacheTTL     time.Duration
+	CacheBackend         string
+	CacheAddress         string
+	Warmup               string
+	InvalidationRedis    string
+	CacheSnapshot        string
+
+	Concurrency         int
+	UpstreamConcurrency int
+	GOMAXPROCS          string
+	GCPercent           int
+	PrecomputeTop       int
+	PrecomputeInterval  time.Duration
+	AuthIssuer          string
+	AuthAudience        string
+	AuthJWKSURL         string
+	ClientHeader        string
+	TrustedGateways     string
+	ClientPriorities    string
+	FairScheduling      bool
+	RateLimit           float64
+	RateLimitBurst      int
+	ClientRateLimits    string
+	AllowCIDRs          string
+	DenyCIDRs           string
+	CORSOrigins         string
+	CORSMethods         string
+	CORSHeaders         string
+	CORSMaxAge          time.Duration
+	Features            string
+	MaxDepth            int
+	MaxNodes            int
+	MaxInFlight         int
+
+	RequestTimeout    time.Duration
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	MaxURIBytes       int
+	MaxBodyBytes      int64
+
+	LogFormat           string
+	LogLevel            slog.Level
+	LogSampleFirst      int
+	LogSampleThereafter int
+	LogSampleInterval   time.Duration
+	LogOutput           string
+	ErrorLogOutput      string
+	LogMaxBytes         int64
+	LogRotateEvery      time.Duration
+	LogMaxBackups       int
+	AccessLog           string
+	AccessLogFormat     string
+	AuditLog            string
+	HistoryFile         string
+	HistoryRetention    time.Duration
+	SentryDSN           string
+	SentryEnvironment   string
+	OTLPEndpoint        string
+	TraceSampleRatio    float64
+	StatsDAddress       string
+	StatsDFormat        string
+	StatsDInterval      time.Duration
+}
+
+// IE: one flag per field, the defaults are the ones of the flags
+func (c *Config) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.ConfigFile, configFlag, "", "YAML (.yaml, .yml) or TOML (.toml) file setting any of these flags by name, below the environment and the command line")
+
+	fs.StringVar(&c.Address, "address", "localhost:3000", "host:port the server listens on")
+	fs.IntVar(&c.Port, "port", 0, "port the server listens on in place of the one of -address, 0 keeps it")
+	fs.IntVar(&c.ListenFD, "fd", -1, "serve on this inherited listening socket (i.e. from a restart manager) instead of -address, systemd socket activation (LISTEN_FDS) is picked up without it")
+	fs.StringVar(&c.AdminAddress, "admin-address", "", "serve the operator endpoints (pprof profiles) on this address, i.e. localhost:6060, disabled when empty")
+	fs.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", 30*time.Second, "how long in-flight requests may take to complete on SIGINT/SIGTERM before the server exits anyway")
+	fs.DurationVar(&c.DrainDelay, "drain-delay", 0, "on SIGTERM (or GET /debug/drain from a preStop hook), keep serving this long with /readyz failing before draining, for the load balancer to stop routing here")
+	fs.StringVar(&c.SelfCheck, "self-check", SelfCheckWarn, "check the registry answers and the cache backend works on startup: warn logs the failures, fail refuses to start, off skips it")
+	fs.StringVar(&c.TLSCert, "tls-cert", "", "serve HTTPS with this PEM certificate (chain included), with -tls-key, plain HTTP when empty")
+	fs.StringVar(&c.TLSKey, "tls-key", "", "PEM private key of -tls-cert")
+	fs.StringVar(&c.TLSClientCA, "tls-client-ca", "", "require client certificates issued by one of the CAs of this PEM bundle (mutual TLS), with -tls-cert, disabled when empty")
+	fs.StringVar(&c.TLSClientAuth, "tls-client-auth", ClientAuthRequire, "with -tls-client-ca: require fails the handshake without a client certificate, verify lets it through for the API to answer 401, the probes aside")
+	fs.DurationVar(&c.TLSReloadInterval, "tls-reload-interval", time.Minute, "how often -tls-cert and -tls-key are checked for a renewed pair, 0 only reloads them on SIGHUP")
+
+	fs.StringVar(&c.RegistryURL, "registry", "https://registry.npmjs.org", "npm compatible registry to resolve packages from")
+	fs.StringVar(&c.RegistryToken, "registry-token", "", "reference to the bearer token of -registry: env:NAME, file:PATH or vault:PATH#KEY (with VAULT_ADDR and VAULT_TOKEN), anonymous when empty")
+	fs.StringVar(&c.PackagePolicy, "package-policy", "", "YAML file of the packages denied (or, in allow mode, allowed) in the trees, whose resolution is rejected or flagged, disabled when empty")
+	fs.StringVar(&c.LicensePolicy, "license-policy", "", "YAML file of the SPDX licenses allowed and denied in the trees, evaluated by the licenses report section, none when empty")
+	fs.DurationVar(&c.AbandonedAfter, "abandoned-after", 3*365*24*time.Hour, "how long after their last publish the abandoned report section takes packages for abandoned")
+	fs.StringVar(&c.UpstreamHosts, "upstream-hosts", "", "comma separated hosts (i.e. registry.example.com,*.cdn.example.com) the service may call for registry documents and tarballs, redirects included, the ones of -registry and the CDNs when empty")
+	fs.BoolVar(&c.CDNFallback, "cdn-fallback", false, "fall back on jsDelivr/unpkg metadata when the registry fails for a package")
+	fs.BoolVar(&c.VerifyTarballs, "verify-tarballs", false, "download each resolved tarball and verify its integrity hash")
+	fs.BoolVar(&c.VerifyProvenance, "verify-provenance", false, "check the registry signature and provenance attestation of each resolved version, flagged verified or missing")
+	fs.IntVar(&c.TyposquatDistance, "typosquat-distance", 0, "flag the resolved packages within this many edits (fewer for short names) of a popular package as possible typosquats, 0 disables it")
+	fs.StringVar(&c.VulnerabilitySource, "vulnerability-source", "", "where to look the advisories of the resolved versions up: npm for the bulk advisory endpoint of -registry, disabled when empty")
+	fs.StringVar(&c.TyposquatList, "typosquat-list", "", "file of the popular package names, one per line, for -typosquat-distance, a built-in list of the most downloaded ones when empty")
+
+	fs.IntVar(&c.CacheSize, "cache-size", 128, "maximum number of responses kept in the response cache, 0 disables it")
+	fs.DurationVar(&c.CacheTTL, "cache-ttl", 10*time.Minute, "how long a cached response is served before re-resolving, 0 never expires")
+	fs.DurationVar(&c.StaleWhileRevalidate, "stale-while-revalidate", 0, "keep serving expired responses for this long while they are re-resolved in the background")
+	fs.IntVar(&c.PackumentCacheSize, "packument-cache-size", 1024, "maximum number of packuments kept in the packument cache")
+	fs.DurationVar(&c.PackumentTTL, "packument-ttl", 5*time.Minute, "how long packuments (mutable, they change on every publish) are cached")
+	fs.DurationVar(&c.VersionTTL, "version-ttl", 24*time.Hour, "how long version documents (immutable once published) are cached")
+	fs.Int64Var(&c.CacheBytes, "cache-bytes", 256<<20, "memory budget in bytes for cached responses, 0 only bounds the number of entries")
+	fs.Int64Var(&c.PackumentBytes, "packument-bytes", 128<<20, "memory budget in bytes for cached packuments, 0 only bounds the number of entries")
+	fs.IntVar(&c.SubtreeCacheSize, "subtree-cache-size", 4096, "maximum number of subtrees kept in memory for reuse across requests, 0 disables it")
+	fs.Int64Var(&c.SubtreeCacheBytes, "subtree-cache-bytes", 64<<20, "memory budget in bytes for cached subtrees, 0 only bounds the number of entries")
+	fs.IntVar(&c.CacheShards, "cache-shards", 16, "number of independently locked shards for the in-memory caches")
+	fs.DurationVar(&c.NegativeCacheTTL, "negative-cache-ttl", time.Minute, "how long registry 404s and unsatisfiable constraints are remembered, 0 disables it")
+	fs.StringVar(&c.CacheBackend, "cache-backend", api.CacheBackendMemory, "where packuments and responses are cached: memory, redis, memcached, bolt or tiered")
+	fs.StringVar(&c.CacheAddress, "cache-address", "", "redis url, comma separated memcached host:port list or bolt/tiered file, depending on -cache-backend")
+	fs.StringVar(&c.Warmup, "warmup", "", "file listing package@version entries to resolve in the background on startup")
+	fs.StringVar(&c.InvalidationRedis, "invalidation-redis", "", "broadcast cache purges to the other replicas through redis pub/sub (i.e. redis://localhost:6379/0)")
+	fs.StringVar(&c.CacheSnapshot, "cache-snapshot", "", "save the in-memory caches to this file on shutdown and restore them on startup")
+
+	fs.IntVar(&c.Concurrency, "concurrency", 32, "maximum number of dependencies resolved at the same time for each tree")
+	fs.IntVar(&c.UpstreamConcurrency, "upstream-concurrency", 128, "maximum number of upstream requests in flight across all trees, halved while upstream throttles, 0 doesn't limit them")
+	fs.StringVar(&c.GOMAXPROCS, "gomaxprocs", "", "number of OS threads running Go code, or fraction of the CPUs (i.e. 0.75), empty keeps the runtime default")
+	fs.IntVar(&c.GCPercent, "gc-percent", 0, "GC target percentage, 0 keeps the runtime default, -1 turns the GC off")
+	fs.IntVar(&c.PrecomputeTop, "precompute-top", 0, "re-resolve this many of the most requested trees in the background so they are always cached, 0 disables it")
+	fs.DurationVar(&c.PrecomputeInterval, "precompute-interval", 5*time.Minute, "how often the most requested trees are re-resolved, keep it below -cache-ttl")
+	fs.StringVar(&c.AuthIssuer, "auth-issuer", "", "require a bearer JWT issued by this OIDC issuer on the API requests (probes and /metrics aside), disabled when empty")
+	fs.StringVar(&c.AuthAudience, "auth-audience", "", "audience the bearer tokens must be issued for, not checked when empty")
+	fs.StringVar(&c.AuthJWKSURL, "auth-jwks-url", "", "where the signing keys of -auth-issuer are, its OpenID configuration (/.well-known/openid-configuration) tells when empty")
+	fs.StringVar(&c.ClientHeader, "client-header", "", "request header the -trusted-gateways identify their clients with (i.e. X-Client-ID) for fair scheduling, priorities and rate limits")
+	fs.StringVar(&c.TrustedGateways, "trusted-gateways", "", "comma separated token subjects or client certificate common names allowed to name their clients in -client-header")
+	fs.StringVar(&c.ClientPriorities, "client-priorities", "", "comma separated client=priority list, higher goes first when upstream calls queue up, 0 by default and -1 for background")
+	fs.BoolVar(&c.FairScheduling, "fair-scheduling", true, "clients take turns for upstream calls once queued instead of first come first served")
+	fs.Float64Var(&c.RateLimit, "rate-limit", 0, "package requests per second each client may make, beyond it (and -rate-limit-burst) it gets a 429, 0 doesn't limit them")
+	fs.IntVar(&c.RateLimitBurst, "rate-limit-burst", 0, "requests a client may make at once before -rate-limit applies, 0 for a second worth of them")
+	fs.StringVar(&c.ClientRateLimits, "client-rate-limits", "", "comma separated client=requests per second list overriding -rate-limit, 0 doesn't limit the client")
+	fs.StringVar(&c.AllowCIDRs, "allow-cidrs", "", "comma separated networks (i.e. 10.0.0.0/8) or addresses the clients must come from, the others get a 403, anybody when empty")
+	fs.StringVar(&c.DenyCIDRs, "deny-cidrs", "", "comma separated networks or addresses whose clients get a 403, even within -allow-cidrs")
+	fs.StringVar(&c.CORSOrigins, "cors-origins", "", "comma separated origins (i.e. https://dashboard.example.com, https://*.example.com or *) whose pages may call the API from a browser, disabled when empty")
+	fs.StringVar(&c.CORSMethods, "cors-methods", "GET,POST", "comma separated methods the pages of -cors-origins may call the API with")
+	fs.StringVar(&c.CORSHeaders, "cors-headers", "Authorization,Content-Type,X-Request-ID,X-Feature-Flags", "comma separated request headers the pages of -cors-origins may send, -client-header included anyway")
+	fs.DurationVar(&c.CORSMaxAge, "cors-max-age", 10*time.Minute, "how long browsers may cache the answer to a CORS preflight")
+	fs.StringVar(&c.Features, "features", "", "comma separated feature=on|off list turning features on or off for the deployment, i.e. prefetch=off, see /debug/features")
+	fs.IntVar(&c.MaxDepth, "max-depth", 0, "stop resolving dependencies this many levels below the requested package, 0 doesn't limit the depth")
+	fs.IntVar(&c.MaxNodes, "max-nodes", 100000, "maximum number of nodes resolved for each tree, the rest is left out and the tree flagged partial, 0 doesn't limit them")
+	fs.IntVar(&c.MaxInFlight, "max-in-flight", 64, "maximum number of package requests served at the same time, beyond it clients get a 429, 0 doesn't limit them")
+
+	fs.DurationVar(&c.RequestTimeout, "request-timeout", 90*time.Second, "abandon requests, resolution included, taking longer than this with a 504, 0 doesn't bound them")
+	fs.DurationVar(&c.ReadHeaderTimeout, "read-header-timeout", 10*time.Second, "how long clients may take to send the request headers")
+	fs.DurationVar(&c.ReadTimeout, "read-timeout", 30*time.Second, "how long clients may take to send the whole request")
+	fs.DurationVar(&c.WriteTimeout, "write-timeout", 2*time.Minute, "how long writing the response may take, from the end of the request headers, keep it above -request-timeout")
+	fs.DurationVar(&c.IdleTimeout, "idle-timeout", 2*time.Minute, "how long idle keep-alive connections are kept open")
+	fs.IntVar(&c.MaxHeaderBytes, "max-header-bytes", 64<<10, "maximum size of the request headers")
+	fs.IntVar(&c.MaxURIBytes, "max-uri-bytes", 4096, "maximum length of the request URIs, longer ones get a 414, 0 doesn't limit them")
+	fs.Int64Var(&c.MaxBodyBytes, "max-body-bytes", 1<<20, "maximum size of the request bodies, larger ones get a 413, 0 doesn't limit them")
+
+	fs.StringVar(&c.LogFormat, "log-format", api.LogFormatText, "format of the log records: text or json")
+	fs.TextVar(&c.LogLevel, "log-level", slog.LevelInfo, "lowest level logged: debug, info, warn or error")
+	fs.IntVar(&c.LogSampleFirst, "log-sample-first", 10, "identical warnings and errors logged every -log-sample-interval before sampling them, 0 logs them all")
+	fs.IntVar(&c.LogSampleThereafter, "log-sample-thereafter", 100, "past -log-sample-first, log one in this many identical warnings and errors, 0 drops them all")
+	fs.DurationVar(&c.LogSampleInterval, "log-sample-interval", time.Second, "interval the identical warnings and errors are counted over")
+	fs.StringVar(&c.LogOutput, "log-output", "-", "where the logs go: - for stdout, stderr, syslog, syslog://host:port (UDP), syslog+tcp://host:port or a file, rotated by -log-max-bytes and -log-rotate-every")
+	fs.StringVar(&c.ErrorLogOutput, "error-log-output", "", "send the warnings and errors there instead of -log-output, same destinations, with -log-output when empty")
+	fs.Int64Var(&c.LogMaxBytes, "log-max-bytes", 100<<20, "rotate the log files (logs, errors and access log) once they would grow past this size, 0 doesn't bound it")
+	fs.DurationVar(&c.LogRotateEvery, "log-rotate-every", 0, "rotate the log files once they were opened this long ago, i.e. 24h, 0 doesn't rotate them by age")
+	fs.IntVar(&c.LogMaxBackups, "log-max-backups", 7, "rotated log files kept next to each log file, the oldest are deleted, 0 keeps them all")
+	fs.StringVar(&c.AccessLog, "access-log", "", "write one access log line per request there, same destinations as -log-output, disabled when empty")
+	fs.StringVar(&c.AccessLogFormat, "access-log-format", api.AccessLogCombined, "access log format: combined or json")
+	fs.StringVar(&c.AuditLog, "audit-log", "", "record every resolution request to this file, or post them to this http(s) url, as JSON lines, disabled when empty")
+	fs.StringVar(&c.HistoryFile, "history-file", "", "bolt file keeping every tree resolved or served from the cache (its package set and fingerprint), served by /history, disabled when empty")
+	fs.DurationVar(&c.HistoryRetention, "history-retention", 90*24*time.Hour, "resolutions of -history-file older than this are dropped, 0 keeps them all")
+	fs.StringVar(&c.SentryDSN, "sentry-dsn", "", "report panics and failed resolutions to this Sentry (or compatible) DSN, disabled when empty")
+	fs.StringVar(&c.SentryEnvironment, "sentry-environment", "production", "environment the error reports are tagged with")
+	fs.StringVar(&c.OTLPEndpoint, "otlp-endpoint", "", "export traces to this OTLP/HTTP collector (i.e. http://localhost:4318), disabled when empty")
+	fs.Float64Var(&c.TraceSampleRatio, "trace-sample-ratio", 1, "fraction of the requests traced, unless the caller already decided through traceparent")
+	fs.StringVar(&c.StatsDAddress, "statsd-address", "", "push the metrics to this StatsD or Datadog agent (i.e. localhost:8125) on top of serving /metrics, disabled when empty")
+	fs.StringVar(&c.StatsDFormat, "statsd-format", api.StatsDFormatDatadog, "statsd wire format: datadog (labels as tags) or statsd (label values in the names)")
+	fs.DurationVar(&c.StatsDInterval, "statsd-interval", 10*time.Second, "how often the metrics are pushed to -statsd-address")
+}
+
+// Default returns the settings used when nothing else sets them.
+func Default() *Config {
+	c := &Config{}
+	c.register(flag.NewFlagSet("defaults", flag.ContinueOnError))
+	return c
+}
+
+// EnvName returns the environment variable setting the flag name, i.e.
+// DEPS_CACHE_TTL for cache-ttl.
+func EnvName(name string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// Load parses the command line args (without the program name), then sets the
+// flags not given there from the environment, looked up with lookupEnv (i.e.
+// os.LookupEnv), and the ones still unset from the -config file. Asking for
+// -h returns flag.ErrHelp once the usage is written to output.
+func Load(name string, args []string, lookupEnv func(string) (string, bool), output io.Writer) (*Config, error) {
+	c := &Config{}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(output)
+	c.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(output, "Usage of %s:\n", name)
+		fs.PrintDefaults()
+		fmt.Fprintf(output, "\nEvery flag can also be set from the environment (i.e. %s for -cache-ttl) or, under its own name, from the -config file.\n", EnvName("cache-ttl"))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments %q", fs.Args())
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] {
+			return
+		}
+		if value, found := lookupEnv(EnvName(f.Name)); found {
+			if err := fs.Set(f.Name, value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", EnvName(f.Name), err))
+			}
+			set[f.Name] = true
+		}
+	})
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	if c.ConfigFile == "" {
+		return c, nil
+	}
+	values, err := readFile(c.ConfigFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", c.ConfigFile, err)
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if key == configFlag || fs.Lookup(key) == nil {
+			errs = append(errs, fmt.Errorf("%s: unknown setting %q", c.ConfigFile, key))
+			continue
+		}
+		if set[key] {
+			continue
+		}
+		if err := fs.Set(key, values[key]); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s: %w", c.ConfigFile, key, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// IE: the flags the running server applies on reload, through api.Reload but
+// for the log level, the others only take effect on the next start
+var reloadable = map[string]bool{
+	"log-level":              true,
+	"registry":               true,
+	"concurrency":            true,
+	"upstream-concurrency":   true,
+	"max-in-flight":          true,
+	"max-nodes":              true,
+	"max-depth":              true,
+	"cache-ttl":              true,
+	"stale-while-revalidate": true,
+	"packument-ttl":          true,
+	"version-ttl":            true,
+	"negative-cache-ttl":     true,
+}
+
+// ReloadOptions returns the options api.Reload applies to the running server.
+func (c *Config) ReloadOptions() []api.Option {
+	return []api.Option{
+		api.WithRegistryURL(c.RegistryURL),
+		api.WithConcurrency(c.Concurrency),
+		api.WithUpstreamConcurrency(c.UpstreamConcurrency),
+		api.WithMaxInFlight(c.MaxInFlight),
+		api.WithInputLimits(c.MaxURIBytes, c.MaxBodyBytes),
+		api.WithMaxNodes(c.MaxNodes),
+		api.WithMaxDepth(c.MaxDepth),
+		api.WithResponseCache(c.CacheSize, c.CacheTTL),
+		api.WithStaleWhileRevalidate(c.StaleWhileRevalidate),
+		api.WithPackumentCache(c.PackumentCacheSize, c.PackumentTTL),
+		api.WithVersionDocumentTTL(c.VersionTTL),
+		api.WithNegativeCache(c.NegativeCacheTTL),
+	}
+}
+
+// RestartRequired returns the names of the flags set differently in c and in
+// the running configuration, that a reload doesn't apply.
+func (c *Config) RestartRequired(running *Config) []string {
+	values, runningValues := c.values(), running.values()
+	var names []string
+	for name, value := range values {
+		if value != runningValues[name] && !reloadable[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IE: compared as the flags print them, register sets the defaults so it gets
+// a copy, pointed back at the values of c afterwards
+func (c *Config) values() map[string]string {
+	copied := &Config{}
+	fs := flag.NewFlagSet("values", flag.ContinueOnError)
+	copied.register(fs)
+	*copied = *c
+
+	values := make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) { values[f.Name] = f.Value.String() })
+	return values
+}
+
+// IE: flat, one key per flag, the values as the flag would take them
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("unknown config format %q, expected .yaml, .yml or .toml", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(raw))
+	for key, value := range raw {
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			return nil, fmt.Errorf("%s: expected a single value", key)
+		case nil:
+			values[key] = ""
+		default:
+			values[key] = fmt.Sprint(value)
+		}
+	}
+	return values, nil
+}
+
+// IE: the empty items of "a, ,b," dropped
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// ListenAddress returns the host:port the server listens on, the one of
+// -address with the port of -port when set.
+func (c *Config) ListenAddress() string {
+	if c.Port == 0 {
+		return c.Address
+	}
+	host, _, err := net.SplitHostPort(c.Address)
+	if err != nil {
+		host = c.Address
+	}
+	return net.JoinHostPort(host, strconv.Itoa(c.Port))
+}
+
+// LogRotation returns the rotation of the log files, access log included.
+func (c *Config) LogRotation() logsink.Rotation {
+	return logsink.Rotation{MaxBytes: c.LogMaxBytes, Every: c.LogRotateEvery, MaxBackups: c.LogMaxBackups}
+}
+
+// APIOptions returns the api options of the settings, the ones needing
+// resources of their own (logger, tracer, access log file) aside.
+func (c *Config) APIOptions() ([]api.Option, error) {
+	priorities, err := api.ParseClientPriorities(c.ClientPriorities)
+	if err != nil {
+		return nil, fmt.Errorf("client-priorities: %w", err)
+	}
+
+	rateLimits, err := api.ParseClientRateLimits(c.ClientRateLimits)
+	if err != nil {
+		return nil, fmt.Errorf("client-rate-limits: %w", err)
+	}
+
+	upstreamHosts, err := api.ParseUpstreamHosts(c.UpstreamHosts)
+	if err != nil {
+		return nil, fmt.Errorf("upstream-hosts: %w", err)
+	}
+
+	var registryToken *api.Secret
+	if c.RegistryToken != "" {
+		if registryToken, err = api.ParseSecret(c.RegistryToken); err != nil {
+			return nil, fmt.Errorf("registry-token: %w", err)
+		}
+	}
+
+	switch c.VulnerabilitySource {
+	case "", api.VulnerabilitySourceNPM:
+	default:
+		return nil, fmt.Errorf("vulnerability-source: expected npm or empty, got %q", c.VulnerabilitySource)
+	}
+
+	var popular []string
+	if c.TyposquatList != "" {
+		if popular, err = api.LoadPopularPackages(c.TyposquatList); err != nil {
+			return nil, fmt.Errorf("typosquat-list: %w", err)
+		}
+	}
+
+	var policy *api.PackagePolicy
+	if c.PackagePolicy != "" {
+		if policy, err = api.LoadPackagePolicy(c.PackagePolicy); err != nil {
+			return nil, fmt.Errorf("package-policy: %w", err)
+		}
+	}
+
+	var licensePolicy *api.LicensePolicy
+	if c.LicensePolicy != "" {
+		if licensePolicy, err = api.LoadLicensePolicy(c.LicensePolicy); err != nil {
+			return nil, fmt.Errorf("license-policy: %w", err)
+		}
+	}
+
+	allowCIDRs, err := api.ParseCIDRs(c.AllowCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("allow-cidrs: %w", err)
+	}
+	denyCIDRs, err := api.ParseCIDRs(c.DenyCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("deny-cidrs: %w", err)
+	}
+
+	corsOrigins, err := api.ParseCORSOrigins(c.CORSOrigins)
+	if err != nil {
+		return nil, fmt.Errorf("cors-origins: %w", err)
+	}
+
+	features, err := api.ParseFeatureFlags(c.Features)
+	if err != nil {
+		return nil, fmt.Errorf("features: %w", err)
+	}
+
+	return []api.Option{
+		api.WithFeatures(features),
+		api.WithRegistryURL(c.RegistryURL),
+		api.WithUpstreamHosts(upstreamHosts),
+		api.WithPackagePolicy(policy),
+		api.WithLicensePolicy(licensePolicy),
+		api.WithAbandonedAfter(c.AbandonedAfter),
+		api.WithRegistryToken(registryToken),
+		api.WithTarballVerification(c.VerifyTarballs),
+		api.WithProvenanceVerification(c.VerifyProvenance),
+		api.WithTyposquatCheck(popular, c.TyposquatDistance),
+		api.WithVulnerabilitySource(c.VulnerabilitySource),
+		api.WithCDNFallback(c.CDNFallback),
+		api.WithResponseCache(c.CacheSize, c.CacheTTL),
+		api.WithStaleWhileRevalidate(c.StaleWhileRevalidate),
+		api.WithPackumentCache(c.PackumentCacheSize, c.PackumentTTL),
+		api.WithVersionDocumentTTL(c.VersionTTL),
+		api.WithCacheMemoryBudget(c.CacheBytes, c.PackumentBytes),
+		api.WithSubtreeCache(c.SubtreeCacheSize, c.SubtreeCacheBytes),
+		api.WithCacheShards(c.CacheShards),
+		api.WithNegativeCache(c.NegativeCacheTTL),
+		api.WithCacheBackend(c.CacheBackend, c.CacheAddress),
+		api.WithWarmupList(c.Warmup),
+		api.WithInvalidationBus(c.InvalidationRedis),
+		api.WithCacheSnapshot(c.CacheSnapshot),
+		api.WithConcurrency(c.Concurrency),
+		api.WithUpstreamConcurrency(c.UpstreamConcurrency),
+		api.WithJWTAuth(c.AuthIssuer, c.AuthAudience, c.AuthJWKSURL),
+		api.WithClientHeader(c.ClientHeader),
+		api.WithTrustedGateways(splitList(c.TrustedGateways)),
+		api.WithClientPriorities(priorities),
+		api.WithFairScheduling(c.FairScheduling),
+		api.WithRateLimit(c.RateLimit, c.RateLimitBurst, rateLimits),
+		api.WithAddressFilter(allowCIDRs, denyCIDRs),
+		api.WithCORS(corsOrigins, splitList(c.CORSMethods), splitList(c.CORSHeaders), c.CORSMaxAge),
+		api.WithMaxDepth(c.MaxDepth),
+		api.WithMaxNodes(c.MaxNodes),
+		api.WithMaxInFlight(c.MaxInFlight),
+		api.WithRequestTimeout(c.RequestTimeout),
+		api.WithPrecompute(c.PrecomputeTop, c.PrecomputeInterval),
+		api.WithStatsD(c.StatsDAddress, c.StatsDFormat, c.StatsDInterval),
+		api.WithAuditLog(c.AuditLog),
+		api.WithResolutionHistory(c.HistoryFile, c.HistoryRetention),
+		api.WithDrainDelay(c.DrainDelay),
+		api.WithErrorTracking(c.SentryDSN, c.SentryEnvironment),
+		api.WithLogSampling(c.LogSampleFirst, c.LogSampleThereafter, c.LogSampleInterval),
+	}, nil
+}
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func env(values map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := values[key]
+		return value, ok
+	}
+}
+
+func writeConfig(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.Nil(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestEnvName(t *testing.T) {
+	assert.Equal(t, "DEPS_CACHE_TTL", EnvName("cache-ttl"))
+	assert.Equal(t, "DEPS_GOMAXPROCS", EnvName("gomaxprocs"))
+}
+
+func TestLoadDefaults(t *testing.T) {
+	c, err := Load("deps", nil, env(nil), io.Discard)
+	require.Nil(t, err)
+	assert.Equal(t, Default(), c)
+	assert.Equal(t, "localhost:3000", c.Address)
+	assert.Equal(t, 32, c.Concurrency)
+	assert.Equal(t, slog.LevelInfo, c.LogLevel)
+}
+
+func TestListenAddress(t *testing.T) {
+	c, err := Load("deps", []string{"--port", "8080"}, env(nil), io.Discard)
+	require.Nil(t, err)
+	assert.Equal(t, "localhost:8080", c.ListenAddress())
+
+	c, err = Load("deps", []string{"-address", ":3000"}, env(nil), io.Discard)
+	require.Nil(t, err)
+	assert.Equal(t, ":3000", c.ListenAddress())
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfig(t, "deps.yaml", `
+cache-size: 10
+cache-ttl: 1m
+concurrency: 4
+max-nodes: 500
+`)
+	c, err := Load("deps", []string{"-config", path, "-cache-size", "30"}, env(map[string]string{
+		"DEPS_CACHE_SIZE":  "20",
+		"DEPS_CACHE_TTL":   "2m",
+		"DEPS_CONCURRENCY": "12",
+	}), io.Discard)
+	require.Nil(t, err)
+
+	// IE: flag over env over file over default
+	assert.Equal(t, 30, c.CacheSize)
+	assert.Equal(t, 2*time.Minute, c.CacheTTL)
+	assert.Equal(t, 12, c.Concurrency)
+	assert.Equal(t, 500, c.MaxNodes)
+	assert.Equal(t, 64, c.MaxInFlight)
+}
+
+func TestLoadConfigFileFromEnv(t *testing.T) {
+	path := writeConfig(t, "deps.yml", "address: 0.0.0.0:8080\n")
+	c, err := Load("deps", nil, env(map[string]string{"DEPS_CONFIG": path}), io.Discard)
+	require.Nil(t, err)
+	assert.Equal(t, path, c.ConfigFile)
+	assert.Equal(t, "0.0.0.0:8080", c.Address)
+}
+
+func TestLoadTOML(t *testing.T) {
+	path := writeConfig(t, "deps.toml", `
+address = "0.0.0.0:8080"
+fair-scheduling = false
+trace-sample-ratio = 0.25
+log-level = "debug"
+packument-cache-size = 64
+`)
+	c, err := Load("deps", []string{"-config", path}, env(nil), io.Discard)
+	require.Nil(t, err)
+	assert.Equal(t, "0.0.0.0:8080", c.Address)
+	assert.False(t, c.FairScheduling)
+	assert.Equal(t, 0.25, c.TraceSampleRatio)
+	assert.Equal(t, slog.LevelDebug, c.LogLevel)
+	assert.Equal(t, 64, c.PackumentCacheSize)
+}
+
+func TestLoadRejectsInvalidSettings(t *testing.T) {
+	for name, content := range map[string]string{
+		"unknown.yaml": "cache-sise: 10\n",
+		"nested.yaml":  "cache:\n  size: 10\n",
+		"invalid.toml": "cache-ttl = \"soon\"\n",
+		"self.yaml":    "config: other.yaml\n",
+		"deps.json":    "{}",
+	} {
+		path := writeConfig(t, name, content)
+		_, err := Load("deps", []string{"-config", path}, env(nil), io.Discard)
+		assert.NotNil(t, err, name)
+	}
+
+	_, err := Load("deps", nil, env(map[string]string{"DEPS_CONCURRENCY": "many"}), io.Discard)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "DEPS_CONCURRENCY")
+
+	_, err = Load("deps", []string{"-config"}, env(nil), io.Discard)
+	assert.NotNil(t, err)
+
+	_, err = Load("deps", []string{"extra"}, env(nil), io.Discard)
+	assert.NotNil(t, err)
+}
+
+func TestLoadHelp(t *testing.T) {
+	var out strings.Builder
+	_, err := Load("deps", []string{"-h"}, env(nil), &out)
+	assert.ErrorIs(t, err, flag.ErrHelp)
+	assert.Contains(t, out.String(), "-packument-cache-size")
+	assert.Contains(t, out.String(), "DEPS_CACHE_TTL")
+}
+
+func TestRestartRequired(t *testing.T) {
+	running := Default()
+	next := Default()
+	next.CacheTTL = time.Hour
+	next.LogLevel = slog.LevelDebug
+	next.RegistryURL = "http://localhost:4873"
+	assert.Empty(t, next.RestartRequired(running))
+
+	next.Address = "0.0.0.0:3000"
+	next.CacheSize = 1
+	assert.Equal(t, []string{"address", "cache-size"}, next.RestartRequired(running))
+	assert.NotEmpty(t, next.ReloadOptions())
+	// IE: left alone
+	assert.Equal(t, "localhost:3000", running.Address)
+}
+
+func TestAPIOptions(t *testing.T) {
+	c := Default()
+	optFns, err := c.APIOptions()
+	require.Nil(t, err)
+	assert.NotEmpty(t, optFns)
+
+	c.ClientPriorities = "ci=low"
+	_, err = c.APIOptions()
+	assert.NotNil(t, err)
+
+	c = Default()
+	c.Features = "prefetch=off,unknown-feature=on"
+	_, err = c.APIOptions()
+	assert.NotNil(t, err)
+
+	c = Default()
+	c.CORSOrigins = "https://dashboard.example.com/app"
+	_, err = c.APIOptions()
+	assert.NotNil(t, err)
+
+	c = Default()
+	c.DenyCIDRs = "10.0.0.0/33"
+	_, err = c.APIOptions()
+	assert.NotNil(t, err)
+
+	c = Default()
+	c.RegistryToken = "npm_plaintext"
+	_, err = c.APIOptions()
+	assert.NotNil(t, err)
+
+	c = Default()
+	c.VulnerabilitySource = "osv"
+	_, err = c.APIOptions()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,78 @@
+// Package fixtures serves recorded registry data as an npm compatible
+// registry, so the resolver can be tested and benchmarked without the network.
+package fixtures
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Registry maps package name -> version -> dependency name -> constraint, the
+// only parts of the registry documents the resolver reads.
+type Registry map[string]map[string]map[string]string
+
+// Load reads a registry recorded as JSON in the Registry layout.
+func Load(path string) (Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var registry Registry
+	if err := json.Unmarshal(data, &registry); err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
+
+type versionDocument struct {
+	Name         string            `json:"name"`
+	Version      string            `json:"version"`
+	Dependencies map[string]string `json:"dependencies"`
+}
+
+type packument struct {
+	Versions map[string]versionDocument `json:"versions"`
+}
+
+// ServeHTTP answers /{name} with the packument and /{name}/{version} with the
+// version document, scoped names (i.e. /@babel/core/7.19.3) included.
+func (r Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	name, version := splitPath(req.URL.Path)
+	versions, found := r[name]
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if version == "" {
+		doc := packument{Versions: make(map[string]versionDocument, len(versions))}
+		for v, deps := range versions {
+			doc.Versions[v] = versionDocument{Name: name, Version: v, Dependencies: deps}
+		}
+		_ = json.NewEncoder(w).Encode(doc)
+		return
+	}
+
+	deps, found := versions[version]
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(versionDocument{Name: name, Version: version, Dependencies: deps})
+}
+
+// IE: scoped names carry a slash of their own, i.e. "@babel/core"
+func splitPath(path string) (string, string) {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if strings.HasPrefix(parts[0], "@") && len(parts) > 1 {
+		parts = append([]string{parts[0] + "/" + parts[1]}, parts[2:]...)
+	}
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
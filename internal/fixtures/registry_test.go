@@ -0,0 +1,40 @@
+package fixtures
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryServesScopedPackages(t *testing.T) {
+	registry := Registry{
+		"@babel/core": {"7.19.3": {"debug": "^4.1.0"}},
+	}
+
+	rec := httptest.NewRecorder()
+	registry.ServeHTTP(rec, httptest.NewRequest("GET", "/@babel/core", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var doc packument
+	require.Nil(t, json.NewDecoder(rec.Body).Decode(&doc))
+	assert.Equal(t, "^4.1.0", doc.Versions["7.19.3"].Dependencies["debug"])
+
+	rec = httptest.NewRecorder()
+	registry.ServeHTTP(rec, httptest.NewRequest("GET", "/@babel/core/7.19.3", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	registry.ServeHTTP(rec, httptest.NewRequest("GET", "/@babel/core/1.0.0", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestLoadRecordedFixtures(t *testing.T) {
+	registry, err := Load(filepath.Join("..", "..", "api", "testdata", "registry", "express-4.18.1.json"))
+	require.Nil(t, err)
+	assert.Contains(t, registry["express"], "4.18.1")
+}
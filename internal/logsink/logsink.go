@@ -0,0 +1,185 @@
+// Package logsink opens the destinations the logs are written to: the
+// standard streams, files rotated by size and age, or syslog.
+package logsink
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Severity is the syslog severity the lines of a destination are sent with,
+// the other destinations ignore it.
+type Severity int
+
+// Severities of syslog destinations.
+const (
+	SeverityInfo Severity = iota
+	SeverityError
+)
+
+// Rotation bounds the log files. A file is rotated once writing would take it
+// past MaxBytes, or once it was opened Every ago, and only the MaxBackups most
+// recent rotated files are kept. Zero values turn each bound off.
+type Rotation struct {
+	MaxBytes   int64
+	Every      time.Duration
+	MaxBackups int
+}
+
+// IE: rotated files get the time of the rotation appended, sortable as is
+const backupTimeLayout = "20060102T150405.000"
+
+// Open returns the destination target names: - (or stdout) and stderr for the
+// standard streams, syslog for the local syslog daemon, syslog://host:port
+// (UDP) or syslog+tcp://host:port for a remote one, a file path otherwise,
+// appended to and rotated according to rotation.
+func Open(target string, rotation Rotation, severity Severity) (io.WriteCloser, error) {
+	switch {
+	case target == "-" || target == "stdout":
+		return nopCloser{os.Stdout}, nil
+	case target == "stderr":
+		return nopCloser{os.Stderr}, nil
+	case target == "syslog":
+		return openSyslog("", "", severity)
+	case strings.HasPrefix(target, "syslog://"):
+		return openSyslog("udp", strings.TrimPrefix(target, "syslog://"), severity)
+	case strings.HasPrefix(target, "syslog+tcp://"):
+		return openSyslog("tcp", strings.TrimPrefix(target, "syslog+tcp://"), severity)
+	case target == "":
+		return nil, fmt.Errorf("no log destination")
+	}
+	return openRotatingFile(target, rotation, time.Now)
+}
+
+// IE: closing the process' standard streams would lose the last lines
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// IE: every write goes through the lock, the rotation swaps the file under it
+type rotatingFile struct {
+	mu       sync.Mutex
+	path     string
+	rotation Rotation
+	now      func() time.Time
+
+	f      *os.File
+	size   int64
+	opened time.Time
+}
+
+func openRotatingFile(path string, rotation Rotation, now func() time.Time) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, rotation: rotation, now: now}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size, r.opened = f, info.Size(), r.now()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.due(int64(len(p))) {
+		if err := r.rotate(); err != nil {
+			// IE: keep logging to the file there is rather than losing the lines
+			fmt.Fprintf(os.Stderr, "could not rotate %s: %v\n", r.path, err)
+		}
+	}
+	if r.f == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// IE: a line bigger than MaxBytes still goes to a file of its own, an empty one
+// is never rotated
+func (r *rotatingFile) due(next int64) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.rotation.MaxBytes > 0 && r.size+next > r.rotation.MaxBytes {
+		return true
+	}
+	return r.rotation.Every > 0 && r.now().Sub(r.opened) >= r.rotation.Every
+}
+
+func (r *rotatingFile) rotate() error {
+	err := r.f.Close()
+	r.f = nil
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(r.path, r.path+"."+r.now().Format(backupTimeLayout)); err != nil {
+		return err
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+	return r.prune()
+}
+
+// IE: 0 backups keeps them all, the operator prunes them then
+func (r *rotatingFile) prune() error {
+	if r.rotation.MaxBackups <= 0 {
+		return nil
+	}
+	matches, err := filepath.Glob(r.path + ".*")
+	if err != nil {
+		return err
+	}
+	// IE: only the ones rotated here, deps.log.gz or the like are left alone
+	var backups []string
+	for _, match := range matches {
+		if _, err := time.Parse(backupTimeLayout, strings.TrimPrefix(match, r.path+".")); err == nil {
+			backups = append(backups, match)
+		}
+	}
+	if len(backups) <= r.rotation.MaxBackups {
+		return nil
+	}
+	sort.Strings(backups)
+	for _, backup := range backups[:len(backups)-r.rotation.MaxBackups] {
+		if err := os.Remove(backup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
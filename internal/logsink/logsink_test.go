@@ -0,0 +1,96 @@
+package logsink
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// IE: the time moves on by a millisecond per call, rotated files get different names
+func clock(start time.Time) func() time.Time {
+	now := start
+	return func() time.Time {
+		now = now.Add(time.Millisecond)
+		return now
+	}
+}
+
+func backups(t *testing.T, path string) []string {
+	matches, err := filepath.Glob(path + ".*")
+	require.Nil(t, err)
+	sort.Strings(matches)
+	return matches
+}
+
+func TestRotateBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deps.log")
+	f, err := openRotatingFile(path, Rotation{MaxBytes: 10, MaxBackups: 2}, clock(time.Now()))
+	require.Nil(t, err)
+	defer f.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err := f.Write([]byte(line))
+		require.Nil(t, err)
+	}
+
+	current, err := os.ReadFile(path)
+	require.Nil(t, err)
+	assert.Equal(t, "fourth\n", string(current))
+
+	// IE: the first one pruned
+	rotated := backups(t, path)
+	require.Len(t, rotated, 2)
+	oldest, err := os.ReadFile(rotated[0])
+	require.Nil(t, err)
+	assert.Equal(t, "second\n", string(oldest))
+}
+
+func TestRotateByAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deps.log")
+	// IE: as if appended to by a previous run
+	require.Nil(t, os.WriteFile(path, []byte("before\n"), 0o644))
+	require.Nil(t, os.WriteFile(path+".gz", nil, 0o644))
+
+	now := time.Now()
+	f, err := openRotatingFile(path, Rotation{Every: time.Hour, MaxBackups: 1}, func() time.Time { return now })
+	require.Nil(t, err)
+	defer f.Close()
+
+	_, err = f.Write([]byte("same hour\n"))
+	require.Nil(t, err)
+	assert.Equal(t, []string{path + ".gz"}, backups(t, path))
+
+	now = now.Add(time.Hour)
+	_, err = f.Write([]byte("next hour\n"))
+	require.Nil(t, err)
+
+	current, err := os.ReadFile(path)
+	require.Nil(t, err)
+	assert.Equal(t, "next hour\n", string(current))
+	// IE: the .gz isn't one of its backups, it's left alone
+	assert.Equal(t, []string{path + "." + now.Format(backupTimeLayout), path + ".gz"}, backups(t, path))
+}
+
+func TestOpen(t *testing.T) {
+	stdout, err := Open("-", Rotation{}, SeverityInfo)
+	require.Nil(t, err)
+	assert.Nil(t, stdout.Close())
+
+	path := filepath.Join(t.TempDir(), "access.log")
+	file, err := Open(path, Rotation{}, SeverityInfo)
+	require.Nil(t, err)
+	_, err = file.Write([]byte("line\n"))
+	require.Nil(t, err)
+	require.Nil(t, file.Close())
+	assert.FileExists(t, path)
+
+	_, err = Open(filepath.Join(t.TempDir(), "missing", "deps.log"), Rotation{}, SeverityInfo)
+	assert.NotNil(t, err)
+	_, err = Open("", Rotation{}, SeverityInfo)
+	assert.NotNil(t, err)
+}
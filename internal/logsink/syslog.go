@@ -0,0 +1,19 @@
+//go:build !windows && !plan9
+
+package logsink
+
+import (
+	"io"
+	"log/syslog"
+	"os"
+	"path/filepath"
+)
+
+// IE: the lines are tagged with the name of the binary, as syslog(3) does
+func openSyslog(network, address string, severity Severity) (io.WriteCloser, error) {
+	priority := syslog.LOG_DAEMON | syslog.LOG_INFO
+	if severity == SeverityError {
+		priority = syslog.LOG_DAEMON | syslog.LOG_ERR
+	}
+	return syslog.Dial(network, address, priority, filepath.Base(os.Args[0]))
+}
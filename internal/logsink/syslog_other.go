@@ -0,0 +1,12 @@
+//go:build windows || plan9
+
+package logsink
+
+import (
+	"errors"
+	"io"
+)
+
+func openSyslog(network, address string, severity Severity) (io.WriteCloser, error) {
+	return nil, errors.New("syslog isn't available on this platform")
+}
@@ -0,0 +1,33 @@
+//go:build !windows && !plan9
+
+package logsink
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenSyslog(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer conn.Close()
+
+	w, err := Open("syslog://"+conn.LocalAddr().String(), Rotation{}, SeverityError)
+	require.Nil(t, err)
+	defer w.Close()
+	_, err = w.Write([]byte("level=ERROR msg=failed\n"))
+	require.Nil(t, err)
+
+	buf := make([]byte, 1024)
+	require.Nil(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	n, _, err := conn.ReadFrom(buf)
+	require.Nil(t, err)
+	// IE: daemon facility (3) and err severity (3)
+	assert.True(t, strings.HasPrefix(string(buf[:n]), "<27>"), string(buf[:n]))
+	assert.Contains(t, string(buf[:n]), "level=ERROR msg=failed")
+}
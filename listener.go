@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// IE: the first descriptor systemd passes, after stdin, stdout and stderr
+const listenFDsStart = 3
+
+// IE: the variables of the sd_listen_fds protocol, see systemd.socket(5)
+const (
+	envListenPID     = "LISTEN_PID"
+	envListenFDs     = "LISTEN_FDS"
+	envListenFDNames = "LISTEN_FDNAMES"
+)
+
+// IE: -1 when systemd passed nothing, or passed it to another process (LISTEN_PID
+// is inherited by our children too)
+func systemdListenFD(getenv func(string) string, pid int) (int, error) {
+	if getenv(envListenPID) == "" {
+		return -1, nil
+	}
+	listenPID, err := strconv.Atoi(getenv(envListenPID))
+	if err != nil {
+		return -1, fmt.Errorf("%s must be a process id, got %q", envListenPID, getenv(envListenPID))
+	}
+	if listenPID != pid {
+		return -1, nil
+	}
+	n, err := strconv.Atoi(getenv(envListenFDs))
+	if err != nil || n < 1 {
+		return -1, fmt.Errorf("%s must be a positive number of descriptors, got %q", envListenFDs, getenv(envListenFDs))
+	}
+	if n > 1 {
+		return -1, fmt.Errorf("systemd passed %d sockets, expected a single one", n)
+	}
+	return listenFDsStart, nil
+}
+
+// IE: the socket of -fd, then the one of systemd socket activation, otherwise
+// a fresh one on address. Inherited sockets keep the connections queued while
+// the previous process restarts, which is what makes restarts zero-downtime
+func listen(address string, fd int) (net.Listener, error) {
+	if fd < 0 {
+		var err error
+		fd, err = systemdListenFD(os.Getenv, os.Getpid())
+		if err != nil {
+			return nil, err
+		}
+		// IE: like sd_listen_fds(1), our children must not take the socket for theirs
+		os.Unsetenv(envListenPID)
+		os.Unsetenv(envListenFDs)
+		os.Unsetenv(envListenFDNames)
+	}
+	if fd < 0 {
+		return net.Listen("tcp", address)
+	}
+
+	// IE: FileListener dups the descriptor, the original isn't needed after it
+	file := os.NewFile(uintptr(fd), "listener")
+	if file == nil {
+		return nil, fmt.Errorf("invalid listener descriptor %d", fd)
+	}
+	defer file.Close()
+	listener, err := net.FileListener(file)
+	if err != nil {
+		return nil, fmt.Errorf("descriptor %d is not a listening socket: %w", fd, err)
+	}
+	return listener, nil
+}
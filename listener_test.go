@@ -0,0 +1,81 @@
+//go:build unix
+
+package main
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSystemdListenFD(t *testing.T) {
+	env := func(values map[string]string) func(string) string {
+		return func(key string) string { return values[key] }
+	}
+
+	fd, err := systemdListenFD(env(nil), 42)
+	require.Nil(t, err)
+	assert.Equal(t, -1, fd)
+
+	fd, err = systemdListenFD(env(map[string]string{envListenPID: "42", envListenFDs: "1"}), 42)
+	require.Nil(t, err)
+	assert.Equal(t, listenFDsStart, fd)
+
+	// IE: meant for the parent process
+	fd, err = systemdListenFD(env(map[string]string{envListenPID: "41", envListenFDs: "1"}), 42)
+	require.Nil(t, err)
+	assert.Equal(t, -1, fd)
+
+	for _, invalid := range []map[string]string{
+		{envListenPID: "self", envListenFDs: "1"},
+		{envListenPID: "42", envListenFDs: "0"},
+		{envListenPID: "42", envListenFDs: "2"},
+	} {
+		_, err = systemdListenFD(env(invalid), 42)
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+func TestListenInheritsDescriptor(t *testing.T) {
+	parent, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer parent.Close()
+	file, err := parent.(*net.TCPListener).File()
+	require.Nil(t, err)
+	defer file.Close()
+	// IE: listen closes the descriptor it is given, like the inherited one
+	fd, err := syscall.Dup(int(file.Fd()))
+	require.Nil(t, err)
+
+	listener, err := listen("unused:0", fd)
+	require.Nil(t, err)
+	defer listener.Close()
+	assert.Equal(t, parent.Addr().String(), listener.Addr().String())
+
+	go func() {
+		_ = http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+	}()
+	resp, err := http.Get("http://" + listener.Addr().String())
+	require.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
+
+func TestListenRejectsOtherDescriptors(t *testing.T) {
+	file, err := os.CreateTemp(t.TempDir(), "not-a-socket")
+	require.Nil(t, err)
+	defer file.Close()
+
+	fd, err := syscall.Dup(int(file.Fd()))
+	require.Nil(t, err)
+
+	_, err = listen("unused:0", fd)
+	assert.NotNil(t, err)
+}
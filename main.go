@@ -1,27 +1,273 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/snyk/snyk-code-review-exercise/api"
+	"github.com/snyk/snyk-code-review-exercise/internal/config"
+	"github.com/snyk/snyk-code-review-exercise/internal/logsink"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
-func main() {
-	handler := api.New()
+// IE: a registry that slow to answer is as good as unreachable
+const selfCheckTimeout = 10 * time.Second
 
-	// IE: use log for logging instead of fmt for extra features (i.e. timestamp)
-	logger := log.New(os.Stdout, "DEPS API: ", log.Ldate|log.Ltime|log.Lshortfile)
-	logger.Println("Server running on http://localhost:3000/")
+// IE: the service until it's stopped, args are the flags of internal/config
+func serve(name string, args []string) {
+	cfg, err := config.Load(name, args, os.LookupEnv, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// IE: structured, so log pipelines can parse it (-log-format json). The level
+	// is a var, a reload may change it
+	var logLevel slog.LevelVar
+	logLevel.Set(cfg.LogLevel)
+	logOutput, err := logsink.Open(cfg.LogOutput, cfg.LogRotation(), logsink.SeverityInfo)
+	if err != nil {
+		log.Fatalf("Could not open the log output: %v", err)
+	}
+	defer logOutput.Close()
+	var logger *slog.Logger
+	if cfg.ErrorLogOutput == "" {
+		logger, err = api.NewLogger(logOutput, cfg.LogFormat, &logLevel)
+	} else {
+		errorOutput, openErr := logsink.Open(cfg.ErrorLogOutput, cfg.LogRotation(), logsink.SeverityError)
+		if openErr != nil {
+			log.Fatalf("Could not open the error log output: %v", openErr)
+		}
+		defer errorOutput.Close()
+		logger, err = api.NewSplitLogger(logOutput, errorOutput, cfg.LogFormat, &logLevel)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	fatal := func(msg string, err error) {
+		logger.Error(msg, "error", err)
+		os.Exit(1)
+	}
+	if cfg.ConfigFile != "" {
+		logger.Info("Loaded settings", "file", cfg.ConfigFile)
+	}
+
+	tuning, err := applyResourceTuning(cfg.GOMAXPROCS, cfg.GCPercent)
+	if err != nil {
+		fatal("Invalid resource tuning", err)
+	}
+	logger.Info("Running with " + tuning)
+
+	optFns, err := cfg.APIOptions()
+	if err != nil {
+		fatal("Invalid settings", err)
+	}
+	// IE: the same files, environment and flags as on startup, the file is what
+	// changes. Serialized, SIGHUP and /debug/reload may come together
+	var reloadMu sync.Mutex
+	reload := func() error {
+		reloadMu.Lock()
+		defer reloadMu.Unlock()
+
+		next, err := config.Load(name, args, os.LookupEnv, io.Discard)
+		if err != nil {
+			return err
+		}
+		if err := api.Reload(next.ReloadOptions()...); err != nil {
+			return err
+		}
+		logLevel.Set(next.LogLevel)
+		if names := next.RestartRequired(cfg); len(names) > 0 {
+			logger.Warn("Some settings only apply after a restart", "flags", names)
+		}
+		return nil
+	}
+	optFns = append(optFns, api.WithLogger(logger), api.WithReloader(reload))
+	if cfg.AccessLog != "" {
+		accessLog, err := logsink.Open(cfg.AccessLog, cfg.LogRotation(), logsink.SeverityInfo)
+		if err != nil {
+			fatal("Could not open the access log", err)
+		}
+		defer accessLog.Close()
+		optFns = append(optFns, api.WithAccessLog(accessLog, cfg.AccessLogFormat))
+	}
+	var tracerProvider *sdktrace.TracerProvider
+	if cfg.OTLPEndpoint != "" {
+		tracerProvider, err = api.NewOTLPTracerProvider(context.Background(), cfg.OTLPEndpoint, cfg.TraceSampleRatio)
+		if err != nil {
+			fatal("Could not set up trace export", err)
+		}
+		optFns = append(optFns, api.WithTracerProvider(tracerProvider))
+	}
+
+	var certificates *certificateReloader
+	if cfg.TLSCert != "" || cfg.TLSKey != "" {
+		certificates, err = newCertificateReloader(cfg.TLSCert, cfg.TLSKey, logger)
+		if err != nil {
+			fatal("Could not load the TLS certificate", err)
+		}
+	}
+	if cfg.TLSClientCA != "" {
+		auth, err := clientAuthType(cfg.TLSClientAuth)
+		if err == nil && certificates == nil {
+			err = errors.New("tls-client-ca needs -tls-cert and -tls-key")
+		}
+		if err != nil {
+			fatal("Invalid settings", err)
+		}
+		if err := certificates.requireClientCertificates(cfg.TLSClientCA, auth); err != nil {
+			fatal("Could not load the client CAs", err)
+		}
+		optFns = append(optFns, api.WithClientCertificates(auth == tls.VerifyClientCertIfGiven))
+	}
 
-	if err := http.ListenAndServe("localhost:3000", handler); err != nil {
+	// IE: before the api starts its background jobs, a socket that can't be had is fatal anyway
+	listener, err := listen(cfg.ListenAddress(), cfg.ListenFD)
+	if err != nil {
+		fatal("Could not listen", err)
+	}
+
+	handler := api.New(optFns...)
+
+	// IE: a wrong registry or an unreachable cache otherwise only shows as
+	// failing resolutions, once the traffic is switched over
+	switch cfg.SelfCheck {
+	case config.SelfCheckOff:
+	case config.SelfCheckWarn, config.SelfCheckFail:
+		ctx, cancel := context.WithTimeout(context.Background(), selfCheckTimeout)
+		err := api.SelfCheck(ctx)
+		cancel()
+		if err != nil && cfg.SelfCheck == config.SelfCheckFail {
+			fatal("Self-check failed, refusing to start (-self-check warn starts anyway)", err)
+		}
+	default:
+		fatal("Invalid settings", fmt.Errorf("self-check: expected off, warn or fail, got %q", cfg.SelfCheck))
+	}
+
+	// IE: slow clients (or slowloris) must not hold connections forever
+	server := &http.Server{
+		Addr:              cfg.ListenAddress(),
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+	scheme := "http"
+	stopWatching := make(chan struct{})
+	defer close(stopWatching)
+	if certificates != nil {
+		server.TLSConfig = certificates.tlsConfig()
+		scheme = "https"
+		go certificates.watch(cfg.TLSReloadInterval, stopWatching)
+	}
+	var admin *http.Server
+	if cfg.AdminAddress != "" {
+		admin = &http.Server{Addr: cfg.AdminAddress, Handler: api.AdminHandler()}
+		go func() {
+			logger.Info("Admin endpoints on http://" + cfg.AdminAddress + "/debug/")
+			if err := admin.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("Admin server failed", "error", err)
+			}
+		}()
+	}
+
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	go func() {
+		for range hangups {
+			if err := reload(); err != nil {
+				logger.Error("Could not reload settings", "error", err)
+			}
+			// IE: the renewal hook of certbot and the like sends SIGHUP
+			if certificates != nil {
+				certificates.reloadIfChanged()
+			}
+		}
+	}()
+
+	// IE: fail readiness and keep serving for the drain delay (the load balancer
+	// catching up), then stop accepting connections, let the in-flight
+	// resolutions complete (bounded) and exit. The whole of it has to fit in the
+	// termination grace period, the kubelet kills the process past it
+	drained := make(chan struct{})
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		// IE: a second signal means the operator doesn't want to wait
+		go func() {
+			<-signals
+			logger.Warn("Forced shutdown")
+			os.Exit(1)
+		}()
+
+		_ = api.Drain(context.Background())
+		logger.Info("Shutting down, draining in-flight requests", "timeout", cfg.ShutdownTimeout)
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			logger.Error("Could not drain all requests", "error", err)
+		}
+		if admin != nil {
+			_ = admin.Shutdown(ctx)
+		}
+		close(drained)
+	}()
+
+	logger.Info("Server running on " + scheme + "://" + listener.Addr().String() + "/")
+	serve := server.Serve
+	if certificates != nil {
+		// IE: the certificate comes from TLSConfig, not from the files
+		serve = func(l net.Listener) error { return server.ServeTLS(l, "", "") }
+	}
+	if err := serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		// IE: use log for logging instead of fmt for extra features (i.e. timestamp)
-		logger.Fatal(err.Error())
+		fatal("Server failed", err)
 		// or we can do:
 		// panic(err.Error())
 
 		// IE: now we don't need this anymore
 		// os.Exit(1)
 	}
+	<-drained
+
+	// IE: keep the warm caches across deploys, once the drained requests filled them
+	if err := api.FlushMetrics(); err != nil {
+		logger.Error("Could not flush metrics", "error", err)
+	}
+	if err := api.FlushAuditLog(); err != nil {
+		logger.Error("Could not flush the audit log", "error", err)
+	}
+	if !api.FlushErrors(5 * time.Second) {
+		logger.Error("Could not send all error reports")
+	}
+	if err := api.SnapshotCaches(); err != nil {
+		logger.Error("Could not snapshot caches", "error", err)
+	}
+	// IE: the last spans are still batched
+	if tracerProvider != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := tracerProvider.Shutdown(ctx); err != nil {
+			logger.Error("Could not flush traces", "error", err)
+		}
+		cancel()
+	}
+	logger.Info("Server stopped")
 }
@@ -0,0 +1,141 @@
+// Package resolver resolves the dependency graphs of npm packages the way the
+// HTTP service does, for the Go programs embedding it rather than calling it.
+//
+// The resolver keeps its caches and settings for the whole process, like the
+// service: a Resolver is configured once, when created, and the last one
+// created (or api.New) sets them for every other.
+package resolver
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/snyk/snyk-code-review-exercise/api"
+)
+
+// Resolver resolves dependency graphs from the registry its options point at.
+type Resolver struct{}
+
+// New configures the resolver with the options of the service, i.e.
+// api.WithRegistryURL or api.WithMaxDepth. Those about serving HTTP are
+// ignored.
+func New(opts ...api.Option) *Resolver {
+	api.Configure(opts...)
+	return &Resolver{}
+}
+
+// Node is a name@version of a graph, and the ones it depends on by name.
+type Node struct {
+	Name         string
+	Version      string
+	Dependencies map[string]*Node
+}
+
+// Graph is the dependencies of a package, a single node per name@version: the
+// dependencies of a cycle lead back to a node already in the graph.
+type Graph struct {
+	Root *Node
+	// Partial is set when the node budget of the resolver (api.WithMaxNodes)
+	// ran out before every dependency was resolved.
+	Partial bool
+}
+
+// Resolve resolves name at the highest version constraint accepts (a range,
+// an exact version or a dist-tag), from the cache when it holds the tree.
+func (r *Resolver) Resolve(ctx context.Context, name, constraint string) (*Graph, error) {
+	tree, err := api.Resolve(ctx, name, constraint)
+	if err != nil {
+		return nil, err
+	}
+	return newGraph(tree), nil
+}
+
+// IE: a cycle or the depth limit cuts some of the nodes of a name@version in
+// the tree, the one with the most dependencies stands for all of them
+func newGraph(tree *api.NpmPackageVersion) *Graph {
+	expanded := make(map[string]*api.NpmPackageVersion)
+	stack := []*api.NpmPackageVersion{tree}
+	for len(stack) > 0 {
+		pkg := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		key := pkg.Name + "@" + pkg.Version
+		if kept, found := expanded[key]; found && len(kept.Dependencies) >= len(pkg.Dependencies) {
+			continue
+		}
+		expanded[key] = pkg
+		for _, dep := range pkg.Dependencies {
+			if dep != nil {
+				stack = append(stack, dep)
+			}
+		}
+	}
+
+	nodes := make(map[string]*Node, len(expanded))
+	for key, pkg := range expanded {
+		nodes[key] = &Node{Name: pkg.Name, Version: pkg.Version, Dependencies: make(map[string]*Node, len(pkg.Dependencies))}
+	}
+	for key, pkg := range expanded {
+		for name, dep := range pkg.Dependencies {
+			if dep != nil {
+				nodes[key].Dependencies[name] = nodes[dep.Name+"@"+dep.Version]
+			}
+		}
+	}
+	return &Graph{Root: nodes[tree.Name+"@"+tree.Version], Partial: tree.Partial}
+}
+
+// IE: a node as MarshalJSON writes it, its dependencies by name@version
+type jsonNode struct {
+	Name         string            `json:"name"`
+	Version      string            `json:"version"`
+	Dependencies map[string]string `json:"dependencies,omitempty"`
+}
+
+// MarshalJSON writes the graph flat, the cycles have nowhere to nest: the
+// name@version of the root, and every node (Nodes) with the name@version of
+// each of its dependencies.
+func (g *Graph) MarshalJSON() ([]byte, error) {
+	nodes := g.Nodes()
+	flat := make([]jsonNode, 0, len(nodes))
+	for _, node := range nodes {
+		entry := jsonNode{Name: node.Name, Version: node.Version}
+		if len(node.Dependencies) > 0 {
+			entry.Dependencies = make(map[string]string, len(node.Dependencies))
+			for name, dep := range node.Dependencies {
+				entry.Dependencies[name] = dep.Name + "@" + dep.Version
+			}
+		}
+		flat = append(flat, entry)
+	}
+	return json.Marshal(struct {
+		Root    string     `json:"root"`
+		Partial bool       `json:"partial,omitempty"`
+		Nodes   []jsonNode `json:"nodes"`
+	}{g.Root.Name + "@" + g.Root.Version, g.Partial, flat})
+}
+
+// Nodes lists every node of the graph, the root included, by name then version.
+func (g *Graph) Nodes() []*Node {
+	var nodes []*Node
+	visited := map[*Node]bool{g.Root: true}
+	stack := []*Node{g.Root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		nodes = append(nodes, node)
+		for _, dep := range node.Dependencies {
+			if !visited[dep] {
+				visited[dep] = true
+				stack = append(stack, dep)
+			}
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Name != nodes[j].Name {
+			return nodes[i].Name < nodes[j].Name
+		}
+		return nodes[i].Version < nodes[j].Version
+	})
+	return nodes
+}
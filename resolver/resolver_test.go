@@ -0,0 +1,198 @@
+package resolver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/snyk/snyk-code-review-exercise/api"
+	"github.com/snyk/snyk-code-review-exercise/internal/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newResolver(t *testing.T, registry fixtures.Registry, opts ...api.Option) *Resolver {
+	server := httptest.NewServer(registry)
+	t.Cleanup(server.Close)
+	return New(append([]api.Option{api.WithRegistryURL(server.URL), api.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))}, opts...)...)
+}
+
+func TestResolve(t *testing.T) {
+	r := newResolver(t, fixtures.Registry{
+		"app":    {"1.0.0": {"a": "^1.0.0", "b": "^1.0.0"}},
+		"a":      {"1.0.0": {"shared": "^1.0.0"}, "1.2.0": {"shared": "^1.0.0", "b": "^1.0.0"}},
+		"b":      {"1.0.0": {"a": "^1.0.0"}},
+		"shared": {"1.0.0": nil},
+	})
+
+	graph, err := r.Resolve(context.Background(), "app", "^1.0.0")
+	require.Nil(t, err)
+	assert.False(t, graph.Partial)
+	assert.Equal(t, "1.0.0", graph.Root.Version)
+
+	// IE: one node per name@version, the cycle between a and b included
+	a, b := graph.Root.Dependencies["a"], graph.Root.Dependencies["b"]
+	assert.Equal(t, "1.2.0", a.Version)
+	assert.Same(t, a, b.Dependencies["a"])
+	assert.Same(t, b, a.Dependencies["b"])
+
+	var keys []string
+	for _, node := range graph.Nodes() {
+		keys = append(keys, node.Name+"@"+node.Version)
+	}
+	assert.Equal(t, []string{"a@1.2.0", "app@1.0.0", "b@1.0.0", "shared@1.0.0"}, keys)
+
+	encoded, err := json.Marshal(graph)
+	require.Nil(t, err)
+	assert.JSONEq(t, `{"root": "app@1.0.0", "nodes": [
+		{"name": "a", "version": "1.2.0", "dependencies": {"b": "b@1.0.0", "shared": "shared@1.0.0"}},
+		{"name": "app", "version": "1.0.0", "dependencies": {"a": "a@1.2.0", "b": "b@1.0.0"}},
+		{"name": "b", "version": "1.0.0", "dependencies": {"a": "a@1.2.0"}},
+		{"name": "shared", "version": "1.0.0"}
+	]}`, string(encoded))
+}
+
+func TestResolveErrors(t *testing.T) {
+	r := newResolver(t, fixtures.Registry{"app": {"1.0.0": {"missing": "^1.0.0"}}})
+
+	_, err := r.Resolve(context.Background(), "app", "^2.0.0")
+	assert.True(t, errors.Is(err, api.ErrNoCompatibleVersion), err)
+
+	_, err = r.Resolve(context.Background(), "app", "1.0.0")
+	assert.NotNil(t, err)
+}
+
+func TestResolveMaxDepth(t *testing.T) {
+	r := newResolver(t, fixtures.Registry{
+		"app": {"1.0.0": {"a": "^1.0.0"}},
+		"a":   {"1.0.0": {"b": "^1.0.0"}},
+		"b":   {"1.0.0": nil},
+	}, api.WithMaxDepth(1))
+
+	graph, err := r.Resolve(context.Background(), "app", "1.0.0")
+	require.Nil(t, err)
+	assert.Empty(t, graph.Root.Dependencies["a"].Dependencies)
+}
+
+// IE: the documents of a fixtures.Registry without a server in between
+type memoryRegistry fixtures.Registry
+
+func (m memoryRegistry) document(path string) ([]byte, error) {
+	rec := httptest.NewRecorder()
+	fixtures.Registry(m).ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+	if rec.Code != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s", api.ErrPackageNotFound, path)
+	}
+	return rec.Body.Bytes(), nil
+}
+
+func (m memoryRegistry) Packument(_ context.Context, name string) ([]byte, error) {
+	return m.document("/" + name)
+}
+
+func (m memoryRegistry) Version(_ context.Context, name, version string) ([]byte, error) {
+	return m.document("/" + name + "/" + version)
+}
+
+type mapCache struct {
+	mu      sync.Mutex
+	entries map[string][]byte
+}
+
+func (c *mapCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	value, found := c.entries[key]
+	return value, found
+}
+
+func (c *mapCache) Set(key string, value []byte, _ time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = value
+}
+
+func (c *mapCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+func (c *mapCache) Stats() api.CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return api.CacheStats{Backend: "map", Entries: len(c.entries)}
+}
+
+func TestResolveOffline(t *testing.T) {
+	cache := &mapCache{entries: make(map[string][]byte)}
+	r := New(
+		api.WithRegistryURL("http://127.0.0.1:1"),
+		api.WithRegistry(memoryRegistry{
+			"app": {"1.0.0": {"a": "^1.0.0"}},
+			"a":   {"1.0.0": nil, "1.0.1": nil},
+		}),
+		api.WithCache(cache),
+		api.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+
+	graph, err := r.Resolve(context.Background(), "app", "1.0.0")
+	require.Nil(t, err)
+	assert.Equal(t, "1.0.1", graph.Root.Dependencies["a"].Version)
+	assert.NotZero(t, cache.Stats().Entries)
+
+	_, err = r.Resolve(context.Background(), "missing", "1.0.0")
+	assert.True(t, errors.Is(err, api.ErrPackageNotFound), err)
+}
+
+// IE: a memoryRegistry whose packuments carry dist-tags
+type taggedRegistry struct {
+	memoryRegistry
+	tags map[string]map[string]string
+}
+
+func (r taggedRegistry) Packument(ctx context.Context, name string) ([]byte, error) {
+	body, err := r.memoryRegistry.Packument(ctx, name)
+	if err != nil || r.tags[name] == nil {
+		return body, err
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, err
+	}
+	doc["dist-tags"] = r.tags[name]
+	return json.Marshal(doc)
+}
+
+func TestResolveDistTag(t *testing.T) {
+	r := New(
+		api.WithRegistry(taggedRegistry{
+			memoryRegistry: memoryRegistry{
+				"app": {"1.0.0": {"a": "next"}, "2.0.0": nil, "3.0.0-rc.1": nil},
+				"a":   {"1.0.0": nil, "2.0.0-beta.1": nil},
+			},
+			tags: map[string]map[string]string{
+				"app": {"latest": "1.0.0", "next": "3.0.0-rc.1"},
+				"a":   {"latest": "1.0.0", "next": "2.0.0-beta.1"},
+			},
+		}),
+		api.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+
+	// IE: latest points back at 1.0.0, above it is what the range would take
+	graph, err := r.Resolve(context.Background(), "app", "latest")
+	require.Nil(t, err)
+	assert.Equal(t, "1.0.0", graph.Root.Version)
+	assert.Equal(t, "2.0.0-beta.1", graph.Root.Dependencies["a"].Version)
+
+	_, err = r.Resolve(context.Background(), "app", "beta")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/snyk/snyk-code-review-exercise/internal/config"
+)
+
+// IE: the certificate and key of -tls-cert and -tls-key, loaded again once
+// either file changed (i.e. cert-manager or certbot renewed them), checked every
+// -tls-reload-interval and on SIGHUP. Connections already open keep the
+// certificate they were handshaken with. The CAs of -tls-client-ca, when set,
+// are reloaded along
+type certificateReloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+	clientAuth   tls.ClientAuthType
+	logger       *slog.Logger
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  [3]time.Time
+}
+
+func newCertificateReloader(certFile, keyFile string, logger *slog.Logger) (*certificateReloader, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("tls-cert and tls-key go together")
+	}
+	c := &certificateReloader{certFile: certFile, keyFile: keyFile, logger: logger}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// IE: mutual TLS, the clients present a certificate issued by one of the CAs of
+// the PEM bundle at caFile. With tls.VerifyClientCertIfGiven the ones without
+// get through the handshake, for the API to decide (the probes stay open)
+func (c *certificateReloader) requireClientCertificates(caFile string, auth tls.ClientAuthType) error {
+	c.clientCAFile, c.clientAuth = caFile, auth
+	return c.reload()
+}
+
+func (c *certificateReloader) stat() ([3]time.Time, error) {
+	var modTimes [3]time.Time
+	for i, path := range []string{c.certFile, c.keyFile, c.clientCAFile} {
+		if path == "" {
+			continue
+		}
+		// IE: Stat follows the symlinks the Kubernetes secret volumes swap
+		info, err := os.Stat(path)
+		if err != nil {
+			return modTimes, err
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+func (c *certificateReloader) reload() error {
+	modTimes, err := c.stat()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading %s and %s: %w", c.certFile, c.keyFile, err)
+	}
+	var clientCAs *x509.CertPool
+	if c.clientCAFile != "" {
+		data, err := os.ReadFile(c.clientCAFile)
+		if err != nil {
+			return err
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no PEM certificate in %s", c.clientCAFile)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cert, c.clientCAs, c.modTimes = &cert, clientCAs, modTimes
+	return nil
+}
+
+// IE: a failed reload keeps the previous certificate, the files may be caught
+// halfway through a renewal (the new certificate next to the old key), the
+// next check picks up the pair once both are written
+func (c *certificateReloader) reloadIfChanged() {
+	modTimes, err := c.stat()
+	c.mu.RLock()
+	changed := modTimes != c.modTimes
+	c.mu.RUnlock()
+	if err == nil && !changed {
+		return
+	}
+	if err == nil {
+		err = c.reload()
+	}
+	if err != nil {
+		c.logger.Error("Could not reload the TLS certificate, serving the previous one", "cert", c.certFile, "error", err)
+		return
+	}
+	c.logger.Info("Reloaded the TLS certificate", "cert", c.certFile, "expires", c.expiry())
+}
+
+// IE: 0 only reloads on SIGHUP
+func (c *certificateReloader) watch(interval time.Duration, done <-chan struct{}) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.reloadIfChanged()
+		case <-done:
+			return
+		}
+	}
+}
+
+func (c *certificateReloader) expiry() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.cert.Leaf == nil {
+		return time.Time{}
+	}
+	return c.cert.Leaf.NotAfter
+}
+
+func (c *certificateReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+func clientAuthType(value string) (tls.ClientAuthType, error) {
+	switch value {
+	case config.ClientAuthRequire:
+		return tls.RequireAndVerifyClientCert, nil
+	case config.ClientAuthVerify:
+		return tls.VerifyClientCertIfGiven, nil
+	}
+	return tls.NoClientCert, fmt.Errorf("tls-client-auth: expected require or verify, got %q", value)
+}
+
+// IE: TLS 1.2 at least, the Go defaults otherwise; ServeTLS adds h2 to it. The
+// config of each handshake is made from the CAs loaded last
+func (c *certificateReloader) tlsConfig() *tls.Config {
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: c.getCertificate,
+	}
+	if c.clientCAFile != "" {
+		config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			c.mu.RLock()
+			defer c.mu.RUnlock()
+			return &tls.Config{
+				MinVersion:     tls.VersionTLS12,
+				GetCertificate: c.getCertificate,
+				ClientAuth:     c.clientAuth,
+				ClientCAs:      c.clientCAs,
+				NextProtos:     []string{"h2", "http/1.1"},
+			}, nil
+		}
+	}
+	return config
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/snyk/snyk-code-review-exercise/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// IE: a self-signed localhost certificate and its key, PEM encoded
+func selfSigned(t *testing.T, serial int64) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.Nil(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.Nil(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+}
+
+// IE: the modification times pushed forward, the filesystem may not tell
+// writes of the same second apart
+func writePair(t *testing.T, dir string, certPEM, keyPEM []byte, modTime time.Time) (string, string) {
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	for path, data := range map[string][]byte{certFile: certPEM, keyFile: keyPEM} {
+		require.Nil(t, os.WriteFile(path, data, 0o600))
+		require.Nil(t, os.Chtimes(path, modTime, modTime))
+	}
+	return certFile, keyFile
+}
+
+func servedSerial(t *testing.T, c *certificateReloader) int64 {
+	cert, err := c.getCertificate(nil)
+	require.Nil(t, err)
+	return cert.Leaf.SerialNumber.Int64()
+}
+
+func TestCertificateReloader(t *testing.T) {
+	dir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	certPEM, keyPEM := selfSigned(t, 1)
+	certFile, keyFile := writePair(t, dir, certPEM, keyPEM, time.Now().Add(-time.Hour))
+
+	certificates, err := newCertificateReloader(certFile, keyFile, logger)
+	require.Nil(t, err)
+	assert.Equal(t, int64(1), servedSerial(t, certificates))
+
+	// IE: unchanged files aren't loaded again
+	certificates.reloadIfChanged()
+	assert.Equal(t, int64(1), servedSerial(t, certificates))
+
+	renewedCert, renewedKey := selfSigned(t, 2)
+	// IE: halfway through the renewal, the new certificate next to the old key
+	writePair(t, dir, renewedCert, keyPEM, time.Now().Add(-time.Minute))
+	certificates.reloadIfChanged()
+	assert.Equal(t, int64(1), servedSerial(t, certificates))
+
+	writePair(t, dir, renewedCert, renewedKey, time.Now())
+	certificates.reloadIfChanged()
+	assert.Equal(t, int64(2), servedSerial(t, certificates))
+
+	_, err = newCertificateReloader(certFile, "", logger)
+	assert.NotNil(t, err)
+	_, err = newCertificateReloader(certFile, filepath.Join(dir, "missing.key"), logger)
+	assert.NotNil(t, err)
+}
+
+func TestServeTLS(t *testing.T) {
+	certPEM, keyPEM := selfSigned(t, 7)
+	certFile, keyFile := writePair(t, t.TempDir(), certPEM, keyPEM, time.Now())
+	certificates, err := newCertificateReloader(certFile, keyFile, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.Nil(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	server := &http.Server{
+		Handler:   http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }),
+		TLSConfig: certificates.tlsConfig(),
+		ErrorLog:  log.New(io.Discard, "", 0),
+	}
+	go func() { _ = server.ServeTLS(listener, "", "") }()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(certPEM))
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}, ForceAttemptHTTP2: true}}
+	resp, err := client.Get("https://" + listener.Addr().String())
+	require.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, "HTTP/2.0", resp.Proto)
+	assert.Equal(t, int64(7), resp.TLS.PeerCertificates[0].SerialNumber.Int64())
+
+	// IE: no TLS 1.1 clients
+	_, err = tls.Dial("tcp", listener.Addr().String(), &tls.Config{RootCAs: roots, MaxVersion: tls.VersionTLS11})
+	assert.NotNil(t, err)
+}
+
+// IE: a CA and a client certificate it issued to commonName, PEM encoded
+func clientCertificate(t *testing.T, commonName string) (caPEM []byte, cert tls.Certificate) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(100),
+		Subject:               pkix.Name{CommonName: "build infrastructure"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	require.Nil(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(101),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	require.Nil(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	certPEM, keyPEM := selfSigned(t, 7)
+	certFile, keyFile := writePair(t, dir, certPEM, keyPEM, time.Now())
+	caPEM, clientCert := clientCertificate(t, "ci")
+	caFile := filepath.Join(dir, "clients.crt")
+	require.Nil(t, os.WriteFile(caFile, caPEM, 0o600))
+	_, strangerCert := clientCertificate(t, "stranger")
+
+	certificates, err := newCertificateReloader(certFile, keyFile, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.Nil(t, err)
+	auth, err := clientAuthType(config.ClientAuthRequire)
+	require.Nil(t, err)
+	require.Nil(t, certificates.requireClientCertificates(caFile, auth))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, r.TLS.VerifiedChains[0][0].Subject.CommonName)
+		}),
+		TLSConfig: certificates.tlsConfig(),
+		ErrorLog:  log.New(io.Discard, "", 0),
+	}
+	go func() { _ = server.ServeTLS(listener, "", "") }()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(certPEM))
+	get := func(certs ...tls.Certificate) (string, error) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs}, ForceAttemptHTTP2: true}}
+		resp, err := client.Get("https://" + listener.Addr().String())
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	body, err := get(clientCert)
+	require.Nil(t, err)
+	assert.Equal(t, "ci", body)
+	_, err = get()
+	assert.NotNil(t, err)
+	// IE: issued by another CA
+	_, err = get(strangerCert)
+	assert.NotNil(t, err)
+
+	_, err = clientAuthType("optional")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// IE: either a number of threads or a fraction of the CPUs (i.e. "0.75"), empty
+// keeps the runtime default (GOMAXPROCS env, cgroup limit or all CPUs)
+func parseGOMAXPROCS(value string, cpus int) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	if n, err := strconv.Atoi(value); err == nil && n > 0 {
+		return n, nil
+	}
+	fraction, err := strconv.ParseFloat(value, 64)
+	if err != nil || fraction <= 0 || fraction > 1 {
+		return 0, fmt.Errorf("gomaxprocs must be a positive number of threads or a fraction of the CPUs, got %q", value)
+	}
+	n := int(float64(cpus) * fraction)
+	if n < 1 {
+		n = 1
+	}
+	return n, nil
+}
+
+// IE: a gcPercent of 0 keeps the runtime default (GOGC env or 100), -1 turns the GC off
+func applyResourceTuning(gomaxprocs string, gcPercent int) (string, error) {
+	procs, err := parseGOMAXPROCS(gomaxprocs, runtime.NumCPU())
+	if err != nil {
+		return "", err
+	}
+	if procs > 0 {
+		runtime.GOMAXPROCS(procs)
+	}
+	if gcPercent != 0 {
+		debug.SetGCPercent(gcPercent)
+	}
+	return fmt.Sprintf("GOMAXPROCS=%d of %d CPUs", runtime.GOMAXPROCS(0), runtime.NumCPU()), nil
+}
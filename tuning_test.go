@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGOMAXPROCS(t *testing.T) {
+	n, err := parseGOMAXPROCS("", 8)
+	require.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = parseGOMAXPROCS("3", 8)
+	require.Nil(t, err)
+	assert.Equal(t, 3, n)
+
+	n, err = parseGOMAXPROCS("0.75", 8)
+	require.Nil(t, err)
+	assert.Equal(t, 6, n)
+
+	// IE: never below one thread
+	n, err = parseGOMAXPROCS("0.1", 2)
+	require.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	for _, invalid := range []string{"-1", "1.5", "all"} {
+		_, err = parseGOMAXPROCS(invalid, 8)
+		assert.NotNil(t, err, invalid)
+	}
+}